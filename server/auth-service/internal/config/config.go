@@ -10,12 +10,150 @@ import (
 )
 
 type Config struct {
-	Env            string     `yaml:"env" env-default:"local"`
-	ClientDomen    string     `yaml:"client_domen"`
-	Server         HTTPServer `yaml:"http_server"`
+	Env           string       `yaml:"env" env-default:"local"`
+	ClientDomen   string       `yaml:"client_domen"`
+	Server        HTTPServer   `yaml:"http_server"`
+	Mailer        Mailer       `yaml:"mailer"`
+	PasswordReset Reset        `yaml:"password_reset"`
+	Verification  Verification `yaml:"email_verification"`
+	TwoFactor     TwoFactor    `yaml:"two_factor"`
+	JWT           JWT          `yaml:"jwt"`
+	Lockout       Lockout      `yaml:"lockout"`
+	Admin         Admin        `yaml:"admin"`
+	OIDC          OIDC         `yaml:"oidc"`
+	Deletion      Deletion     `yaml:"account_deletion"`
+	Export        Export       `yaml:"data_export"`
+	Gateway       Gateway      `yaml:"gateway"`
 	// PostgreStorage PostgresDB `yaml:"psql"`
 }
 
+type Mailer struct {
+	Driver   string `yaml:"driver" env-default:"file"`
+	From     string `yaml:"from" env-default:"no-reply@cchat.local"`
+	Dir      string `yaml:"dir"`
+	Host     string `yaml:"host"`
+	Port     string `yaml:"port" env-default:"587"`
+	Username string `yaml:"username"`
+	Password string `env:"SMTP_PASSWORD"`
+}
+
+type Reset struct {
+	TokenTTL time.Duration `yaml:"token_ttl" env-default:"1h"`
+	URL      string        `yaml:"url" env-default:"http://localhost:5173/reset-password"`
+}
+
+type Verification struct {
+	TokenTTL         time.Duration `yaml:"token_ttl" env-default:"24h"`
+	URL              string        `yaml:"url" env-default:"http://localhost:5173/verify-email"`
+	RequiredForLogin bool          `yaml:"required_for_login" env-default:"false"`
+}
+
+type TwoFactor struct {
+	Issuer        string        `yaml:"issuer" env-default:"Cchat"`
+	ChallengeTTL  time.Duration `yaml:"challenge_ttl" env-default:"5m"`
+	MaxAttempts   int           `yaml:"max_attempts" env-default:"5"`
+	RecoveryCodes int           `yaml:"recovery_codes" env-default:"10"`
+}
+
+// JWT lists the signing keys. The active key signs new tokens, the rest
+// stay published in the JWKS until the tokens signed with them expire.
+// Without keys an ephemeral one is generated, which only suits local runs.
+type JWT struct {
+	ActiveKey string       `yaml:"active_key" env:"JWT_ACTIVE_KEY"`
+	Keys      []SigningKey `yaml:"keys"`
+}
+
+type SigningKey struct {
+	ID   string `yaml:"id"`
+	Path string `yaml:"path"`
+}
+
+// Gateway lists the networks the nginx gateway reaches the service from.
+// The client address is only taken from forwarded headers sent from there.
+type Gateway struct {
+	TrustedNetworks []string `yaml:"trusted_networks" env:"GATEWAY_TRUSTED_NETWORKS" env-default:"127.0.0.1/32,::1/128"`
+}
+
+// Lockout throttles failed logins per account and per IP. From BackoffAfter
+// failures on, every failure blocks the key for a doubling delay, reaching
+// the limit locks it for Duration. A locked account gets an unlock link.
+// The memory store only suits a single instance, replicas need postgres.
+type Lockout struct {
+	Store          string        `yaml:"store" env-default:"postgres"`
+	Window         time.Duration `yaml:"window" env-default:"1h"`
+	BackoffAfter   int           `yaml:"backoff_after" env-default:"3"`
+	BaseDelay      time.Duration `yaml:"base_delay" env-default:"1s"`
+	MaxDelay       time.Duration `yaml:"max_delay" env-default:"1m"`
+	AccountLimit   int           `yaml:"account_limit" env-default:"10"`
+	IPLimit        int           `yaml:"ip_limit" env-default:"50"`
+	Duration       time.Duration `yaml:"duration" env-default:"30m"`
+	UnlockTokenTTL time.Duration `yaml:"unlock_token_ttl" env-default:"1h"`
+	UnlockURL      string        `yaml:"unlock_url" env-default:"http://localhost:5173/unlock-account"`
+}
+
+// Admin lists the users given the admin role on startup. Further roles
+// are handed out by them through the admin API.
+type Admin struct {
+	UserIDs []string `yaml:"user_ids" env:"ADMIN_USER_IDS"`
+}
+
+// OIDC lists the external providers users can sign in with. After the
+// callback the browser is sent to SuccessURL, to TwoFactorURL with a
+// challenge when a second factor is needed, or to ErrorURL with an error.
+type OIDC struct {
+	StateTTL     time.Duration  `yaml:"state_ttl" env-default:"10m"`
+	SuccessURL   string         `yaml:"success_url" env-default:"http://localhost:5173/"`
+	TwoFactorURL string         `yaml:"two_factor_url" env-default:"http://localhost:5173/login/2fa"`
+	ErrorURL     string         `yaml:"error_url" env-default:"http://localhost:5173/login"`
+	Providers    []OIDCProvider `yaml:"providers"`
+}
+
+// OIDCProvider is one provider. The client secret is read from the
+// environment variable named by ClientSecretEnv, not from the file.
+type OIDCProvider struct {
+	Name            string   `yaml:"name"`
+	Issuer          string   `yaml:"issuer"`
+	ClientID        string   `yaml:"client_id"`
+	ClientSecretEnv string   `yaml:"client_secret_env"`
+	RedirectURL     string   `yaml:"redirect_url"`
+	Scopes          []string `yaml:"scopes"`
+}
+
+// Deletion keeps a deleted account restorable through the mailed link for
+// GracePeriod. After that a worker polling every PollInterval erases the
+// user from every service. A failed run is retried after RetryInterval,
+// doubling up to MaxRetryInterval, and picks up where it stopped.
+// Accounts without a password confirm the deletion through a link under
+// ConfirmURL that is valid for ConfirmTTL.
+type Deletion struct {
+	GracePeriod      time.Duration `yaml:"grace_period" env-default:"720h"`
+	RestoreURL       string        `yaml:"restore_url" env-default:"http://localhost:5173/restore-account"`
+	ConfirmURL       string        `yaml:"confirm_url" env-default:"http://localhost:5173/confirm-account-deletion"`
+	ConfirmTTL       time.Duration `yaml:"confirm_ttl" env-default:"1h"`
+	PollInterval     time.Duration `yaml:"poll_interval" env-default:"1m"`
+	BatchSize        int           `yaml:"batch_size" env-default:"10"`
+	RetryInterval    time.Duration `yaml:"retry_interval" env-default:"1m"`
+	MaxRetryInterval time.Duration `yaml:"max_retry_interval" env-default:"6h"`
+}
+
+// Export collects what every service keeps about a user into a ZIP in
+// Dir. A worker polling every PollInterval builds the archives, a failed
+// run is retried after RetryInterval, doubling, until MaxAttempts. The
+// archive is kept for TTL and downloaded through a link under DownloadURL
+// signed with SigningKey that is valid for LinkTTL. Without a key an
+// ephemeral one is generated, which only suits local runs.
+type Export struct {
+	Dir           string        `yaml:"dir" env-default:"./data/exports"`
+	PollInterval  time.Duration `yaml:"poll_interval" env-default:"30s"`
+	BatchSize     int           `yaml:"batch_size" env-default:"5"`
+	RetryInterval time.Duration `yaml:"retry_interval" env-default:"1m"`
+	MaxAttempts   int           `yaml:"max_attempts" env-default:"5"`
+	TTL           time.Duration `yaml:"ttl" env-default:"168h"`
+	LinkTTL       time.Duration `yaml:"link_ttl" env-default:"1h"`
+	DownloadURL   string        `yaml:"download_url" env-default:"http://localhost:8040/services/auth/auth/exports"`
+	SigningKey    string        `env:"EXPORT_SIGNING_KEY"`
+}
+
 type HTTPServer struct {
 	Port         string        `yaml:"server_port" env-default:"localhost:8040"`
 	Timeout      time.Duration `yaml:"timeout" env-default:"4s"`
@@ -0,0 +1,15 @@
+package models
+
+import "github.com/google/uuid"
+
+// Account is the state of the credentials that is carried in the access token.
+type Account struct {
+	UserID           uuid.UUID
+	EmailVerified    bool
+	TwoFactorEnabled bool
+	// Deactivated accounts are scheduled for deletion and can not log in.
+	Deactivated bool
+	Role        string
+	// Suspended accounts are blocked by an admin until they are unsuspended.
+	Suspended bool
+}
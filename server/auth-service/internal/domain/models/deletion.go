@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Statuses of an account deletion.
+const (
+	DeletionPending   = "pending"
+	DeletionCancelled = "cancelled"
+	DeletionCompleted = "completed"
+)
+
+// DeleteAccount carries the current password. Accounts without one leave
+// it empty and confirm through the mailed link, see ConfirmDeletion.
+type DeleteAccount struct {
+	Password string `json:"password" example:"12345678"`
+}
+
+type ConfirmDeletion struct {
+	Token string `json:"token" validate:"required" example:"Zm9vYmFy"`
+}
+
+type RestoreAccount struct {
+	Token string `json:"token" validate:"required" example:"Zm9vYmFy"`
+}
+
+type DeletionScheduled struct {
+	ScheduledFor time.Time `json:"scheduled_for"`
+}
+
+// AccountDeletion is a deletion that is due. CompletedSteps are the
+// services the user is already erased from.
+type AccountDeletion struct {
+	UserID         uuid.UUID
+	ScheduledFor   time.Time
+	CompletedSteps []string
+	Attempts       int
+}
@@ -0,0 +1,75 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Types of the events in the authentication audit log.
+const (
+	EventRegister               = "register"
+	EventLoginSucceeded         = "login_succeeded"
+	EventLoginFailed            = "login_failed"
+	EventLogout                 = "logout"
+	EventPasswordChanged        = "password_changed"
+	EventPasswordResetRequested = "password_reset_requested"
+	EventPasswordReset          = "password_reset"
+	EventSessionRevoked         = "session_revoked"
+	EventTwoFactorEnabled       = "two_factor_enabled"
+	EventTwoFactorDisabled      = "two_factor_disabled"
+	EventAccountLocked          = "account_locked"
+	EventAccountUnlocked        = "account_unlocked"
+	EventAccessTokenCreated     = "access_token_created"
+	EventAccessTokenRevoked     = "access_token_revoked"
+	EventIdentityLinked         = "identity_linked"
+	EventDeletionRequested      = "account_deletion_requested"
+	EventDeletionCancelled      = "account_deletion_cancelled"
+	EventAccountDeleted         = "account_deleted"
+	EventAccountSuspended       = "account_suspended"
+	EventAccountUnsuspended     = "account_unsuspended"
+	EventForcedLogout           = "forced_logout"
+	EventRoleChanged            = "role_changed"
+	EventExportRequested        = "data_export_requested"
+	EventExportDownloaded       = "data_export_downloaded"
+)
+
+type AuthEvent struct {
+	ID        int64             `json:"id"`
+	UserID    uuid.NullUUID     `json:"user_id" swaggertype:"string"`
+	Type      string            `json:"type"`
+	IP        string            `json:"ip"`
+	UserAgent string            `json:"user_agent"`
+	RequestID string            `json:"request_id"`
+	Details   map[string]string `json:"details,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+}
+
+// NewAuthEvent describes something that happened to the user during
+// the request. userID is uuid.Nil when the user is unknown.
+func NewAuthEvent(eventType string, userID uuid.UUID, meta RequestMeta) AuthEvent {
+	return AuthEvent{
+		UserID:    uuid.NullUUID{UUID: userID, Valid: userID != uuid.Nil},
+		Type:      eventType,
+		IP:        meta.IP,
+		UserAgent: meta.UserAgent,
+		RequestID: meta.RequestID,
+	}
+}
+
+// EventFilter narrows down the audit log, zero fields do not filter.
+// Events are returned newest first, Cursor is the id to continue below.
+type EventFilter struct {
+	UserID uuid.NullUUID
+	Types  []string
+	IP     string
+	From   time.Time
+	To     time.Time
+	Cursor int64
+	Limit  int
+}
+
+type EventPage struct {
+	Events     []AuthEvent `json:"events"`
+	NextCursor int64       `json:"next_cursor"`
+}
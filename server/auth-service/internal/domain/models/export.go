@@ -0,0 +1,61 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Statuses of a data export.
+const (
+	ExportPending = "pending"
+	ExportReady   = "ready"
+	ExportFailed  = "failed"
+	ExportExpired = "expired"
+)
+
+// DataExport is a request to collect everything kept about a user.
+type DataExport struct {
+	ID          uuid.UUID
+	UserID      uuid.UUID
+	Status      string
+	RequestedAt time.Time
+	Attempts    int
+	FinishedAt  *time.Time
+	ExpiresAt   *time.Time
+}
+
+// ExportJob is a data export as the user sees it. DownloadURL is only set
+// once the archive is ready and stops working after LinkExpiresAt.
+type ExportJob struct {
+	ID            uuid.UUID  `json:"id"`
+	Status        string     `json:"status" example:"pending"`
+	RequestedAt   time.Time  `json:"requested_at"`
+	FinishedAt    *time.Time `json:"finished_at,omitempty"`
+	ExpiresAt     *time.Time `json:"expires_at,omitempty"`
+	DownloadURL   string     `json:"download_url,omitempty"`
+	LinkExpiresAt *time.Time `json:"link_expires_at,omitempty"`
+}
+
+// AccountExport is what auth-service keeps about the user, secrets and
+// hashes left out.
+type AccountExport struct {
+	UserID             uuid.UUID              `json:"user_id"`
+	Role               string                 `json:"role"`
+	CreatedAt          time.Time              `json:"created_at"`
+	UpdatedAt          time.Time              `json:"updated_at"`
+	EmailVerifiedAt    *time.Time             `json:"email_verified_at"`
+	TwoFactorEnabledAt *time.Time             `json:"two_factor_enabled_at"`
+	SuspendedAt        *time.Time             `json:"suspended_at"`
+	Sessions           []Session              `json:"sessions"`
+	AccessTokens       []AccessToken          `json:"access_tokens"`
+	IdentityLinks      []ExportedIdentityLink `json:"identity_links"`
+	Events             []AuthEvent            `json:"events"`
+}
+
+type ExportedIdentityLink struct {
+	Provider    string    `json:"provider"`
+	Email       string    `json:"email"`
+	CreatedAt   time.Time `json:"created_at"`
+	LastLoginAt time.Time `json:"last_login_at"`
+}
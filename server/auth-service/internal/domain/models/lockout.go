@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// LoginAttempts is the failed login counter of one key, an account or an IP.
+type LoginAttempts struct {
+	Key          string
+	Failures     int
+	LastFailedAt time.Time
+	BlockedUntil time.Time
+}
+
+// Lockout is the audit record written every time a key gets locked.
+type Lockout struct {
+	Key         string
+	UserID      uuid.NullUUID
+	IP          string
+	Failures    int
+	LockedUntil time.Time
+}
+
+type UnlockAccount struct {
+	Token string `json:"token" validate:"required"`
+}
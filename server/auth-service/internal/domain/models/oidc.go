@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// OIDCState is kept between sending the user to the provider and the
+// callback. It is looked up by the hash of the state parameter.
+type OIDCState struct {
+	Provider  string
+	Verifier  string
+	Nonce     string
+	ExpiresAt time.Time
+}
+
+// IdentityLink ties the subject of an external provider to a user.
+// Email is the email of the account, the user is looked up by it.
+type IdentityLink struct {
+	Provider string
+	Subject  string
+	UserID   uuid.UUID
+	Email    string
+}
+
+type OIDCProviders struct {
+	Providers []string `json:"providers"`
+}
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Roles a user can have, every account starts as RoleUser.
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+// RoleRank orders the roles, a higher role can manage the lower ones.
+// Unknown roles rank below RoleUser.
+func RoleRank(role string) int {
+	switch role {
+	case RoleUser:
+		return 1
+	case RoleModerator:
+		return 2
+	case RoleAdmin:
+		return 3
+	default:
+		return 0
+	}
+}
+
+type SuspendAccount struct {
+	Reason string `json:"reason" validate:"required,max=500" example:"spam"`
+}
+
+type ChangeRole struct {
+	Role string `json:"role" validate:"required,oneof=user moderator admin" example:"moderator"`
+}
+
+// AccountStatus is what admins see about the credentials of a user.
+type AccountStatus struct {
+	UserID           uuid.UUID  `json:"user_id"`
+	Role             string     `json:"role"`
+	EmailVerified    bool       `json:"email_verified"`
+	TwoFactorEnabled bool       `json:"two_factor_enabled"`
+	Deactivated      bool       `json:"deactivated"`
+	SuspendedAt      *time.Time `json:"suspended_at,omitempty"`
+	SuspendedReason  string     `json:"suspended_reason,omitempty"`
+}
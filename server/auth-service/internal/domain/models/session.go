@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Session struct {
+	ID         uuid.UUID  `json:"id"`
+	UserID     uuid.UUID  `json:"user_id"`
+	UserAgent  string     `json:"user_agent"`
+	IP         string     `json:"ip"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt time.Time  `json:"last_used_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// ConsumedToken is a refresh token presented again after it was rotated,
+// with the successor it was rotated into.
+type ConsumedToken struct {
+	UsedAt        time.Time
+	SuccessorID   uuid.UUID
+	SuccessorUsed bool
+}
+
+type RequestMeta struct {
+	IP        string
+	UserAgent string
+	RequestID string
+}
+
+type SessionInfo struct {
+	ID           uuid.UUID `json:"id"`
+	Device       string    `json:"device"`
+	IP           string    `json:"ip"`
+	CreatedAt    time.Time `json:"created_at"`
+	LastActivity time.Time `json:"last_activity"`
+	Current      bool      `json:"current"`
+}
@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Scopes a personal access token can be limited to. A token without
+// scopes has the same access to chats and messages as the session of its
+// owner. Profiles, contacts and blocks in user-service, and the account
+// itself, take a session.
+const (
+	ScopeChatsRead     = "chats:read"
+	ScopeChatsWrite    = "chats:write"
+	ScopeMessagesRead  = "messages:read"
+	ScopeMessagesWrite = "messages:write"
+)
+
+type AccessToken struct {
+	ID         uuid.UUID  `json:"id"`
+	UserID     uuid.UUID  `json:"-"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+}
+
+type CreateAccessToken struct {
+	Name      string     `json:"name" validate:"required,max=100" example:"deploy bot"`
+	Scopes    []string   `json:"scopes,omitempty" validate:"omitempty,unique,dive,oneof=chats:read chats:write messages:read messages:write" example:"chats:read"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty" validate:"omitempty" example:"2027-01-01T00:00:00Z"`
+}
+
+// NewAccessToken is the only time the plain token is shown.
+type NewAccessToken struct {
+	Token string `json:"token"`
+	AccessToken
+}
@@ -0,0 +1,58 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type TwoFactor struct {
+	UserID    uuid.UUID
+	Secret    string
+	LastStep  int64
+	EnabledAt *time.Time
+}
+
+type TwoFactorEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+type TwoFactorCode struct {
+	Code string `json:"code" validate:"required" example:"123456"`
+}
+
+type DisableTwoFactor struct {
+	Password string `json:"password" validate:"required" example:"12345678"`
+	Code     string `json:"code" validate:"required" example:"123456"`
+}
+
+type RecoveryCodes struct {
+	Codes []string `json:"recovery_codes"`
+}
+
+type LoginChallenge struct {
+	UserID    uuid.UUID
+	Email     string
+	ExpiresAt time.Time
+}
+
+type TwoFactorChallenge struct {
+	TwoFactorRequired bool      `json:"two_factor_required"`
+	Challenge         string    `json:"challenge"`
+	ExpiresAt         time.Time `json:"expires_at"`
+}
+
+type TwoFactorLogin struct {
+	Challenge string `json:"challenge" validate:"required" example:"Zm9vYmFy"`
+	Code      string `json:"code" validate:"required" example:"123456"`
+}
+
+// LoginResult is either a started session or a challenge
+// that has to be completed with a second factor.
+type LoginResult struct {
+	User         *NormalizedUser
+	AccessToken  string
+	RefreshToken string
+	Challenge    *TwoFactorChallenge
+}
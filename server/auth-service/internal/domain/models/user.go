@@ -36,10 +36,28 @@ type ResetPassword struct {
 	Email string `json:"email" validate:"required,email" example:"example@mail.com"`
 }
 
+type ConfirmPasswordReset struct {
+	Token       string `json:"token" validate:"required" example:"Zm9vYmFy"`
+	NewPassword string `json:"new_password" validate:"required,gte=8" example:"123456789"`
+}
+
+type VerifyEmail struct {
+	Token string `json:"token" validate:"required" example:"Zm9vYmFy"`
+}
+
+type ResendVerification struct {
+	Email string `json:"email" validate:"required,email" example:"example@mail.com"`
+}
+
 type NormalizedUser struct {
-	UUID     uuid.UUID `json:"uuid"`
-	Username string    `json:"username"`
-	Email    string    `json:"email"`
+	UUID          uuid.UUID `json:"uuid"`
+	Username      string    `json:"username"`
+	Email         string    `json:"email"`
+	EmailVerified bool      `json:"email_verified"`
+	Role          string    `json:"role"`
+	SessionID     uuid.UUID `json:"-"`
+	// Scopes limit a personal access token, empty means no limit.
+	Scopes []string `json:"-"`
 }
 
 func UserToNormalized(user *User) NormalizedUser {
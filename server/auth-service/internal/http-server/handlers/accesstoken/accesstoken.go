@@ -0,0 +1,223 @@
+package accesstoken
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"github.com/go-chi/render"
+	"github.com/google/uuid"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/domain/models"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/http-server/handlers"
+	resp "github.com/sergey-frey/cchat/server/auth-service/internal/lib/api/response"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/lib/cookie"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/lib/jwt"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/lib/logger/sl"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/lib/requestmeta"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/services/accesstoken"
+)
+
+type AccessToken interface {
+	Create(ctx context.Context, userID uuid.UUID, create models.CreateAccessToken, meta models.RequestMeta) (token *models.NewAccessToken, err error)
+	List(ctx context.Context, userID uuid.UUID) (tokens []models.AccessToken, err error)
+	Revoke(ctx context.Context, userID uuid.UUID, tokenID uuid.UUID, meta models.RequestMeta) (err error)
+}
+
+type AccessTokenHandler struct {
+	tokens   AccessToken
+	sessions jwt.SessionStore
+	log      *slog.Logger
+}
+
+func New(tokens AccessToken, sessions jwt.SessionStore, log *slog.Logger) *AccessTokenHandler {
+	return &AccessTokenHandler{
+		tokens:   tokens,
+		sessions: sessions,
+		log:      log,
+	}
+}
+
+// @Summary CreateAccessToken
+// @Tags auth
+// @Description Creates a personal access token for scripts and bots. The token is sent as "Authorization: Bearer" and is only returned in this response
+// @Description The token works for the chats and messages services, user-service refuses it with 403
+// @ID create-access-token
+// @Accept  json
+// @Produce  json
+// @Param input body models.CreateAccessToken true "token name, optional scopes and expiry"
+// @Success 201 {object} response.SuccessResponse{data=models.NewAccessToken}
+// @Failure 400,401 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Failure default {object} response.ErrorResponse
+// @Security CookieAuth
+// @Router /auth/tokens [post]
+func (a *AccessTokenHandler) Create(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.accesstoken.Create"
+
+		log := a.log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		userInfo, err := cookie.TakeUserInfo(ctx, w, r, a.sessions)
+		if flag := handlers.HandleGettingCookie(w, r, err, log); !flag {
+			return
+		}
+
+		var req models.CreateAccessToken
+
+		err = render.Decode(r, &req)
+
+		if flag := handlers.HandleError(w, r, req, err, log); !flag {
+			return
+		}
+
+		token, err := a.tokens.Create(ctx, userInfo.UUID, req, requestmeta.FromRequest(r))
+		if err != nil {
+			if errors.Is(err, accesstoken.ErrInvalidExpiry) {
+				render.Status(r, http.StatusBadRequest)
+
+				render.JSON(w, r, resp.ErrorResponse{
+					Status: http.StatusBadRequest,
+					Error:  "expiry must be in the future",
+				})
+
+				return
+			}
+
+			render.Status(r, http.StatusInternalServerError)
+
+			render.JSON(w, r, resp.ErrorResponse{
+				Status: http.StatusInternalServerError,
+				Error:  "failed to create token",
+			})
+
+			return
+		}
+
+		render.Status(r, http.StatusCreated)
+
+		render.JSON(w, r, resp.SuccessResponse{
+			Status: http.StatusCreated,
+			Data:   token,
+		})
+	}
+}
+
+// @Summary ListAccessTokens
+// @Tags auth
+// @Description Lists the personal access tokens of the authenticated user that are not revoked
+// @ID list-access-tokens
+// @Produce  json
+// @Success 200 {object} response.SuccessResponse{data=[]models.AccessToken}
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Failure default {object} response.ErrorResponse
+// @Security CookieAuth
+// @Router /auth/tokens [get]
+func (a *AccessTokenHandler) List(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.accesstoken.List"
+
+		log := a.log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		userInfo, err := cookie.TakeUserInfo(ctx, w, r, a.sessions)
+		if flag := handlers.HandleGettingCookie(w, r, err, log); !flag {
+			return
+		}
+
+		tokens, err := a.tokens.List(ctx, userInfo.UUID)
+		if err != nil {
+			render.Status(r, http.StatusInternalServerError)
+
+			render.JSON(w, r, resp.ErrorResponse{
+				Status: http.StatusInternalServerError,
+				Error:  "failed to get tokens",
+			})
+
+			return
+		}
+
+		render.JSON(w, r, resp.SuccessResponse{
+			Status: http.StatusOK,
+			Data:   tokens,
+		})
+	}
+}
+
+// @Summary RevokeAccessToken
+// @Tags auth
+// @Description Revokes a personal access token of the authenticated user
+// @ID revoke-access-token
+// @Produce  json
+// @Param id path string true "Token ID"
+// @Success 200 {object} response.SuccessResponse
+// @Failure 400,401,404 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Failure default {object} response.ErrorResponse
+// @Security CookieAuth
+// @Router /auth/tokens/{id} [delete]
+func (a *AccessTokenHandler) Revoke(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.accesstoken.Revoke"
+
+		log := a.log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		userInfo, err := cookie.TakeUserInfo(ctx, w, r, a.sessions)
+		if flag := handlers.HandleGettingCookie(w, r, err, log); !flag {
+			return
+		}
+
+		tokenID, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			log.Warn("invalid token id", sl.Err(err))
+
+			render.Status(r, http.StatusBadRequest)
+
+			render.JSON(w, r, resp.ErrorResponse{
+				Status: http.StatusBadRequest,
+				Error:  "invalid token id",
+			})
+
+			return
+		}
+
+		err = a.tokens.Revoke(ctx, userInfo.UUID, tokenID, requestmeta.FromRequest(r))
+		if err != nil {
+			if errors.Is(err, accesstoken.ErrAccessTokenNotFound) {
+				render.Status(r, http.StatusNotFound)
+
+				render.JSON(w, r, resp.ErrorResponse{
+					Status: http.StatusNotFound,
+					Error:  "token not found",
+				})
+
+				return
+			}
+
+			render.Status(r, http.StatusInternalServerError)
+
+			render.JSON(w, r, resp.ErrorResponse{
+				Status: http.StatusInternalServerError,
+				Error:  "failed to revoke token",
+			})
+
+			return
+		}
+
+		render.JSON(w, r, resp.SuccessResponse{
+			Status: http.StatusOK,
+			Data:   "token revoked",
+		})
+	}
+}
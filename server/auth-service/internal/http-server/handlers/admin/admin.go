@@ -0,0 +1,313 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"github.com/go-chi/render"
+	"github.com/google/uuid"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/domain/models"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/http-server/handlers"
+	resp "github.com/sergey-frey/cchat/server/auth-service/internal/lib/api/response"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/lib/identity"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/lib/logger/sl"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/lib/requestmeta"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/services/admin"
+)
+
+type Admin interface {
+	Account(ctx context.Context, uid uuid.UUID) (status *models.AccountStatus, err error)
+	Suspend(ctx context.Context, actor models.NormalizedUser, uid uuid.UUID, suspend models.SuspendAccount, meta models.RequestMeta) (err error)
+	Unsuspend(ctx context.Context, actor models.NormalizedUser, uid uuid.UUID, meta models.RequestMeta) (err error)
+	ForceLogout(ctx context.Context, actor models.NormalizedUser, uid uuid.UUID, meta models.RequestMeta) (err error)
+	ChangeRole(ctx context.Context, actor models.NormalizedUser, uid uuid.UUID, change models.ChangeRole, meta models.RequestMeta) (err error)
+}
+
+// AdminHandler serves the /admin routes, the roles are checked by
+// jwtcheck.RequireRole in front of it.
+type AdminHandler struct {
+	admin Admin
+	log   *slog.Logger
+}
+
+func New(admin Admin, log *slog.Logger) *AdminHandler {
+	return &AdminHandler{
+		admin: admin,
+		log:   log,
+	}
+}
+
+// @Summary Account
+// @Tags admin
+// @Description Returns the role, the suspension and the rest of the credentials state of a user. Available to moderators and admins
+// @ID admin-account
+// @Produce  json
+// @Param id path string true "user id"
+// @Success 200 {object} response.SuccessResponse{data=models.AccountStatus}
+// @Failure 400,401,403,404 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Failure default {object} response.ErrorResponse
+// @Security CookieAuth
+// @Router /admin/users/{id}/account [get]
+func (a *AdminHandler) Account(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.admin.Account"
+
+		log := a.log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		uid, ok := userID(w, r, log)
+		if !ok {
+			return
+		}
+
+		status, err := a.admin.Account(ctx, uid)
+		if err != nil {
+			adminError(w, r, err, "failed to get account")
+
+			return
+		}
+
+		render.JSON(w, r, resp.SuccessResponse{
+			Status: http.StatusOK,
+			Data:   status,
+		})
+	}
+}
+
+// @Summary Suspend
+// @Tags admin
+// @Description Suspends a user, the user is logged out everywhere and can not log in until unsuspended.
+// @Description Moderators can suspend users, admins can suspend users and moderators
+// @ID admin-suspend
+// @Accept  json
+// @Produce  json
+// @Param id path string true "user id"
+// @Param input body models.SuspendAccount true "reason"
+// @Success 200 {object} response.SuccessResponse
+// @Failure 400,401,403,404 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Failure default {object} response.ErrorResponse
+// @Security CookieAuth
+// @Router /admin/users/{id}/suspend [post]
+func (a *AdminHandler) Suspend(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.admin.Suspend"
+
+		log := a.log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		actor, _ := identity.User(r.Context())
+
+		uid, ok := userID(w, r, log)
+		if !ok {
+			return
+		}
+
+		var req models.SuspendAccount
+
+		err := render.Decode(r, &req)
+
+		if flag := handlers.HandleError(w, r, req, err, log); !flag {
+			return
+		}
+
+		err = a.admin.Suspend(ctx, *actor, uid, req, requestmeta.FromRequest(r))
+		if err != nil {
+			adminError(w, r, err, "failed to suspend account")
+
+			return
+		}
+
+		render.JSON(w, r, resp.SuccessResponse{
+			Status: http.StatusOK,
+			Data:   "account suspended",
+		})
+	}
+}
+
+// @Summary Unsuspend
+// @Tags admin
+// @Description Lifts the suspension of a user, the user has to log in again
+// @ID admin-unsuspend
+// @Produce  json
+// @Param id path string true "user id"
+// @Success 200 {object} response.SuccessResponse
+// @Failure 400,401,403,404 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Failure default {object} response.ErrorResponse
+// @Security CookieAuth
+// @Router /admin/users/{id}/unsuspend [post]
+func (a *AdminHandler) Unsuspend(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.admin.Unsuspend"
+
+		log := a.log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		actor, _ := identity.User(r.Context())
+
+		uid, ok := userID(w, r, log)
+		if !ok {
+			return
+		}
+
+		err := a.admin.Unsuspend(ctx, *actor, uid, requestmeta.FromRequest(r))
+		if err != nil {
+			adminError(w, r, err, "failed to unsuspend account")
+
+			return
+		}
+
+		render.JSON(w, r, resp.SuccessResponse{
+			Status: http.StatusOK,
+			Data:   "account unsuspended",
+		})
+	}
+}
+
+// @Summary ForceLogout
+// @Tags admin
+// @Description Ends every session of a user
+// @ID admin-force-logout
+// @Produce  json
+// @Param id path string true "user id"
+// @Success 200 {object} response.SuccessResponse
+// @Failure 400,401,403,404 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Failure default {object} response.ErrorResponse
+// @Security CookieAuth
+// @Router /admin/users/{id}/logout [post]
+func (a *AdminHandler) ForceLogout(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.admin.ForceLogout"
+
+		log := a.log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		actor, _ := identity.User(r.Context())
+
+		uid, ok := userID(w, r, log)
+		if !ok {
+			return
+		}
+
+		err := a.admin.ForceLogout(ctx, *actor, uid, requestmeta.FromRequest(r))
+		if err != nil {
+			adminError(w, r, err, "failed to log out user")
+
+			return
+		}
+
+		render.JSON(w, r, resp.SuccessResponse{
+			Status: http.StatusOK,
+			Data:   "user logged out",
+		})
+	}
+}
+
+// @Summary ChangeRole
+// @Tags admin
+// @Description Sets the role of a user and ends their sessions so the new role applies on the next login. Only available to admins
+// @ID admin-change-role
+// @Accept  json
+// @Produce  json
+// @Param id path string true "user id"
+// @Param input body models.ChangeRole true "new role"
+// @Success 200 {object} response.SuccessResponse
+// @Failure 400,401,403,404 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Failure default {object} response.ErrorResponse
+// @Security CookieAuth
+// @Router /admin/users/{id}/role [put]
+func (a *AdminHandler) ChangeRole(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.admin.ChangeRole"
+
+		log := a.log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		actor, _ := identity.User(r.Context())
+
+		uid, ok := userID(w, r, log)
+		if !ok {
+			return
+		}
+
+		var req models.ChangeRole
+
+		err := render.Decode(r, &req)
+
+		if flag := handlers.HandleError(w, r, req, err, log); !flag {
+			return
+		}
+
+		err = a.admin.ChangeRole(ctx, *actor, uid, req, requestmeta.FromRequest(r))
+		if err != nil {
+			adminError(w, r, err, "failed to change role")
+
+			return
+		}
+
+		render.JSON(w, r, resp.SuccessResponse{
+			Status: http.StatusOK,
+			Data:   "role changed",
+		})
+	}
+}
+
+func userID(w http.ResponseWriter, r *http.Request, log *slog.Logger) (uuid.UUID, bool) {
+	uid, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		log.Warn("invalid user id", sl.Err(err))
+
+		render.Status(r, http.StatusBadRequest)
+
+		render.JSON(w, r, resp.ErrorResponse{
+			Status: http.StatusBadRequest,
+			Error:  "invalid user id",
+		})
+
+		return uuid.Nil, false
+	}
+
+	return uid, true
+}
+
+// adminError answers with the status of a refused action, anything else
+// is an internal error described by message.
+func adminError(w http.ResponseWriter, r *http.Request, err error, message string) {
+	status := http.StatusInternalServerError
+
+	switch {
+	case errors.Is(err, admin.ErrUserNotFound):
+		status, message = http.StatusNotFound, "user not found"
+	case errors.Is(err, admin.ErrOwnAccount):
+		status, message = http.StatusForbidden, "can not manage own account"
+	case errors.Is(err, admin.ErrInsufficientRole):
+		status, message = http.StatusForbidden, "access denied"
+	case errors.Is(err, admin.ErrInvalidRole):
+		status, message = http.StatusBadRequest, "invalid role"
+	}
+
+	render.Status(r, status)
+
+	render.JSON(w, r, resp.ErrorResponse{
+		Status: status,
+		Error:  message,
+	})
+}
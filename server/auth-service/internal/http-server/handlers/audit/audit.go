@@ -0,0 +1,227 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/middleware"
+	"github.com/go-chi/render"
+	"github.com/google/uuid"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/domain/models"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/http-server/handlers"
+	resp "github.com/sergey-frey/cchat/server/auth-service/internal/lib/api/response"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/lib/cookie"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/lib/jwt"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/lib/logger/sl"
+)
+
+type Audit interface {
+	UserEvents(ctx context.Context, uid uuid.UUID, cursor int64, limit int) (page *models.EventPage, err error)
+	QueryEvents(ctx context.Context, filter models.EventFilter) (page *models.EventPage, err error)
+}
+
+type AuditHandler struct {
+	audit    Audit
+	sessions jwt.SessionStore
+	log      *slog.Logger
+}
+
+func New(audit Audit, sessions jwt.SessionStore, log *slog.Logger) *AuditHandler {
+	return &AuditHandler{
+		audit:    audit,
+		sessions: sessions,
+		log:      log,
+	}
+}
+
+// @Summary Events
+// @Tags auth
+// @Description Returns the security history of the authenticated user, newest first
+// @ID auth-events
+// @Produce  json
+// @Param cursor query int false "next_cursor of the previous page"
+// @Param limit query int false "page size, 20 by default, at most 100"
+// @Success 200 {object} response.SuccessResponse{data=models.EventPage}
+// @Failure 400,401 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Failure default {object} response.ErrorResponse
+// @Security CookieAuth
+// @Router /auth/events [get]
+func (a *AuditHandler) Events(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.audit.Events"
+
+		log := a.log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		userInfo, err := cookie.TakeUserInfo(ctx, w, r, a.sessions)
+		if flag := handlers.HandleGettingCookie(w, r, err, log); !flag {
+			return
+		}
+
+		query := r.URL.Query()
+
+		cursor, limit, err := parsePage(query)
+		if err != nil {
+			badQuery(w, r, err)
+
+			return
+		}
+
+		page, err := a.audit.UserEvents(ctx, userInfo.UUID, cursor, limit)
+		if err != nil {
+			log.Error("failed to get events", sl.Err(err))
+
+			render.Status(r, http.StatusInternalServerError)
+
+			render.JSON(w, r, resp.ErrorResponse{
+				Status: http.StatusInternalServerError,
+				Error:  "failed to get events",
+			})
+
+			return
+		}
+
+		render.JSON(w, r, resp.SuccessResponse{
+			Status: http.StatusOK,
+			Data:   page,
+		})
+	}
+}
+
+// @Summary AdminEvents
+// @Tags admin
+// @Description Queries the audit log of all users, newest first. Only available to admins
+// @ID admin-events
+// @Produce  json
+// @Param user_id query string false "user id"
+// @Param type query string false "comma separated event types"
+// @Param ip query string false "client ip"
+// @Param from query string false "RFC 3339 time, inclusive"
+// @Param to query string false "RFC 3339 time, exclusive"
+// @Param cursor query int false "next_cursor of the previous page"
+// @Param limit query int false "page size, 20 by default, at most 100"
+// @Success 200 {object} response.SuccessResponse{data=models.EventPage}
+// @Failure 400,401,403 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Failure default {object} response.ErrorResponse
+// @Security CookieAuth
+// @Router /admin/events [get]
+func (a *AuditHandler) AdminEvents(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.audit.AdminEvents"
+
+		log := a.log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		filter, err := parseFilter(r.URL.Query())
+		if err != nil {
+			badQuery(w, r, err)
+
+			return
+		}
+
+		page, err := a.audit.QueryEvents(ctx, filter)
+		if err != nil {
+			log.Error("failed to query events", sl.Err(err))
+
+			render.Status(r, http.StatusInternalServerError)
+
+			render.JSON(w, r, resp.ErrorResponse{
+				Status: http.StatusInternalServerError,
+				Error:  "failed to get events",
+			})
+
+			return
+		}
+
+		render.JSON(w, r, resp.SuccessResponse{
+			Status: http.StatusOK,
+			Data:   page,
+		})
+	}
+}
+
+func parsePage(query url.Values) (cursor int64, limit int, err error) {
+	if raw := query.Get("cursor"); raw != "" {
+		cursor, err = strconv.ParseInt(raw, 10, 64)
+		if err != nil || cursor < 0 {
+			return 0, 0, errors.New("invalid cursor")
+		}
+	}
+
+	if raw := query.Get("limit"); raw != "" {
+		limit, err = strconv.Atoi(raw)
+		if err != nil || limit < 1 {
+			return 0, 0, errors.New("invalid limit")
+		}
+	}
+
+	return cursor, limit, nil
+}
+
+func parseFilter(query url.Values) (models.EventFilter, error) {
+	var filter models.EventFilter
+
+	cursor, limit, err := parsePage(query)
+	if err != nil {
+		return filter, err
+	}
+
+	filter.Cursor = cursor
+	filter.Limit = limit
+
+	if raw := query.Get("user_id"); raw != "" {
+		uid, err := uuid.Parse(raw)
+		if err != nil {
+			return filter, errors.New("invalid user_id")
+		}
+
+		filter.UserID = uuid.NullUUID{UUID: uid, Valid: true}
+	}
+
+	if raw := query.Get("type"); raw != "" {
+		for _, eventType := range strings.Split(raw, ",") {
+			if eventType = strings.TrimSpace(eventType); eventType != "" {
+				filter.Types = append(filter.Types, eventType)
+			}
+		}
+	}
+
+	filter.IP = query.Get("ip")
+
+	if raw := query.Get("from"); raw != "" {
+		filter.From, err = time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return filter, errors.New("invalid from, expected RFC 3339")
+		}
+	}
+
+	if raw := query.Get("to"); raw != "" {
+		filter.To, err = time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return filter, errors.New("invalid to, expected RFC 3339")
+		}
+	}
+
+	return filter, nil
+}
+
+func badQuery(w http.ResponseWriter, r *http.Request, err error) {
+	render.Status(r, http.StatusBadRequest)
+
+	render.JSON(w, r, resp.ErrorResponse{
+		Status: http.StatusBadRequest,
+		Error:  err.Error(),
+	})
+}
@@ -4,45 +4,59 @@ import (
 	"context"
 	"errors"
 	"log/slog"
+	"math"
 	"net/http"
+	"strconv"
 
 	"github.com/go-chi/chi/middleware"
 	"github.com/go-chi/render"
+	"github.com/google/uuid"
 	"github.com/sergey-frey/cchat/server/auth-service/internal/domain/models"
 	"github.com/sergey-frey/cchat/server/auth-service/internal/http-server/handlers"
 	resp "github.com/sergey-frey/cchat/server/auth-service/internal/lib/api/response"
 	"github.com/sergey-frey/cchat/server/auth-service/internal/lib/cookie"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/lib/jwt"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/lib/logger/sl"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/lib/requestmeta"
 	"github.com/sergey-frey/cchat/server/auth-service/internal/services/auth"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/services/lockout"
 )
 
 type Auth interface {
-	Login(ctx context.Context, loginUser models.LoginUser) (user *models.NormalizedUser, accessToken string, refreshToken string, err error)
-	RegisterNewUser(ctx context.Context, registerUSer models.RegisterUser) (user *models.NormalizedUser, accessToken string, refreshToken string, err error)
-	ChangePassword(ctx context.Context, newPassword models.NewPassword) (err error)
-	ResetPassword(ctx context.Context, resetPassword models.ResetPassword) (err error)
+	Login(ctx context.Context, loginUser models.LoginUser, meta models.RequestMeta) (result *models.LoginResult, err error)
+	RegisterNewUser(ctx context.Context, registerUSer models.RegisterUser, meta models.RequestMeta) (user *models.NormalizedUser, accessToken string, refreshToken string, err error)
+	ChangePassword(ctx context.Context, newPassword models.NewPassword, meta models.RequestMeta) (err error)
+	ResetPassword(ctx context.Context, resetPassword models.ResetPassword, meta models.RequestMeta) (err error)
+	ConfirmPasswordReset(ctx context.Context, confirm models.ConfirmPasswordReset, meta models.RequestMeta) (err error)
+	VerifyEmail(ctx context.Context, verify models.VerifyEmail) (userID uuid.UUID, err error)
+	ResendVerification(ctx context.Context, resend models.ResendVerification) (err error)
 }
 
 type AuthHandler struct {
-	auth Auth
-	log  *slog.Logger
+	auth     Auth
+	sessions jwt.SessionStore
+	log      *slog.Logger
 }
 
-func New(auth Auth, log *slog.Logger) *AuthHandler {
+func New(auth Auth, sessions jwt.SessionStore, log *slog.Logger) *AuthHandler {
 	return &AuthHandler{
-		auth: auth,
-		log:  log,
+		auth:     auth,
+		sessions: sessions,
+		log:      log,
 	}
 }
 
 // @Summary Login
 // @Tags auth
-// @Description Accepts email and password and verifies them
+// @Description Accepts email and password and verifies them. If the account has two-factor authentication
+// @Description enabled, no session is started and a challenge for /auth/login/2fa is returned instead.
+// @Description Repeated failures block the account and the IP for a growing delay, see the Retry-After header.
 // @ID create-account
 // @Accept  json
 // @Produce  json
 // @Param input body models.LoginUser true "valid email and password"
 // @Success 200 {object} response.SuccessResponse
-// @Failure 400,404,409 {object} response.ErrorResponse
+// @Failure 400,403,404,409,429 {object} response.ErrorResponse
 // @Failure 500 {object} response.ErrorResponse
 // @Failure default {object} response.ErrorResponse
 // @Router /auth/login [post]
@@ -65,7 +79,7 @@ func (a *AuthHandler) Login(ctx context.Context) http.HandlerFunc {
 			return
 		}
 
-		user, accessToken, refreshToken, err := a.auth.Login(ctx, req)
+		result, err := a.auth.Login(ctx, req, requestmeta.FromRequest(r))
 
 		if err != nil {
 			if errors.Is(err, auth.ErrInvalidCredentials) {
@@ -80,6 +94,54 @@ func (a *AuthHandler) Login(ctx context.Context) http.HandlerFunc {
 				return
 			}
 
+			var blocked *lockout.BlockedError
+			if errors.As(err, &blocked) {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(blocked.RetryAfter.Seconds()))))
+
+				render.Status(r, http.StatusTooManyRequests)
+
+				render.JSON(w, r, resp.ErrorResponse{
+					Status: http.StatusTooManyRequests,
+					Error:  "too many failed login attempts, try again later",
+				})
+
+				return
+			}
+
+			if errors.Is(err, auth.ErrEmailNotVerified) {
+
+				render.Status(r, http.StatusForbidden)
+
+				render.JSON(w, r, resp.ErrorResponse{
+					Status: http.StatusForbidden,
+					Error:  "email not verified",
+				})
+
+				return
+			}
+
+			if errors.Is(err, auth.ErrAccountDeactivated) {
+				render.Status(r, http.StatusForbidden)
+
+				render.JSON(w, r, resp.ErrorResponse{
+					Status: http.StatusForbidden,
+					Error:  "account is scheduled for deletion",
+				})
+
+				return
+			}
+
+			if errors.Is(err, auth.ErrAccountSuspended) {
+				render.Status(r, http.StatusForbidden)
+
+				render.JSON(w, r, resp.ErrorResponse{
+					Status: http.StatusForbidden,
+					Error:  "account is suspended",
+				})
+
+				return
+			}
+
 			render.Status(r, http.StatusInternalServerError)
 
 			render.JSON(w, r, resp.ErrorResponse{
@@ -89,18 +151,28 @@ func (a *AuthHandler) Login(ctx context.Context) http.HandlerFunc {
 			return
 		}
 
-		cookie.SetCookie(w, accessToken, refreshToken)
+		if result.Challenge != nil {
+			render.JSON(w, r, resp.SuccessResponse{
+				Status: http.StatusOK,
+				Data:   result.Challenge,
+			})
+
+			return
+		}
+
+		cookie.SetCookie(w, result.AccessToken, result.RefreshToken)
 
 		render.JSON(w, r, resp.SuccessResponse{
 			Status: http.StatusOK,
-			Data:   user,
+			Data:   result.User,
 		})
 	}
 }
 
 // @Summary Register
 // @Tags auth
-// @Description Accepts the email and password and if the email does not exist creates a new user
+// @Description Accepts the email and password and if the email does not exist creates a new user and sends a verification link to the email.
+// @Description No session is started when verification is required before login.
 // @ID login-account
 // @Accept  json
 // @Produce  json
@@ -127,7 +199,7 @@ func (a *AuthHandler) Register(ctx context.Context) http.HandlerFunc {
 			return
 		}
 
-		user, accessToken, refreshToken, err := a.auth.RegisterNewUser(ctx, req)
+		user, accessToken, refreshToken, err := a.auth.RegisterNewUser(ctx, req, requestmeta.FromRequest(r))
 		if err != nil {
 			if errors.Is(err, auth.ErrUserExists) {
 
@@ -150,7 +222,10 @@ func (a *AuthHandler) Register(ctx context.Context) http.HandlerFunc {
 			return
 		}
 
-		cookie.SetCookie(w, accessToken, refreshToken)
+		// Without a verified email there is no session to hand out yet.
+		if accessToken != "" {
+			cookie.SetCookie(w, accessToken, refreshToken)
+		}
 
 		render.JSON(w, r, resp.SuccessResponse{
 			Status: http.StatusOK,
@@ -176,7 +251,7 @@ func (a *AuthHandler) ChangePassword(ctx context.Context) http.HandlerFunc {
 			return
 		}
 
-		err = a.auth.ChangePassword(ctx, req)
+		err = a.auth.ChangePassword(ctx, req, requestmeta.FromRequest(r))
 		if err != nil {
 			if errors.Is(err, auth.ErrInvalidCredentials) {
 
@@ -206,6 +281,18 @@ func (a *AuthHandler) ChangePassword(ctx context.Context) http.HandlerFunc {
 	}
 }
 
+// @Summary ResetPassword
+// @Tags auth
+// @Description Sends a password reset link to the email if an account with it exists
+// @ID reset-password
+// @Accept  json
+// @Produce  json
+// @Param input body models.ResetPassword true "account email"
+// @Success 200 {object} response.SuccessResponse
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Failure default {object} response.ErrorResponse
+// @Router /auth/password/reset [post]
 func (a *AuthHandler) ResetPassword(ctx context.Context) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		const op = "handlers.auth.ResetPassword"
@@ -215,8 +302,207 @@ func (a *AuthHandler) ResetPassword(ctx context.Context) http.HandlerFunc {
 			slog.String("request_id", middleware.GetReqID(r.Context())),
 		)
 
-		log.Info("reseting password")
+		var req models.ResetPassword
+
+		err := render.Decode(r, &req)
 
-		//TODO: implement password reset
+		if flag := handlers.HandleError(w, r, req, err, log); !flag {
+			return
+		}
+
+		err = a.auth.ResetPassword(ctx, req, requestmeta.FromRequest(r))
+		if err != nil {
+			render.Status(r, http.StatusInternalServerError)
+
+			render.JSON(w, r, resp.ErrorResponse{
+				Status: http.StatusInternalServerError,
+				Error:  "internal error",
+			})
+			return
+		}
+
+		render.JSON(w, r, resp.SuccessResponse{
+			Status: http.StatusOK,
+			Data:   "if the account exists, a reset link has been sent to the email",
+		})
+	}
+}
+
+// @Summary ConfirmPasswordReset
+// @Tags auth
+// @Description Sets a new password using the token from the reset link, all sessions of the user are revoked
+// @ID confirm-password-reset
+// @Accept  json
+// @Produce  json
+// @Param input body models.ConfirmPasswordReset true "reset token and new password(minimum of 8 characters)"
+// @Success 200 {object} response.SuccessResponse
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Failure default {object} response.ErrorResponse
+// @Router /auth/password/reset/confirm [post]
+func (a *AuthHandler) ConfirmPasswordReset(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.auth.ConfirmPasswordReset"
+
+		log := a.log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		var req models.ConfirmPasswordReset
+
+		err := render.Decode(r, &req)
+
+		if flag := handlers.HandleError(w, r, req, err, log); !flag {
+			return
+		}
+
+		err = a.auth.ConfirmPasswordReset(ctx, req, requestmeta.FromRequest(r))
+		if err != nil {
+			if errors.Is(err, auth.ErrInvalidResetToken) {
+
+				render.Status(r, http.StatusBadRequest)
+
+				render.JSON(w, r, resp.ErrorResponse{
+					Status: http.StatusBadRequest,
+					Error:  "invalid or expired reset token",
+				})
+
+				return
+			}
+
+			render.Status(r, http.StatusInternalServerError)
+
+			render.JSON(w, r, resp.ErrorResponse{
+				Status: http.StatusInternalServerError,
+				Error:  "internal error",
+			})
+			return
+		}
+
+		cookie.DeleteCookie(w)
+
+		render.JSON(w, r, resp.SuccessResponse{
+			Status: http.StatusOK,
+			Data:   "password reset successfully",
+		})
+	}
+}
+
+// @Summary VerifyEmail
+// @Tags auth
+// @Description Confirms the email using the token from the verification link, the tokens of a logged in user are reissued
+// @ID verify-email
+// @Accept  json
+// @Produce  json
+// @Param input body models.VerifyEmail true "verification token"
+// @Success 200 {object} response.SuccessResponse
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Failure default {object} response.ErrorResponse
+// @Router /auth/verify-email [post]
+func (a *AuthHandler) VerifyEmail(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.auth.VerifyEmail"
+
+		log := a.log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		var req models.VerifyEmail
+
+		err := render.Decode(r, &req)
+
+		if flag := handlers.HandleError(w, r, req, err, log); !flag {
+			return
+		}
+
+		userID, err := a.auth.VerifyEmail(ctx, req)
+		if err != nil {
+			if errors.Is(err, auth.ErrInvalidVerifyToken) {
+
+				render.Status(r, http.StatusBadRequest)
+
+				render.JSON(w, r, resp.ErrorResponse{
+					Status: http.StatusBadRequest,
+					Error:  "invalid or expired verification token",
+				})
+
+				return
+			}
+
+			render.Status(r, http.StatusInternalServerError)
+
+			render.JSON(w, r, resp.ErrorResponse{
+				Status: http.StatusInternalServerError,
+				Error:  "internal error",
+			})
+			return
+		}
+
+		// The link may be opened in a browser that is already logged in,
+		// its tokens still say the email is not verified. RefreshCookie
+		// rotates whether the access token expired or not, so it is the
+		// only rotation of the request.
+		if refreshCookie, err := r.Cookie("refresh_token"); err == nil {
+			if claims, err := jwt.ParseRefreshToken(refreshCookie.Value); err == nil && claims.UserID == userID {
+				if _, err := cookie.RefreshCookie(ctx, w, r, a.sessions); err != nil {
+					log.Warn("failed to reissue tokens", sl.Err(err))
+				}
+			}
+		}
+
+		render.JSON(w, r, resp.SuccessResponse{
+			Status: http.StatusOK,
+			Data:   "email verified",
+		})
+	}
+}
+
+// @Summary ResendVerification
+// @Tags auth
+// @Description Sends a new verification link to the email if an unverified account with it exists
+// @ID resend-verification
+// @Accept  json
+// @Produce  json
+// @Param input body models.ResendVerification true "account email"
+// @Success 200 {object} response.SuccessResponse
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Failure default {object} response.ErrorResponse
+// @Router /auth/verify-email/resend [post]
+func (a *AuthHandler) ResendVerification(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.auth.ResendVerification"
+
+		log := a.log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		var req models.ResendVerification
+
+		err := render.Decode(r, &req)
+
+		if flag := handlers.HandleError(w, r, req, err, log); !flag {
+			return
+		}
+
+		err = a.auth.ResendVerification(ctx, req)
+		if err != nil {
+			render.Status(r, http.StatusInternalServerError)
+
+			render.JSON(w, r, resp.ErrorResponse{
+				Status: http.StatusInternalServerError,
+				Error:  "internal error",
+			})
+			return
+		}
+
+		render.JSON(w, r, resp.SuccessResponse{
+			Status: http.StatusOK,
+			Data:   "if the email is not verified yet, a new link has been sent to it",
+		})
 	}
 }
@@ -0,0 +1,249 @@
+package deletion
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/go-chi/chi/middleware"
+	"github.com/go-chi/render"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/domain/models"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/http-server/handlers"
+	resp "github.com/sergey-frey/cchat/server/auth-service/internal/lib/api/response"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/lib/cookie"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/lib/jwt"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/lib/requestmeta"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/services/deletion"
+)
+
+type Deletion interface {
+	Request(ctx context.Context, user models.NormalizedUser, deleteAccount models.DeleteAccount, meta models.RequestMeta) (scheduled *models.DeletionScheduled, err error)
+	Confirm(ctx context.Context, user models.NormalizedUser, confirm models.ConfirmDeletion, meta models.RequestMeta) (scheduled *models.DeletionScheduled, err error)
+	Restore(ctx context.Context, restore models.RestoreAccount, meta models.RequestMeta) (err error)
+}
+
+type DeletionHandler struct {
+	deletion Deletion
+	sessions jwt.SessionStore
+	log      *slog.Logger
+}
+
+func New(deletion Deletion, sessions jwt.SessionStore, log *slog.Logger) *DeletionHandler {
+	return &DeletionHandler{
+		deletion: deletion,
+		sessions: sessions,
+		log:      log,
+	}
+}
+
+// @Summary DeleteAccount
+// @Tags auth
+// @Description Schedules the deletion of the account after the password is confirmed. The account is logged out everywhere and can not log in,
+// @Description a mailed link restores it until the grace period is over. After that the user is erased from every service.
+// @Description An account without a password, made through an identity provider, is mailed a link to confirm the deletion instead.
+// @ID delete-account
+// @Accept  json
+// @Produce  json
+// @Param input body models.DeleteAccount true "current password, empty for accounts without one"
+// @Success 202 {object} response.SuccessResponse{data=models.DeletionScheduled}
+// @Failure 400,401,403 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Failure default {object} response.ErrorResponse
+// @Security CookieAuth
+// @Router /auth/account [delete]
+func (d *DeletionHandler) Request(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.deletion.Request"
+
+		log := d.log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		userInfo, err := cookie.TakeUserInfo(ctx, w, r, d.sessions)
+		if flag := handlers.HandleGettingCookie(w, r, err, log); !flag {
+			return
+		}
+
+		var req models.DeleteAccount
+
+		err = render.Decode(r, &req)
+
+		if flag := handlers.HandleError(w, r, req, err, log); !flag {
+			return
+		}
+
+		scheduled, err := d.deletion.Request(ctx, *userInfo, req, requestmeta.FromRequest(r))
+		if err != nil {
+			if errors.Is(err, deletion.ErrConfirmationSent) {
+				render.Status(r, http.StatusAccepted)
+
+				render.JSON(w, r, resp.SuccessResponse{
+					Status: http.StatusAccepted,
+					Data:   "follow the mailed link to confirm the deletion",
+				})
+
+				return
+			}
+
+			if errors.Is(err, deletion.ErrInvalidCredentials) {
+				render.Status(r, http.StatusForbidden)
+
+				render.JSON(w, r, resp.ErrorResponse{
+					Status: http.StatusForbidden,
+					Error:  "invalid password",
+				})
+
+				return
+			}
+
+			render.Status(r, http.StatusInternalServerError)
+
+			render.JSON(w, r, resp.ErrorResponse{
+				Status: http.StatusInternalServerError,
+				Error:  "failed to delete account",
+			})
+
+			return
+		}
+
+		cookie.DeleteCookie(w)
+
+		render.Status(r, http.StatusAccepted)
+
+		render.JSON(w, r, resp.SuccessResponse{
+			Status: http.StatusAccepted,
+			Data:   scheduled,
+		})
+	}
+}
+
+// @Summary ConfirmAccountDeletion
+// @Tags auth
+// @Description Schedules the deletion of an account without a password, accepts the token from the mailed confirmation link.
+// @Description The account is logged out everywhere, the restore link works as after DeleteAccount.
+// @ID confirm-account-deletion
+// @Accept  json
+// @Produce  json
+// @Param input body models.ConfirmDeletion true "token from the confirmation link"
+// @Success 202 {object} response.SuccessResponse{data=models.DeletionScheduled}
+// @Failure 400,401 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Failure default {object} response.ErrorResponse
+// @Security CookieAuth
+// @Router /auth/account/confirm-deletion [post]
+func (d *DeletionHandler) Confirm(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.deletion.Confirm"
+
+		log := d.log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		userInfo, err := cookie.TakeUserInfo(ctx, w, r, d.sessions)
+		if flag := handlers.HandleGettingCookie(w, r, err, log); !flag {
+			return
+		}
+
+		var req models.ConfirmDeletion
+
+		err = render.Decode(r, &req)
+
+		if flag := handlers.HandleError(w, r, req, err, log); !flag {
+			return
+		}
+
+		scheduled, err := d.deletion.Confirm(ctx, *userInfo, req, requestmeta.FromRequest(r))
+		if err != nil {
+			if errors.Is(err, deletion.ErrInvalidConfirmToken) {
+				render.Status(r, http.StatusBadRequest)
+
+				render.JSON(w, r, resp.ErrorResponse{
+					Status: http.StatusBadRequest,
+					Error:  "invalid or expired confirmation token",
+				})
+
+				return
+			}
+
+			render.Status(r, http.StatusInternalServerError)
+
+			render.JSON(w, r, resp.ErrorResponse{
+				Status: http.StatusInternalServerError,
+				Error:  "failed to delete account",
+			})
+
+			return
+		}
+
+		cookie.DeleteCookie(w)
+
+		render.Status(r, http.StatusAccepted)
+
+		render.JSON(w, r, resp.SuccessResponse{
+			Status: http.StatusAccepted,
+			Data:   scheduled,
+		})
+	}
+}
+
+// @Summary RestoreAccount
+// @Tags auth
+// @Description Cancels a scheduled account deletion during the grace period, accepts the token from the mailed link
+// @ID restore-account
+// @Accept  json
+// @Produce  json
+// @Param input body models.RestoreAccount true "token from the restore link"
+// @Success 200 {object} response.SuccessResponse
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Failure default {object} response.ErrorResponse
+// @Router /auth/account/restore [post]
+func (d *DeletionHandler) Restore(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.deletion.Restore"
+
+		log := d.log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		var req models.RestoreAccount
+
+		err := render.Decode(r, &req)
+
+		if flag := handlers.HandleError(w, r, req, err, log); !flag {
+			return
+		}
+
+		err = d.deletion.Restore(ctx, req, requestmeta.FromRequest(r))
+		if err != nil {
+			if errors.Is(err, deletion.ErrInvalidRestoreToken) {
+				render.Status(r, http.StatusBadRequest)
+
+				render.JSON(w, r, resp.ErrorResponse{
+					Status: http.StatusBadRequest,
+					Error:  "invalid or expired restore token",
+				})
+
+				return
+			}
+
+			render.Status(r, http.StatusInternalServerError)
+
+			render.JSON(w, r, resp.ErrorResponse{
+				Status: http.StatusInternalServerError,
+				Error:  "internal error",
+			})
+
+			return
+		}
+
+		render.JSON(w, r, resp.SuccessResponse{
+			Status: http.StatusOK,
+			Data:   "account restored",
+		})
+	}
+}
@@ -0,0 +1,243 @@
+package export
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"github.com/go-chi/render"
+	"github.com/google/uuid"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/domain/models"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/http-server/handlers"
+	resp "github.com/sergey-frey/cchat/server/auth-service/internal/lib/api/response"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/lib/cookie"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/lib/jwt"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/lib/logger/sl"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/lib/requestmeta"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/services/export"
+)
+
+type Export interface {
+	Request(ctx context.Context, uid uuid.UUID, meta models.RequestMeta) (job *models.ExportJob, err error)
+	Job(ctx context.Context, uid uuid.UUID, id uuid.UUID) (job *models.ExportJob, err error)
+	Open(ctx context.Context, id uuid.UUID, query url.Values, meta models.RequestMeta) (file *os.File, dataExport *models.DataExport, err error)
+}
+
+type ExportHandler struct {
+	exports  Export
+	sessions jwt.SessionStore
+	log      *slog.Logger
+}
+
+func New(exports Export, sessions jwt.SessionStore, log *slog.Logger) *ExportHandler {
+	return &ExportHandler{
+		exports:  exports,
+		sessions: sessions,
+		log:      log,
+	}
+}
+
+// @Summary RequestExport
+// @Tags auth
+// @Description Starts collecting everything kept about the user into a ZIP of JSON files. The export runs in the background,
+// @Description its status is polled by id. While an export is pending asking again returns that one.
+// @ID request-export
+// @Produce  json
+// @Success 202 {object} response.SuccessResponse{data=models.ExportJob}
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Failure default {object} response.ErrorResponse
+// @Security CookieAuth
+// @Router /auth/exports [post]
+func (e *ExportHandler) Request(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.export.Request"
+
+		log := e.log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		userInfo, err := cookie.TakeUserInfo(ctx, w, r, e.sessions)
+		if flag := handlers.HandleGettingCookie(w, r, err, log); !flag {
+			return
+		}
+
+		job, err := e.exports.Request(ctx, userInfo.UUID, requestmeta.FromRequest(r))
+		if err != nil {
+			render.Status(r, http.StatusInternalServerError)
+
+			render.JSON(w, r, resp.ErrorResponse{
+				Status: http.StatusInternalServerError,
+				Error:  "failed to request export",
+			})
+
+			return
+		}
+
+		render.Status(r, http.StatusAccepted)
+
+		render.JSON(w, r, resp.SuccessResponse{
+			Status: http.StatusAccepted,
+			Data:   job,
+		})
+	}
+}
+
+// @Summary ExportStatus
+// @Tags auth
+// @Description Returns the status of an export of the authenticated user. A ready export carries a signed download link,
+// @Description every call signs a fresh one.
+// @ID export-status
+// @Produce  json
+// @Param id path string true "Export ID"
+// @Success 200 {object} response.SuccessResponse{data=models.ExportJob}
+// @Failure 400,401,404 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Failure default {object} response.ErrorResponse
+// @Security CookieAuth
+// @Router /auth/exports/{id} [get]
+func (e *ExportHandler) Status(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.export.Status"
+
+		log := e.log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		userInfo, err := cookie.TakeUserInfo(ctx, w, r, e.sessions)
+		if flag := handlers.HandleGettingCookie(w, r, err, log); !flag {
+			return
+		}
+
+		exportID, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			log.Warn("invalid export id", sl.Err(err))
+
+			render.Status(r, http.StatusBadRequest)
+
+			render.JSON(w, r, resp.ErrorResponse{
+				Status: http.StatusBadRequest,
+				Error:  "invalid export id",
+			})
+
+			return
+		}
+
+		job, err := e.exports.Job(ctx, userInfo.UUID, exportID)
+		if err != nil {
+			if errors.Is(err, export.ErrExportNotFound) {
+				render.Status(r, http.StatusNotFound)
+
+				render.JSON(w, r, resp.ErrorResponse{
+					Status: http.StatusNotFound,
+					Error:  "export not found",
+				})
+
+				return
+			}
+
+			render.Status(r, http.StatusInternalServerError)
+
+			render.JSON(w, r, resp.ErrorResponse{
+				Status: http.StatusInternalServerError,
+				Error:  "failed to get export",
+			})
+
+			return
+		}
+
+		render.JSON(w, r, resp.SuccessResponse{
+			Status: http.StatusOK,
+			Data:   job,
+		})
+	}
+}
+
+// @Summary DownloadExport
+// @Tags auth
+// @Description Downloads the archive of a ready export. Takes the signed link from the export status, no session is needed
+// @ID download-export
+// @Produce  application/zip
+// @Param id path string true "Export ID"
+// @Param expires query int true "Expiry of the link, unix seconds"
+// @Param signature query string true "Signature of the link"
+// @Success 200 {file} file
+// @Failure 400,403,404 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Failure default {object} response.ErrorResponse
+// @Router /auth/exports/{id}/download [get]
+func (e *ExportHandler) Download(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.export.Download"
+
+		log := e.log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		exportID, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			log.Warn("invalid export id", sl.Err(err))
+
+			render.Status(r, http.StatusBadRequest)
+
+			render.JSON(w, r, resp.ErrorResponse{
+				Status: http.StatusBadRequest,
+				Error:  "invalid export id",
+			})
+
+			return
+		}
+
+		file, dataExport, err := e.exports.Open(ctx, exportID, r.URL.Query(), requestmeta.FromRequest(r))
+		if err != nil {
+			switch {
+			case errors.Is(err, export.ErrInvalidLink):
+				render.Status(r, http.StatusForbidden)
+
+				render.JSON(w, r, resp.ErrorResponse{
+					Status: http.StatusForbidden,
+					Error:  "invalid or expired download link",
+				})
+			case errors.Is(err, export.ErrExportNotFound):
+				render.Status(r, http.StatusNotFound)
+
+				render.JSON(w, r, resp.ErrorResponse{
+					Status: http.StatusNotFound,
+					Error:  "export not found",
+				})
+			default:
+				render.Status(r, http.StatusInternalServerError)
+
+				render.JSON(w, r, resp.ErrorResponse{
+					Status: http.StatusInternalServerError,
+					Error:  "failed to download export",
+				})
+			}
+
+			return
+		}
+
+		defer file.Close()
+
+		modTime := time.Time{}
+		if dataExport.FinishedAt != nil {
+			modTime = *dataExport.FinishedAt
+		}
+
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": export.FileName(dataExport)}))
+		w.Header().Set("Cache-Control", "private, no-store")
+
+		http.ServeContent(w, r, "", modTime, file)
+	}
+}
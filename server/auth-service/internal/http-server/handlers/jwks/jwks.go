@@ -0,0 +1,26 @@
+package jwks
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/go-chi/render"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/lib/jwt"
+)
+
+// @Summary JWKS
+// @Tags auth
+// @Description Public keys the access tokens are signed with, other services verify tokens against them
+// @ID jwks
+// @Produce  json
+// @Success 200 {object} jwt.JWKS
+// @Router /.well-known/jwks.json [get]
+func JWKS(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// The set is a plain JWKS document, not wrapped in the API response,
+		// so standard clients can read it.
+		w.Header().Set("Cache-Control", "public, max-age=300")
+
+		render.JSON(w, r, jwt.PublicJWKS())
+	}
+}
@@ -0,0 +1,91 @@
+package lockout
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/go-chi/chi/middleware"
+	"github.com/go-chi/render"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/domain/models"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/http-server/handlers"
+	resp "github.com/sergey-frey/cchat/server/auth-service/internal/lib/api/response"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/lib/requestmeta"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/services/lockout"
+)
+
+type Lockout interface {
+	Unlock(ctx context.Context, unlock models.UnlockAccount, meta models.RequestMeta) (err error)
+}
+
+type LockoutHandler struct {
+	lockout Lockout
+	log     *slog.Logger
+}
+
+func New(lockout Lockout, log *slog.Logger) *LockoutHandler {
+	return &LockoutHandler{
+		lockout: lockout,
+		log:     log,
+	}
+}
+
+// @Summary UnlockAccount
+// @Tags auth
+// @Description Lifts the lock of an account after too many failed logins, accepts the token from the mailed link
+// @ID unlock-account
+// @Accept  json
+// @Produce  json
+// @Param input body models.UnlockAccount true "token from the unlock link"
+// @Success 200 {object} response.SuccessResponse
+// @Failure 400,409 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Failure default {object} response.ErrorResponse
+// @Router /auth/unlock [post]
+func (l *LockoutHandler) Unlock(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.lockout.Unlock"
+
+		log := l.log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		var req models.UnlockAccount
+
+		err := render.Decode(r, &req)
+
+		if flag := handlers.HandleError(w, r, req, err, log); !flag {
+			return
+		}
+
+		err = l.lockout.Unlock(ctx, req, requestmeta.FromRequest(r))
+		if err != nil {
+			if errors.Is(err, lockout.ErrInvalidUnlockToken) {
+				render.Status(r, http.StatusBadRequest)
+
+				render.JSON(w, r, resp.ErrorResponse{
+					Status: http.StatusBadRequest,
+					Error:  "invalid or expired unlock token",
+				})
+
+				return
+			}
+
+			render.Status(r, http.StatusInternalServerError)
+
+			render.JSON(w, r, resp.ErrorResponse{
+				Status: http.StatusInternalServerError,
+				Error:  "internal error",
+			})
+
+			return
+		}
+
+		render.JSON(w, r, resp.SuccessResponse{
+			Status: http.StatusOK,
+			Data:   "account unlocked",
+		})
+	}
+}
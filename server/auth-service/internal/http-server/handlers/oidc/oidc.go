@@ -0,0 +1,192 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"github.com/go-chi/render"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/config"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/domain/models"
+	resp "github.com/sergey-frey/cchat/server/auth-service/internal/lib/api/response"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/lib/cookie"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/lib/logger/sl"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/lib/requestmeta"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/services/oidc"
+)
+
+type OIDC interface {
+	Providers() (providers []string)
+	Start(ctx context.Context, provider string) (authURL string, err error)
+	Complete(ctx context.Context, provider string, code string, state string, meta models.RequestMeta) (result *models.LoginResult, err error)
+}
+
+type OIDCHandler struct {
+	oidc OIDC
+	cfg  *config.Config
+	log  *slog.Logger
+}
+
+func New(oidc OIDC, cfg *config.Config, log *slog.Logger) *OIDCHandler {
+	return &OIDCHandler{
+		oidc: oidc,
+		cfg:  cfg,
+		log:  log,
+	}
+}
+
+// @Summary OIDCProviders
+// @Tags auth
+// @Description Lists the external providers users can sign in with
+// @ID oidc-providers
+// @Produce  json
+// @Success 200 {object} response.SuccessResponse{data=models.OIDCProviders}
+// @Router /auth/oidc/providers [get]
+func (o *OIDCHandler) Providers(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		providers := o.oidc.Providers()
+		if providers == nil {
+			providers = []string{}
+		}
+
+		render.JSON(w, r, resp.SuccessResponse{
+			Status: http.StatusOK,
+			Data:   models.OIDCProviders{Providers: providers},
+		})
+	}
+}
+
+// @Summary OIDCLogin
+// @Tags auth
+// @Description Redirects to the sign in page of the provider, using the authorization code flow with PKCE
+// @ID oidc-login
+// @Param provider path string true "Provider name"
+// @Success 302
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 502 {object} response.ErrorResponse
+// @Router /auth/oidc/{provider}/login [get]
+func (o *OIDCHandler) Login(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.oidc.Login"
+
+		log := o.log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		authURL, err := o.oidc.Start(ctx, chi.URLParam(r, "provider"))
+		if err != nil {
+			if errors.Is(err, oidc.ErrUnknownProvider) {
+				render.Status(r, http.StatusNotFound)
+
+				render.JSON(w, r, resp.ErrorResponse{
+					Status: http.StatusNotFound,
+					Error:  "unknown provider",
+				})
+
+				return
+			}
+
+			log.Error("failed to start login", sl.Err(err))
+
+			render.Status(r, http.StatusBadGateway)
+
+			render.JSON(w, r, resp.ErrorResponse{
+				Status: http.StatusBadGateway,
+				Error:  "provider is unavailable",
+			})
+
+			return
+		}
+
+		http.Redirect(w, r, authURL, http.StatusFound)
+	}
+}
+
+// @Summary OIDCCallback
+// @Tags auth
+// @Description The provider redirects here after the sign in. Sets the token cookies and redirects to the client, to its two-factor page with a challenge when the account has a second factor, or to its login page with an error
+// @ID oidc-callback
+// @Param provider path string true "Provider name"
+// @Param code query string true "Authorization code"
+// @Param state query string true "State from the login redirect"
+// @Success 302
+// @Router /auth/oidc/{provider}/callback [get]
+func (o *OIDCHandler) Callback(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.oidc.Callback"
+
+		log := o.log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		query := r.URL.Query()
+
+		// The user declined or the provider failed, nothing to exchange.
+		if providerErr := query.Get("error"); providerErr != "" {
+			log.Warn("provider returned an error", slog.String("error", providerErr))
+
+			o.redirect(w, r, o.cfg.OIDC.ErrorURL, "error", "provider_error")
+
+			return
+		}
+
+		result, err := o.oidc.Complete(ctx, chi.URLParam(r, "provider"), query.Get("code"), query.Get("state"), requestmeta.FromRequest(r))
+		if err != nil {
+			log.Warn("login with provider failed", sl.Err(err))
+
+			o.redirect(w, r, o.cfg.OIDC.ErrorURL, "error", errorCode(err))
+
+			return
+		}
+
+		if result.Challenge != nil {
+			o.redirect(w, r, o.cfg.OIDC.TwoFactorURL, "challenge", result.Challenge.Challenge)
+
+			return
+		}
+
+		cookie.SetCookie(w, result.AccessToken, result.RefreshToken)
+
+		http.Redirect(w, r, o.cfg.OIDC.SuccessURL, http.StatusFound)
+	}
+}
+
+func (o *OIDCHandler) redirect(w http.ResponseWriter, r *http.Request, target string, key string, value string) {
+	separator := "?"
+	if strings.Contains(target, "?") {
+		separator = "&"
+	}
+
+	http.Redirect(w, r, target+separator+url.Values{key: {value}}.Encode(), http.StatusFound)
+}
+
+// errorCode is what the client is told, the details stay in the log.
+func errorCode(err error) string {
+	switch {
+	case errors.Is(err, oidc.ErrUnknownProvider):
+		return "unknown_provider"
+	case errors.Is(err, oidc.ErrInvalidState):
+		return "invalid_state"
+	case errors.Is(err, oidc.ErrProviderLogin):
+		return "provider_error"
+	case errors.Is(err, oidc.ErrEmailRequired):
+		return "email_required"
+	case errors.Is(err, oidc.ErrAccountExists):
+		return "account_exists"
+	case errors.Is(err, oidc.ErrEmailNotVerified):
+		return "email_not_verified"
+	case errors.Is(err, oidc.ErrDeactivated):
+		return "account_deactivated"
+	case errors.Is(err, oidc.ErrSuspended):
+		return "account_suspended"
+	default:
+		return "server_error"
+	}
+}
@@ -5,17 +5,59 @@ import (
 	"errors"
 	"log/slog"
 	"net/http"
+	"strconv"
+	"strings"
 
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
 	"github.com/go-chi/render"
+	"github.com/google/uuid"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/domain/models"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/http-server/handlers"
 	resp "github.com/sergey-frey/cchat/server/auth-service/internal/lib/api/response"
 	"github.com/sergey-frey/cchat/server/auth-service/internal/lib/cookie"
 	"github.com/sergey-frey/cchat/server/auth-service/internal/lib/jwt"
 	"github.com/sergey-frey/cchat/server/auth-service/internal/lib/logger/sl"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/lib/requestmeta"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/services/accesstoken"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/services/session"
 )
 
+type Session interface {
+	ValidateSession(ctx context.Context, sessionID uuid.UUID) (err error)
+	RotateRefreshToken(ctx context.Context, userID uuid.UUID, sessionID uuid.UUID, tokenID uuid.UUID, meta models.RequestMeta) (newTokenID uuid.UUID, user *models.NormalizedUser, err error)
+	Logout(ctx context.Context, userID uuid.UUID, sessionID uuid.UUID, meta models.RequestMeta) (err error)
+	ListSessions(ctx context.Context, userID uuid.UUID, currentSessionID uuid.UUID) (sessions []models.SessionInfo, err error)
+	RevokeUserSession(ctx context.Context, userID uuid.UUID, sessionID uuid.UUID, meta models.RequestMeta) (err error)
+	RevokeOtherSessions(ctx context.Context, userID uuid.UUID, currentSessionID uuid.UUID, meta models.RequestMeta) (revoked int64, err error)
+}
+
+// TokenAuthenticator resolves personal access tokens.
+type TokenAuthenticator interface {
+	Authenticate(ctx context.Context, token string) (user *models.NormalizedUser, err error)
+}
+
+type RevokeOthersResponse struct {
+	Revoked int64 `json:"revoked"`
+}
+
+type SessionHandler struct {
+	session Session
+	tokens  TokenAuthenticator
+	log     *slog.Logger
+}
+
+func New(session Session, tokens TokenAuthenticator, log *slog.Logger) *SessionHandler {
+	return &SessionHandler{
+		session: session,
+		tokens:  tokens,
+		log:     log,
+	}
+}
+
 // @Summary Session
 // @Tags auth
-// @Description Checks whether a cookie with a token is set
+// @Description Checks whether a cookie with a token is set, rotates the refresh token if the access token has expired
 // @ID check-session
 // @Accept  json
 // @Produce  json
@@ -24,19 +66,22 @@ import (
 // @Failure 500 {object} response.ErrorResponse
 // @Failure default {object} response.ErrorResponse
 // @Router /auth/session [post]
-func CheckSession(ctx context.Context, log *slog.Logger) http.HandlerFunc {
+func (s *SessionHandler) CheckSession(ctx context.Context) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		const op = "session.CheckSession"
+		const op = "handlers.session.CheckSession"
 
-		log = log.With(
+		log := s.log.With(
 			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
 		)
 
-		user, err := cookie.CheckCookie(w, r)
+		user, err := cookie.CheckCookie(ctx, w, r, s.session)
 		if err != nil {
 			if errors.Is(err, http.ErrNoCookie) || errors.Is(err, jwt.ErrUserUnauthorized) {
 				log.Warn("user unauthorized", sl.Err(err))
 
+				cookie.DeleteCookie(w)
+
 				render.Status(r, http.StatusUnauthorized)
 
 				render.JSON(w, r, resp.ErrorResponse{
@@ -68,25 +113,123 @@ func CheckSession(ctx context.Context, log *slog.Logger) http.HandlerFunc {
 	}
 }
 
+// @Summary Validate
+// @Tags internal
+// @Description Forward-auth endpoint for the gateway. Accepts the token cookies, a Bearer access token or a Bearer personal access token, returns the identity in X-User-Id, X-Username, X-Session-Id and X-User-Role headers. The scopes of a personal access token are returned in X-Token-Scopes. An expired access token in the cookie is refreshed and the new cookies are set on the response
+// @ID validate
+// @Success 200
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /internal/validate [get]
+func (s *SessionHandler) Validate(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.session.Validate"
+
+		log := s.log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		var (
+			user *models.NormalizedUser
+			err  error
+		)
+
+		// A Bearer token can not be refreshed here, the client has to
+		// go through /auth/session with its refresh token itself.
+		token, bearer := cookie.BearerToken(r)
+
+		switch {
+		case bearer && accesstoken.IsAccessToken(token):
+			user, err = s.tokens.Authenticate(ctx, token)
+		case bearer:
+			_, _, user, err = jwt.VerifyAccessToken(ctx, token, "", s.session, requestmeta.FromRequest(r))
+		default:
+			user, err = cookie.CheckCookie(ctx, w, r, s.session)
+		}
+
+		if err != nil {
+			if errors.Is(err, http.ErrNoCookie) || errors.Is(err, jwt.ErrUserUnauthorized) {
+				log.Debug("user unauthorized", sl.Err(err))
+
+				render.Status(r, http.StatusUnauthorized)
+
+				render.JSON(w, r, resp.ErrorResponse{
+					Status: http.StatusUnauthorized,
+					Error:  "user unauthorized",
+				})
+
+				return
+			}
+
+			log.Error("failed to validate request", sl.Err(err))
+
+			render.Status(r, http.StatusInternalServerError)
+
+			render.JSON(w, r, resp.ErrorResponse{
+				Status: http.StatusInternalServerError,
+				Error:  "internal error",
+			})
+
+			return
+		}
+
+		w.Header().Set("X-User-Id", user.UUID.String())
+		w.Header().Set("X-Username", user.Username)
+		w.Header().Set("X-Session-Id", user.SessionID.String())
+		w.Header().Set("X-Email-Verified", strconv.FormatBool(user.EmailVerified))
+		w.Header().Set("X-User-Role", user.Role)
+
+		if len(user.Scopes) > 0 {
+			w.Header().Set("X-Token-Scopes", strings.Join(user.Scopes, ","))
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
 // @Summary Logout
 // @Tags auth
-// @Description Terminates the user's session, deletes the cookie with the token
+// @Description Terminates the user's session on the server, deletes the cookie with the token
 // @ID finish-session
 // @Accept  json
 // @Produce  json
 // @Success 200 {object} response.SuccessResponse
+// @Failure 500 {object} response.ErrorResponse
 // @Failure default {object} response.ErrorResponse
 // @Router /auth/logout [post]
-func FinishSession(ctx context.Context, log *slog.Logger) http.HandlerFunc {
+func (s *SessionHandler) FinishSession(ctx context.Context) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		const op = "session.FinishSession"
+		const op = "handlers.session.FinishSession"
 
-		log = log.With(
-			"op", op,
+		log := s.log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
 		)
 
+		// A missing or broken refresh token has no session to revoke,
+		// the cookies are cleared either way.
+		if refreshCookie, err := r.Cookie("refresh_token"); err == nil {
+			if claims, err := jwt.ParseRefreshToken(refreshCookie.Value); err == nil {
+				if err := s.session.Logout(ctx, claims.UserID, claims.SessionID, requestmeta.FromRequest(r)); err != nil {
+					log.Error("failed to revoke session", sl.Err(err))
+
+					render.Status(r, http.StatusInternalServerError)
+
+					render.JSON(w, r, resp.ErrorResponse{
+						Status: http.StatusInternalServerError,
+						Error:  "failed to logout",
+					})
+
+					return
+				}
+			}
+		}
+
 		cookie.DeleteCookie(w)
 
+		log.Info("user logged out")
+
 		render.JSON(w, r, resp.SuccessResponse{
 			Status: http.StatusOK,
 			Data:   "success logout",
@@ -94,3 +237,177 @@ func FinishSession(ctx context.Context, log *slog.Logger) http.HandlerFunc {
 
 	}
 }
+
+// @Summary ListSessions
+// @Tags auth
+// @Description Returns the active sessions of the authenticated user, the session of the request is marked as current
+// @ID list-sessions
+// @Produce  json
+// @Success 200 {object} response.SuccessResponse
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Failure default {object} response.ErrorResponse
+// @Security CookieAuth
+// @Router /auth/sessions [get]
+func (s *SessionHandler) ListSessions(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.session.ListSessions"
+
+		log := s.log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		userInfo, err := cookie.TakeUserInfo(ctx, w, r, s.session)
+		if flag := handlers.HandleGettingCookie(w, r, err, log); !flag {
+			return
+		}
+
+		sessions, err := s.session.ListSessions(ctx, userInfo.UUID, userInfo.SessionID)
+		if err != nil {
+			log.Error("failed to get sessions", sl.Err(err))
+
+			render.Status(r, http.StatusInternalServerError)
+
+			render.JSON(w, r, resp.ErrorResponse{
+				Status: http.StatusInternalServerError,
+				Error:  "failed to get sessions",
+			})
+
+			return
+		}
+
+		log.Info("got sessions")
+
+		render.JSON(w, r, resp.SuccessResponse{
+			Status: http.StatusOK,
+			Data:   sessions,
+		})
+	}
+}
+
+// @Summary RevokeSession
+// @Tags auth
+// @Description Revokes one of the sessions of the authenticated user
+// @ID revoke-session
+// @Produce  json
+// @Param id path string true "Session ID"
+// @Success 200 {object} response.SuccessResponse
+// @Failure 400,401,404 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Failure default {object} response.ErrorResponse
+// @Security CookieAuth
+// @Router /auth/sessions/{id} [delete]
+func (s *SessionHandler) RevokeSession(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.session.RevokeSession"
+
+		log := s.log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		userInfo, err := cookie.TakeUserInfo(ctx, w, r, s.session)
+		if flag := handlers.HandleGettingCookie(w, r, err, log); !flag {
+			return
+		}
+
+		sessionID, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			log.Warn("invalid session id", sl.Err(err))
+
+			render.Status(r, http.StatusBadRequest)
+
+			render.JSON(w, r, resp.ErrorResponse{
+				Status: http.StatusBadRequest,
+				Error:  "invalid session id",
+			})
+
+			return
+		}
+
+		err = s.session.RevokeUserSession(ctx, userInfo.UUID, sessionID, requestmeta.FromRequest(r))
+		if err != nil {
+			if errors.Is(err, session.ErrSessionNotFound) {
+				render.Status(r, http.StatusNotFound)
+
+				render.JSON(w, r, resp.ErrorResponse{
+					Status: http.StatusNotFound,
+					Error:  "session not found",
+				})
+
+				return
+			}
+
+			log.Error("failed to revoke session", sl.Err(err))
+
+			render.Status(r, http.StatusInternalServerError)
+
+			render.JSON(w, r, resp.ErrorResponse{
+				Status: http.StatusInternalServerError,
+				Error:  "failed to revoke session",
+			})
+
+			return
+		}
+
+		if sessionID == userInfo.SessionID {
+			cookie.DeleteCookie(w)
+		}
+
+		log.Info("session revoked")
+
+		render.JSON(w, r, resp.SuccessResponse{
+			Status: http.StatusOK,
+			Data:   "session revoked",
+		})
+	}
+}
+
+// @Summary RevokeOtherSessions
+// @Tags auth
+// @Description Revokes every session of the authenticated user except the current one
+// @ID revoke-other-sessions
+// @Produce  json
+// @Success 200 {object} response.SuccessResponse
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Failure default {object} response.ErrorResponse
+// @Security CookieAuth
+// @Router /auth/sessions/revoke-others [post]
+func (s *SessionHandler) RevokeOtherSessions(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.session.RevokeOtherSessions"
+
+		log := s.log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		userInfo, err := cookie.TakeUserInfo(ctx, w, r, s.session)
+		if flag := handlers.HandleGettingCookie(w, r, err, log); !flag {
+			return
+		}
+
+		revoked, err := s.session.RevokeOtherSessions(ctx, userInfo.UUID, userInfo.SessionID, requestmeta.FromRequest(r))
+		if err != nil {
+			log.Error("failed to revoke sessions", sl.Err(err))
+
+			render.Status(r, http.StatusInternalServerError)
+
+			render.JSON(w, r, resp.ErrorResponse{
+				Status: http.StatusInternalServerError,
+				Error:  "failed to revoke sessions",
+			})
+
+			return
+		}
+
+		log.Info("other sessions revoked")
+
+		render.JSON(w, r, resp.SuccessResponse{
+			Status: http.StatusOK,
+			Data:   RevokeOthersResponse{Revoked: revoked},
+		})
+	}
+}
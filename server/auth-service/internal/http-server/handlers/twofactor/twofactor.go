@@ -0,0 +1,330 @@
+package twofactor
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/middleware"
+	"github.com/go-chi/render"
+	"github.com/google/uuid"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/domain/models"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/http-server/handlers"
+	resp "github.com/sergey-frey/cchat/server/auth-service/internal/lib/api/response"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/lib/cookie"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/lib/jwt"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/lib/logger/sl"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/lib/requestmeta"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/services/lockout"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/services/twofactor"
+)
+
+type TwoFactor interface {
+	Enroll(ctx context.Context, user models.NormalizedUser) (enrollment *models.TwoFactorEnrollment, err error)
+	Confirm(ctx context.Context, uid uuid.UUID, code models.TwoFactorCode, meta models.RequestMeta) (codes *models.RecoveryCodes, err error)
+	Disable(ctx context.Context, uid uuid.UUID, disable models.DisableTwoFactor, meta models.RequestMeta) (err error)
+	CompleteLogin(ctx context.Context, login models.TwoFactorLogin, meta models.RequestMeta) (user *models.NormalizedUser, accessToken string, refreshToken string, err error)
+}
+
+type TwoFactorHandler struct {
+	twoFactor TwoFactor
+	sessions  jwt.SessionStore
+	log       *slog.Logger
+}
+
+func New(twoFactor TwoFactor, sessions jwt.SessionStore, log *slog.Logger) *TwoFactorHandler {
+	return &TwoFactorHandler{
+		twoFactor: twoFactor,
+		sessions:  sessions,
+		log:       log,
+	}
+}
+
+// @Summary EnrollTwoFactor
+// @Tags auth
+// @Description Generates a TOTP secret for the authenticated user, returns it with an otpauth:// URI for authenticator apps
+// @ID enroll-two-factor
+// @Produce  json
+// @Success 200 {object} response.SuccessResponse
+// @Failure 401,409 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Failure default {object} response.ErrorResponse
+// @Security CookieAuth
+// @Router /auth/2fa/enroll [post]
+func (t *TwoFactorHandler) Enroll(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.twofactor.Enroll"
+
+		log := t.log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		userInfo, err := cookie.TakeUserInfo(ctx, w, r, t.sessions)
+		if flag := handlers.HandleGettingCookie(w, r, err, log); !flag {
+			return
+		}
+
+		enrollment, err := t.twoFactor.Enroll(ctx, *userInfo)
+		if err != nil {
+			if errors.Is(err, twofactor.ErrTwoFactorEnabled) {
+				render.Status(r, http.StatusConflict)
+
+				render.JSON(w, r, resp.ErrorResponse{
+					Status: http.StatusConflict,
+					Error:  "two-factor authentication already enabled",
+				})
+
+				return
+			}
+
+			render.Status(r, http.StatusInternalServerError)
+
+			render.JSON(w, r, resp.ErrorResponse{
+				Status: http.StatusInternalServerError,
+				Error:  "internal error",
+			})
+
+			return
+		}
+
+		render.JSON(w, r, resp.SuccessResponse{
+			Status: http.StatusOK,
+			Data:   enrollment,
+		})
+	}
+}
+
+// @Summary ConfirmTwoFactor
+// @Tags auth
+// @Description Enables two-factor authentication with the first code from the authenticator app, returns one-time recovery codes
+// @ID confirm-two-factor
+// @Accept  json
+// @Produce  json
+// @Param input body models.TwoFactorCode true "code from the authenticator app"
+// @Success 200 {object} response.SuccessResponse
+// @Failure 400,401,409 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Failure default {object} response.ErrorResponse
+// @Security CookieAuth
+// @Router /auth/2fa/confirm [post]
+func (t *TwoFactorHandler) Confirm(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.twofactor.Confirm"
+
+		log := t.log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		userInfo, err := cookie.TakeUserInfo(ctx, w, r, t.sessions)
+		if flag := handlers.HandleGettingCookie(w, r, err, log); !flag {
+			return
+		}
+
+		var req models.TwoFactorCode
+
+		err = render.Decode(r, &req)
+
+		if flag := handlers.HandleError(w, r, req, err, log); !flag {
+			return
+		}
+
+		codes, err := t.twoFactor.Confirm(ctx, userInfo.UUID, req, requestmeta.FromRequest(r))
+		if err != nil {
+			switch {
+			case errors.Is(err, twofactor.ErrInvalidCode):
+				render.Status(r, http.StatusBadRequest)
+
+				render.JSON(w, r, resp.ErrorResponse{
+					Status: http.StatusBadRequest,
+					Error:  "invalid code",
+				})
+			case errors.Is(err, twofactor.ErrTwoFactorEnabled), errors.Is(err, twofactor.ErrTwoFactorNotEnrolled):
+				render.Status(r, http.StatusConflict)
+
+				render.JSON(w, r, resp.ErrorResponse{
+					Status: http.StatusConflict,
+					Error:  "two-factor authentication is not awaiting confirmation",
+				})
+			default:
+				render.Status(r, http.StatusInternalServerError)
+
+				render.JSON(w, r, resp.ErrorResponse{
+					Status: http.StatusInternalServerError,
+					Error:  "internal error",
+				})
+			}
+
+			return
+		}
+
+		render.JSON(w, r, resp.SuccessResponse{
+			Status: http.StatusOK,
+			Data:   codes,
+		})
+	}
+}
+
+// @Summary DisableTwoFactor
+// @Tags auth
+// @Description Disables two-factor authentication, requires the password and a TOTP or recovery code
+// @ID disable-two-factor
+// @Accept  json
+// @Produce  json
+// @Param input body models.DisableTwoFactor true "password and code"
+// @Success 200 {object} response.SuccessResponse
+// @Failure 400,401,409 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Failure default {object} response.ErrorResponse
+// @Security CookieAuth
+// @Router /auth/2fa/disable [post]
+func (t *TwoFactorHandler) Disable(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.twofactor.Disable"
+
+		log := t.log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		userInfo, err := cookie.TakeUserInfo(ctx, w, r, t.sessions)
+		if flag := handlers.HandleGettingCookie(w, r, err, log); !flag {
+			return
+		}
+
+		var req models.DisableTwoFactor
+
+		err = render.Decode(r, &req)
+
+		if flag := handlers.HandleError(w, r, req, err, log); !flag {
+			return
+		}
+
+		err = t.twoFactor.Disable(ctx, userInfo.UUID, req, requestmeta.FromRequest(r))
+		if err != nil {
+			switch {
+			case errors.Is(err, twofactor.ErrInvalidCode), errors.Is(err, twofactor.ErrInvalidCredentials):
+				render.Status(r, http.StatusBadRequest)
+
+				render.JSON(w, r, resp.ErrorResponse{
+					Status: http.StatusBadRequest,
+					Error:  "invalid password or code",
+				})
+			case errors.Is(err, twofactor.ErrTwoFactorDisabled):
+				render.Status(r, http.StatusConflict)
+
+				render.JSON(w, r, resp.ErrorResponse{
+					Status: http.StatusConflict,
+					Error:  "two-factor authentication is not enabled",
+				})
+			default:
+				render.Status(r, http.StatusInternalServerError)
+
+				render.JSON(w, r, resp.ErrorResponse{
+					Status: http.StatusInternalServerError,
+					Error:  "internal error",
+				})
+			}
+
+			return
+		}
+
+		log.Info("two-factor authentication disabled")
+
+		render.JSON(w, r, resp.SuccessResponse{
+			Status: http.StatusOK,
+			Data:   "two-factor authentication disabled",
+		})
+	}
+}
+
+// @Summary LoginTwoFactor
+// @Tags auth
+// @Description Completes a login that returned a challenge, accepts a TOTP code or one of the recovery codes
+// @ID login-two-factor
+// @Accept  json
+// @Produce  json
+// @Param input body models.TwoFactorLogin true "login challenge and code"
+// @Success 200 {object} response.SuccessResponse
+// @Failure 400,401,403,429 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Failure default {object} response.ErrorResponse
+// @Router /auth/login/2fa [post]
+func (t *TwoFactorHandler) Login(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.twofactor.Login"
+
+		log := t.log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		var req models.TwoFactorLogin
+
+		err := render.Decode(r, &req)
+
+		if flag := handlers.HandleError(w, r, req, err, log); !flag {
+			return
+		}
+
+		user, accessToken, refreshToken, err := t.twoFactor.CompleteLogin(ctx, req, requestmeta.FromRequest(r))
+		if err != nil {
+			var blocked *lockout.BlockedError
+
+			switch {
+			case errors.Is(err, twofactor.ErrInvalidCode):
+				render.Status(r, http.StatusBadRequest)
+
+				render.JSON(w, r, resp.ErrorResponse{
+					Status: http.StatusBadRequest,
+					Error:  "invalid code",
+				})
+			case errors.Is(err, twofactor.ErrInvalidChallenge), errors.Is(err, twofactor.ErrTwoFactorDisabled):
+				render.Status(r, http.StatusUnauthorized)
+
+				render.JSON(w, r, resp.ErrorResponse{
+					Status: http.StatusUnauthorized,
+					Error:  "invalid or expired login challenge",
+				})
+			case errors.As(err, &blocked):
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(blocked.RetryAfter.Seconds()))))
+
+				render.Status(r, http.StatusTooManyRequests)
+
+				render.JSON(w, r, resp.ErrorResponse{
+					Status: http.StatusTooManyRequests,
+					Error:  "too many failed login attempts, try again later",
+				})
+			case errors.Is(err, twofactor.ErrAccountSuspended):
+				render.Status(r, http.StatusForbidden)
+
+				render.JSON(w, r, resp.ErrorResponse{
+					Status: http.StatusForbidden,
+					Error:  "account is suspended",
+				})
+			default:
+				log.Error("failed to complete login", sl.Err(err))
+
+				render.Status(r, http.StatusInternalServerError)
+
+				render.JSON(w, r, resp.ErrorResponse{
+					Status: http.StatusInternalServerError,
+					Error:  "internal error",
+				})
+			}
+
+			return
+		}
+
+		cookie.SetCookie(w, accessToken, refreshToken)
+
+		render.JSON(w, r, resp.SuccessResponse{
+			Status: http.StatusOK,
+			Data:   user,
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package jwtcheck
+
+import (
+	"context"
+	"net/http"
+	"slices"
+
+	"github.com/go-chi/render"
+	resp "github.com/sergey-frey/cchat/server/auth-service/internal/lib/api/response"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/lib/cookie"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/lib/identity"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/lib/jwt"
+)
+
+// JWTCheck authenticates the request the same way the handlers do with
+// cookie.TakeUserInfo and stores the user for the handlers behind it.
+func JWTCheck(ctx context.Context, sessions jwt.SessionStore) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, err := cookie.TakeUserInfo(ctx, w, r, sessions)
+			if err != nil || user == nil {
+				render.Status(r, http.StatusUnauthorized)
+
+				render.JSON(w, r, resp.ErrorResponse{
+					Status: http.StatusUnauthorized,
+					Error:  "user unauthorized",
+				})
+
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(identity.WithUser(r.Context(), user)))
+		})
+	}
+}
+
+// RequireRole lets through users with one of the roles. It expects
+// JWTCheck to run before it.
+func RequireRole(roles ...string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, ok := identity.User(r.Context())
+			if !ok {
+				render.Status(r, http.StatusUnauthorized)
+
+				render.JSON(w, r, resp.ErrorResponse{
+					Status: http.StatusUnauthorized,
+					Error:  "user unauthorized",
+				})
+
+				return
+			}
+
+			if !slices.Contains(roles, user.Role) {
+				render.Status(r, http.StatusForbidden)
+
+				render.JSON(w, r, resp.ErrorResponse{
+					Status: http.StatusForbidden,
+					Error:  "access denied",
+				})
+
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
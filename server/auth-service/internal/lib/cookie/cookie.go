@@ -1,16 +1,31 @@
 package cookie
 
 import (
+	"context"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/sergey-frey/cchat/server/auth-service/internal/domain/models"
 	"github.com/sergey-frey/cchat/server/auth-service/internal/lib/jwt"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/lib/requestmeta"
 )
 
-func TakeUserInfo(w http.ResponseWriter, r *http.Request) (*models.NormalizedUser, error) {
-	user, err := CheckCookie(w, r)
+// TakeUserInfo authenticates the request by a Bearer access token or,
+// without one, by the token cookies. Personal access tokens are not
+// accepted here, they can not manage the account they belong to.
+func TakeUserInfo(ctx context.Context, w http.ResponseWriter, r *http.Request, sessions jwt.SessionStore) (*models.NormalizedUser, error) {
+	if token, ok := BearerToken(r); ok {
+		_, _, user, err := jwt.VerifyAccessToken(ctx, token, "", sessions, requestmeta.FromRequest(r))
+		if err != nil {
+			return nil, fmt.Errorf("error with token: %w", err)
+		}
+
+		return user, nil
+	}
+
+	user, err := CheckCookie(ctx, w, r, sessions)
 	if err != nil {
 		return nil, fmt.Errorf("error with taking cookie")
 	}
@@ -38,7 +53,7 @@ func SetCookie(w http.ResponseWriter, accessToken string, refreshToken string) {
 	http.SetCookie(w, cookie2)
 }
 
-func CheckCookie(w http.ResponseWriter, r *http.Request) (*models.NormalizedUser, error) {
+func CheckCookie(ctx context.Context, w http.ResponseWriter, r *http.Request, sessions jwt.SessionStore) (*models.NormalizedUser, error) {
 	accessCookie, err := r.Cookie("access_token")
 	if err != nil {
 		return HandlerError(err)
@@ -51,7 +66,7 @@ func CheckCookie(w http.ResponseWriter, r *http.Request) (*models.NormalizedUser
 
 	accessToken, refreshToken := accessCookie.Value, refreshCookie.Value
 
-	accessToken, refreshToken, user, err := jwt.VerifyAccessToken(accessToken, refreshToken)
+	accessToken, refreshToken, user, err := jwt.VerifyAccessToken(ctx, accessToken, refreshToken, sessions, requestmeta.FromRequest(r))
 	if err != nil {
 		return nil, fmt.Errorf("error with token: %w", err)
 	}
@@ -63,6 +78,38 @@ func CheckCookie(w http.ResponseWriter, r *http.Request) (*models.NormalizedUser
 	return user, nil
 }
 
+// RefreshCookie replaces the token pair of the request with a freshly rotated one.
+func RefreshCookie(ctx context.Context, w http.ResponseWriter, r *http.Request, sessions jwt.SessionStore) (*models.NormalizedUser, error) {
+	accessCookie, err := r.Cookie("access_token")
+	if err != nil {
+		return HandlerError(err)
+	}
+
+	refreshCookie, err := r.Cookie("refresh_token")
+	if err != nil {
+		return HandlerError(err)
+	}
+
+	accessToken, refreshToken, user, err := jwt.ReissueTokens(ctx, accessCookie.Value, refreshCookie.Value, sessions, requestmeta.FromRequest(r))
+	if err != nil {
+		return nil, fmt.Errorf("error with token: %w", err)
+	}
+
+	SetCookie(w, accessToken, refreshToken)
+
+	return user, nil
+}
+
+// BearerToken returns the access token of an "Authorization: Bearer" header.
+func BearerToken(r *http.Request) (string, bool) {
+	scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return "", false
+	}
+
+	return token, true
+}
+
 func DeleteCookie(w http.ResponseWriter) {
 	cookie := &http.Cookie{
 		Name:     "access_token",
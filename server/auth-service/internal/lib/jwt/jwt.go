@@ -1,6 +1,7 @@
 package jwt
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"time"
@@ -12,33 +13,52 @@ import (
 
 const (
 	accessDuration  = 15 * time.Minute
-	refreshDuration = 43200 * time.Minute
+	RefreshDuration = 43200 * time.Minute
+
+	// Both token types are signed with the same keys, typ keeps
+	// a refresh token from being accepted as an access token.
+	accessType  = "access"
+	refreshType = "refresh"
 )
 
 var (
 	ErrUserUnauthorized = errors.New("user unauthorized")
 )
 
-func NewPairTokens(user models.NormalizedUser) (string, string, error) {
-	accessToken := jwt.New(jwt.SigningMethodHS256)
+// SessionStore is the server-side state behind refresh tokens.
+type SessionStore interface {
+	ValidateSession(ctx context.Context, sessionID uuid.UUID) error
+	RotateRefreshToken(ctx context.Context, userID uuid.UUID, sessionID uuid.UUID, tokenID uuid.UUID, meta models.RequestMeta) (newTokenID uuid.UUID, user *models.NormalizedUser, err error)
+}
 
-	claims := accessToken.Claims.(jwt.MapClaims)
-	claims["uuid"] = user.UUID
-	claims["username"] = user.Username
-	claims["email"] = user.Email
-	claims["exp"] = time.Now().Add(accessDuration).Unix()
+type RefreshClaims struct {
+	UserID    uuid.UUID
+	SessionID uuid.UUID
+	TokenID   uuid.UUID
+}
 
-	accessTokenString, err := accessToken.SignedString([]byte("somesecret"))
+func NewPairTokens(user models.NormalizedUser, sessionID uuid.UUID, tokenID uuid.UUID) (string, string, error) {
+	accessTokenString, err := keys.sign(jwt.MapClaims{
+		"typ":            accessType,
+		"uuid":           user.UUID,
+		"username":       user.Username,
+		"email":          user.Email,
+		"email_verified": user.EmailVerified,
+		"role":           user.Role,
+		"sid":            sessionID,
+		"exp":            time.Now().Add(accessDuration).Unix(),
+	})
 	if err != nil {
 		return "", "", err
 	}
 
-	refreshToken := jwt.New(jwt.SigningMethodHS256)
-
-	claims = refreshToken.Claims.(jwt.MapClaims)
-	claims["exp"] = time.Now().Add(refreshDuration).Unix()
-
-	refreshTokenString, err := refreshToken.SignedString([]byte("secret"))
+	refreshTokenString, err := keys.sign(jwt.MapClaims{
+		"typ": refreshType,
+		"sub": user.UUID,
+		"sid": sessionID,
+		"jti": tokenID,
+		"exp": time.Now().Add(RefreshDuration).Unix(),
+	})
 	if err != nil {
 		return "", "", err
 	}
@@ -47,65 +67,124 @@ func NewPairTokens(user models.NormalizedUser) (string, string, error) {
 
 }
 
-func VerifyAccessToken(accessToken string, refreshToken string) (string, string, *models.NormalizedUser, error) {
+func VerifyAccessToken(ctx context.Context, accessToken string, refreshToken string, sessions SessionStore, meta models.RequestMeta) (string, string, *models.NormalizedUser, error) {
 	claims := &jwt.MapClaims{}
 
-	accesstoken, err := jwt.ParseWithClaims(accessToken, claims, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte("somesecret"), nil
-	})
+	accesstoken, err := jwt.ParseWithClaims(accessToken, claims, keys.keyFunc)
+
+	if (*claims)["typ"] != accessType {
+		return "", "", nil, ErrUserUnauthorized
+	}
 
 	if err != nil || !accesstoken.Valid {
+		// An expired access token is only trusted for the identity it carries,
+		// the refresh token decides whether the session may continue.
+		if !errors.Is(err, jwt.ErrTokenExpired) {
+			return "", "", nil, ErrUserUnauthorized
+		}
 
 		user, userErr := extractUserFromClaims(*claims)
 		if userErr != nil {
 			return "", "", nil, ErrUserUnauthorized
 		}
-		
-		return VerifyRefreshToken(*user, refreshToken)
+
+		return VerifyRefreshToken(ctx, *user, refreshToken, sessions, meta)
 	}
 
 	user, userErr := extractUserFromClaims(*claims)
 	if userErr != nil {
-		return "", "", nil, userErr
+		return "", "", nil, ErrUserUnauthorized
+	}
+
+	if err := sessions.ValidateSession(ctx, user.SessionID); err != nil {
+		return "", "", nil, err
 	}
 
 	return "", "", user, nil
 }
 
-func VerifyRefreshToken(user models.NormalizedUser, refreshToken string) (string, string, *models.NormalizedUser, error) {
+// VerifyRefreshToken rotates the refresh token on every use. The presented
+// token is consumed and a new pair bound to the same session is returned,
+// its claims are taken from the current account and profile rather than
+// from the old access token.
+func VerifyRefreshToken(ctx context.Context, user models.NormalizedUser, refreshToken string, sessions SessionStore, meta models.RequestMeta) (string, string, *models.NormalizedUser, error) {
+	claims, err := ParseRefreshToken(refreshToken)
+	if err != nil {
+		return "", "", nil, err
+	}
 
-	refreshtoken, err := jwt.Parse(refreshToken, func(token *jwt.Token) (any, error) {
-		return []byte("secret"), nil
-	})
+	if claims.UserID != user.UUID || claims.SessionID != user.SessionID {
+		return "", "", nil, ErrUserUnauthorized
+	}
 
+	newTokenID, current, err := sessions.RotateRefreshToken(ctx, claims.UserID, claims.SessionID, claims.TokenID, meta)
 	if err != nil {
 		return "", "", nil, err
 	}
-    
-	if !refreshtoken.Valid {
+
+	newAccessToken, newRefreshToken, err := NewPairTokens(*current, claims.SessionID, newTokenID)
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	return newAccessToken, newRefreshToken, current, nil
+}
+
+// ReissueTokens rotates the refresh token even though the access token is
+// still valid. It is used after the account state behind the claims changes.
+func ReissueTokens(ctx context.Context, accessToken string, refreshToken string, sessions SessionStore, meta models.RequestMeta) (string, string, *models.NormalizedUser, error) {
+	claims := jwt.MapClaims{}
+
+	_, err := jwt.ParseWithClaims(accessToken, claims, keys.keyFunc, jwt.WithoutClaimsValidation())
+	if err != nil || claims["typ"] != accessType {
+		return "", "", nil, ErrUserUnauthorized
+	}
+
+	user, err := extractUserFromClaims(claims)
+	if err != nil {
 		return "", "", nil, ErrUserUnauthorized
 	}
-    
-	newAccessToken, newRefreshToken, err := NewPairTokens(user)
+
+	return VerifyRefreshToken(ctx, *user, refreshToken, sessions, meta)
+}
+
+// ParseRefreshToken checks the signature and expiry of a refresh token
+// and returns the session it belongs to.
+func ParseRefreshToken(refreshToken string) (*RefreshClaims, error) {
+	claims := jwt.MapClaims{}
+
+	refreshtoken, err := jwt.ParseWithClaims(refreshToken, claims, keys.keyFunc)
+
+	if err != nil || !refreshtoken.Valid || claims["typ"] != refreshType {
+		return nil, ErrUserUnauthorized
+	}
+
+	userID, err := uuidClaim(claims, "sub")
 	if err != nil {
-		return "", "", nil, err
+		return nil, ErrUserUnauthorized
+	}
+
+	sessionID, err := uuidClaim(claims, "sid")
+	if err != nil {
+		return nil, ErrUserUnauthorized
+	}
+
+	tokenID, err := uuidClaim(claims, "jti")
+	if err != nil {
+		return nil, ErrUserUnauthorized
 	}
 
-	return newAccessToken, newRefreshToken, &user, nil
+	return &RefreshClaims{
+		UserID:    userID,
+		SessionID: sessionID,
+		TokenID:   tokenID,
+	}, nil
 }
 
 func extractUserFromClaims(claims jwt.MapClaims) (*models.NormalizedUser, error) {
-	uuidStr, ok := claims["uuid"].(string)
-	if !ok {
-		return nil, errors.New("missing or invalid 'uuid' in token claims")
-	}
-	
-	userUUID, err := uuid.Parse(uuidStr)
+	userUUID, err := uuidClaim(claims, "uuid")
 	if err != nil {
-		return nil, errors.New("failed to parse 'uuid' from token claims")
+		return nil, err
 	}
 
 	username, ok := claims["username"].(string)
@@ -118,9 +197,40 @@ func extractUserFromClaims(claims jwt.MapClaims) (*models.NormalizedUser, error)
 		return nil, errors.New("missing or invalid 'email' in token claims")
 	}
 
+	// Tokens issued before verification existed have no such claim.
+	emailVerified, _ := claims["email_verified"].(bool)
+
+	// Same for roles, such tokens act as a plain user.
+	role, ok := claims["role"].(string)
+	if !ok || role == "" {
+		role = models.RoleUser
+	}
+
+	sessionID, err := uuidClaim(claims, "sid")
+	if err != nil {
+		return nil, err
+	}
+
 	return &models.NormalizedUser{
-		UUID:     userUUID,
-		Username: username,
-		Email:    email,
+		UUID:          userUUID,
+		Username:      username,
+		Email:         email,
+		EmailVerified: emailVerified,
+		Role:          role,
+		SessionID:     sessionID,
 	}, nil
 }
+
+func uuidClaim(claims jwt.MapClaims, name string) (uuid.UUID, error) {
+	value, ok := claims[name].(string)
+	if !ok {
+		return uuid.Nil, fmt.Errorf("missing or invalid '%s' in token claims", name)
+	}
+
+	id, err := uuid.Parse(value)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to parse '%s' from token claims", name)
+	}
+
+	return id, nil
+}
@@ -0,0 +1,228 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrNoSigningKey = errors.New("no signing key")
+	ErrUnknownKey   = errors.New("unknown signing key")
+)
+
+// Key is one of the asymmetric keys tokens are signed with. Keys loaded
+// from a public key file are only used to verify tokens issued before
+// a rotation.
+type Key struct {
+	ID      string
+	Method  jwt.SigningMethod
+	Private crypto.Signer
+	Public  crypto.PublicKey
+}
+
+type KeySet struct {
+	active *Key
+	keys   map[string]*Key
+}
+
+// KeyFile points to a PEM encoded key. The algorithm is derived
+// from the key type: RSA keys sign with RS256, Ed25519 keys with EdDSA.
+type KeyFile struct {
+	ID   string
+	Path string
+}
+
+// keys is set once at startup, before the server accepts requests.
+var keys *KeySet
+
+func UseKeySet(keySet *KeySet) {
+	keys = keySet
+}
+
+func LoadKeySet(files []KeyFile, activeID string) (*KeySet, error) {
+	keySet := &KeySet{
+		keys: make(map[string]*Key, len(files)),
+	}
+
+	for _, file := range files {
+		data, err := os.ReadFile(file.Path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read key %q: %w", file.ID, err)
+		}
+
+		key, err := parseKey(file.ID, data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse key %q: %w", file.ID, err)
+		}
+
+		keySet.keys[key.ID] = key
+	}
+
+	active, ok := keySet.keys[activeID]
+	if !ok || active.Private == nil {
+		return nil, fmt.Errorf("active key %q: %w", activeID, ErrNoSigningKey)
+	}
+
+	keySet.active = active
+
+	return keySet, nil
+}
+
+// GenerateKeySet creates a throwaway Ed25519 key. Tokens signed with it
+// do not survive a restart, so it is only meant for local development.
+func GenerateKeySet() (*KeySet, error) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+
+	key := &Key{
+		ID:      "ephemeral",
+		Method:  jwt.SigningMethodEdDSA,
+		Private: private,
+		Public:  public,
+	}
+
+	return &KeySet{
+		active: key,
+		keys:   map[string]*Key{key.ID: key},
+	}, nil
+}
+
+func (k *KeySet) sign(claims jwt.MapClaims) (string, error) {
+	if k == nil || k.active == nil {
+		return "", ErrNoSigningKey
+	}
+
+	token := jwt.NewWithClaims(k.active.Method, claims)
+	token.Header["kid"] = k.active.ID
+
+	return token.SignedString(k.active.Private)
+}
+
+// keyFunc picks the verification key by the kid header and refuses
+// tokens whose algorithm does not belong to that key.
+func (k *KeySet) keyFunc(token *jwt.Token) (interface{}, error) {
+	if k == nil {
+		return nil, ErrNoSigningKey
+	}
+
+	kid, _ := token.Header["kid"].(string)
+
+	key, ok := k.keys[kid]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+
+	return key.Public, nil
+}
+
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// PublicJWKS returns the public part of every key, including the retired ones.
+func PublicJWKS() JWKS {
+	jwks := JWKS{Keys: make([]JWK, 0)}
+
+	if keys == nil {
+		return jwks
+	}
+
+	for _, key := range keys.keys {
+		jwk := JWK{
+			Kid: key.ID,
+			Use: "sig",
+			Alg: key.Method.Alg(),
+		}
+
+		switch public := key.Public.(type) {
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		default:
+			continue
+		}
+
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+
+	sort.Slice(jwks.Keys, func(i, j int) bool {
+		return jwks.Keys[i].Kid < jwks.Keys[j].Kid
+	})
+
+	return jwks
+}
+
+func parseKey(id string, data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	var parsed any
+	var err error
+
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	key := &Key{ID: id}
+
+	switch k := parsed.(type) {
+	case ed25519.PrivateKey:
+		key.Method, key.Private, key.Public = jwt.SigningMethodEdDSA, k, k.Public()
+	case *rsa.PrivateKey:
+		key.Method, key.Private, key.Public = jwt.SigningMethodRS256, k, k.Public()
+	case ed25519.PublicKey:
+		key.Method, key.Public = jwt.SigningMethodEdDSA, k
+	case *rsa.PublicKey:
+		key.Method, key.Public = jwt.SigningMethodRS256, k
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", parsed)
+	}
+
+	return key, nil
+}
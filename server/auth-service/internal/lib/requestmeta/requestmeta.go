@@ -0,0 +1,95 @@
+package requestmeta
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/middleware"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/domain/models"
+)
+
+// trusted are the networks of the gateway, only requests coming from
+// there may name the client in forwarded headers.
+var trusted []*net.IPNet
+
+// TrustNetworks sets the networks whose forwarded headers are believed.
+// Without any the peer address is always the client.
+func TrustNetworks(cidrs []string) error {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return fmt.Errorf("invalid trusted network %q: %w", cidr, err)
+		}
+
+		networks = append(networks, network)
+	}
+
+	trusted = networks
+
+	return nil
+}
+
+// FromRequest collects the client information that is stored with sessions.
+// Behind the nginx gateway the real address comes in X-Forwarded-For or X-Real-IP.
+func FromRequest(r *http.Request) models.RequestMeta {
+	return models.RequestMeta{
+		IP:        clientIP(r),
+		UserAgent: r.UserAgent(),
+		RequestID: middleware.GetReqID(r.Context()),
+	}
+}
+
+// clientIP believes the forwarded headers only when the request came from
+// the gateway. The gateway appends the peer it saw to X-Forwarded-For, so
+// the list is walked from the end and the first hop that is not a trusted
+// proxy is the client, whatever the client put in front of it.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	if !isTrusted(host) {
+		return host
+	}
+
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		hops := strings.Split(forwarded, ",")
+
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			if net.ParseIP(hop) == nil {
+				break
+			}
+
+			if !isTrusted(hop) || i == 0 {
+				return hop
+			}
+		}
+	}
+
+	if realIP := strings.TrimSpace(r.Header.Get("X-Real-IP")); net.ParseIP(realIP) != nil {
+		return realIP
+	}
+
+	return host
+}
+
+func isTrusted(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+
+	for _, network := range trusted {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,29 @@
+package token
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+)
+
+const size = 32
+
+// New returns a random url-safe token and the hash that is stored instead of it.
+func New() (string, []byte, error) {
+	raw := make([]byte, size)
+
+	if _, err := rand.Read(raw); err != nil {
+		return "", nil, fmt.Errorf("failed to generate token: %w", err)
+	}
+
+	plain := base64.RawURLEncoding.EncodeToString(raw)
+
+	return plain, Hash(plain), nil
+}
+
+func Hash(plain string) []byte {
+	sum := sha256.Sum256([]byte(plain))
+
+	return sum[:]
+}
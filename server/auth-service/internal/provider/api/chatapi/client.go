@@ -0,0 +1,97 @@
+package chatapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+// serviceTokenHeader carries the token chat-service expects on its internal
+// routes.
+const serviceTokenHeader = "X-Service-Token"
+
+type Client struct {
+	httpClient *http.Client
+	baseURL    string
+	token      string
+	log        *slog.Logger
+}
+
+// NewClient takes the service token shared with chat-service, both calls
+// go to its internal routes.
+func NewClient(httpClient *http.Client, baseURL string, token string, log *slog.Logger) *Client {
+	return &Client{
+		httpClient: httpClient,
+		baseURL:    baseURL,
+		token:      token,
+		log:        log,
+	}
+}
+
+// EraseUser removes the user from every chat, a user without chats is fine.
+func (c *Client) EraseUser(ctx context.Context, uid uuid.UUID) error {
+	const op = "api.chatapi.client.EraseUser"
+
+	endpoint := fmt.Sprintf("%s/internal/users/%s/chats", c.baseURL, uid)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, endpoint, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	req.Header.Set(serviceTokenHeader, c.token)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: unexpected status code %d", op, resp.StatusCode)
+	}
+
+	return nil
+}
+
+type dataResponse struct {
+	Status int             `json:"status"`
+	Data   json.RawMessage `json:"data"`
+}
+
+// ExportUser returns the chats the user is a member of.
+func (c *Client) ExportUser(ctx context.Context, uid uuid.UUID) (json.RawMessage, error) {
+	const op = "api.chatapi.client.ExportUser"
+
+	endpoint := fmt.Sprintf("%s/internal/users/%s/chats/export", c.baseURL, uid)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	req.Header.Set(serviceTokenHeader, c.token)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: unexpected status code %d", op, resp.StatusCode)
+	}
+
+	var body dataResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return body.Data, nil
+}
@@ -9,12 +9,15 @@ import (
 	"net/http"
 	"net/url"
 
+	"github.com/google/uuid"
 	"github.com/sergey-frey/cchat/server/auth-service/internal/domain/models"
+	storage "github.com/sergey-frey/cchat/server/auth-service/internal/provider"
 )
 
 var (
 	ErrUserExists = fmt.Errorf("user already exists")
-	ErrUserNotFound = fmt.Errorf("user not found")
+	// The services match the storage sentinel, whichever provider answered.
+	ErrUserNotFound = storage.ErrUserNotFound
 )
 
 type NormalizedUserResponse struct {
@@ -26,16 +29,24 @@ type EmailOfUser struct {
 	Email string `json:"email"`
 }
 
+// serviceTokenHeader carries the token user-service expects on its
+// internal routes.
+const serviceTokenHeader = "X-Service-Token"
+
 type Client struct {
 	httpClient *http.Client
 	baseURL    string
+	token      string
 	log *slog.Logger
 }
 
-func NewClient(httpClient *http.Client, baseURL string, log *slog.Logger) *Client {
+// NewClient takes the base URL of user-service and the service token
+// shared with it, every call goes to an internal route that requires it.
+func NewClient(httpClient *http.Client, baseURL string, token string, log *slog.Logger) *Client {
 	return &Client{
 		httpClient: httpClient,
 		baseURL:    baseURL,
+		token:      token,
 		log: log,
 	}
 }
@@ -54,14 +65,14 @@ func (c *Client) GetUser(ctx context.Context, email string) (*models.NormalizedU
 
 	log.Info("email:")
 
-	endpoint := fmt.Sprintf("http://users-service-1:8080/users/?%s", param.Encode())
+	endpoint := fmt.Sprintf("%s/internal/users?%s", c.baseURL, param.Encode())
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	// req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(serviceTokenHeader, c.token)
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
@@ -86,6 +97,43 @@ func (c *Client) GetUser(ctx context.Context, email string) (*models.NormalizedU
 	return &user.Data, nil
 }
 
+// UserByID looks the user up on the internal route of user-service, it
+// answers with the current email and username.
+func (c *Client) UserByID(ctx context.Context, uid uuid.UUID) (*models.NormalizedUser, error) {
+	const op = "api.userapi.client.UserByID"
+
+	endpoint := fmt.Sprintf("%s/internal/users/%s", c.baseURL, uid)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	req.Header.Set(serviceTokenHeader, c.token)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, fmt.Errorf("%s: %w", op, ErrUserNotFound)
+		}
+
+		return nil, fmt.Errorf("%s: unexpected status code %d", op, resp.StatusCode)
+	}
+
+	var user NormalizedUserResponse
+	if err := json.NewDecoder(resp.Body).Decode(&user); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &user.Data, nil
+}
+
 func (c *Client) CreateUser(ctx context.Context, email string) (*models.NormalizedUser, error) {
 	const op = "api.userapi.client.CreateUser"
 
@@ -98,7 +146,7 @@ func (c *Client) CreateUser(ctx context.Context, email string) (*models.Normaliz
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	endpoint := fmt.Sprintf("http://users-service-1:8080/users/")
+	endpoint := fmt.Sprintf("%s/internal/users", c.baseURL)
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewBuffer(requestBody))
 	if err != nil {
@@ -106,6 +154,7 @@ func (c *Client) CreateUser(ctx context.Context, email string) (*models.Normaliz
 	}
 
 	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(serviceTokenHeader, c.token)
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
@@ -128,4 +177,70 @@ func (c *Client) CreateUser(ctx context.Context, email string) (*models.Normaliz
 	}
 
 	return &newUser.Data, nil
-}
\ No newline at end of file
+}
+
+// EraseUser anonymizes the profile, a user that is already gone is fine.
+func (c *Client) EraseUser(ctx context.Context, uid uuid.UUID) error {
+	const op = "api.userapi.client.EraseUser"
+
+	endpoint := fmt.Sprintf("%s/internal/users/%s", c.baseURL, uid)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, endpoint, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	req.Header.Set(serviceTokenHeader, c.token)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: unexpected status code %d", op, resp.StatusCode)
+	}
+
+	return nil
+}
+
+// dataResponse is the envelope of the export routes, data is kept as it
+// came so it goes into the archive unchanged.
+type dataResponse struct {
+	Status int             `json:"status"`
+	Data   json.RawMessage `json:"data"`
+}
+
+// ExportUser returns the profile, privacy settings, username history, contacts and blocks of the user.
+func (c *Client) ExportUser(ctx context.Context, uid uuid.UUID) (json.RawMessage, error) {
+	const op = "api.userapi.client.ExportUser"
+
+	endpoint := fmt.Sprintf("%s/internal/users/%s/export", c.baseURL, uid)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	req.Header.Set(serviceTokenHeader, c.token)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: unexpected status code %d", op, resp.StatusCode)
+	}
+
+	var body dataResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return body.Data, nil
+}
@@ -0,0 +1,57 @@
+package file
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sergey-frey/cchat/server/auth-service/internal/domain/models"
+)
+
+// Mailer writes every mail into a directory and the log instead of sending it.
+// It is meant for local development and tests.
+type Mailer struct {
+	dir  string
+	from string
+	log  *slog.Logger
+}
+
+func New(dir string, from string, log *slog.Logger) *Mailer {
+	return &Mailer{
+		dir:  dir,
+		from: from,
+		log:  log,
+	}
+}
+
+func (m *Mailer) Send(ctx context.Context, mail models.Mail) error {
+	const op = "mailer.file.Send"
+
+	m.log.Info("mail sent",
+		slog.String("op", op),
+		slog.String("to", mail.To),
+		slog.String("subject", mail.Subject),
+		slog.String("body", mail.Body),
+	)
+
+	if m.dir == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(m.dir, 0o755); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	name := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), strings.ReplaceAll(mail.To, "@", "_at_"))
+	content := fmt.Sprintf("From: %s\nTo: %s\nSubject: %s\n\n%s\n", m.from, mail.To, mail.Subject, mail.Body)
+
+	if err := os.WriteFile(filepath.Join(m.dir, name), []byte(content), 0o644); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
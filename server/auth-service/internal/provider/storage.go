@@ -11,4 +11,22 @@ var (
 	ErrFailedToCreateChat     = errors.New("failed to create new chat")
 	ErrFailedToAddUsersInChat = errors.New("failed to add users in chat")
 	ErrChatsNotFound          = errors.New("chats not found")
+	ErrSessionNotFound        = errors.New("session not found")
+	ErrSessionRevoked         = errors.New("session revoked")
+	ErrRefreshTokenReused     = errors.New("refresh token reused")
+	ErrResetTokenNotFound     = errors.New("reset token not found")
+	ErrVerifyTokenNotFound    = errors.New("verification token not found")
+	ErrTwoFactorNotFound      = errors.New("two-factor authentication not found")
+	ErrTwoFactorEnabled       = errors.New("two-factor authentication already enabled")
+	ErrTOTPCodeReused         = errors.New("totp code already used")
+	ErrRecoveryCodeNotFound   = errors.New("recovery code not found")
+	ErrChallengeNotFound      = errors.New("login challenge not found")
+	ErrUnlockTokenNotFound    = errors.New("unlock token not found")
+	ErrAccessTokenNotFound    = errors.New("access token not found")
+	ErrOIDCStateNotFound      = errors.New("oidc state not found")
+	ErrIdentityLinkNotFound   = errors.New("identity link not found")
+	ErrIdentityLinked         = errors.New("identity already linked")
+	ErrDeletionNotFound       = errors.New("account deletion not found")
+	ErrConfirmTokenNotFound   = errors.New("deletion confirmation not found")
+	ErrExportNotFound         = errors.New("data export not found")
 )
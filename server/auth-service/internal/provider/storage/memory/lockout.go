@@ -0,0 +1,136 @@
+// Package memory keeps the login lockout state in the process. It is meant
+// for a single auth-service instance and for tests, replicas do not share it.
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/domain/models"
+	storage "github.com/sergey-frey/cchat/server/auth-service/internal/provider"
+)
+
+type unlockToken struct {
+	userID    uuid.UUID
+	expiresAt time.Time
+	used      bool
+}
+
+type Storage struct {
+	mu           sync.Mutex
+	attempts     map[string]models.LoginAttempts
+	lockouts     []models.Lockout
+	unlockTokens map[string]unlockToken
+}
+
+func New() *Storage {
+	return &Storage{
+		attempts:     make(map[string]models.LoginAttempts),
+		unlockTokens: make(map[string]unlockToken),
+	}
+}
+
+func (s *Storage) LoginAttempts(ctx context.Context, key string) (*models.LoginAttempts, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attempts, ok := s.attempts[key]
+	if !ok {
+		attempts = models.LoginAttempts{Key: key}
+	}
+
+	return &attempts, nil
+}
+
+func (s *Storage) RegisterLoginFailure(ctx context.Context, key string, now time.Time, window time.Duration) (*models.LoginAttempts, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attempts, ok := s.attempts[key]
+	if !ok || attempts.LastFailedAt.Before(now.Add(-window)) {
+		attempts = models.LoginAttempts{Key: key}
+	}
+
+	attempts.Failures++
+	attempts.LastFailedAt = now
+
+	s.attempts[key] = attempts
+
+	return &attempts, nil
+}
+
+func (s *Storage) BlockLogin(ctx context.Context, key string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if attempts, ok := s.attempts[key]; ok {
+		attempts.BlockedUntil = until
+		s.attempts[key] = attempts
+	}
+
+	return nil
+}
+
+func (s *Storage) ResetLoginAttempts(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.attempts, key)
+
+	return nil
+}
+
+func (s *Storage) RecordLockout(ctx context.Context, lockout models.Lockout) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lockouts = append(s.lockouts, lockout)
+
+	return nil
+}
+
+// Lockouts returns the recorded lockouts, oldest first.
+func (s *Storage) Lockouts() []models.Lockout {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]models.Lockout(nil), s.lockouts...)
+}
+
+func (s *Storage) SaveUnlockToken(ctx context.Context, uid uuid.UUID, tokenHash []byte, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for hash, token := range s.unlockTokens {
+		if token.userID == uid && !token.used {
+			delete(s.unlockTokens, hash)
+		}
+	}
+
+	s.unlockTokens[string(tokenHash)] = unlockToken{
+		userID:    uid,
+		expiresAt: expiresAt,
+	}
+
+	return nil
+}
+
+func (s *Storage) ConsumeUnlockToken(ctx context.Context, tokenHash []byte) (uuid.UUID, error) {
+	const op = "storage.memory.lockout.ConsumeUnlockToken"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, ok := s.unlockTokens[string(tokenHash)]
+	if !ok || token.used || !token.expiresAt.After(time.Now()) {
+		return uuid.Nil, fmt.Errorf("%s: %w", op, storage.ErrUnlockTokenNotFound)
+	}
+
+	token.used = true
+	s.unlockTokens[string(tokenHash)] = token
+
+	return token.userID, nil
+}
@@ -0,0 +1,143 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/domain/models"
+	storage "github.com/sergey-frey/cchat/server/auth-service/internal/provider"
+)
+
+// AccountStatus returns the credentials state shown to admins.
+func (s *Storage) AccountStatus(ctx context.Context, uid uuid.UUID) (*models.AccountStatus, error) {
+	const op = "storage.postgres.admin.AccountStatus"
+
+	status := models.AccountStatus{UserID: uid}
+
+	row := s.pool.QueryRow(ctx, `
+		SELECT c.role, c.email_verified_at IS NOT NULL, t.enabled_at IS NOT NULL,
+			c.deactivated_at IS NOT NULL, c.suspended_at, c.suspended_reason
+		FROM credentials c
+		LEFT JOIN two_factor t ON t.user_id = c.user_id
+		WHERE c.user_id = $1;
+	`, uid)
+
+	err := row.Scan(&status.Role, &status.EmailVerified, &status.TwoFactorEnabled, &status.Deactivated, &status.SuspendedAt, &status.SuspendedReason)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+		}
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &status, nil
+}
+
+// SuspendAccount blocks the account and revokes its sessions in the same
+// transaction, so no token of the user outlives the suspension. Suspending
+// again only replaces the reason.
+func (s *Storage) SuspendAccount(ctx context.Context, uid uuid.UUID, reason string) (err error) {
+	const op = "storage.postgres.admin.SuspendAccount"
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback(ctx)
+			return
+		}
+
+		commitErr := tx.Commit(ctx)
+		if commitErr != nil {
+			err = fmt.Errorf("%s: %w", op, commitErr)
+		}
+	}()
+
+	tag, err := tx.Exec(ctx, `
+		UPDATE credentials
+		SET suspended_at = COALESCE(suspended_at, NOW()), suspended_reason = $2, updated_at = NOW()
+		WHERE user_id = $1;
+	`, uid, reason)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		err = storage.ErrUserNotFound
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE sessions
+		SET revoked_at = NOW()
+		WHERE user_id = $1 AND revoked_at IS NULL;
+	`, uid)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) UnsuspendAccount(ctx context.Context, uid uuid.UUID) error {
+	const op = "storage.postgres.admin.UnsuspendAccount"
+
+	tag, err := s.pool.Exec(ctx, `
+		UPDATE credentials
+		SET suspended_at = NULL, suspended_reason = '', updated_at = NOW()
+		WHERE user_id = $1;
+	`, uid)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+	}
+
+	return nil
+}
+
+func (s *Storage) SetRole(ctx context.Context, uid uuid.UUID, role string) error {
+	const op = "storage.postgres.admin.SetRole"
+
+	tag, err := s.pool.Exec(ctx, `
+		UPDATE credentials
+		SET role = $2, updated_at = NOW()
+		WHERE user_id = $1;
+	`, uid, role)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+	}
+
+	return nil
+}
+
+// PromoteAdmins gives the admin role to the users that do not have it yet
+// and returns how many were promoted. Unknown ids are ignored.
+func (s *Storage) PromoteAdmins(ctx context.Context, uids []uuid.UUID) (int64, error) {
+	const op = "storage.postgres.admin.PromoteAdmins"
+
+	tag, err := s.pool.Exec(ctx, `
+		UPDATE credentials
+		SET role = $2, updated_at = NOW()
+		WHERE user_id = ANY($1) AND role <> $2;
+	`, uids, models.RoleAdmin)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return tag.RowsAffected(), nil
+}
@@ -2,9 +2,13 @@ package postgres
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/domain/models"
+	storage "github.com/sergey-frey/cchat/server/auth-service/internal/provider"
 )
 
 func (s *Storage) Register(ctx context.Context, uid uuid.UUID, passHash []byte) (error) {
@@ -185,4 +189,28 @@ func (s *Storage) ResetPassword(ctx context.Context, uid uuid.UUID, newPasswordH
 	}
 
 	return nil
-}
\ No newline at end of file
+}
+func (s *Storage) Account(ctx context.Context, uid uuid.UUID) (*models.Account, error) {
+	const op = "storage.postgres.credential.Account"
+
+	account := models.Account{UserID: uid}
+
+	row := s.pool.QueryRow(ctx, `
+		SELECT c.email_verified_at IS NOT NULL, t.enabled_at IS NOT NULL, c.deactivated_at IS NOT NULL,
+			c.role, c.suspended_at IS NOT NULL
+		FROM credentials c
+		LEFT JOIN two_factor t ON t.user_id = c.user_id
+		WHERE c.user_id = $1;
+	`, uid)
+
+	err := row.Scan(&account.EmailVerified, &account.TwoFactorEnabled, &account.Deactivated, &account.Role, &account.Suspended)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+		}
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &account, nil
+}
@@ -0,0 +1,329 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/domain/models"
+	storage "github.com/sergey-frey/cchat/server/auth-service/internal/provider"
+)
+
+// ScheduleDeletion deactivates the credentials, revokes the personal access
+// tokens and schedules the deletion. A deletion cancelled before is
+// scheduled again from scratch.
+func (s *Storage) ScheduleDeletion(ctx context.Context, uid uuid.UUID, restoreTokenHash []byte, scheduledFor time.Time) (err error) {
+	const op = "storage.postgres.deletion.ScheduleDeletion"
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback(ctx)
+			return
+		}
+
+		commitErr := tx.Commit(ctx)
+		if commitErr != nil {
+			err = fmt.Errorf("%s: %w", op, commitErr)
+		}
+	}()
+
+	tag, err := tx.Exec(ctx, `
+		UPDATE credentials
+		SET deactivated_at = NOW(), updated_at = NOW()
+		WHERE user_id = $1 AND deactivated_at IS NULL;
+	`, uid)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		err = storage.ErrUserNotFound
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE personal_access_tokens
+		SET revoked_at = NOW()
+		WHERE user_id = $1 AND revoked_at IS NULL;
+	`, uid)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO account_deletions(user_id, status, restore_token_hash, requested_at, scheduled_for, next_attempt_at)
+		VALUES($1, $2, $3, NOW(), $4, $4)
+		ON CONFLICT (user_id) DO UPDATE
+		SET status = EXCLUDED.status,
+			restore_token_hash = EXCLUDED.restore_token_hash,
+			requested_at = EXCLUDED.requested_at,
+			scheduled_for = EXCLUDED.scheduled_for,
+			completed_steps = '{}',
+			attempts = 0,
+			last_error = '',
+			next_attempt_at = EXCLUDED.next_attempt_at,
+			finished_at = NULL;
+	`, uid, models.DeletionPending, restoreTokenHash, scheduledFor)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// RestoreAccount cancels the deletion the token belongs to and reactivates
+// the credentials. Unknown tokens and deletions past the grace period are
+// all storage.ErrDeletionNotFound.
+func (s *Storage) RestoreAccount(ctx context.Context, restoreTokenHash []byte) (uid uuid.UUID, err error) {
+	const op = "storage.postgres.deletion.RestoreAccount"
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback(ctx)
+			return
+		}
+
+		commitErr := tx.Commit(ctx)
+		if commitErr != nil {
+			err = fmt.Errorf("%s: %w", op, commitErr)
+		}
+	}()
+
+	row := tx.QueryRow(ctx, `
+		UPDATE account_deletions
+		SET status = $2, restore_token_hash = NULL, finished_at = NOW()
+		WHERE restore_token_hash = $1 AND status = $3 AND scheduled_for > NOW()
+		RETURNING user_id;
+	`, restoreTokenHash, models.DeletionCancelled, models.DeletionPending)
+
+	err = row.Scan(&uid)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			err = storage.ErrDeletionNotFound
+		}
+
+		return uuid.Nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE credentials
+		SET deactivated_at = NULL, updated_at = NOW()
+		WHERE user_id = $1;
+	`, uid)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return uid, nil
+}
+
+// SaveDeletionConfirmation stores a new confirmation token and drops the
+// unused ones issued to the user before, so only the latest link works.
+func (s *Storage) SaveDeletionConfirmation(ctx context.Context, uid uuid.UUID, tokenHash []byte, expiresAt time.Time) (err error) {
+	const op = "storage.postgres.deletion.SaveDeletionConfirmation"
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback(ctx)
+			return
+		}
+
+		commitErr := tx.Commit(ctx)
+		if commitErr != nil {
+			err = fmt.Errorf("%s: %w", op, commitErr)
+		}
+	}()
+
+	_, err = tx.Exec(ctx, `
+		DELETE FROM deletion_confirmations
+		WHERE user_id = $1 AND used_at IS NULL;
+	`, uid)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO deletion_confirmations(token_hash, user_id, created_at, expires_at)
+		VALUES($1, $2, NOW(), $3);
+	`, tokenHash, uid, expiresAt)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// ConsumeDeletionConfirmation marks the token of the user as used. Unknown,
+// expired and already used tokens, and tokens of another user, are all
+// storage.ErrConfirmTokenNotFound.
+func (s *Storage) ConsumeDeletionConfirmation(ctx context.Context, uid uuid.UUID, tokenHash []byte) error {
+	const op = "storage.postgres.deletion.ConsumeDeletionConfirmation"
+
+	tag, err := s.pool.Exec(ctx, `
+		UPDATE deletion_confirmations
+		SET used_at = NOW()
+		WHERE token_hash = $1 AND user_id = $2 AND used_at IS NULL AND expires_at > NOW();
+	`, tokenHash, uid)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrConfirmTokenNotFound)
+	}
+
+	return nil
+}
+
+// ClaimDeletions returns the deletions that are due and pushes their next
+// attempt back to leaseUntil, so other replicas leave them alone meanwhile.
+// A replica that dies holding a deletion hands it over once the lease ends.
+func (s *Storage) ClaimDeletions(ctx context.Context, limit int, leaseUntil time.Time) ([]models.AccountDeletion, error) {
+	const op = "storage.postgres.deletion.ClaimDeletions"
+
+	rows, err := s.pool.Query(ctx, `
+		UPDATE account_deletions
+		SET next_attempt_at = $2, attempts = attempts + 1
+		WHERE user_id IN (
+			SELECT user_id
+			FROM account_deletions
+			WHERE status = $3 AND scheduled_for <= NOW() AND next_attempt_at <= NOW()
+			ORDER BY next_attempt_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING user_id, scheduled_for, completed_steps, attempts;
+	`, limit, leaseUntil, models.DeletionPending)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var deletions []models.AccountDeletion
+
+	for rows.Next() {
+		var deletion models.AccountDeletion
+
+		err = rows.Scan(&deletion.UserID, &deletion.ScheduledFor, &deletion.CompletedSteps, &deletion.Attempts)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		deletions = append(deletions, deletion)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return deletions, nil
+}
+
+// CompleteDeletionStep records that the user is erased from one service.
+func (s *Storage) CompleteDeletionStep(ctx context.Context, uid uuid.UUID, step string) error {
+	const op = "storage.postgres.deletion.CompleteDeletionStep"
+
+	_, err := s.pool.Exec(ctx, `
+		UPDATE account_deletions
+		SET completed_steps = array_append(completed_steps, $2)
+		WHERE user_id = $1 AND status = $3 AND NOT ($2 = ANY(completed_steps));
+	`, uid, step, models.DeletionPending)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) RetryDeletion(ctx context.Context, uid uuid.UUID, nextAttemptAt time.Time, reason string) error {
+	const op = "storage.postgres.deletion.RetryDeletion"
+
+	_, err := s.pool.Exec(ctx, `
+		UPDATE account_deletions
+		SET next_attempt_at = $2, last_error = $3
+		WHERE user_id = $1 AND status = $4;
+	`, uid, nextAttemptAt, reason, models.DeletionPending)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// FinishDeletion removes the credentials, the sessions and everything else
+// kept for the user, and marks the deletion as completed. The audit log
+// is kept.
+func (s *Storage) FinishDeletion(ctx context.Context, uid uuid.UUID) (err error) {
+	const op = "storage.postgres.deletion.FinishDeletion"
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback(ctx)
+			return
+		}
+
+		commitErr := tx.Commit(ctx)
+		if commitErr != nil {
+			err = fmt.Errorf("%s: %w", op, commitErr)
+		}
+	}()
+
+	_, err = tx.Exec(ctx, `
+		DELETE FROM sessions
+		WHERE user_id = $1;
+	`, uid)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		DELETE FROM password_resets
+		WHERE user_id = $1;
+	`, uid)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		DELETE FROM credentials
+		WHERE user_id = $1;
+	`, uid)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE account_deletions
+		SET status = $2, restore_token_hash = NULL, last_error = '', finished_at = NOW()
+		WHERE user_id = $1;
+	`, uid, models.DeletionCompleted)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,116 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/sergey-frey/cchat/server/auth-service/internal/domain/models"
+)
+
+func (s *Storage) SaveAuthEvent(ctx context.Context, event models.AuthEvent) error {
+	const op = "storage.postgres.event.SaveAuthEvent"
+
+	details, err := json.Marshal(event.Details)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if event.Details == nil {
+		details = []byte("{}")
+	}
+
+	_, err = s.pool.Exec(ctx, `
+		INSERT INTO auth_events(user_id, type, ip, user_agent, request_id, details, created_at)
+		VALUES($1, $2, $3, $4, $5, $6, NOW());
+	`, event.UserID, event.Type, event.IP, event.UserAgent, event.RequestID, details)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// AuthEvents returns the events matching the filter, newest first.
+func (s *Storage) AuthEvents(ctx context.Context, filter models.EventFilter) ([]models.AuthEvent, error) {
+	const op = "storage.postgres.event.AuthEvents"
+
+	conditions := make([]string, 0, 6)
+	values := make([]interface{}, 0, 7)
+
+	where := func(condition string, value interface{}) {
+		values = append(values, value)
+		conditions = append(conditions, fmt.Sprintf(condition, len(values)))
+	}
+
+	if filter.UserID.Valid {
+		where("user_id = $%d", filter.UserID.UUID)
+	}
+
+	if len(filter.Types) > 0 {
+		where("type = ANY($%d)", filter.Types)
+	}
+
+	if filter.IP != "" {
+		where("ip = $%d", filter.IP)
+	}
+
+	if !filter.From.IsZero() {
+		where("created_at >= $%d", filter.From)
+	}
+
+	if !filter.To.IsZero() {
+		where("created_at < $%d", filter.To)
+	}
+
+	if filter.Cursor > 0 {
+		where("event_id < $%d", filter.Cursor)
+	}
+
+	clause := ""
+	if len(conditions) > 0 {
+		clause = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	values = append(values, filter.Limit)
+
+	stmt := fmt.Sprintf(`
+		SELECT event_id, user_id, type, ip, user_agent, request_id, details, created_at
+		FROM auth_events
+		%s
+		ORDER BY event_id DESC
+		LIMIT $%d;
+	`, clause, len(values))
+
+	rows, err := s.pool.Query(ctx, stmt, values...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	defer rows.Close()
+
+	events := make([]models.AuthEvent, 0, filter.Limit)
+
+	for rows.Next() {
+		var event models.AuthEvent
+		var details []byte
+
+		err := rows.Scan(&event.ID, &event.UserID, &event.Type, &event.IP, &event.UserAgent, &event.RequestID, &details, &event.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		if err := json.Unmarshal(details, &event.Details); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		events = append(events, event)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return events, nil
+}
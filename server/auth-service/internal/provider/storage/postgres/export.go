@@ -0,0 +1,350 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/domain/models"
+	storage "github.com/sergey-frey/cchat/server/auth-service/internal/provider"
+)
+
+const exportColumns = `id, user_id, status, requested_at, attempts, finished_at, expires_at`
+
+func scanExport(row pgx.Row) (*models.DataExport, error) {
+	var export models.DataExport
+
+	err := row.Scan(&export.ID, &export.UserID, &export.Status, &export.RequestedAt, &export.Attempts, &export.FinishedAt, &export.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &export, nil
+}
+
+// CreateExport queues an export for the user. While one is still pending
+// that one is returned instead, asking twice does not run it twice.
+func (s *Storage) CreateExport(ctx context.Context, id uuid.UUID, uid uuid.UUID) (*models.DataExport, error) {
+	const op = "storage.postgres.export.CreateExport"
+
+	export, err := scanExport(s.pool.QueryRow(ctx, `
+		INSERT INTO data_exports(id, user_id, status, requested_at, next_attempt_at)
+		VALUES($1, $2, $3, NOW(), NOW())
+		ON CONFLICT (user_id) WHERE status = 'pending' DO NOTHING
+		RETURNING `+exportColumns+`;
+	`, id, uid, models.ExportPending))
+	if err == nil {
+		return export, nil
+	}
+
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	export, err = scanExport(s.pool.QueryRow(ctx, `
+		SELECT `+exportColumns+`
+		FROM data_exports
+		WHERE user_id = $1 AND status = $2;
+	`, uid, models.ExportPending))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return export, nil
+}
+
+func (s *Storage) Export(ctx context.Context, id uuid.UUID) (*models.DataExport, error) {
+	const op = "storage.postgres.export.Export"
+
+	export, err := scanExport(s.pool.QueryRow(ctx, `
+		SELECT `+exportColumns+`
+		FROM data_exports
+		WHERE id = $1;
+	`, id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%s: %w", op, storage.ErrExportNotFound)
+		}
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return export, nil
+}
+
+// ClaimExports returns the pending exports that are due and pushes their
+// next attempt back to leaseUntil, like ClaimDeletions.
+func (s *Storage) ClaimExports(ctx context.Context, limit int, leaseUntil time.Time) ([]models.DataExport, error) {
+	const op = "storage.postgres.export.ClaimExports"
+
+	rows, err := s.pool.Query(ctx, `
+		UPDATE data_exports
+		SET next_attempt_at = $2, attempts = attempts + 1
+		WHERE id IN (
+			SELECT id
+			FROM data_exports
+			WHERE status = $3 AND next_attempt_at <= NOW()
+			ORDER BY next_attempt_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+exportColumns+`;
+	`, limit, leaseUntil, models.ExportPending)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var exports []models.DataExport
+
+	for rows.Next() {
+		export, err := scanExport(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		exports = append(exports, *export)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return exports, nil
+}
+
+func (s *Storage) FinishExport(ctx context.Context, id uuid.UUID, expiresAt time.Time) error {
+	const op = "storage.postgres.export.FinishExport"
+
+	_, err := s.pool.Exec(ctx, `
+		UPDATE data_exports
+		SET status = $2, last_error = '', finished_at = NOW(), expires_at = $3
+		WHERE id = $1 AND status = $4;
+	`, id, models.ExportReady, expiresAt, models.ExportPending)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) RetryExport(ctx context.Context, id uuid.UUID, nextAttemptAt time.Time, reason string) error {
+	const op = "storage.postgres.export.RetryExport"
+
+	_, err := s.pool.Exec(ctx, `
+		UPDATE data_exports
+		SET next_attempt_at = $2, last_error = $3
+		WHERE id = $1 AND status = $4;
+	`, id, nextAttemptAt, reason, models.ExportPending)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// FailExport gives up on the export, the user has to ask for a new one.
+func (s *Storage) FailExport(ctx context.Context, id uuid.UUID, reason string) error {
+	const op = "storage.postgres.export.FailExport"
+
+	_, err := s.pool.Exec(ctx, `
+		UPDATE data_exports
+		SET status = $2, last_error = $3, finished_at = NOW()
+		WHERE id = $1 AND status = $4;
+	`, id, models.ExportFailed, reason, models.ExportPending)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// ExpireExports marks the archives past their expiry as expired and
+// returns their ids, so the files can be removed.
+func (s *Storage) ExpireExports(ctx context.Context) ([]uuid.UUID, error) {
+	const op = "storage.postgres.export.ExpireExports"
+
+	rows, err := s.pool.Query(ctx, `
+		UPDATE data_exports
+		SET status = $1
+		WHERE status = $2 AND expires_at <= NOW()
+		RETURNING id;
+	`, models.ExportExpired, models.ExportReady)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var ids []uuid.UUID
+
+	for rows.Next() {
+		var id uuid.UUID
+
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		ids = append(ids, id)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return ids, nil
+}
+
+// AccountExport collects the credentials metadata, every session and access
+// token including the revoked ones, the identity links and the audit log of
+// the user.
+func (s *Storage) AccountExport(ctx context.Context, uid uuid.UUID) (*models.AccountExport, error) {
+	const op = "storage.postgres.export.AccountExport"
+
+	account := models.AccountExport{
+		UserID:        uid,
+		Sessions:      make([]models.Session, 0),
+		AccessTokens:  make([]models.AccessToken, 0),
+		IdentityLinks: make([]models.ExportedIdentityLink, 0),
+		Events:        make([]models.AuthEvent, 0),
+	}
+
+	row := s.pool.QueryRow(ctx, `
+		SELECT c.role, c.created_at, c.updated_at, c.email_verified_at, t.enabled_at, c.suspended_at
+		FROM credentials c
+		LEFT JOIN two_factor t ON t.user_id = c.user_id
+		WHERE c.user_id = $1;
+	`, uid)
+
+	err := row.Scan(&account.Role, &account.CreatedAt, &account.UpdatedAt, &account.EmailVerifiedAt, &account.TwoFactorEnabledAt, &account.SuspendedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+		}
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	rows, err := s.pool.Query(ctx, `
+		SELECT session_id, user_id, user_agent, ip, created_at, last_used_at, expires_at, revoked_at
+		FROM sessions
+		WHERE user_id = $1
+		ORDER BY created_at;
+	`, uid)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	for rows.Next() {
+		var session models.Session
+
+		err = rows.Scan(&session.ID, &session.UserID, &session.UserAgent, &session.IP, &session.CreatedAt, &session.LastUsedAt, &session.ExpiresAt, &session.RevokedAt)
+		if err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		account.Sessions = append(account.Sessions, session)
+	}
+
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	rows, err = s.pool.Query(ctx, `
+		SELECT token_id, user_id, name, scopes, created_at, last_used_at, expires_at
+		FROM personal_access_tokens
+		WHERE user_id = $1
+		ORDER BY created_at;
+	`, uid)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	for rows.Next() {
+		var token models.AccessToken
+
+		err = rows.Scan(&token.ID, &token.UserID, &token.Name, &token.Scopes, &token.CreatedAt, &token.LastUsedAt, &token.ExpiresAt)
+		if err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		account.AccessTokens = append(account.AccessTokens, token)
+	}
+
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	rows, err = s.pool.Query(ctx, `
+		SELECT provider, email, created_at, last_login_at
+		FROM identity_links
+		WHERE user_id = $1
+		ORDER BY created_at;
+	`, uid)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	for rows.Next() {
+		var link models.ExportedIdentityLink
+
+		err = rows.Scan(&link.Provider, &link.Email, &link.CreatedAt, &link.LastLoginAt)
+		if err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		account.IdentityLinks = append(account.IdentityLinks, link)
+	}
+
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	rows, err = s.pool.Query(ctx, `
+		SELECT event_id, user_id, type, ip, user_agent, request_id, details, created_at
+		FROM auth_events
+		WHERE user_id = $1
+		ORDER BY event_id;
+	`, uid)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	for rows.Next() {
+		var event models.AuthEvent
+		var details []byte
+
+		err = rows.Scan(&event.ID, &event.UserID, &event.Type, &event.IP, &event.UserAgent, &event.RequestID, &details, &event.CreatedAt)
+		if err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		if err := json.Unmarshal(details, &event.Details); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		account.Events = append(account.Events, event)
+	}
+
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &account, nil
+}
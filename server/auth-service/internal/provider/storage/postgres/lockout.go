@@ -0,0 +1,191 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/domain/models"
+	storage "github.com/sergey-frey/cchat/server/auth-service/internal/provider"
+)
+
+// LoginAttempts returns the counter of the key, a key without
+// failures gets an empty counter.
+func (s *Storage) LoginAttempts(ctx context.Context, key string) (*models.LoginAttempts, error) {
+	const op = "storage.postgres.lockout.LoginAttempts"
+
+	attempts := models.LoginAttempts{Key: key}
+
+	var blockedUntil *time.Time
+
+	row := s.pool.QueryRow(ctx, `
+		SELECT failures, last_failed_at, blocked_until
+		FROM login_attempts
+		WHERE key = $1;
+	`, key)
+
+	err := row.Scan(&attempts.Failures, &attempts.LastFailedAt, &blockedUntil)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return &attempts, nil
+		}
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if blockedUntil != nil {
+		attempts.BlockedUntil = *blockedUntil
+	}
+
+	return &attempts, nil
+}
+
+// RegisterLoginFailure counts a failed login. A counter whose last failure
+// is older than the window starts over, so old failures are forgotten.
+func (s *Storage) RegisterLoginFailure(ctx context.Context, key string, now time.Time, window time.Duration) (*models.LoginAttempts, error) {
+	const op = "storage.postgres.lockout.RegisterLoginFailure"
+
+	attempts := models.LoginAttempts{Key: key}
+
+	var blockedUntil *time.Time
+
+	row := s.pool.QueryRow(ctx, `
+		INSERT INTO login_attempts(key, failures, last_failed_at)
+		VALUES($1, 1, $2)
+		ON CONFLICT (key) DO UPDATE
+		SET failures = CASE
+				WHEN login_attempts.last_failed_at < $3 THEN 1
+				ELSE login_attempts.failures + 1
+			END,
+			blocked_until = CASE
+				WHEN login_attempts.last_failed_at < $3 THEN NULL
+				ELSE login_attempts.blocked_until
+			END,
+			last_failed_at = EXCLUDED.last_failed_at
+		RETURNING failures, last_failed_at, blocked_until;
+	`, key, now, now.Add(-window))
+
+	err := row.Scan(&attempts.Failures, &attempts.LastFailedAt, &blockedUntil)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if blockedUntil != nil {
+		attempts.BlockedUntil = *blockedUntil
+	}
+
+	return &attempts, nil
+}
+
+func (s *Storage) BlockLogin(ctx context.Context, key string, until time.Time) error {
+	const op = "storage.postgres.lockout.BlockLogin"
+
+	_, err := s.pool.Exec(ctx, `
+		UPDATE login_attempts
+		SET blocked_until = $2
+		WHERE key = $1;
+	`, key, until)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) ResetLoginAttempts(ctx context.Context, key string) error {
+	const op = "storage.postgres.lockout.ResetLoginAttempts"
+
+	_, err := s.pool.Exec(ctx, `
+		DELETE FROM login_attempts
+		WHERE key = $1;
+	`, key)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) RecordLockout(ctx context.Context, lockout models.Lockout) error {
+	const op = "storage.postgres.lockout.RecordLockout"
+
+	_, err := s.pool.Exec(ctx, `
+		INSERT INTO lockouts(key, user_id, ip, failures, locked_until, created_at)
+		VALUES($1, $2, $3, $4, $5, NOW());
+	`, lockout.Key, lockout.UserID, lockout.IP, lockout.Failures, lockout.LockedUntil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// SaveUnlockToken stores a new unlock token and drops the unused ones
+// issued to the user before, so only the latest link works.
+func (s *Storage) SaveUnlockToken(ctx context.Context, uid uuid.UUID, tokenHash []byte, expiresAt time.Time) (err error) {
+	const op = "storage.postgres.lockout.SaveUnlockToken"
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback(ctx)
+			return
+		}
+
+		commitErr := tx.Commit(ctx)
+		if commitErr != nil {
+			err = fmt.Errorf("%s: %w", op, commitErr)
+		}
+	}()
+
+	_, err = tx.Exec(ctx, `
+		DELETE FROM unlock_tokens
+		WHERE user_id = $1 AND used_at IS NULL;
+	`, uid)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO unlock_tokens(token_hash, user_id, created_at, expires_at)
+		VALUES($1, $2, NOW(), $3);
+	`, tokenHash, uid, expiresAt)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// ConsumeUnlockToken marks the token as used and returns its owner.
+// Unknown, expired and already used tokens are all storage.ErrUnlockTokenNotFound.
+func (s *Storage) ConsumeUnlockToken(ctx context.Context, tokenHash []byte) (uuid.UUID, error) {
+	const op = "storage.postgres.lockout.ConsumeUnlockToken"
+
+	var uid uuid.UUID
+
+	row := s.pool.QueryRow(ctx, `
+		UPDATE unlock_tokens
+		SET used_at = NOW()
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+		RETURNING user_id;
+	`, tokenHash)
+
+	err := row.Scan(&uid)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return uuid.Nil, fmt.Errorf("%s: %w", op, storage.ErrUnlockTokenNotFound)
+		}
+
+		return uuid.Nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return uid, nil
+}
@@ -0,0 +1,143 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/domain/models"
+	storage "github.com/sergey-frey/cchat/server/auth-service/internal/provider"
+)
+
+func (s *Storage) SaveOIDCState(ctx context.Context, stateHash []byte, state models.OIDCState) error {
+	const op = "storage.postgres.oidc.SaveOIDCState"
+
+	_, err := s.pool.Exec(ctx, `
+		INSERT INTO oidc_states(state_hash, provider, code_verifier, nonce, created_at, expires_at)
+		VALUES($1, $2, $3, $4, NOW(), $5);
+	`, stateHash, state.Provider, state.Verifier, state.Nonce, state.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// ConsumeOIDCState returns a live state once, expired states are
+// cleaned up on the way.
+func (s *Storage) ConsumeOIDCState(ctx context.Context, stateHash []byte) (*models.OIDCState, error) {
+	const op = "storage.postgres.oidc.ConsumeOIDCState"
+
+	_, err := s.pool.Exec(ctx, `
+		DELETE FROM oidc_states
+		WHERE expires_at <= NOW();
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var state models.OIDCState
+
+	row := s.pool.QueryRow(ctx, `
+		DELETE FROM oidc_states
+		WHERE state_hash = $1
+		RETURNING provider, code_verifier, nonce, expires_at;
+	`, stateHash)
+
+	err = row.Scan(&state.Provider, &state.Verifier, &state.Nonce, &state.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%s: %w", op, storage.ErrOIDCStateNotFound)
+		}
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &state, nil
+}
+
+// IdentityLink returns the link of the external subject and records the login.
+func (s *Storage) IdentityLink(ctx context.Context, provider string, subject string) (*models.IdentityLink, error) {
+	const op = "storage.postgres.oidc.IdentityLink"
+
+	link := models.IdentityLink{Provider: provider, Subject: subject}
+
+	row := s.pool.QueryRow(ctx, `
+		UPDATE identity_links
+		SET last_login_at = NOW()
+		WHERE provider = $1 AND subject = $2
+		RETURNING user_id, email;
+	`, provider, subject)
+
+	err := row.Scan(&link.UserID, &link.Email)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%s: %w", op, storage.ErrIdentityLinkNotFound)
+		}
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &link, nil
+}
+
+// LinkIdentity links the subject to the user. Users created by the
+// login get credentials without a password, they can set one through
+// the password reset. A provider that verified the email verifies it here.
+func (s *Storage) LinkIdentity(ctx context.Context, link models.IdentityLink, emailVerified bool) (err error) {
+	const op = "storage.postgres.oidc.LinkIdentity"
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback(ctx)
+			return
+		}
+
+		commitErr := tx.Commit(ctx)
+		if commitErr != nil {
+			err = fmt.Errorf("%s: %w", op, commitErr)
+		}
+	}()
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO credentials(user_id, password_hash, created_at, updated_at)
+		VALUES($1, ''::BYTEA, NOW(), NOW())
+		ON CONFLICT (user_id) DO NOTHING;
+	`, link.UserID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if emailVerified {
+		_, err = tx.Exec(ctx, `
+			UPDATE credentials
+			SET email_verified_at = NOW()
+			WHERE user_id = $1 AND email_verified_at IS NULL;
+		`, link.UserID)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	tag, err := tx.Exec(ctx, `
+		INSERT INTO identity_links(provider, subject, user_id, email, created_at, last_login_at)
+		VALUES($1, $2, $3, $4, NOW(), NOW())
+		ON CONFLICT (provider, subject) DO NOTHING;
+	`, link.Provider, link.Subject, link.UserID, link.Email)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		err = storage.ErrIdentityLinked
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
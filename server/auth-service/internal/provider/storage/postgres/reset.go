@@ -0,0 +1,104 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	storage "github.com/sergey-frey/cchat/server/auth-service/internal/provider"
+)
+
+// SavePasswordResetToken stores a new reset token and drops the unused ones
+// issued to the user before, so only the latest link works.
+func (s *Storage) SavePasswordResetToken(ctx context.Context, uid uuid.UUID, tokenHash []byte, expiresAt time.Time) (err error) {
+	const op = "storage.postgres.reset.SavePasswordResetToken"
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback(ctx)
+			return
+		}
+
+		commitErr := tx.Commit(ctx)
+		if commitErr != nil {
+			err = fmt.Errorf("%s: %w", op, commitErr)
+		}
+	}()
+
+	_, err = tx.Exec(ctx, `
+		DELETE FROM password_resets
+		WHERE user_id = $1 AND used_at IS NULL;
+	`, uid)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO password_resets(token_hash, user_id, created_at, expires_at)
+		VALUES($1, $2, NOW(), $3);
+	`, tokenHash, uid, expiresAt)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// ResetPasswordByToken marks the token as used and sets the new password of
+// its owner in one transaction, so a failed change leaves the link working.
+// Unknown, expired and already used tokens are all storage.ErrResetTokenNotFound.
+func (s *Storage) ResetPasswordByToken(ctx context.Context, tokenHash []byte, newPasswordHash []byte) (uid uuid.UUID, err error) {
+	const op = "storage.postgres.reset.ResetPasswordByToken"
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback(ctx)
+			return
+		}
+
+		commitErr := tx.Commit(ctx)
+		if commitErr != nil {
+			err = fmt.Errorf("%s: %w", op, commitErr)
+		}
+	}()
+
+	row := tx.QueryRow(ctx, `
+		UPDATE password_resets
+		SET used_at = NOW()
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+		RETURNING user_id;
+	`, tokenHash)
+
+	err = row.Scan(&uid)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return uuid.Nil, fmt.Errorf("%s: %w", op, storage.ErrResetTokenNotFound)
+		}
+
+		return uuid.Nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE credentials
+		SET password_hash = $1
+		WHERE user_id = $2;
+	`, newPasswordHash, uid)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return uid, nil
+}
@@ -0,0 +1,286 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/domain/models"
+	storage "github.com/sergey-frey/cchat/server/auth-service/internal/provider"
+)
+
+func (s *Storage) CreateSession(ctx context.Context, session models.Session, tokenID uuid.UUID) (err error) {
+	const op = "storage.postgres.session.CreateSession"
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback(ctx)
+			return
+		}
+
+		commitErr := tx.Commit(ctx)
+		if commitErr != nil {
+			err = fmt.Errorf("%s: %w", op, commitErr)
+		}
+	}()
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO sessions(session_id, user_id, user_agent, ip, created_at, last_used_at, expires_at)
+		VALUES($1, $2, $3, $4, NOW(), NOW(), $5);
+	`, session.ID, session.UserID, session.UserAgent, session.IP, session.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO refresh_tokens(token_id, session_id, created_at)
+		VALUES($1, $2, NOW());
+	`, tokenID, session.ID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) Session(ctx context.Context, sessionID uuid.UUID) (*models.Session, error) {
+	const op = "storage.postgres.session.Session"
+
+	var session models.Session
+
+	row := s.pool.QueryRow(ctx, `
+		SELECT session_id, user_id, user_agent, ip, created_at, last_used_at, expires_at, revoked_at
+		FROM sessions
+		WHERE session_id = $1;
+	`, sessionID)
+
+	err := row.Scan(&session.ID, &session.UserID, &session.UserAgent, &session.IP, &session.CreatedAt, &session.LastUsedAt, &session.ExpiresAt, &session.RevokedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%s: %w", op, storage.ErrSessionNotFound)
+		}
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &session, nil
+}
+
+// RotateRefreshToken consumes tokenID and stores newTokenID as its successor.
+// A token that was already consumed is reported as storage.ErrRefreshTokenReused
+// together with the successor it was rotated into, the caller decides whether
+// that is a fork of the chain or a parallel request racing the rotation.
+func (s *Storage) RotateRefreshToken(ctx context.Context, userID uuid.UUID, sessionID uuid.UUID, tokenID uuid.UUID, newTokenID uuid.UUID, meta models.RequestMeta) (consumed *models.ConsumedToken, err error) {
+	const op = "storage.postgres.session.RotateRefreshToken"
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback(ctx)
+			return
+		}
+
+		commitErr := tx.Commit(ctx)
+		if commitErr != nil {
+			err = fmt.Errorf("%s: %w", op, commitErr)
+		}
+	}()
+
+	var (
+		owner     uuid.UUID
+		expiresAt time.Time
+		revokedAt *time.Time
+		usedAt    *time.Time
+	)
+
+	// The lock makes a parallel rotation of the same token wait for this
+	// one and then find the successor it stored.
+	row := tx.QueryRow(ctx, `
+		SELECT s.user_id, s.expires_at, s.revoked_at, t.used_at
+		FROM refresh_tokens t
+		JOIN sessions s ON s.session_id = t.session_id
+		WHERE t.token_id = $1 AND t.session_id = $2
+		FOR UPDATE OF t;
+	`, tokenID, sessionID)
+
+	err = row.Scan(&owner, &expiresAt, &revokedAt, &usedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			err = storage.ErrSessionNotFound
+		}
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if owner != userID {
+		err = storage.ErrSessionNotFound
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if revokedAt != nil || expiresAt.Before(time.Now()) {
+		err = storage.ErrSessionRevoked
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if usedAt != nil {
+		consumed = &models.ConsumedToken{UsedAt: *usedAt}
+
+		var successorUsedAt *time.Time
+
+		row := tx.QueryRow(ctx, `
+			SELECT token_id, used_at
+			FROM refresh_tokens
+			WHERE session_id = $1 AND parent_id = $2;
+		`, sessionID, tokenID)
+
+		err = row.Scan(&consumed.SuccessorID, &successorUsedAt)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		consumed.SuccessorUsed = successorUsedAt != nil
+
+		// Nothing was written, the read only transaction is rolled back.
+		err = storage.ErrRefreshTokenReused
+
+		return consumed, fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE refresh_tokens
+		SET used_at = NOW()
+		WHERE token_id = $1;
+	`, tokenID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO refresh_tokens(token_id, session_id, parent_id, created_at)
+		VALUES($1, $2, $3, NOW());
+	`, newTokenID, sessionID, tokenID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE sessions
+		SET last_used_at = NOW(), ip = $1, user_agent = $2
+		WHERE session_id = $3;
+	`, meta.IP, meta.UserAgent, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil, nil
+}
+
+func (s *Storage) RevokeSession(ctx context.Context, sessionID uuid.UUID) error {
+	const op = "storage.postgres.session.RevokeSession"
+
+	_, err := s.pool.Exec(ctx, `
+		UPDATE sessions
+		SET revoked_at = NOW()
+		WHERE session_id = $1 AND revoked_at IS NULL;
+	`, sessionID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) UserSessions(ctx context.Context, userID uuid.UUID) ([]models.Session, error) {
+	const op = "storage.postgres.session.UserSessions"
+
+	rows, err := s.pool.Query(ctx, `
+		SELECT session_id, user_id, user_agent, ip, created_at, last_used_at, expires_at, revoked_at
+		FROM sessions
+		WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+		ORDER BY last_used_at DESC;
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	defer rows.Close()
+
+	sessions := make([]models.Session, 0)
+	for rows.Next() {
+		var session models.Session
+
+		err := rows.Scan(&session.ID, &session.UserID, &session.UserAgent, &session.IP, &session.CreatedAt, &session.LastUsedAt, &session.ExpiresAt, &session.RevokedAt)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		sessions = append(sessions, session)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return sessions, nil
+}
+
+func (s *Storage) RevokeUserSession(ctx context.Context, userID uuid.UUID, sessionID uuid.UUID) error {
+	const op = "storage.postgres.session.RevokeUserSession"
+
+	tag, err := s.pool.Exec(ctx, `
+		UPDATE sessions
+		SET revoked_at = NOW()
+		WHERE session_id = $1 AND user_id = $2 AND revoked_at IS NULL;
+	`, sessionID, userID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrSessionNotFound)
+	}
+
+	return nil
+}
+
+func (s *Storage) RevokeOtherSessions(ctx context.Context, userID uuid.UUID, currentSessionID uuid.UUID) (int64, error) {
+	const op = "storage.postgres.session.RevokeOtherSessions"
+
+	tag, err := s.pool.Exec(ctx, `
+		UPDATE sessions
+		SET revoked_at = NOW()
+		WHERE user_id = $1 AND session_id <> $2 AND revoked_at IS NULL;
+	`, userID, currentSessionID)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return tag.RowsAffected(), nil
+}
+
+func (s *Storage) RevokeUserSessions(ctx context.Context, userID uuid.UUID) error {
+	const op = "storage.postgres.session.RevokeUserSessions"
+
+	_, err := s.pool.Exec(ctx, `
+		UPDATE sessions
+		SET revoked_at = NOW()
+		WHERE user_id = $1 AND revoked_at IS NULL;
+	`, userID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
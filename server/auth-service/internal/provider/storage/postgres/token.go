@@ -0,0 +1,109 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/domain/models"
+	storage "github.com/sergey-frey/cchat/server/auth-service/internal/provider"
+)
+
+func (s *Storage) SaveAccessToken(ctx context.Context, token models.AccessToken, tokenHash []byte) (*models.AccessToken, error) {
+	const op = "storage.postgres.token.SaveAccessToken"
+
+	row := s.pool.QueryRow(ctx, `
+		INSERT INTO personal_access_tokens(token_id, user_id, name, token_hash, scopes, created_at, expires_at)
+		VALUES($1, $2, $3, $4, $5, NOW(), $6)
+		RETURNING created_at;
+	`, token.ID, token.UserID, token.Name, tokenHash, token.Scopes, token.ExpiresAt)
+
+	if err := row.Scan(&token.CreatedAt); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &token, nil
+}
+
+// AccessTokens lists the tokens of the user that are not revoked, expired ones included.
+func (s *Storage) AccessTokens(ctx context.Context, userID uuid.UUID) ([]models.AccessToken, error) {
+	const op = "storage.postgres.token.AccessTokens"
+
+	rows, err := s.pool.Query(ctx, `
+		SELECT token_id, user_id, name, scopes, created_at, last_used_at, expires_at
+		FROM personal_access_tokens
+		WHERE user_id = $1 AND revoked_at IS NULL
+		ORDER BY created_at DESC;
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	tokens := make([]models.AccessToken, 0)
+
+	for rows.Next() {
+		var token models.AccessToken
+
+		err := rows.Scan(&token.ID, &token.UserID, &token.Name, &token.Scopes, &token.CreatedAt, &token.LastUsedAt, &token.ExpiresAt)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		tokens = append(tokens, token)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return tokens, nil
+}
+
+// UseAccessToken finds a live token by its hash and marks it as used.
+func (s *Storage) UseAccessToken(ctx context.Context, tokenHash []byte) (*models.AccessToken, error) {
+	const op = "storage.postgres.token.UseAccessToken"
+
+	var token models.AccessToken
+
+	row := s.pool.QueryRow(ctx, `
+		UPDATE personal_access_tokens
+		SET last_used_at = NOW()
+		WHERE token_hash = $1
+			AND revoked_at IS NULL
+			AND (expires_at IS NULL OR expires_at > NOW())
+		RETURNING token_id, user_id, name, scopes, created_at, last_used_at, expires_at;
+	`, tokenHash)
+
+	err := row.Scan(&token.ID, &token.UserID, &token.Name, &token.Scopes, &token.CreatedAt, &token.LastUsedAt, &token.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%s: %w", op, storage.ErrAccessTokenNotFound)
+		}
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &token, nil
+}
+
+func (s *Storage) RevokeAccessToken(ctx context.Context, userID uuid.UUID, tokenID uuid.UUID) error {
+	const op = "storage.postgres.token.RevokeAccessToken"
+
+	tag, err := s.pool.Exec(ctx, `
+		UPDATE personal_access_tokens
+		SET revoked_at = NOW()
+		WHERE token_id = $1 AND user_id = $2 AND revoked_at IS NULL;
+	`, tokenID, userID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrAccessTokenNotFound)
+	}
+
+	return nil
+}
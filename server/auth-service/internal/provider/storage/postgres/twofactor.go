@@ -0,0 +1,265 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/domain/models"
+	storage "github.com/sergey-frey/cchat/server/auth-service/internal/provider"
+)
+
+func (s *Storage) TwoFactor(ctx context.Context, uid uuid.UUID) (*models.TwoFactor, error) {
+	const op = "storage.postgres.twofactor.TwoFactor"
+
+	twoFactor := models.TwoFactor{UserID: uid}
+
+	row := s.pool.QueryRow(ctx, `
+		SELECT secret, last_step, enabled_at
+		FROM two_factor
+		WHERE user_id = $1;
+	`, uid)
+
+	err := row.Scan(&twoFactor.Secret, &twoFactor.LastStep, &twoFactor.EnabledAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%s: %w", op, storage.ErrTwoFactorNotFound)
+		}
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &twoFactor, nil
+}
+
+// SaveTwoFactorSecret starts or restarts an enrollment. An enabled
+// second factor is never overwritten.
+func (s *Storage) SaveTwoFactorSecret(ctx context.Context, uid uuid.UUID, secret string) error {
+	const op = "storage.postgres.twofactor.SaveTwoFactorSecret"
+
+	tag, err := s.pool.Exec(ctx, `
+		INSERT INTO two_factor(user_id, secret, last_step, created_at)
+		VALUES($1, $2, 0, NOW())
+		ON CONFLICT (user_id) DO UPDATE
+		SET secret = EXCLUDED.secret, last_step = 0, created_at = NOW()
+		WHERE two_factor.enabled_at IS NULL;
+	`, uid, secret)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrTwoFactorEnabled)
+	}
+
+	return nil
+}
+
+// EnableTwoFactor finishes the enrollment and replaces the recovery codes.
+func (s *Storage) EnableTwoFactor(ctx context.Context, uid uuid.UUID, step int64, recoveryHashes [][]byte) (err error) {
+	const op = "storage.postgres.twofactor.EnableTwoFactor"
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback(ctx)
+			return
+		}
+
+		commitErr := tx.Commit(ctx)
+		if commitErr != nil {
+			err = fmt.Errorf("%s: %w", op, commitErr)
+		}
+	}()
+
+	tag, err := tx.Exec(ctx, `
+		UPDATE two_factor
+		SET enabled_at = NOW(), last_step = $2
+		WHERE user_id = $1 AND enabled_at IS NULL;
+	`, uid, step)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		err = storage.ErrTwoFactorEnabled
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		DELETE FROM recovery_codes
+		WHERE user_id = $1;
+	`, uid)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	for _, hash := range recoveryHashes {
+		_, err = tx.Exec(ctx, `
+			INSERT INTO recovery_codes(user_id, code_hash, created_at)
+			VALUES($1, $2, NOW());
+		`, uid, hash)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	return nil
+}
+
+func (s *Storage) DisableTwoFactor(ctx context.Context, uid uuid.UUID) (err error) {
+	const op = "storage.postgres.twofactor.DisableTwoFactor"
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback(ctx)
+			return
+		}
+
+		commitErr := tx.Commit(ctx)
+		if commitErr != nil {
+			err = fmt.Errorf("%s: %w", op, commitErr)
+		}
+	}()
+
+	_, err = tx.Exec(ctx, `
+		DELETE FROM recovery_codes
+		WHERE user_id = $1;
+	`, uid)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		DELETE FROM two_factor
+		WHERE user_id = $1;
+	`, uid)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// UseTOTPStep remembers the step of an accepted code, so the same
+// code can not be replayed while it is still valid.
+func (s *Storage) UseTOTPStep(ctx context.Context, uid uuid.UUID, step int64) error {
+	const op = "storage.postgres.twofactor.UseTOTPStep"
+
+	tag, err := s.pool.Exec(ctx, `
+		UPDATE two_factor
+		SET last_step = $2
+		WHERE user_id = $1 AND last_step < $2;
+	`, uid, step)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrTOTPCodeReused)
+	}
+
+	return nil
+}
+
+func (s *Storage) UseRecoveryCode(ctx context.Context, uid uuid.UUID, codeHash []byte) error {
+	const op = "storage.postgres.twofactor.UseRecoveryCode"
+
+	tag, err := s.pool.Exec(ctx, `
+		UPDATE recovery_codes
+		SET used_at = NOW()
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL;
+	`, uid, codeHash)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrRecoveryCodeNotFound)
+	}
+
+	return nil
+}
+
+func (s *Storage) SaveLoginChallenge(ctx context.Context, challengeHash []byte, challenge models.LoginChallenge) error {
+	const op = "storage.postgres.twofactor.SaveLoginChallenge"
+
+	_, err := s.pool.Exec(ctx, `
+		INSERT INTO login_challenges(challenge_hash, user_id, email, attempts, created_at, expires_at)
+		VALUES($1, $2, $3, 0, NOW(), $4);
+	`, challengeHash, challenge.UserID, challenge.Email, challenge.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// LoginChallenge returns a challenge that is still open and has attempts left.
+func (s *Storage) LoginChallenge(ctx context.Context, challengeHash []byte, maxAttempts int) (*models.LoginChallenge, error) {
+	const op = "storage.postgres.twofactor.LoginChallenge"
+
+	var challenge models.LoginChallenge
+
+	row := s.pool.QueryRow(ctx, `
+		SELECT user_id, email, expires_at
+		FROM login_challenges
+		WHERE challenge_hash = $1 AND used_at IS NULL AND expires_at > NOW() AND attempts < $2;
+	`, challengeHash, maxAttempts)
+
+	err := row.Scan(&challenge.UserID, &challenge.Email, &challenge.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%s: %w", op, storage.ErrChallengeNotFound)
+		}
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &challenge, nil
+}
+
+func (s *Storage) FailLoginChallenge(ctx context.Context, challengeHash []byte) error {
+	const op = "storage.postgres.twofactor.FailLoginChallenge"
+
+	_, err := s.pool.Exec(ctx, `
+		UPDATE login_challenges
+		SET attempts = attempts + 1
+		WHERE challenge_hash = $1;
+	`, challengeHash)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) ConsumeLoginChallenge(ctx context.Context, challengeHash []byte) error {
+	const op = "storage.postgres.twofactor.ConsumeLoginChallenge"
+
+	tag, err := s.pool.Exec(ctx, `
+		UPDATE login_challenges
+		SET used_at = NOW()
+		WHERE challenge_hash = $1 AND used_at IS NULL;
+	`, challengeHash)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrChallengeNotFound)
+	}
+
+	return nil
+}
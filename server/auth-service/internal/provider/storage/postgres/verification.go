@@ -0,0 +1,103 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	storage "github.com/sergey-frey/cchat/server/auth-service/internal/provider"
+)
+
+// SaveEmailVerificationToken stores a new verification token and drops the
+// unused ones issued to the user before, so only the latest link works.
+func (s *Storage) SaveEmailVerificationToken(ctx context.Context, uid uuid.UUID, tokenHash []byte, expiresAt time.Time) (err error) {
+	const op = "storage.postgres.verification.SaveEmailVerificationToken"
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback(ctx)
+			return
+		}
+
+		commitErr := tx.Commit(ctx)
+		if commitErr != nil {
+			err = fmt.Errorf("%s: %w", op, commitErr)
+		}
+	}()
+
+	_, err = tx.Exec(ctx, `
+		DELETE FROM email_verifications
+		WHERE user_id = $1 AND used_at IS NULL;
+	`, uid)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO email_verifications(token_hash, user_id, created_at, expires_at)
+		VALUES($1, $2, NOW(), $3);
+	`, tokenHash, uid, expiresAt)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// VerifyEmail consumes the token and marks the email of its owner as verified.
+// Unknown, expired and already used tokens are all storage.ErrVerifyTokenNotFound.
+func (s *Storage) VerifyEmail(ctx context.Context, tokenHash []byte) (uid uuid.UUID, err error) {
+	const op = "storage.postgres.verification.VerifyEmail"
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback(ctx)
+			return
+		}
+
+		commitErr := tx.Commit(ctx)
+		if commitErr != nil {
+			err = fmt.Errorf("%s: %w", op, commitErr)
+		}
+	}()
+
+	row := tx.QueryRow(ctx, `
+		UPDATE email_verifications
+		SET used_at = NOW()
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+		RETURNING user_id;
+	`, tokenHash)
+
+	err = row.Scan(&uid)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			err = storage.ErrVerifyTokenNotFound
+		}
+
+		return uuid.Nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE credentials
+		SET email_verified_at = COALESCE(email_verified_at, NOW()), updated_at = NOW()
+		WHERE user_id = $1;
+	`, uid)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return uid, nil
+}
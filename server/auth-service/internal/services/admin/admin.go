@@ -0,0 +1,293 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/google/uuid"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/domain/models"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/lib/logger/sl"
+	storage "github.com/sergey-frey/cchat/server/auth-service/internal/provider"
+)
+
+type Store interface {
+	AccountStatus(ctx context.Context, uid uuid.UUID) (*models.AccountStatus, error)
+	SuspendAccount(ctx context.Context, uid uuid.UUID, reason string) error
+	UnsuspendAccount(ctx context.Context, uid uuid.UUID) error
+	SetRole(ctx context.Context, uid uuid.UUID, role string) error
+	PromoteAdmins(ctx context.Context, uids []uuid.UUID) (int64, error)
+}
+
+type SessionRevoker interface {
+	RevokeUserSessions(ctx context.Context, userID uuid.UUID) error
+}
+
+// EventEmitter appends to the authentication audit log.
+type EventEmitter interface {
+	Emit(ctx context.Context, event models.AuthEvent)
+}
+
+type AdminService struct {
+	store    Store
+	sessions SessionRevoker
+	events   EventEmitter
+	log      *slog.Logger
+}
+
+var (
+	ErrUserNotFound     = errors.New("user not found")
+	ErrOwnAccount       = errors.New("can not manage own account")
+	ErrInsufficientRole = errors.New("role is not high enough to manage the user")
+	ErrInvalidRole      = errors.New("invalid role")
+)
+
+func New(store Store, sessions SessionRevoker, events EventEmitter, log *slog.Logger) *AdminService {
+	return &AdminService{
+		store:    store,
+		sessions: sessions,
+		events:   events,
+		log:      log,
+	}
+}
+
+// Account returns the credentials state of any user.
+func (a *AdminService) Account(ctx context.Context, uid uuid.UUID) (*models.AccountStatus, error) {
+	const op = "services.admin.Account"
+
+	status, err := a.store.AccountStatus(ctx, uid)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return nil, fmt.Errorf("%s: %w", op, ErrUserNotFound)
+		}
+
+		a.log.Error("failed to get account", slog.String("op", op), sl.Err(err))
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return status, nil
+}
+
+// Suspend blocks the user from logging in and ends all of their sessions.
+func (a *AdminService) Suspend(ctx context.Context, actor models.NormalizedUser, uid uuid.UUID, suspend models.SuspendAccount, meta models.RequestMeta) error {
+	const op = "services.admin.Suspend"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.String("actor_id", actor.UUID.String()),
+		slog.String("user_id", uid.String()),
+	)
+
+	if _, err := a.authorize(ctx, actor, uid); err != nil {
+		log.Warn("suspension refused", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.store.SuspendAccount(ctx, uid, suspend.Reason); err != nil {
+		log.Error("failed to suspend account", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("account suspended")
+
+	event := models.NewAuthEvent(models.EventAccountSuspended, uid, meta)
+	event.Details = map[string]string{
+		"actor_id": actor.UUID.String(),
+		"reason":   suspend.Reason,
+	}
+
+	a.events.Emit(ctx, event)
+
+	return nil
+}
+
+// Unsuspend lets the user log in again, the sessions ended by the
+// suspension stay ended.
+func (a *AdminService) Unsuspend(ctx context.Context, actor models.NormalizedUser, uid uuid.UUID, meta models.RequestMeta) error {
+	const op = "services.admin.Unsuspend"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.String("actor_id", actor.UUID.String()),
+		slog.String("user_id", uid.String()),
+	)
+
+	if _, err := a.authorize(ctx, actor, uid); err != nil {
+		log.Warn("unsuspension refused", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.store.UnsuspendAccount(ctx, uid); err != nil {
+		log.Error("failed to unsuspend account", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("account unsuspended")
+
+	event := models.NewAuthEvent(models.EventAccountUnsuspended, uid, meta)
+	event.Details = map[string]string{"actor_id": actor.UUID.String()}
+
+	a.events.Emit(ctx, event)
+
+	return nil
+}
+
+// ForceLogout ends every session of the user.
+func (a *AdminService) ForceLogout(ctx context.Context, actor models.NormalizedUser, uid uuid.UUID, meta models.RequestMeta) error {
+	const op = "services.admin.ForceLogout"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.String("actor_id", actor.UUID.String()),
+		slog.String("user_id", uid.String()),
+	)
+
+	if _, err := a.authorize(ctx, actor, uid); err != nil {
+		log.Warn("forced logout refused", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.sessions.RevokeUserSessions(ctx, uid); err != nil {
+		log.Error("failed to revoke sessions", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("user logged out")
+
+	event := models.NewAuthEvent(models.EventForcedLogout, uid, meta)
+	event.Details = map[string]string{"actor_id": actor.UUID.String()}
+
+	a.events.Emit(ctx, event)
+
+	return nil
+}
+
+// ChangeRole sets the role of the user. The sessions are ended, the role
+// in the tokens already issued would otherwise stay until they expire.
+func (a *AdminService) ChangeRole(ctx context.Context, actor models.NormalizedUser, uid uuid.UUID, change models.ChangeRole, meta models.RequestMeta) error {
+	const op = "services.admin.ChangeRole"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.String("actor_id", actor.UUID.String()),
+		slog.String("user_id", uid.String()),
+	)
+
+	if models.RoleRank(change.Role) == 0 {
+		return fmt.Errorf("%s: %w", op, ErrInvalidRole)
+	}
+
+	// Nobody hands out a role above their own.
+	if models.RoleRank(change.Role) > models.RoleRank(actor.Role) {
+		log.Warn("role change refused", slog.String("role", change.Role))
+
+		return fmt.Errorf("%s: %w", op, ErrInsufficientRole)
+	}
+
+	status, err := a.authorize(ctx, actor, uid)
+	if err != nil {
+		log.Warn("role change refused", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if status.Role == change.Role {
+		return nil
+	}
+
+	if err := a.store.SetRole(ctx, uid, change.Role); err != nil {
+		log.Error("failed to set role", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.sessions.RevokeUserSessions(ctx, uid); err != nil {
+		log.Error("failed to revoke sessions", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("role changed", slog.String("role", change.Role))
+
+	event := models.NewAuthEvent(models.EventRoleChanged, uid, meta)
+	event.Details = map[string]string{
+		"actor_id": actor.UUID.String(),
+		"from":     status.Role,
+		"to":       change.Role,
+	}
+
+	a.events.Emit(ctx, event)
+
+	return nil
+}
+
+// PromoteAdmins makes sure the configured users are admins, ids that do
+// not parse are skipped. It is run on startup so there is always someone
+// to hand out the other roles.
+func (a *AdminService) PromoteAdmins(ctx context.Context, ids []string) error {
+	const op = "services.admin.PromoteAdmins"
+
+	log := a.log.With(
+		slog.String("op", op),
+	)
+
+	uids := make([]uuid.UUID, 0, len(ids))
+	for _, id := range ids {
+		uid, err := uuid.Parse(id)
+		if err != nil {
+			log.Warn("skipping invalid admin user id", slog.String("id", id))
+
+			continue
+		}
+
+		uids = append(uids, uid)
+	}
+
+	if len(uids) == 0 {
+		return nil
+	}
+
+	promoted, err := a.store.PromoteAdmins(ctx, uids)
+	if err != nil {
+		log.Error("failed to promote admins", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if promoted > 0 {
+		log.Info("admins promoted", slog.Int64("promoted", promoted))
+	}
+
+	return nil
+}
+
+// authorize allows the actor to manage users ranked below them, never
+// their own account.
+func (a *AdminService) authorize(ctx context.Context, actor models.NormalizedUser, uid uuid.UUID) (*models.AccountStatus, error) {
+	if actor.UUID == uid {
+		return nil, ErrOwnAccount
+	}
+
+	status, err := a.store.AccountStatus(ctx, uid)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return nil, ErrUserNotFound
+		}
+
+		return nil, err
+	}
+
+	if models.RoleRank(actor.Role) <= models.RoleRank(status.Role) {
+		return nil, ErrInsufficientRole
+	}
+
+	return status, nil
+}
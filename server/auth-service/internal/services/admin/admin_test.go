@@ -0,0 +1,158 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/domain/models"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/lib/logger/slogdiscard"
+	storage "github.com/sergey-frey/cchat/server/auth-service/internal/provider"
+)
+
+type store struct {
+	accounts map[uuid.UUID]*models.AccountStatus
+}
+
+func (s *store) AccountStatus(ctx context.Context, uid uuid.UUID) (*models.AccountStatus, error) {
+	account, ok := s.accounts[uid]
+	if !ok {
+		return nil, storage.ErrUserNotFound
+	}
+
+	copied := *account
+
+	return &copied, nil
+}
+
+func (s *store) SuspendAccount(ctx context.Context, uid uuid.UUID, reason string) error {
+	s.accounts[uid].SuspendedReason = reason
+	return nil
+}
+
+func (s *store) UnsuspendAccount(ctx context.Context, uid uuid.UUID) error {
+	s.accounts[uid].SuspendedReason = ""
+	return nil
+}
+
+func (s *store) SetRole(ctx context.Context, uid uuid.UUID, role string) error {
+	s.accounts[uid].Role = role
+	return nil
+}
+
+func (s *store) PromoteAdmins(ctx context.Context, uids []uuid.UUID) (int64, error) {
+	var promoted int64
+
+	for _, uid := range uids {
+		if account, ok := s.accounts[uid]; ok && account.Role != models.RoleAdmin {
+			account.Role = models.RoleAdmin
+			promoted++
+		}
+	}
+
+	return promoted, nil
+}
+
+type sessions struct {
+	revoked []uuid.UUID
+}
+
+func (s *sessions) RevokeUserSessions(ctx context.Context, userID uuid.UUID) error {
+	s.revoked = append(s.revoked, userID)
+	return nil
+}
+
+type events struct {
+	types []string
+}
+
+func (e *events) Emit(ctx context.Context, event models.AuthEvent) {
+	e.types = append(e.types, event.Type)
+}
+
+func TestAdmin_RoleRanks(t *testing.T) {
+	ctx := context.Background()
+
+	admin := models.NormalizedUser{UUID: uuid.New(), Role: models.RoleAdmin}
+	moderator := models.NormalizedUser{UUID: uuid.New(), Role: models.RoleModerator}
+	user := models.NormalizedUser{UUID: uuid.New(), Role: models.RoleUser}
+	otherAdmin := uuid.New()
+
+	st := &store{accounts: map[uuid.UUID]*models.AccountStatus{
+		admin.UUID:     {UserID: admin.UUID, Role: models.RoleAdmin},
+		moderator.UUID: {UserID: moderator.UUID, Role: models.RoleModerator},
+		user.UUID:      {UserID: user.UUID, Role: models.RoleUser},
+		otherAdmin:     {UserID: otherAdmin, Role: models.RoleUser},
+	}}
+	revoker := &sessions{}
+	log := &events{}
+
+	a := New(st, revoker, log, slogdiscard.NewDiscardLogger())
+
+	if err := a.PromoteAdmins(ctx, []string{otherAdmin.String(), "not-a-uuid"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if st.accounts[otherAdmin].Role != models.RoleAdmin {
+		t.Fatal("expected the configured user to be promoted")
+	}
+
+	suspend := models.SuspendAccount{Reason: "spam"}
+
+	if err := a.Suspend(ctx, moderator, user.UUID, suspend, models.RequestMeta{}); err != nil {
+		t.Fatalf("expected a moderator to suspend a user, got %v", err)
+	}
+
+	if err := a.Suspend(ctx, moderator, admin.UUID, suspend, models.RequestMeta{}); !errors.Is(err, ErrInsufficientRole) {
+		t.Fatalf("expected a moderator not to suspend an admin, got %v", err)
+	}
+
+	if err := a.Suspend(ctx, admin, otherAdmin, suspend, models.RequestMeta{}); !errors.Is(err, ErrInsufficientRole) {
+		t.Fatalf("expected an admin not to suspend another admin, got %v", err)
+	}
+
+	if err := a.ForceLogout(ctx, admin, admin.UUID, models.RequestMeta{}); !errors.Is(err, ErrOwnAccount) {
+		t.Fatalf("expected an admin not to manage their own account, got %v", err)
+	}
+
+	if err := a.ForceLogout(ctx, admin, uuid.New(), models.RequestMeta{}); !errors.Is(err, ErrUserNotFound) {
+		t.Fatalf("expected an unknown user to be reported, got %v", err)
+	}
+
+	if err := a.ChangeRole(ctx, moderator, user.UUID, models.ChangeRole{Role: models.RoleAdmin}, models.RequestMeta{}); !errors.Is(err, ErrInsufficientRole) {
+		t.Fatalf("expected a moderator not to hand out the admin role, got %v", err)
+	}
+
+	if err := a.ChangeRole(ctx, admin, user.UUID, models.ChangeRole{Role: models.RoleModerator}, models.RequestMeta{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if st.accounts[user.UUID].Role != models.RoleModerator {
+		t.Fatal("expected the role to be changed")
+	}
+
+	if !slices.Equal(revoker.revoked, []uuid.UUID{user.UUID}) {
+		t.Fatalf("expected the role change to end the sessions, revoked %v", revoker.revoked)
+	}
+
+	// The former user is a moderator now, out of reach for other moderators.
+	if err := a.Unsuspend(ctx, moderator, user.UUID, models.RequestMeta{}); !errors.Is(err, ErrInsufficientRole) {
+		t.Fatalf("expected a moderator not to manage another moderator, got %v", err)
+	}
+
+	if err := a.Unsuspend(ctx, admin, user.UUID, models.RequestMeta{}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		models.EventAccountSuspended,
+		models.EventRoleChanged,
+		models.EventAccountUnsuspended,
+	}
+
+	if !slices.Equal(log.types, want) {
+		t.Fatalf("expected events %v, got %v", want, log.types)
+	}
+}
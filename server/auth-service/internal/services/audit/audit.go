@@ -0,0 +1,98 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/google/uuid"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/domain/models"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/lib/logger/sl"
+)
+
+const (
+	defaultLimit = 20
+	maxLimit     = 100
+)
+
+type EventStore interface {
+	SaveAuthEvent(ctx context.Context, event models.AuthEvent) error
+	AuthEvents(ctx context.Context, filter models.EventFilter) ([]models.AuthEvent, error)
+}
+
+type AuditService struct {
+	events EventStore
+	log    *slog.Logger
+}
+
+func New(events EventStore, log *slog.Logger) *AuditService {
+	return &AuditService{
+		events: events,
+		log:    log,
+	}
+}
+
+// Emit appends the event to the audit log. The action it describes has
+// already happened, so a failed write is logged and never returned.
+func (a *AuditService) Emit(ctx context.Context, event models.AuthEvent) {
+	const op = "services.audit.Emit"
+
+	if err := a.events.SaveAuthEvent(ctx, event); err != nil {
+		a.log.Error("failed to save auth event",
+			slog.String("op", op),
+			slog.String("type", event.Type),
+			slog.String("request_id", event.RequestID),
+			sl.Err(err),
+		)
+	}
+}
+
+// UserEvents returns the history of one user.
+func (a *AuditService) UserEvents(ctx context.Context, uid uuid.UUID, cursor int64, limit int) (*models.EventPage, error) {
+	const op = "services.audit.UserEvents"
+
+	page, err := a.QueryEvents(ctx, models.EventFilter{
+		UserID: uuid.NullUUID{UUID: uid, Valid: true},
+		Cursor: cursor,
+		Limit:  limit,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return page, nil
+}
+
+// QueryEvents returns one page of the events matching the filter.
+func (a *AuditService) QueryEvents(ctx context.Context, filter models.EventFilter) (*models.EventPage, error) {
+	const op = "services.audit.QueryEvents"
+
+	log := a.log.With(
+		slog.String("op", op),
+	)
+
+	limit := filter.Limit
+	if limit < 1 {
+		limit = defaultLimit
+	}
+	limit = min(limit, maxLimit)
+
+	// One more event than asked tells whether there is a next page.
+	filter.Limit = limit + 1
+
+	events, err := a.events.AuthEvents(ctx, filter)
+	if err != nil {
+		log.Error("failed to get auth events", sl.Err(err))
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	page := &models.EventPage{Events: events}
+
+	if len(events) > limit {
+		page.Events = events[:limit]
+		page.NextCursor = page.Events[limit-1].ID
+	}
+
+	return page, nil
+}
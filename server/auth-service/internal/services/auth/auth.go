@@ -6,11 +6,13 @@ import (
 	"fmt"
 	"log/slog"
 
-	"github.com/brianvoe/gofakeit/v6"
+	"time"
+
 	"github.com/google/uuid"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/config"
 	"github.com/sergey-frey/cchat/server/auth-service/internal/domain/models"
-	"github.com/sergey-frey/cchat/server/auth-service/internal/lib/jwt"
 	"github.com/sergey-frey/cchat/server/auth-service/internal/lib/logger/sl"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/lib/token"
 	storage "github.com/sergey-frey/cchat/server/auth-service/internal/provider"
 	"golang.org/x/crypto/bcrypt"
 )
@@ -20,6 +22,11 @@ type AuthProvider interface {
 	Login(ctx context.Context, uuid uuid.UUID) ([]byte, error)
 	Password(ctx context.Context, uuid uuid.UUID) ([]byte, error)
 	ChangePassword(ctx context.Context, uid uuid.UUID, newPasswordHash []byte) error
+	SavePasswordResetToken(ctx context.Context, uid uuid.UUID, tokenHash []byte, expiresAt time.Time) error
+	ResetPasswordByToken(ctx context.Context, tokenHash []byte, newPasswordHash []byte) (uuid.UUID, error)
+	Account(ctx context.Context, uid uuid.UUID) (*models.Account, error)
+	SaveEmailVerificationToken(ctx context.Context, uid uuid.UUID, tokenHash []byte, expiresAt time.Time) error
+	VerifyEmail(ctx context.Context, tokenHash []byte) (uuid.UUID, error)
 }
 
 type UserProvider interface {
@@ -27,10 +34,41 @@ type UserProvider interface {
 	CreateUser(ctx context.Context, email string) (*models.NormalizedUser, error)
 }
 
+type SessionIssuer interface {
+	NewSession(ctx context.Context, user models.NormalizedUser, meta models.RequestMeta) (accessToken string, refreshToken string, err error)
+	RevokeUserSessions(ctx context.Context, userID uuid.UUID) error
+}
+
+type ChallengeIssuer interface {
+	NewChallenge(ctx context.Context, user models.NormalizedUser) (*models.TwoFactorChallenge, error)
+}
+
+// LoginGuard throttles failed logins per account and per IP.
+type LoginGuard interface {
+	Check(ctx context.Context, uid uuid.UUID, ip string) error
+	Fail(ctx context.Context, user *models.NormalizedUser, meta models.RequestMeta) error
+	Succeed(ctx context.Context, uid uuid.UUID) error
+}
+
+// EventEmitter appends to the authentication audit log.
+type EventEmitter interface {
+	Emit(ctx context.Context, event models.AuthEvent)
+}
+
+type Mailer interface {
+	Send(ctx context.Context, mail models.Mail) error
+}
+
 type AuthService struct {
-	auth AuthProvider
-	user UserProvider
-	log  *slog.Logger
+	auth     AuthProvider
+	user     UserProvider
+	sessions   SessionIssuer
+	challenges ChallengeIssuer
+	guard      LoginGuard
+	events     EventEmitter
+	mailer     Mailer
+	cfg        *config.Config
+	log        *slog.Logger
 }
 
 var (
@@ -39,18 +77,31 @@ var (
 	ErrInvalidAppID       = errors.New("invalid app id")
 	ErrUserExists         = errors.New("user already exists")
 	ErrUserNotFound       = errors.New("user not found")
+	ErrInvalidResetToken  = errors.New("invalid or expired reset token")
+	ErrInvalidVerifyToken = errors.New("invalid or expired verification token")
+	ErrEmailNotVerified   = errors.New("email not verified")
+	ErrAccountDeactivated = errors.New("account is scheduled for deletion")
+	ErrAccountSuspended   = errors.New("account is suspended")
 )
 
-func New(auth AuthProvider, user UserProvider, log *slog.Logger) *AuthService {
+func New(auth AuthProvider, user UserProvider, sessions SessionIssuer, challenges ChallengeIssuer, guard LoginGuard, events EventEmitter, mailer Mailer, cfg *config.Config, log *slog.Logger) *AuthService {
 	return &AuthService{
-		auth: auth,
-		user: user,
-		log:  log,
+		auth:       auth,
+		user:       user,
+		sessions:   sessions,
+		challenges: challenges,
+		guard:      guard,
+		events:     events,
+		mailer:     mailer,
+		cfg:        cfg,
+		log:        log,
 	}
 }
 
 //go:generate go run github.com/vektra/mockery/v2@v2.53 --name=Auth
-func (a *AuthService) Login(ctx context.Context, loginUser models.LoginUser) (*models.NormalizedUser, string, string, error) {
+// Login checks the password and starts a session. Accounts with a second
+// factor get a challenge instead, it is completed by the two-factor service.
+func (a *AuthService) Login(ctx context.Context, loginUser models.LoginUser, meta models.RequestMeta) (*models.LoginResult, error) {
 	const op = "services.auth.Login"
 
 	log := a.log.With(
@@ -61,16 +112,33 @@ func (a *AuthService) Login(ctx context.Context, loginUser models.LoginUser) (*m
 	log.Info("attempting to login user")
 
 	user, err := a.user.GetUser(ctx, loginUser.Email)
-	if err != nil {
-		if errors.Is(err, storage.ErrUserNotFound) {
-			log.Warn("user not found", sl.Err(err))
+	if err != nil && !errors.Is(err, storage.ErrUserNotFound) {
+		log.Error("failed to get user", sl.Err(err))
 
-			return nil, "", "", fmt.Errorf("%s: %w", op, ErrInvalidCredentials)
-		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
 
-		log.Error("failed to get user", sl.Err(err))
+	// Unknown emails are throttled by IP as well, otherwise guessing
+	// which emails are registered would be free.
+	var uid uuid.UUID
+	if user != nil {
+		uid = user.UUID
+	}
 
-		return nil, "", "", fmt.Errorf("%s: %w", op, err)
+	if err := a.guard.Check(ctx, uid, meta.IP); err != nil {
+		log.Warn("login blocked", sl.Err(err))
+
+		a.emitLoginFailed(ctx, uid, loginUser.Email, "blocked", meta)
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if user == nil {
+		log.Warn("user not found")
+
+		a.loginFailed(ctx, nil, loginUser.Email, meta, log)
+
+		return nil, fmt.Errorf("%s: %w", op, ErrInvalidCredentials)
 	}
 
 	passHash, err := a.auth.Login(ctx, user.UUID)
@@ -78,32 +146,122 @@ func (a *AuthService) Login(ctx context.Context, loginUser models.LoginUser) (*m
 		if errors.Is(err, storage.ErrUserNotFound) {
 			log.Warn("user not found", sl.Err(err))
 
-			return nil, "", "", fmt.Errorf("%s: %w", op, ErrInvalidCredentials)
+			a.loginFailed(ctx, nil, loginUser.Email, meta, log)
+
+			return nil, fmt.Errorf("%s: %w", op, ErrInvalidCredentials)
 		}
 
 		log.Error("failed to get user", sl.Err(err))
 
-		return nil, "", "", fmt.Errorf("%s: %w", op, err)
+		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
 	if err := bcrypt.CompareHashAndPassword(passHash, []byte(loginUser.Password)); err != nil {
 		log.Warn("invalid credentials", sl.Err(err))
-		return nil, "", "", fmt.Errorf("%s: %w", op, ErrInvalidCredentials)
+
+		a.loginFailed(ctx, user, loginUser.Email, meta, log)
+
+		return nil, fmt.Errorf("%s: %w", op, ErrInvalidCredentials)
+	}
+
+	account, err := a.auth.Account(ctx, user.UUID)
+	if err != nil {
+		log.Error("failed to get account", sl.Err(err))
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if account.Deactivated {
+		log.Warn("account is scheduled for deletion")
+
+		a.emitLoginFailed(ctx, user.UUID, loginUser.Email, "account_deactivated", meta)
+
+		return nil, fmt.Errorf("%s: %w", op, ErrAccountDeactivated)
+	}
+
+	if account.Suspended {
+		log.Warn("account is suspended")
+
+		a.emitLoginFailed(ctx, user.UUID, loginUser.Email, "account_suspended", meta)
+
+		return nil, fmt.Errorf("%s: %w", op, ErrAccountSuspended)
+	}
+
+	user.EmailVerified = account.EmailVerified
+	user.Role = account.Role
+
+	if !user.EmailVerified && a.cfg.Verification.RequiredForLogin {
+		log.Warn("email not verified")
+
+		a.emitLoginFailed(ctx, user.UUID, loginUser.Email, "email_not_verified", meta)
+
+		return nil, fmt.Errorf("%s: %w", op, ErrEmailNotVerified)
+	}
+
+	if account.TwoFactorEnabled {
+		challenge, err := a.challenges.NewChallenge(ctx, *user)
+		if err != nil {
+			log.Error("failed to issue login challenge", sl.Err(err))
+
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		log.Info("second factor required")
+
+		return &models.LoginResult{Challenge: challenge}, nil
+	}
+
+	// Only a login that ends in a session resets the counters. A refused
+	// account or a pending second factor leaves them as they are, the
+	// counters of the latter are reset once the challenge is completed.
+	if err := a.guard.Succeed(ctx, user.UUID); err != nil {
+		log.Error("failed to reset login attempts", sl.Err(err))
 	}
 
 	log.Info("user logged in successfully")
 
-	accessToken, refreshToken, err := jwt.NewPairTokens(*user)
+	accessToken, refreshToken, err := a.sessions.NewSession(ctx, *user, meta)
 	if err != nil {
-		log.Error("failed to generate tokens", sl.Err(err))
+		log.Error("failed to start session", sl.Err(err))
 
-		return nil, "", "", fmt.Errorf("%s: %w", op, err)
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	a.events.Emit(ctx, models.NewAuthEvent(models.EventLoginSucceeded, user.UUID, meta))
+
+	return &models.LoginResult{
+		User:         user,
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+	}, nil
+}
+
+// loginFailed counts the failure. The caller answers with invalid
+// credentials either way, so a broken counter is only logged.
+func (a *AuthService) loginFailed(ctx context.Context, user *models.NormalizedUser, email string, meta models.RequestMeta, log *slog.Logger) {
+	var uid uuid.UUID
+	if user != nil {
+		uid = user.UUID
+	}
+
+	a.emitLoginFailed(ctx, uid, email, "invalid_credentials", meta)
+
+	if err := a.guard.Fail(ctx, user, meta); err != nil {
+		log.Error("failed to count failed login", sl.Err(err))
+	}
+}
+
+func (a *AuthService) emitLoginFailed(ctx context.Context, uid uuid.UUID, email string, reason string, meta models.RequestMeta) {
+	event := models.NewAuthEvent(models.EventLoginFailed, uid, meta)
+	event.Details = map[string]string{
+		"email":  email,
+		"reason": reason,
 	}
 
-	return user, accessToken, refreshToken, err
+	a.events.Emit(ctx, event)
 }
 
-func (a *AuthService) RegisterNewUser(ctx context.Context, registerUser models.RegisterUser) (*models.NormalizedUser, string, string, error) {
+func (a *AuthService) RegisterNewUser(ctx context.Context, registerUser models.RegisterUser, meta models.RequestMeta) (*models.NormalizedUser, string, string, error) {
 	const op = "services.auth.RegisterNewUser"
 
 	log := a.log.With(
@@ -142,9 +300,20 @@ func (a *AuthService) RegisterNewUser(ctx context.Context, registerUser models.R
 
 	log.Info("user registered")
 
-	accessToken, refreshToken, err := jwt.NewPairTokens(*user)
+	a.events.Emit(ctx, models.NewAuthEvent(models.EventRegister, user.UUID, meta))
+
+	// A failed mail does not undo the registration, the user can ask for another one.
+	if err := a.sendVerification(ctx, *user); err != nil {
+		log.Error("failed to send verification mail", sl.Err(err))
+	}
+
+	if a.cfg.Verification.RequiredForLogin {
+		return user, "", "", nil
+	}
+
+	accessToken, refreshToken, err := a.sessions.NewSession(ctx, *user, meta)
 	if err != nil {
-		log.Error("failed to generate tokens", sl.Err(err))
+		log.Error("failed to start session", sl.Err(err))
 
 		return nil, "", "", fmt.Errorf("%s: %w", op, err)
 	}
@@ -152,7 +321,7 @@ func (a *AuthService) RegisterNewUser(ctx context.Context, registerUser models.R
 	return user, accessToken, refreshToken, nil
 }
 
-func (a *AuthService) ChangePassword(ctx context.Context, newPassword models.NewPassword) (error) {
+func (a *AuthService) ChangePassword(ctx context.Context, newPassword models.NewPassword, meta models.RequestMeta) (error) {
 	const op = "services.auth.ChangePassword"
 
 	log := a.log.With(
@@ -210,10 +379,15 @@ func (a *AuthService) ChangePassword(ctx context.Context, newPassword models.New
 
 	log.Info("password changed successfully")
 
+	a.events.Emit(ctx, models.NewAuthEvent(models.EventPasswordChanged, user.UUID, meta))
+
 	return nil
 }
 
-func (a *AuthService) ResetPassword(ctx context.Context, resetPassword models.ResetPassword) (error) {
+// ResetPassword mails a single-use reset link to the owner of the email.
+// An unknown email is not reported to the caller, so the endpoint can not
+// be used to find out who is registered.
+func (a *AuthService) ResetPassword(ctx context.Context, resetPassword models.ResetPassword, meta models.RequestMeta) error {
 	const op = "services.auth.ResetPassword"
 
 	log := a.log.With(
@@ -221,46 +395,205 @@ func (a *AuthService) ResetPassword(ctx context.Context, resetPassword models.Re
 		slog.String("email", resetPassword.Email),
 	)
 
-	log.Info("changing user password")
+	log.Info("requesting password reset")
 
 	user, err := a.user.GetUser(ctx, resetPassword.Email)
 	if err != nil {
 		if errors.Is(err, storage.ErrUserNotFound) {
 			log.Warn("user not found", sl.Err(err))
 
-			return fmt.Errorf("%s: %w", op, ErrUserNotFound)
+			return nil
 		}
 
 		log.Error("failed to get user", sl.Err(err))
 
 		return fmt.Errorf("%s: %w", op, err)
 	}
-	
 
-	key := gofakeit.Password(true, true, true, true, false, 14)
+	plain, hash, err := token.New()
+	if err != nil {
+		log.Error("failed to generate reset token", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
 
-	passHash, err := bcrypt.GenerateFromPassword([]byte(key), bcrypt.DefaultCost)
+	err = a.auth.SavePasswordResetToken(ctx, user.UUID, hash, time.Now().Add(a.cfg.PasswordReset.TokenTTL))
+	if err != nil {
+		log.Error("failed to save reset token", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	link := a.cfg.PasswordReset.URL + "?token=" + plain
+
+	err = a.mailer.Send(ctx, models.Mail{
+		To:      user.Email,
+		Subject: "Cchat password reset",
+		Body: fmt.Sprintf(
+			"Someone asked to reset the password of your Cchat account.\n\nFollow the link to set a new one: %s\n\nThe link expires in %s. If it was not you, ignore this email.",
+			link, a.cfg.PasswordReset.TokenTTL,
+		),
+	})
+	if err != nil {
+		log.Error("failed to send reset mail", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("reset link sent")
+
+	a.events.Emit(ctx, models.NewAuthEvent(models.EventPasswordResetRequested, user.UUID, meta))
+
+	return nil
+}
+
+// ConfirmPasswordReset sets a new password for the owner of the token
+// and logs the user out everywhere.
+func (a *AuthService) ConfirmPasswordReset(ctx context.Context, confirm models.ConfirmPasswordReset, meta models.RequestMeta) error {
+	const op = "services.auth.ConfirmPasswordReset"
+
+	log := a.log.With(
+		slog.String("op", op),
+	)
+
+	log.Info("confirming password reset")
+
+	passHash, err := bcrypt.GenerateFromPassword([]byte(confirm.NewPassword), bcrypt.DefaultCost)
 	if err != nil {
 		log.Error("failed to generate password hash", sl.Err(err))
 
 		return fmt.Errorf("%s: %w", op, err)
 	}
 
-	err = a.auth.ChangePassword(ctx, user.UUID, passHash)
+	uid, err := a.auth.ResetPasswordByToken(ctx, token.Hash(confirm.Token), passHash)
 	if err != nil {
-		if errors.Is(err, storage.ErrUserExists) {
-			log.Warn("user already exists", sl.Err(err))
+		if errors.Is(err, storage.ErrResetTokenNotFound) {
+			log.Warn("invalid reset token", sl.Err(err))
 
-			return fmt.Errorf("%s: %w", op, ErrUserExists)
+			return fmt.Errorf("%s: %w", op, ErrInvalidResetToken)
 		}
 
-		log.Error("failed to save user", sl.Err(err))
+		log.Error("failed to reset password", sl.Err(err))
 
 		return fmt.Errorf("%s: %w", op, err)
 	}
 
-	log.Info("password changed successfully")
+	log = log.With(slog.String("user_id", uid.String()))
+
+	err = a.sessions.RevokeUserSessions(ctx, uid)
+	if err != nil {
+		log.Error("failed to revoke sessions", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("password reset")
+
+	a.events.Emit(ctx, models.NewAuthEvent(models.EventPasswordReset, uid, meta))
 
 	return nil
 }
 
+// VerifyEmail marks the email of the token owner as verified and returns the owner.
+func (a *AuthService) VerifyEmail(ctx context.Context, verify models.VerifyEmail) (uuid.UUID, error) {
+	const op = "services.auth.VerifyEmail"
+
+	log := a.log.With(
+		slog.String("op", op),
+	)
+
+	log.Info("verifying email")
+
+	uid, err := a.auth.VerifyEmail(ctx, token.Hash(verify.Token))
+	if err != nil {
+		if errors.Is(err, storage.ErrVerifyTokenNotFound) {
+			log.Warn("invalid verification token", sl.Err(err))
+
+			return uuid.Nil, fmt.Errorf("%s: %w", op, ErrInvalidVerifyToken)
+		}
+
+		log.Error("failed to verify email", sl.Err(err))
+
+		return uuid.Nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("email verified", slog.String("user_id", uid.String()))
+
+	return uid, nil
+}
+
+// ResendVerification mails a new verification link. Unknown and already
+// verified emails are not reported to the caller.
+func (a *AuthService) ResendVerification(ctx context.Context, resend models.ResendVerification) error {
+	const op = "services.auth.ResendVerification"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.String("email", resend.Email),
+	)
+
+	log.Info("resending verification mail")
+
+	user, err := a.user.GetUser(ctx, resend.Email)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.Warn("user not found", sl.Err(err))
+
+			return nil
+		}
+
+		log.Error("failed to get user", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	account, err := a.auth.Account(ctx, user.UUID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.Warn("credentials not found", sl.Err(err))
+
+			return nil
+		}
+
+		log.Error("failed to get account", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if account.EmailVerified {
+		log.Info("email already verified")
+
+		return nil
+	}
+
+	if err := a.sendVerification(ctx, *user); err != nil {
+		log.Error("failed to send verification mail", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (a *AuthService) sendVerification(ctx context.Context, user models.NormalizedUser) error {
+	plain, hash, err := token.New()
+	if err != nil {
+		return err
+	}
+
+	err = a.auth.SaveEmailVerificationToken(ctx, user.UUID, hash, time.Now().Add(a.cfg.Verification.TokenTTL))
+	if err != nil {
+		return err
+	}
+
+	link := a.cfg.Verification.URL + "?token=" + plain
+
+	return a.mailer.Send(ctx, models.Mail{
+		To:      user.Email,
+		Subject: "Confirm your Cchat email",
+		Body: fmt.Sprintf(
+			"Welcome to Cchat!\n\nFollow the link to confirm your email: %s\n\nThe link expires in %s. If you did not create an account, ignore this email.",
+			link, a.cfg.Verification.TokenTTL,
+		),
+	})
+}
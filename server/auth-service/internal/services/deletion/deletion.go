@@ -0,0 +1,378 @@
+package deletion
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/config"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/domain/models"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/lib/logger/sl"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/lib/token"
+	storage "github.com/sergey-frey/cchat/server/auth-service/internal/provider"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type Store interface {
+	Password(ctx context.Context, uid uuid.UUID) ([]byte, error)
+	ScheduleDeletion(ctx context.Context, uid uuid.UUID, restoreTokenHash []byte, scheduledFor time.Time) error
+	SaveDeletionConfirmation(ctx context.Context, uid uuid.UUID, tokenHash []byte, expiresAt time.Time) error
+	ConsumeDeletionConfirmation(ctx context.Context, uid uuid.UUID, tokenHash []byte) error
+	RestoreAccount(ctx context.Context, restoreTokenHash []byte) (uuid.UUID, error)
+	ClaimDeletions(ctx context.Context, limit int, leaseUntil time.Time) ([]models.AccountDeletion, error)
+	CompleteDeletionStep(ctx context.Context, uid uuid.UUID, step string) error
+	RetryDeletion(ctx context.Context, uid uuid.UUID, nextAttemptAt time.Time, reason string) error
+	FinishDeletion(ctx context.Context, uid uuid.UUID) error
+}
+
+type SessionRevoker interface {
+	RevokeUserSessions(ctx context.Context, userID uuid.UUID) error
+}
+
+// EventEmitter appends to the authentication audit log.
+type EventEmitter interface {
+	Emit(ctx context.Context, event models.AuthEvent)
+}
+
+type Mailer interface {
+	Send(ctx context.Context, mail models.Mail) error
+}
+
+// Eraser removes what one service keeps about the user. A failed deletion
+// is run again, so erasing a user that is already gone has to succeed.
+type Eraser interface {
+	EraseUser(ctx context.Context, uid uuid.UUID) error
+}
+
+// Step is one service the user is erased from. Name is recorded once the
+// step succeeds, it must not change between releases.
+type Step struct {
+	Name   string
+	Eraser Eraser
+}
+
+type DeletionService struct {
+	store    Store
+	sessions SessionRevoker
+	events   EventEmitter
+	mailer   Mailer
+	steps    []Step
+	cfg      *config.Config
+	log      *slog.Logger
+	now      func() time.Time
+}
+
+var (
+	ErrInvalidCredentials  = errors.New("invalid credentials")
+	ErrInvalidRestoreToken = errors.New("invalid or expired restore token")
+	ErrInvalidConfirmToken = errors.New("invalid or expired confirmation token")
+	ErrConfirmationSent    = errors.New("deletion confirmation sent")
+)
+
+func New(store Store, sessions SessionRevoker, events EventEmitter, mailer Mailer, steps []Step, cfg *config.Config, log *slog.Logger) *DeletionService {
+	return &DeletionService{
+		store:    store,
+		sessions: sessions,
+		events:   events,
+		mailer:   mailer,
+		steps:    steps,
+		cfg:      cfg,
+		log:      log,
+		now:      time.Now,
+	}
+}
+
+// Request confirms the password and schedules the deletion of the account.
+// The account is deactivated and logged out everywhere right away, the
+// mailed link restores it until the grace period is over. An account made
+// through an identity provider has no password, it is mailed a link to
+// confirm the deletion instead and gets ErrConfirmationSent.
+func (d *DeletionService) Request(ctx context.Context, user models.NormalizedUser, deleteAccount models.DeleteAccount, meta models.RequestMeta) (*models.DeletionScheduled, error) {
+	const op = "services.deletion.Request"
+
+	log := d.log.With(
+		slog.String("op", op),
+		slog.String("user_id", user.UUID.String()),
+	)
+
+	log.Info("requesting account deletion")
+
+	passHash, err := d.store.Password(ctx, user.UUID)
+	if err != nil {
+		log.Error("failed to get password", sl.Err(err))
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if len(passHash) == 0 {
+		if err := d.requestConfirmation(ctx, user); err != nil {
+			log.Error("failed to send deletion confirmation", sl.Err(err))
+
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		log.Info("deletion confirmation sent")
+
+		return nil, fmt.Errorf("%s: %w", op, ErrConfirmationSent)
+	}
+
+	if err := bcrypt.CompareHashAndPassword(passHash, []byte(deleteAccount.Password)); err != nil {
+		log.Warn("invalid credentials", sl.Err(err))
+
+		return nil, fmt.Errorf("%s: %w", op, ErrInvalidCredentials)
+	}
+
+	scheduled, err := d.schedule(ctx, user, meta)
+	if err != nil {
+		log.Error("failed to schedule deletion", sl.Err(err))
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return scheduled, nil
+}
+
+// Confirm schedules the deletion of an account without a password once
+// the user follows the mailed link. The token only works for the user it
+// was mailed to.
+func (d *DeletionService) Confirm(ctx context.Context, user models.NormalizedUser, confirm models.ConfirmDeletion, meta models.RequestMeta) (*models.DeletionScheduled, error) {
+	const op = "services.deletion.Confirm"
+
+	log := d.log.With(
+		slog.String("op", op),
+		slog.String("user_id", user.UUID.String()),
+	)
+
+	err := d.store.ConsumeDeletionConfirmation(ctx, user.UUID, token.Hash(confirm.Token))
+	if err != nil {
+		if errors.Is(err, storage.ErrConfirmTokenNotFound) {
+			log.Warn("invalid confirmation token", sl.Err(err))
+
+			return nil, fmt.Errorf("%s: %w", op, ErrInvalidConfirmToken)
+		}
+
+		log.Error("failed to confirm deletion", sl.Err(err))
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	scheduled, err := d.schedule(ctx, user, meta)
+	if err != nil {
+		log.Error("failed to schedule deletion", sl.Err(err))
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return scheduled, nil
+}
+
+func (d *DeletionService) schedule(ctx context.Context, user models.NormalizedUser, meta models.RequestMeta) (*models.DeletionScheduled, error) {
+	log := d.log.With(
+		slog.String("user_id", user.UUID.String()),
+	)
+
+	plain, hash, err := token.New()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate restore token: %w", err)
+	}
+
+	scheduledFor := d.now().Add(d.cfg.Deletion.GracePeriod)
+
+	err = d.store.ScheduleDeletion(ctx, user.UUID, hash, scheduledFor)
+	if err != nil {
+		return nil, err
+	}
+
+	err = d.sessions.RevokeUserSessions(ctx, user.UUID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+
+	log.Info("account deletion scheduled")
+
+	event := models.NewAuthEvent(models.EventDeletionRequested, user.UUID, meta)
+	event.Details = map[string]string{"scheduled_for": scheduledFor.UTC().Format(time.RFC3339)}
+
+	d.events.Emit(ctx, event)
+
+	// The deletion stands without the mail, only the way back is lost.
+	if err := d.sendRestore(ctx, user, plain, scheduledFor); err != nil {
+		log.Error("failed to send restore mail", sl.Err(err))
+	}
+
+	return &models.DeletionScheduled{ScheduledFor: scheduledFor}, nil
+}
+
+func (d *DeletionService) requestConfirmation(ctx context.Context, user models.NormalizedUser) error {
+	plain, hash, err := token.New()
+	if err != nil {
+		return fmt.Errorf("failed to generate confirmation token: %w", err)
+	}
+
+	err = d.store.SaveDeletionConfirmation(ctx, user.UUID, hash, d.now().Add(d.cfg.Deletion.ConfirmTTL))
+	if err != nil {
+		return err
+	}
+
+	link := d.cfg.Deletion.ConfirmURL + "?token=" + plain
+
+	return d.mailer.Send(ctx, models.Mail{
+		To:      user.Email,
+		Subject: "Confirm the deletion of your Cchat account",
+		Body: fmt.Sprintf(
+			"Follow the link to delete your Cchat account: %s\n\nThe link is valid for %s. If it was not you, ignore this mail and log out your other sessions.",
+			link, d.cfg.Deletion.ConfirmTTL,
+		),
+	})
+}
+
+// Restore cancels the deletion and reactivates the account, the user logs
+// in again afterwards.
+func (d *DeletionService) Restore(ctx context.Context, restore models.RestoreAccount, meta models.RequestMeta) error {
+	const op = "services.deletion.Restore"
+
+	log := d.log.With(
+		slog.String("op", op),
+	)
+
+	uid, err := d.store.RestoreAccount(ctx, token.Hash(restore.Token))
+	if err != nil {
+		if errors.Is(err, storage.ErrDeletionNotFound) {
+			log.Warn("invalid restore token", sl.Err(err))
+
+			return fmt.Errorf("%s: %w", op, ErrInvalidRestoreToken)
+		}
+
+		log.Error("failed to restore account", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("account restored", slog.String("user_id", uid.String()))
+
+	d.events.Emit(ctx, models.NewAuthEvent(models.EventDeletionCancelled, uid, meta))
+
+	return nil
+}
+
+// Run erases the accounts past their grace period until ctx is done.
+func (d *DeletionService) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.cfg.Deletion.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		d.processDue(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// processDue runs the deletions that are due and returns how many of
+// them completed.
+func (d *DeletionService) processDue(ctx context.Context) int {
+	const op = "services.deletion.processDue"
+
+	log := d.log.With(
+		slog.String("op", op),
+	)
+
+	// A run that outlives the lease could meet a second one, the steps
+	// are idempotent so that only costs a repeated call.
+	deletions, err := d.store.ClaimDeletions(ctx, d.cfg.Deletion.BatchSize, d.now().Add(d.cfg.Deletion.RetryInterval))
+	if err != nil {
+		log.Error("failed to claim deletions", sl.Err(err))
+
+		return 0
+	}
+
+	completed := 0
+
+	for _, deletion := range deletions {
+		if err := d.process(ctx, deletion); err != nil {
+			log.Error("account deletion failed",
+				slog.String("user_id", deletion.UserID.String()),
+				slog.Int("attempt", deletion.Attempts),
+				sl.Err(err),
+			)
+
+			if err := d.store.RetryDeletion(ctx, deletion.UserID, d.now().Add(d.retryDelay(deletion.Attempts)), err.Error()); err != nil {
+				log.Error("failed to schedule retry", sl.Err(err))
+			}
+
+			continue
+		}
+
+		completed++
+	}
+
+	return completed
+}
+
+// process erases the user from every service that is not done yet and
+// removes the credentials last, so a failure leaves nothing unreachable.
+func (d *DeletionService) process(ctx context.Context, deletion models.AccountDeletion) error {
+	for _, step := range d.steps {
+		if slices.Contains(deletion.CompletedSteps, step.Name) {
+			continue
+		}
+
+		if err := step.Eraser.EraseUser(ctx, deletion.UserID); err != nil {
+			return fmt.Errorf("step %s: %w", step.Name, err)
+		}
+
+		if err := d.store.CompleteDeletionStep(ctx, deletion.UserID, step.Name); err != nil {
+			return fmt.Errorf("step %s: %w", step.Name, err)
+		}
+	}
+
+	if err := d.store.FinishDeletion(ctx, deletion.UserID); err != nil {
+		return err
+	}
+
+	d.log.Info("account deleted", slog.String("user_id", deletion.UserID.String()))
+
+	event := models.NewAuthEvent(models.EventAccountDeleted, deletion.UserID, models.RequestMeta{})
+	event.Details = map[string]string{"attempts": strconv.Itoa(deletion.Attempts)}
+
+	d.events.Emit(ctx, event)
+
+	return nil
+}
+
+// retryDelay doubles with every failed attempt, up to MaxRetryInterval.
+func (d *DeletionService) retryDelay(attempts int) time.Duration {
+	cfg := d.cfg.Deletion
+
+	delay := cfg.RetryInterval
+	for range attempts - 1 {
+		if delay >= cfg.MaxRetryInterval {
+			break
+		}
+
+		delay *= 2
+	}
+
+	return min(delay, cfg.MaxRetryInterval)
+}
+
+func (d *DeletionService) sendRestore(ctx context.Context, user models.NormalizedUser, plain string, scheduledFor time.Time) error {
+	link := d.cfg.Deletion.RestoreURL + "?token=" + plain
+
+	return d.mailer.Send(ctx, models.Mail{
+		To:      user.Email,
+		Subject: "Your Cchat account will be deleted",
+		Body: fmt.Sprintf(
+			"Your Cchat account is scheduled for deletion on %s.\n\nUntil then you can restore it: %s\n\nIf it was not you, restore the account and change your password.",
+			scheduledFor.UTC().Format("2006-01-02 15:04 MST"), link,
+		),
+	})
+}
@@ -0,0 +1,349 @@
+package deletion
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/config"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/domain/models"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/lib/logger/slogdiscard"
+	storage "github.com/sergey-frey/cchat/server/auth-service/internal/provider"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type deletionRecord struct {
+	status        string
+	restoreHash   string
+	scheduledFor  time.Time
+	nextAttemptAt time.Time
+	steps         []string
+	attempts      int
+}
+
+type store struct {
+	now           func() time.Time
+	passwords     map[uuid.UUID][]byte
+	deactivated   map[uuid.UUID]bool
+	deletions     map[uuid.UUID]*deletionRecord
+	confirmations map[string]uuid.UUID
+}
+
+func (s *store) Password(ctx context.Context, uid uuid.UUID) ([]byte, error) {
+	hash, ok := s.passwords[uid]
+	if !ok {
+		return nil, storage.ErrUserNotFound
+	}
+
+	return hash, nil
+}
+
+func (s *store) ScheduleDeletion(ctx context.Context, uid uuid.UUID, restoreTokenHash []byte, scheduledFor time.Time) error {
+	if s.deactivated[uid] {
+		return storage.ErrUserNotFound
+	}
+
+	s.deactivated[uid] = true
+	s.deletions[uid] = &deletionRecord{
+		status:        models.DeletionPending,
+		restoreHash:   string(restoreTokenHash),
+		scheduledFor:  scheduledFor,
+		nextAttemptAt: scheduledFor,
+	}
+
+	return nil
+}
+
+func (s *store) SaveDeletionConfirmation(ctx context.Context, uid uuid.UUID, tokenHash []byte, expiresAt time.Time) error {
+	s.confirmations[string(tokenHash)] = uid
+
+	return nil
+}
+
+func (s *store) ConsumeDeletionConfirmation(ctx context.Context, uid uuid.UUID, tokenHash []byte) error {
+	if owner, ok := s.confirmations[string(tokenHash)]; !ok || owner != uid {
+		return storage.ErrConfirmTokenNotFound
+	}
+
+	delete(s.confirmations, string(tokenHash))
+
+	return nil
+}
+
+func (s *store) RestoreAccount(ctx context.Context, restoreTokenHash []byte) (uuid.UUID, error) {
+	for uid, deletion := range s.deletions {
+		if deletion.restoreHash == string(restoreTokenHash) && deletion.status == models.DeletionPending && deletion.scheduledFor.After(s.now()) {
+			deletion.status = models.DeletionCancelled
+			deletion.restoreHash = ""
+			s.deactivated[uid] = false
+
+			return uid, nil
+		}
+	}
+
+	return uuid.Nil, storage.ErrDeletionNotFound
+}
+
+func (s *store) ClaimDeletions(ctx context.Context, limit int, leaseUntil time.Time) ([]models.AccountDeletion, error) {
+	var due []models.AccountDeletion
+
+	for uid, deletion := range s.deletions {
+		if deletion.status != models.DeletionPending || deletion.scheduledFor.After(s.now()) || deletion.nextAttemptAt.After(s.now()) {
+			continue
+		}
+
+		deletion.attempts++
+		deletion.nextAttemptAt = leaseUntil
+
+		due = append(due, models.AccountDeletion{
+			UserID:         uid,
+			ScheduledFor:   deletion.scheduledFor,
+			CompletedSteps: slices.Clone(deletion.steps),
+			Attempts:       deletion.attempts,
+		})
+	}
+
+	return due, nil
+}
+
+func (s *store) CompleteDeletionStep(ctx context.Context, uid uuid.UUID, step string) error {
+	s.deletions[uid].steps = append(s.deletions[uid].steps, step)
+
+	return nil
+}
+
+func (s *store) RetryDeletion(ctx context.Context, uid uuid.UUID, nextAttemptAt time.Time, reason string) error {
+	s.deletions[uid].nextAttemptAt = nextAttemptAt
+
+	return nil
+}
+
+func (s *store) FinishDeletion(ctx context.Context, uid uuid.UUID) error {
+	delete(s.passwords, uid)
+	s.deletions[uid].status = models.DeletionCompleted
+
+	return nil
+}
+
+type sessions struct{}
+
+func (sessions) RevokeUserSessions(ctx context.Context, userID uuid.UUID) error {
+	return nil
+}
+
+type events struct {
+	types []string
+}
+
+func (e *events) Emit(ctx context.Context, event models.AuthEvent) {
+	e.types = append(e.types, event.Type)
+}
+
+type mailer struct {
+	last models.Mail
+}
+
+func (m *mailer) Send(ctx context.Context, mail models.Mail) error {
+	m.last = mail
+	return nil
+}
+
+// restoreToken takes the token out of the mailed link.
+func (m *mailer) restoreToken(t *testing.T) string {
+	_, after, ok := strings.Cut(m.last.Body, "?token=")
+	if !ok {
+		t.Fatal("expected a link in the mail")
+	}
+
+	return strings.Fields(after)[0]
+}
+
+type eraser struct {
+	calls    int
+	failures int
+}
+
+func (e *eraser) EraseUser(ctx context.Context, uid uuid.UUID) error {
+	e.calls++
+
+	if e.failures > 0 {
+		e.failures--
+		return errors.New("service unavailable")
+	}
+
+	return nil
+}
+
+func TestDeletion_RestoreAndResume(t *testing.T) {
+	ctx := context.Background()
+
+	now := time.Now()
+	clock := func() time.Time { return now }
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("12345678"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user := models.NormalizedUser{UUID: uuid.New(), Email: "alice@example.com"}
+
+	st := &store{
+		now:         clock,
+		passwords:   map[uuid.UUID][]byte{user.UUID: hash},
+		deactivated: make(map[uuid.UUID]bool),
+		deletions:   make(map[uuid.UUID]*deletionRecord),
+	}
+	log := &events{}
+	mail := &mailer{}
+
+	messages := &eraser{}
+	chats := &eraser{failures: 1}
+	users := &eraser{}
+
+	cfg := &config.Config{Deletion: config.Deletion{
+		GracePeriod:      24 * time.Hour,
+		BatchSize:        10,
+		RetryInterval:    time.Minute,
+		MaxRetryInterval: time.Hour,
+	}}
+
+	d := New(st, sessions{}, log, mail, []Step{
+		{Name: "messages", Eraser: messages},
+		{Name: "chats", Eraser: chats},
+		{Name: "users", Eraser: users},
+	}, cfg, slogdiscard.NewDiscardLogger())
+	d.now = clock
+
+	_, err = d.Request(ctx, user, models.DeleteAccount{Password: "wrong-password"}, models.RequestMeta{})
+	if !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("expected a wrong password to be refused, got %v", err)
+	}
+
+	if _, err := d.Request(ctx, user, models.DeleteAccount{Password: "12345678"}, models.RequestMeta{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if !st.deactivated[user.UUID] {
+		t.Fatal("expected the account to be deactivated right away")
+	}
+
+	// Nothing is erased during the grace period, and the link undoes it.
+	if completed := d.processDue(ctx); completed != 0 || messages.calls != 0 {
+		t.Fatalf("expected nothing to run during the grace period")
+	}
+
+	if err := d.Restore(ctx, models.RestoreAccount{Token: mail.restoreToken(t)}, models.RequestMeta{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if st.deactivated[user.UUID] {
+		t.Fatal("expected the restored account to be active")
+	}
+
+	if err := d.Restore(ctx, models.RestoreAccount{Token: mail.restoreToken(t)}, models.RequestMeta{}); !errors.Is(err, ErrInvalidRestoreToken) {
+		t.Fatalf("expected a used restore token to be refused, got %v", err)
+	}
+
+	if _, err := d.Request(ctx, user, models.DeleteAccount{Password: "12345678"}, models.RequestMeta{}); err != nil {
+		t.Fatal(err)
+	}
+
+	token := mail.restoreToken(t)
+
+	now = now.Add(cfg.Deletion.GracePeriod + time.Second)
+
+	if err := d.Restore(ctx, models.RestoreAccount{Token: token}, models.RequestMeta{}); !errors.Is(err, ErrInvalidRestoreToken) {
+		t.Fatalf("expected the restore link to expire with the grace period, got %v", err)
+	}
+
+	// The chats service fails once, the retry picks up at that step.
+	if completed := d.processDue(ctx); completed != 0 {
+		t.Fatal("expected the failed deletion not to complete")
+	}
+
+	if completed := d.processDue(ctx); completed != 0 || chats.calls != 1 {
+		t.Fatal("expected the retry to wait for its delay")
+	}
+
+	now = now.Add(cfg.Deletion.RetryInterval)
+
+	if completed := d.processDue(ctx); completed != 1 {
+		t.Fatal("expected the retry to complete the deletion")
+	}
+
+	if messages.calls != 1 || chats.calls != 2 || users.calls != 1 {
+		t.Fatalf("expected completed steps to be skipped, calls: messages %d, chats %d, users %d", messages.calls, chats.calls, users.calls)
+	}
+
+	if _, ok := st.passwords[user.UUID]; ok {
+		t.Fatal("expected the credentials to be removed")
+	}
+
+	if d.processDue(ctx) != 0 {
+		t.Fatal("expected a completed deletion not to run again")
+	}
+
+	want := []string{
+		models.EventDeletionRequested,
+		models.EventDeletionCancelled,
+		models.EventDeletionRequested,
+		models.EventAccountDeleted,
+	}
+
+	if !slices.Equal(log.types, want) {
+		t.Fatalf("expected events %v, got %v", want, log.types)
+	}
+}
+
+func TestDeletion_PasswordlessConfirmsByMail(t *testing.T) {
+	ctx := context.Background()
+
+	user := models.NormalizedUser{UUID: uuid.New(), Email: "bob@example.com"}
+
+	st := &store{
+		now:           time.Now,
+		passwords:     map[uuid.UUID][]byte{user.UUID: {}},
+		deactivated:   make(map[uuid.UUID]bool),
+		deletions:     make(map[uuid.UUID]*deletionRecord),
+		confirmations: make(map[string]uuid.UUID),
+	}
+	mail := &mailer{}
+
+	cfg := &config.Config{Deletion: config.Deletion{GracePeriod: 24 * time.Hour, ConfirmTTL: time.Hour}}
+
+	d := New(st, sessions{}, &events{}, mail, nil, cfg, slogdiscard.NewDiscardLogger())
+
+	// A stolen session alone is not enough, whatever the password says.
+	for _, password := range []string{"", "12345678"} {
+		if _, err := d.Request(ctx, user, models.DeleteAccount{Password: password}, models.RequestMeta{}); !errors.Is(err, ErrConfirmationSent) {
+			t.Fatalf("expected a confirmation to be mailed, got %v", err)
+		}
+
+		if st.deactivated[user.UUID] {
+			t.Fatal("expected the account to stay active until the deletion is confirmed")
+		}
+	}
+
+	confirm := mail.restoreToken(t)
+
+	other := models.NormalizedUser{UUID: uuid.New()}
+	if _, err := d.Confirm(ctx, other, models.ConfirmDeletion{Token: confirm}, models.RequestMeta{}); !errors.Is(err, ErrInvalidConfirmToken) {
+		t.Fatalf("expected the token of another user to be refused, got %v", err)
+	}
+
+	if _, err := d.Confirm(ctx, user, models.ConfirmDeletion{Token: confirm}, models.RequestMeta{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if !st.deactivated[user.UUID] {
+		t.Fatal("expected the confirmed deletion to deactivate the account")
+	}
+
+	if _, err := d.Confirm(ctx, user, models.ConfirmDeletion{Token: confirm}, models.RequestMeta{}); !errors.Is(err, ErrInvalidConfirmToken) {
+		t.Fatalf("expected a used confirmation token to be refused, got %v", err)
+	}
+}
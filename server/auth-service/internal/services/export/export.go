@@ -0,0 +1,415 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/config"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/domain/models"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/lib/logger/sl"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/lib/signedurl"
+	storage "github.com/sergey-frey/cchat/server/auth-service/internal/provider"
+)
+
+type Store interface {
+	CreateExport(ctx context.Context, id uuid.UUID, uid uuid.UUID) (*models.DataExport, error)
+	Export(ctx context.Context, id uuid.UUID) (*models.DataExport, error)
+	ClaimExports(ctx context.Context, limit int, leaseUntil time.Time) ([]models.DataExport, error)
+	FinishExport(ctx context.Context, id uuid.UUID, expiresAt time.Time) error
+	RetryExport(ctx context.Context, id uuid.UUID, nextAttemptAt time.Time, reason string) error
+	FailExport(ctx context.Context, id uuid.UUID, reason string) error
+	ExpireExports(ctx context.Context) ([]uuid.UUID, error)
+	AccountExport(ctx context.Context, uid uuid.UUID) (*models.AccountExport, error)
+}
+
+// EventEmitter appends to the authentication audit log.
+type EventEmitter interface {
+	Emit(ctx context.Context, event models.AuthEvent)
+}
+
+// Exporter returns what one service keeps about the user as JSON.
+type Exporter interface {
+	ExportUser(ctx context.Context, uid uuid.UUID) (json.RawMessage, error)
+}
+
+// Source is one service the export collects from, its data ends up in
+// <Name>.json in the archive.
+type Source struct {
+	Name     string
+	Exporter Exporter
+}
+
+// accountFile holds what auth-service keeps itself.
+const accountFile = "account.json"
+
+type ExportService struct {
+	store   Store
+	events  EventEmitter
+	sources []Source
+	signer  *signedurl.Signer
+	cfg     *config.Config
+	log     *slog.Logger
+	now     func() time.Time
+}
+
+var (
+	ErrExportNotFound = errors.New("data export not found")
+	ErrInvalidLink    = errors.New("invalid or expired download link")
+)
+
+func New(store Store, events EventEmitter, sources []Source, signer *signedurl.Signer, cfg *config.Config, log *slog.Logger) *ExportService {
+	return &ExportService{
+		store:   store,
+		events:  events,
+		sources: sources,
+		signer:  signer,
+		cfg:     cfg,
+		log:     log,
+		now:     time.Now,
+	}
+}
+
+// Request queues an export of everything kept about the user. While an
+// export is pending asking again returns that one.
+func (e *ExportService) Request(ctx context.Context, uid uuid.UUID, meta models.RequestMeta) (*models.ExportJob, error) {
+	const op = "services.export.Request"
+
+	log := e.log.With(
+		slog.String("op", op),
+		slog.String("user_id", uid.String()),
+	)
+
+	export, err := e.store.CreateExport(ctx, uuid.New(), uid)
+	if err != nil {
+		log.Error("failed to create export", sl.Err(err))
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("data export requested", slog.String("export_id", export.ID.String()))
+
+	event := models.NewAuthEvent(models.EventExportRequested, uid, meta)
+	event.Details = map[string]string{"export_id": export.ID.String()}
+
+	e.events.Emit(ctx, event)
+
+	return e.job(export), nil
+}
+
+// Job returns the export of the user with a fresh download link once the
+// archive is ready. Exports of other users are not found.
+func (e *ExportService) Job(ctx context.Context, uid uuid.UUID, id uuid.UUID) (*models.ExportJob, error) {
+	const op = "services.export.Job"
+
+	log := e.log.With(
+		slog.String("op", op),
+		slog.String("user_id", uid.String()),
+		slog.String("export_id", id.String()),
+	)
+
+	export, err := e.store.Export(ctx, id)
+	if err != nil {
+		if errors.Is(err, storage.ErrExportNotFound) {
+			log.Warn("export not found", sl.Err(err))
+
+			return nil, fmt.Errorf("%s: %w", op, ErrExportNotFound)
+		}
+
+		log.Error("failed to get export", sl.Err(err))
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if export.UserID != uid {
+		log.Warn("export of another user")
+
+		return nil, fmt.Errorf("%s: %w", op, ErrExportNotFound)
+	}
+
+	return e.job(export), nil
+}
+
+// Open checks the signed link and opens the archive it points to. The
+// link is all it takes, no session is needed.
+func (e *ExportService) Open(ctx context.Context, id uuid.UUID, query url.Values, meta models.RequestMeta) (*os.File, *models.DataExport, error) {
+	const op = "services.export.Open"
+
+	log := e.log.With(
+		slog.String("op", op),
+		slog.String("export_id", id.String()),
+	)
+
+	if err := e.signer.Verify(id.String(), query, e.now()); err != nil {
+		log.Warn("invalid download link", sl.Err(err))
+
+		return nil, nil, fmt.Errorf("%s: %w", op, ErrInvalidLink)
+	}
+
+	export, err := e.store.Export(ctx, id)
+	if err != nil {
+		if errors.Is(err, storage.ErrExportNotFound) {
+			log.Warn("export not found", sl.Err(err))
+
+			return nil, nil, fmt.Errorf("%s: %w", op, ErrExportNotFound)
+		}
+
+		log.Error("failed to get export", sl.Err(err))
+
+		return nil, nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if !e.downloadable(export) {
+		log.Warn("export is not downloadable", slog.String("status", export.Status))
+
+		return nil, nil, fmt.Errorf("%s: %w", op, ErrExportNotFound)
+	}
+
+	file, err := os.Open(e.path(id))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			log.Error("archive is missing", sl.Err(err))
+
+			return nil, nil, fmt.Errorf("%s: %w", op, ErrExportNotFound)
+		}
+
+		log.Error("failed to open archive", sl.Err(err))
+
+		return nil, nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	e.events.Emit(ctx, models.NewAuthEvent(models.EventExportDownloaded, export.UserID, meta))
+
+	return file, export, nil
+}
+
+// Run builds the pending archives and removes the expired ones until ctx
+// is done.
+func (e *ExportService) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.cfg.Export.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		e.processDue(ctx)
+		e.removeExpired(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// processDue builds the archives that are due and returns how many of
+// them are ready.
+func (e *ExportService) processDue(ctx context.Context) int {
+	const op = "services.export.processDue"
+
+	log := e.log.With(
+		slog.String("op", op),
+	)
+
+	exports, err := e.store.ClaimExports(ctx, e.cfg.Export.BatchSize, e.now().Add(e.cfg.Export.RetryInterval))
+	if err != nil {
+		log.Error("failed to claim exports", sl.Err(err))
+
+		return 0
+	}
+
+	ready := 0
+
+	for _, export := range exports {
+		log := log.With(
+			slog.String("export_id", export.ID.String()),
+			slog.Int("attempt", export.Attempts),
+		)
+
+		if err := e.build(ctx, export); err != nil {
+			log.Error("data export failed", sl.Err(err))
+
+			if export.Attempts >= e.cfg.Export.MaxAttempts {
+				if err := e.store.FailExport(ctx, export.ID, err.Error()); err != nil {
+					log.Error("failed to mark export as failed", sl.Err(err))
+				}
+
+				continue
+			}
+
+			if err := e.store.RetryExport(ctx, export.ID, e.now().Add(e.retryDelay(export.Attempts)), err.Error()); err != nil {
+				log.Error("failed to schedule retry", sl.Err(err))
+			}
+
+			continue
+		}
+
+		if err := e.store.FinishExport(ctx, export.ID, e.now().Add(e.cfg.Export.TTL)); err != nil {
+			log.Error("failed to finish export", sl.Err(err))
+
+			continue
+		}
+
+		log.Info("data export ready")
+
+		ready++
+	}
+
+	return ready
+}
+
+// build writes the archive next to its final place and moves it there
+// once it is complete, a failed run leaves nothing behind.
+func (e *ExportService) build(ctx context.Context, export models.DataExport) (err error) {
+	if err := os.MkdirAll(e.cfg.Export.Dir, 0o700); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(e.cfg.Export.Dir, export.ID.String()+"-*.tmp")
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			_ = tmp.Close()
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+
+	archive := zip.NewWriter(tmp)
+
+	account, err := e.store.AccountExport(ctx, export.UserID)
+	if err != nil {
+		return fmt.Errorf("account: %w", err)
+	}
+
+	data, err := json.MarshalIndent(account, "", "  ")
+	if err != nil {
+		return fmt.Errorf("account: %w", err)
+	}
+
+	if err := writeFile(archive, accountFile, data); err != nil {
+		return fmt.Errorf("account: %w", err)
+	}
+
+	for _, source := range e.sources {
+		data, err := source.Exporter.ExportUser(ctx, export.UserID)
+		if err != nil {
+			return fmt.Errorf("source %s: %w", source.Name, err)
+		}
+
+		var indented bytes.Buffer
+		if err := json.Indent(&indented, data, "", "  "); err != nil {
+			return fmt.Errorf("source %s: %w", source.Name, err)
+		}
+
+		if err := writeFile(archive, source.Name+".json", indented.Bytes()); err != nil {
+			return fmt.Errorf("source %s: %w", source.Name, err)
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), e.path(export.ID))
+}
+
+// removeExpired expires the archives past their TTL and deletes the files.
+func (e *ExportService) removeExpired(ctx context.Context) {
+	const op = "services.export.removeExpired"
+
+	log := e.log.With(
+		slog.String("op", op),
+	)
+
+	ids, err := e.store.ExpireExports(ctx)
+	if err != nil {
+		log.Error("failed to expire exports", sl.Err(err))
+
+		return
+	}
+
+	for _, id := range ids {
+		if err := os.Remove(e.path(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Error("failed to remove archive", slog.String("export_id", id.String()), sl.Err(err))
+		}
+	}
+}
+
+// job shows the export to its owner, the link is signed for LinkTTL but
+// never outlives the archive.
+func (e *ExportService) job(export *models.DataExport) *models.ExportJob {
+	job := &models.ExportJob{
+		ID:          export.ID,
+		Status:      export.Status,
+		RequestedAt: export.RequestedAt,
+		FinishedAt:  export.FinishedAt,
+		ExpiresAt:   export.ExpiresAt,
+	}
+
+	if export.Status == models.ExportReady && !e.downloadable(export) {
+		job.Status = models.ExportExpired
+	}
+
+	if !e.downloadable(export) {
+		return job
+	}
+
+	linkExpiresAt := e.now().Add(e.cfg.Export.LinkTTL)
+	if export.ExpiresAt.Before(linkExpiresAt) {
+		linkExpiresAt = *export.ExpiresAt
+	}
+
+	job.DownloadURL = fmt.Sprintf("%s/%s/download?%s", e.cfg.Export.DownloadURL, export.ID, e.signer.Query(export.ID.String(), linkExpiresAt).Encode())
+	job.LinkExpiresAt = &linkExpiresAt
+
+	return job
+}
+
+func (e *ExportService) downloadable(export *models.DataExport) bool {
+	return export.Status == models.ExportReady && export.ExpiresAt != nil && e.now().Before(*export.ExpiresAt)
+}
+
+func (e *ExportService) path(id uuid.UUID) string {
+	return filepath.Join(e.cfg.Export.Dir, id.String()+".zip")
+}
+
+// retryDelay doubles with every failed attempt.
+func (e *ExportService) retryDelay(attempts int) time.Duration {
+	delay := e.cfg.Export.RetryInterval
+	for range attempts - 1 {
+		delay *= 2
+	}
+
+	return delay
+}
+
+// FileName is the name the archive is downloaded as.
+func FileName(export *models.DataExport) string {
+	return "cchat-export-" + export.RequestedAt.UTC().Format("2006-01-02") + ".zip"
+}
+
+func writeFile(archive *zip.Writer, name string, data []byte) error {
+	w, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(data)
+
+	return err
+}
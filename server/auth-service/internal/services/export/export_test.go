@@ -0,0 +1,310 @@
+package export
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/config"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/domain/models"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/lib/logger/slogdiscard"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/lib/signedurl"
+	storage "github.com/sergey-frey/cchat/server/auth-service/internal/provider"
+)
+
+type exportRecord struct {
+	models.DataExport
+	nextAttemptAt time.Time
+}
+
+type store struct {
+	now     func() time.Time
+	exports map[uuid.UUID]*exportRecord
+}
+
+func (s *store) CreateExport(ctx context.Context, id uuid.UUID, uid uuid.UUID) (*models.DataExport, error) {
+	for _, export := range s.exports {
+		if export.UserID == uid && export.Status == models.ExportPending {
+			copied := export.DataExport
+			return &copied, nil
+		}
+	}
+
+	s.exports[id] = &exportRecord{
+		DataExport: models.DataExport{
+			ID:          id,
+			UserID:      uid,
+			Status:      models.ExportPending,
+			RequestedAt: s.now(),
+		},
+		nextAttemptAt: s.now(),
+	}
+
+	copied := s.exports[id].DataExport
+
+	return &copied, nil
+}
+
+func (s *store) Export(ctx context.Context, id uuid.UUID) (*models.DataExport, error) {
+	export, ok := s.exports[id]
+	if !ok {
+		return nil, storage.ErrExportNotFound
+	}
+
+	copied := export.DataExport
+
+	return &copied, nil
+}
+
+func (s *store) ClaimExports(ctx context.Context, limit int, leaseUntil time.Time) ([]models.DataExport, error) {
+	var due []models.DataExport
+
+	for _, export := range s.exports {
+		if export.Status != models.ExportPending || export.nextAttemptAt.After(s.now()) {
+			continue
+		}
+
+		export.Attempts++
+		export.nextAttemptAt = leaseUntil
+
+		due = append(due, export.DataExport)
+	}
+
+	return due, nil
+}
+
+func (s *store) FinishExport(ctx context.Context, id uuid.UUID, expiresAt time.Time) error {
+	finishedAt := s.now()
+
+	s.exports[id].Status = models.ExportReady
+	s.exports[id].FinishedAt = &finishedAt
+	s.exports[id].ExpiresAt = &expiresAt
+
+	return nil
+}
+
+func (s *store) RetryExport(ctx context.Context, id uuid.UUID, nextAttemptAt time.Time, reason string) error {
+	s.exports[id].nextAttemptAt = nextAttemptAt
+
+	return nil
+}
+
+func (s *store) FailExport(ctx context.Context, id uuid.UUID, reason string) error {
+	s.exports[id].Status = models.ExportFailed
+
+	return nil
+}
+
+func (s *store) ExpireExports(ctx context.Context) ([]uuid.UUID, error) {
+	var expired []uuid.UUID
+
+	for id, export := range s.exports {
+		if export.Status == models.ExportReady && !export.ExpiresAt.After(s.now()) {
+			export.Status = models.ExportExpired
+			expired = append(expired, id)
+		}
+	}
+
+	return expired, nil
+}
+
+func (s *store) AccountExport(ctx context.Context, uid uuid.UUID) (*models.AccountExport, error) {
+	return &models.AccountExport{UserID: uid, Role: models.RoleUser}, nil
+}
+
+type events struct {
+	types []string
+}
+
+func (e *events) Emit(ctx context.Context, event models.AuthEvent) {
+	e.types = append(e.types, event.Type)
+}
+
+type exporter struct {
+	data     string
+	failures int
+}
+
+func (e *exporter) ExportUser(ctx context.Context, uid uuid.UUID) (json.RawMessage, error) {
+	if e.failures > 0 {
+		e.failures--
+		return nil, errors.New("service unavailable")
+	}
+
+	return json.RawMessage(e.data), nil
+}
+
+// downloadQuery takes the signature parameters out of the download link.
+func downloadQuery(t *testing.T, job *models.ExportJob) url.Values {
+	link, err := url.Parse(job.DownloadURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return link.Query()
+}
+
+func TestExport_BuildAndDownload(t *testing.T) {
+	ctx := context.Background()
+
+	now := time.Now()
+	clock := func() time.Time { return now }
+
+	st := &store{now: clock, exports: make(map[uuid.UUID]*exportRecord)}
+	log := &events{}
+
+	cfg := &config.Config{Export: config.Export{
+		Dir:           t.TempDir(),
+		BatchSize:     5,
+		RetryInterval: time.Minute,
+		MaxAttempts:   3,
+		TTL:           24 * time.Hour,
+		LinkTTL:       time.Hour,
+		DownloadURL:   "http://localhost:8040/services/auth/auth/exports",
+	}}
+
+	e := New(st, log, []Source{
+		{Name: "profile", Exporter: &exporter{data: `{"username":"alice"}`}},
+		{Name: "chats", Exporter: &exporter{data: `[]`, failures: 1}},
+	}, signedurl.New([]byte("secret")), cfg, slogdiscard.NewDiscardLogger())
+	e.now = clock
+
+	uid := uuid.New()
+
+	job, err := e.Request(ctx, uid, models.RequestMeta{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	again, err := e.Request(ctx, uid, models.RequestMeta{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if again.ID != job.ID {
+		t.Fatal("expected a pending export to be returned again")
+	}
+
+	if _, err := e.Job(ctx, uuid.New(), job.ID); !errors.Is(err, ErrExportNotFound) {
+		t.Fatalf("expected the export of another user not to be found, got %v", err)
+	}
+
+	// The chats service fails once, nothing is left behind and the retry
+	// waits for its delay.
+	if ready := e.processDue(ctx); ready != 0 {
+		t.Fatal("expected the failed export not to be ready")
+	}
+
+	if entries, _ := os.ReadDir(cfg.Export.Dir); len(entries) != 0 {
+		t.Fatalf("expected a failed run to leave no files, got %d", len(entries))
+	}
+
+	now = now.Add(cfg.Export.RetryInterval)
+
+	if ready := e.processDue(ctx); ready != 1 {
+		t.Fatal("expected the retry to build the archive")
+	}
+
+	job, err = e.Job(ctx, uid, job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if job.Status != models.ExportReady || job.DownloadURL == "" {
+		t.Fatalf("expected a ready export with a link, got %+v", job)
+	}
+
+	query := downloadQuery(t, job)
+
+	forged := url.Values{"expires": query["expires"], "signature": {"AAAA"}}
+	if _, _, err := e.Open(ctx, job.ID, forged, models.RequestMeta{}); !errors.Is(err, ErrInvalidLink) {
+		t.Fatalf("expected a forged link to be refused, got %v", err)
+	}
+
+	if _, _, err := e.Open(ctx, uuid.New(), query, models.RequestMeta{}); !errors.Is(err, ErrInvalidLink) {
+		t.Fatalf("expected the link not to open another export, got %v", err)
+	}
+
+	file, _, err := e.Open(ctx, job.ID, query, models.RequestMeta{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	archive, err := zip.NewReader(file, info.Size())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, f := range archive.File {
+		names = append(names, f.Name)
+	}
+
+	if want := []string{"account.json", "profile.json", "chats.json"}; !slices.Equal(names, want) {
+		t.Fatalf("expected files %v, got %v", want, names)
+	}
+
+	profile, err := archive.File[1].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := io.ReadAll(profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded map[string]string
+	if err := json.Unmarshal(data, &decoded); err != nil || decoded["username"] != "alice" {
+		t.Fatalf("expected the profile to be kept as it came, got %s", data)
+	}
+
+	file.Close()
+
+	now = now.Add(cfg.Export.LinkTTL)
+
+	if _, _, err := e.Open(ctx, job.ID, query, models.RequestMeta{}); !errors.Is(err, ErrInvalidLink) {
+		t.Fatalf("expected the link to expire, got %v", err)
+	}
+
+	now = now.Add(cfg.Export.TTL)
+
+	e.removeExpired(ctx)
+
+	if _, err := os.Stat(filepath.Join(cfg.Export.Dir, job.ID.String()+".zip")); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected the expired archive to be removed, got %v", err)
+	}
+
+	job, err = e.Job(ctx, uid, job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if job.Status != models.ExportExpired || job.DownloadURL != "" {
+		t.Fatalf("expected an expired export without a link, got %+v", job)
+	}
+
+	want := []string{
+		models.EventExportRequested,
+		models.EventExportRequested,
+		models.EventExportDownloaded,
+	}
+
+	if !slices.Equal(log.types, want) {
+		t.Fatalf("expected events %v, got %v", want, log.types)
+	}
+}
@@ -0,0 +1,327 @@
+package lockout
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/config"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/domain/models"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/lib/logger/sl"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/lib/token"
+	storage "github.com/sergey-frey/cchat/server/auth-service/internal/provider"
+)
+
+// Store keeps the failed login counters. It is implemented by the postgres
+// storage, shared by all replicas, and by the in-memory storage.
+type Store interface {
+	LoginAttempts(ctx context.Context, key string) (*models.LoginAttempts, error)
+	RegisterLoginFailure(ctx context.Context, key string, now time.Time, window time.Duration) (*models.LoginAttempts, error)
+	BlockLogin(ctx context.Context, key string, until time.Time) error
+	ResetLoginAttempts(ctx context.Context, key string) error
+	RecordLockout(ctx context.Context, lockout models.Lockout) error
+	SaveUnlockToken(ctx context.Context, uid uuid.UUID, tokenHash []byte, expiresAt time.Time) error
+	ConsumeUnlockToken(ctx context.Context, tokenHash []byte) (uuid.UUID, error)
+}
+
+// EventEmitter appends to the authentication audit log.
+type EventEmitter interface {
+	Emit(ctx context.Context, event models.AuthEvent)
+}
+
+type Mailer interface {
+	Send(ctx context.Context, mail models.Mail) error
+}
+
+type LockoutService struct {
+	store  Store
+	events EventEmitter
+	mailer Mailer
+	cfg    *config.Config
+	log    *slog.Logger
+	now    func() time.Time
+}
+
+var (
+	ErrTooManyAttempts    = errors.New("too many failed login attempts")
+	ErrInvalidUnlockToken = errors.New("invalid or expired unlock token")
+)
+
+// BlockedError is returned while a key is blocked, it tells the client
+// when to try again.
+type BlockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *BlockedError) Error() string {
+	return ErrTooManyAttempts.Error()
+}
+
+func (e *BlockedError) Unwrap() error {
+	return ErrTooManyAttempts
+}
+
+func New(store Store, events EventEmitter, mailer Mailer, cfg *config.Config, log *slog.Logger) *LockoutService {
+	return &LockoutService{
+		store:  store,
+		events: events,
+		mailer: mailer,
+		cfg:    cfg,
+		log:    log,
+		now:    time.Now,
+	}
+}
+
+// Check fails with a BlockedError while the account or the IP is blocked.
+// uid is uuid.Nil when the email belongs to nobody.
+func (l *LockoutService) Check(ctx context.Context, uid uuid.UUID, ip string) error {
+	const op = "services.lockout.Check"
+
+	now := l.now()
+
+	var blockedUntil time.Time
+
+	for _, key := range keys(uid, ip) {
+		attempts, err := l.store.LoginAttempts(ctx, key)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		if attempts.BlockedUntil.After(blockedUntil) {
+			blockedUntil = attempts.BlockedUntil
+		}
+	}
+
+	if blockedUntil.After(now) {
+		return fmt.Errorf("%s: %w", op, &BlockedError{RetryAfter: blockedUntil.Sub(now)})
+	}
+
+	return nil
+}
+
+// Fail counts a failed login for the IP and, when the email is known,
+// for the account. Reaching a limit locks the key, a locked account
+// is mailed a link to unlock it.
+func (l *LockoutService) Fail(ctx context.Context, user *models.NormalizedUser, meta models.RequestMeta) error {
+	const op = "services.lockout.Fail"
+
+	ip := meta.IP
+
+	log := l.log.With(
+		slog.String("op", op),
+		slog.String("ip", ip),
+	)
+
+	if ip != "" {
+		attempts, err := l.fail(ctx, ipKey(ip), l.cfg.Lockout.IPLimit)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		if attempts.Failures >= l.cfg.Lockout.IPLimit {
+			log.Warn("ip locked out", slog.Int("failures", attempts.Failures))
+
+			err = l.store.RecordLockout(ctx, models.Lockout{
+				Key:         attempts.Key,
+				IP:          ip,
+				Failures:    attempts.Failures,
+				LockedUntil: attempts.BlockedUntil,
+			})
+			if err != nil {
+				return fmt.Errorf("%s: %w", op, err)
+			}
+
+			l.emitLocked(ctx, uuid.Nil, attempts, meta)
+		}
+	}
+
+	if user == nil {
+		return nil
+	}
+
+	log = log.With(slog.String("user_id", user.UUID.String()))
+
+	attempts, err := l.fail(ctx, accountKey(user.UUID), l.cfg.Lockout.AccountLimit)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if attempts.Failures < l.cfg.Lockout.AccountLimit {
+		return nil
+	}
+
+	log.Warn("account locked out", slog.Int("failures", attempts.Failures))
+
+	err = l.store.RecordLockout(ctx, models.Lockout{
+		Key:         attempts.Key,
+		UserID:      uuid.NullUUID{UUID: user.UUID, Valid: true},
+		IP:          ip,
+		Failures:    attempts.Failures,
+		LockedUntil: attempts.BlockedUntil,
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	l.emitLocked(ctx, user.UUID, attempts, meta)
+
+	// The lock stands even if the mail is lost, it expires on its own.
+	if err := l.sendUnlock(ctx, *user, attempts.BlockedUntil); err != nil {
+		log.Error("failed to send unlock mail", sl.Err(err))
+	}
+
+	return nil
+}
+
+// Succeed clears the account counter after a successful login. The IP
+// counter is kept, one valid account must not cover guessing others.
+func (l *LockoutService) Succeed(ctx context.Context, uid uuid.UUID) error {
+	const op = "services.lockout.Succeed"
+
+	if err := l.store.ResetLoginAttempts(ctx, accountKey(uid)); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// Unlock lifts the lock of the account the token was mailed for.
+func (l *LockoutService) Unlock(ctx context.Context, unlock models.UnlockAccount, meta models.RequestMeta) error {
+	const op = "services.lockout.Unlock"
+
+	log := l.log.With(
+		slog.String("op", op),
+	)
+
+	uid, err := l.store.ConsumeUnlockToken(ctx, token.Hash(unlock.Token))
+	if err != nil {
+		if errors.Is(err, storage.ErrUnlockTokenNotFound) {
+			log.Warn("invalid unlock token", sl.Err(err))
+
+			return fmt.Errorf("%s: %w", op, ErrInvalidUnlockToken)
+		}
+
+		log.Error("failed to consume unlock token", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := l.store.ResetLoginAttempts(ctx, accountKey(uid)); err != nil {
+		log.Error("failed to reset login attempts", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("account unlocked", slog.String("user_id", uid.String()))
+
+	l.events.Emit(ctx, models.NewAuthEvent(models.EventAccountUnlocked, uid, meta))
+
+	return nil
+}
+
+func (l *LockoutService) emitLocked(ctx context.Context, uid uuid.UUID, attempts *models.LoginAttempts, meta models.RequestMeta) {
+	event := models.NewAuthEvent(models.EventAccountLocked, uid, meta)
+	event.Details = map[string]string{
+		"key":          attempts.Key,
+		"failures":     strconv.Itoa(attempts.Failures),
+		"locked_until": attempts.BlockedUntil.UTC().Format(time.RFC3339),
+	}
+
+	l.events.Emit(ctx, event)
+}
+
+func (l *LockoutService) fail(ctx context.Context, key string, limit int) (*models.LoginAttempts, error) {
+	now := l.now()
+
+	attempts, err := l.store.RegisterLoginFailure(ctx, key, now, l.cfg.Lockout.Window)
+	if err != nil {
+		return nil, err
+	}
+
+	delay := l.delay(attempts.Failures, limit)
+	if delay == 0 {
+		return attempts, nil
+	}
+
+	attempts.BlockedUntil = now.Add(delay)
+
+	if err := l.store.BlockLogin(ctx, key, attempts.BlockedUntil); err != nil {
+		return nil, err
+	}
+
+	return attempts, nil
+}
+
+// delay doubles with every failure past BackoffAfter, up to MaxDelay.
+// At the limit the key is locked for the whole lockout duration.
+func (l *LockoutService) delay(failures int, limit int) time.Duration {
+	cfg := l.cfg.Lockout
+
+	if failures >= limit {
+		return cfg.Duration
+	}
+
+	if failures < cfg.BackoffAfter {
+		return 0
+	}
+
+	delay := cfg.BaseDelay
+	for range failures - cfg.BackoffAfter {
+		if delay >= cfg.MaxDelay {
+			break
+		}
+
+		delay *= 2
+	}
+
+	return min(delay, cfg.MaxDelay)
+}
+
+func (l *LockoutService) sendUnlock(ctx context.Context, user models.NormalizedUser, lockedUntil time.Time) error {
+	plain, hash, err := token.New()
+	if err != nil {
+		return err
+	}
+
+	err = l.store.SaveUnlockToken(ctx, user.UUID, hash, l.now().Add(l.cfg.Lockout.UnlockTokenTTL))
+	if err != nil {
+		return err
+	}
+
+	link := l.cfg.Lockout.UnlockURL + "?token=" + plain
+
+	return l.mailer.Send(ctx, models.Mail{
+		To:      user.Email,
+		Subject: "Cchat account locked",
+		Body: fmt.Sprintf(
+			"Your Cchat account was locked after too many failed login attempts. It unlocks on its own at %s.\n\nIf it was you, follow the link to unlock it now: %s\n\nIf it was not you, consider resetting your password.",
+			lockedUntil.UTC().Format(time.RFC1123), link,
+		),
+	})
+}
+
+func keys(uid uuid.UUID, ip string) []string {
+	keys := make([]string, 0, 2)
+
+	if uid != uuid.Nil {
+		keys = append(keys, accountKey(uid))
+	}
+
+	if ip != "" {
+		keys = append(keys, ipKey(ip))
+	}
+
+	return keys
+}
+
+func accountKey(uid uuid.UUID) string {
+	return "account:" + uid.String()
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
@@ -0,0 +1,136 @@
+package lockout
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/config"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/domain/models"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/lib/logger/slogdiscard"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/provider/storage/memory"
+)
+
+type mailbox struct {
+	mails []models.Mail
+}
+
+func (m *mailbox) Send(ctx context.Context, mail models.Mail) error {
+	m.mails = append(m.mails, mail)
+	return nil
+}
+
+type eventLog struct {
+	events []models.AuthEvent
+}
+
+func (e *eventLog) Emit(ctx context.Context, event models.AuthEvent) {
+	e.events = append(e.events, event)
+}
+
+func (e *eventLog) count(eventType string) int {
+	n := 0
+	for _, event := range e.events {
+		if event.Type == eventType {
+			n++
+		}
+	}
+
+	return n
+}
+
+func TestLockout_BackoffLockAndUnlock(t *testing.T) {
+	ctx := context.Background()
+
+	store := memory.New()
+	mails := &mailbox{}
+	events := &eventLog{}
+
+	cfg := &config.Config{Lockout: config.Lockout{
+		Window:         time.Hour,
+		BackoffAfter:   2,
+		BaseDelay:      time.Second,
+		MaxDelay:       4 * time.Second,
+		AccountLimit:   5,
+		IPLimit:        100,
+		Duration:       30 * time.Minute,
+		UnlockTokenTTL: time.Hour,
+		UnlockURL:      "http://localhost/unlock",
+	}}
+
+	l := New(store, events, mails, cfg, slogdiscard.NewDiscardLogger())
+
+	now := time.Now()
+	l.now = func() time.Time { return now }
+
+	user := &models.NormalizedUser{UUID: uuid.New(), Email: "user@example.com"}
+	ip := "10.0.0.1"
+	meta := models.RequestMeta{IP: ip}
+
+	delays := []time.Duration{0, time.Second, 2 * time.Second, 4 * time.Second, 30 * time.Minute}
+
+	for i, want := range delays {
+		if err := l.Check(ctx, user.UUID, ip); err != nil {
+			t.Fatalf("attempt %d: unexpected block: %v", i+1, err)
+		}
+
+		if err := l.Fail(ctx, user, meta); err != nil {
+			t.Fatal(err)
+		}
+
+		err := l.Check(ctx, user.UUID, ip)
+
+		var blocked *BlockedError
+		switch {
+		case want == 0 && err != nil:
+			t.Fatalf("attempt %d: unexpected block: %v", i+1, err)
+		case want != 0 && !errors.As(err, &blocked):
+			t.Fatalf("attempt %d: expected a block, got %v", i+1, err)
+		case want != 0 && blocked.RetryAfter != want:
+			t.Fatalf("attempt %d: retry after %s, want %s", i+1, blocked.RetryAfter, want)
+		}
+
+		now = now.Add(want)
+	}
+
+	if lockouts := store.Lockouts(); len(lockouts) != 1 || lockouts[0].UserID.UUID != user.UUID {
+		t.Fatalf("expected one recorded lockout, got %+v", lockouts)
+	}
+
+	if len(mails.mails) != 1 {
+		t.Fatalf("expected one unlock mail, got %d", len(mails.mails))
+	}
+
+	if n := events.count(models.EventAccountLocked); n != 1 {
+		t.Fatalf("expected one account_locked event, got %d", n)
+	}
+
+	// The lock duration has passed on the fake clock, go back into it.
+	now = now.Add(-time.Minute)
+
+	if err := l.Check(ctx, user.UUID, ip); !errors.Is(err, ErrTooManyAttempts) {
+		t.Fatalf("expected the account to be locked, got %v", err)
+	}
+
+	body := mails.mails[0].Body
+	plain := strings.Fields(body[strings.Index(body, "?token=")+len("?token="):])[0]
+
+	if err := l.Unlock(ctx, models.UnlockAccount{Token: plain}, meta); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := l.Check(ctx, user.UUID, ""); err != nil {
+		t.Fatalf("expected the account to be unlocked, got %v", err)
+	}
+
+	if n := events.count(models.EventAccountUnlocked); n != 1 {
+		t.Fatalf("expected one account_unlocked event, got %d", n)
+	}
+
+	if err := l.Unlock(ctx, models.UnlockAccount{Token: plain}, meta); !errors.Is(err, ErrInvalidUnlockToken) {
+		t.Fatalf("expected a used token to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,322 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/config"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/domain/models"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/lib/logger/sl"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/lib/oidc"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/lib/token"
+	storage "github.com/sergey-frey/cchat/server/auth-service/internal/provider"
+)
+
+type IdentityStore interface {
+	SaveOIDCState(ctx context.Context, stateHash []byte, state models.OIDCState) error
+	ConsumeOIDCState(ctx context.Context, stateHash []byte) (*models.OIDCState, error)
+	IdentityLink(ctx context.Context, provider string, subject string) (*models.IdentityLink, error)
+	LinkIdentity(ctx context.Context, link models.IdentityLink, emailVerified bool) error
+	Account(ctx context.Context, uid uuid.UUID) (*models.Account, error)
+}
+
+type UserProvider interface {
+	GetUser(ctx context.Context, email string) (*models.NormalizedUser, error)
+	UserByID(ctx context.Context, uid uuid.UUID) (*models.NormalizedUser, error)
+	CreateUser(ctx context.Context, email string) (*models.NormalizedUser, error)
+}
+
+type SessionIssuer interface {
+	NewSession(ctx context.Context, user models.NormalizedUser, meta models.RequestMeta) (accessToken string, refreshToken string, err error)
+}
+
+type ChallengeIssuer interface {
+	NewChallenge(ctx context.Context, user models.NormalizedUser) (*models.TwoFactorChallenge, error)
+}
+
+// EventEmitter appends to the authentication audit log.
+type EventEmitter interface {
+	Emit(ctx context.Context, event models.AuthEvent)
+}
+
+type OIDCService struct {
+	store      IdentityStore
+	user       UserProvider
+	sessions   SessionIssuer
+	challenges ChallengeIssuer
+	events     EventEmitter
+	providers  *oidc.Registry
+	cfg        *config.Config
+	log        *slog.Logger
+}
+
+var (
+	ErrUnknownProvider  = errors.New("unknown provider")
+	ErrInvalidState     = errors.New("invalid or expired state")
+	ErrProviderLogin    = errors.New("provider login failed")
+	ErrEmailRequired    = errors.New("provider did not share an email")
+	ErrAccountExists    = errors.New("an account with this email already exists")
+	ErrEmailNotVerified = errors.New("email not verified")
+	ErrDeactivated      = errors.New("account is scheduled for deletion")
+	ErrSuspended        = errors.New("account is suspended")
+)
+
+func New(store IdentityStore, user UserProvider, sessions SessionIssuer, challenges ChallengeIssuer, events EventEmitter, providers *oidc.Registry, cfg *config.Config, log *slog.Logger) *OIDCService {
+	return &OIDCService{
+		store:      store,
+		user:       user,
+		sessions:   sessions,
+		challenges: challenges,
+		events:     events,
+		providers:  providers,
+		cfg:        cfg,
+		log:        log,
+	}
+}
+
+func (o *OIDCService) Providers() []string {
+	return o.providers.Names()
+}
+
+// Start returns the url the user is sent to. The PKCE verifier and the
+// nonce stay on the server, bound to the hash of the state.
+func (o *OIDCService) Start(ctx context.Context, providerName string) (string, error) {
+	const op = "services.oidc.Start"
+
+	log := o.log.With(
+		slog.String("op", op),
+		slog.String("provider", providerName),
+	)
+
+	provider, ok := o.providers.Provider(providerName)
+	if !ok {
+		return "", fmt.Errorf("%s: %w", op, ErrUnknownProvider)
+	}
+
+	state, stateHash, err := token.New()
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	nonce, _, err := token.New()
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	verifier, err := oidc.NewVerifier()
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	authURL, err := provider.AuthCodeURL(ctx, state, nonce, verifier)
+	if err != nil {
+		log.Error("failed to reach provider", sl.Err(err))
+
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = o.store.SaveOIDCState(ctx, stateHash, models.OIDCState{
+		Provider:  providerName,
+		Verifier:  verifier,
+		Nonce:     nonce,
+		ExpiresAt: time.Now().Add(o.cfg.OIDC.StateTTL),
+	})
+	if err != nil {
+		log.Error("failed to save state", sl.Err(err))
+
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return authURL, nil
+}
+
+// Complete finishes the login after the provider redirected back. The
+// first login creates the user, or links an existing account when the
+// provider verified its email. Accounts with a second factor get a
+// challenge instead of a session.
+func (o *OIDCService) Complete(ctx context.Context, providerName string, code string, state string, meta models.RequestMeta) (*models.LoginResult, error) {
+	const op = "services.oidc.Complete"
+
+	log := o.log.With(
+		slog.String("op", op),
+		slog.String("provider", providerName),
+	)
+
+	provider, ok := o.providers.Provider(providerName)
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", op, ErrUnknownProvider)
+	}
+
+	saved, err := o.store.ConsumeOIDCState(ctx, token.Hash(state))
+	if err != nil {
+		if errors.Is(err, storage.ErrOIDCStateNotFound) {
+			log.Warn("unknown state", sl.Err(err))
+
+			return nil, fmt.Errorf("%s: %w", op, ErrInvalidState)
+		}
+
+		log.Error("failed to get state", sl.Err(err))
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if saved.Provider != providerName || time.Now().After(saved.ExpiresAt) {
+		log.Warn("state does not belong to the provider or has expired")
+
+		return nil, fmt.Errorf("%s: %w", op, ErrInvalidState)
+	}
+
+	claims, err := provider.Exchange(ctx, code, saved.Verifier, saved.Nonce)
+	if err != nil {
+		log.Warn("failed to exchange code", sl.Err(err))
+
+		return nil, fmt.Errorf("%s: %w: %w", op, ErrProviderLogin, err)
+	}
+
+	user, err := o.linkedUser(ctx, providerName, claims, meta, log)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	account, err := o.store.Account(ctx, user.UUID)
+	if err != nil {
+		log.Error("failed to get account", sl.Err(err))
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if account.Deactivated {
+		log.Warn("account is scheduled for deletion")
+
+		return nil, fmt.Errorf("%s: %w", op, ErrDeactivated)
+	}
+
+	if account.Suspended {
+		log.Warn("account is suspended")
+
+		return nil, fmt.Errorf("%s: %w", op, ErrSuspended)
+	}
+
+	user.EmailVerified = account.EmailVerified
+	user.Role = account.Role
+
+	if !user.EmailVerified && o.cfg.Verification.RequiredForLogin {
+		log.Warn("email not verified")
+
+		return nil, fmt.Errorf("%s: %w", op, ErrEmailNotVerified)
+	}
+
+	if account.TwoFactorEnabled {
+		challenge, err := o.challenges.NewChallenge(ctx, *user)
+		if err != nil {
+			log.Error("failed to issue login challenge", sl.Err(err))
+
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		log.Info("second factor required")
+
+		return &models.LoginResult{Challenge: challenge}, nil
+	}
+
+	accessToken, refreshToken, err := o.sessions.NewSession(ctx, *user, meta)
+	if err != nil {
+		log.Error("failed to start session", sl.Err(err))
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("user logged in with provider")
+
+	event := models.NewAuthEvent(models.EventLoginSucceeded, user.UUID, meta)
+	event.Details = map[string]string{"provider": providerName}
+
+	o.events.Emit(ctx, event)
+
+	return &models.LoginResult{
+		User:         user,
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+	}, nil
+}
+
+// linkedUser returns the user the external subject is linked to,
+// linking it on the first login. The link holds on to the user id, the
+// email it was made with may have changed since.
+func (o *OIDCService) linkedUser(ctx context.Context, providerName string, claims *oidc.Claims, meta models.RequestMeta, log *slog.Logger) (*models.NormalizedUser, error) {
+	link, err := o.store.IdentityLink(ctx, providerName, claims.Subject)
+	if err == nil {
+		user, err := o.user.UserByID(ctx, link.UserID)
+		if err != nil {
+			log.Error("failed to get linked user", sl.Err(err))
+
+			return nil, err
+		}
+
+		return user, nil
+	}
+
+	if !errors.Is(err, storage.ErrIdentityLinkNotFound) {
+		log.Error("failed to get identity link", sl.Err(err))
+
+		return nil, err
+	}
+
+	if claims.Email == "" {
+		log.Warn("no email in id token")
+
+		return nil, ErrEmailRequired
+	}
+
+	eventType := models.EventIdentityLinked
+
+	user, err := o.user.GetUser(ctx, claims.Email)
+	switch {
+	case err == nil:
+		// Whoever controls the provider account would take over the
+		// local one, so only an email the provider verified links.
+		if !claims.EmailVerified {
+			log.Warn("email of an existing account is not verified by the provider")
+
+			return nil, ErrAccountExists
+		}
+	case errors.Is(err, storage.ErrUserNotFound):
+		user, err = o.user.CreateUser(ctx, claims.Email)
+		if err != nil {
+			log.Error("failed to create user", sl.Err(err))
+
+			return nil, err
+		}
+
+		eventType = models.EventRegister
+	default:
+		log.Error("failed to get user", sl.Err(err))
+
+		return nil, err
+	}
+
+	err = o.store.LinkIdentity(ctx, models.IdentityLink{
+		Provider: providerName,
+		Subject:  claims.Subject,
+		UserID:   user.UUID,
+		Email:    user.Email,
+	}, claims.EmailVerified)
+	if err != nil {
+		log.Error("failed to link identity", sl.Err(err))
+
+		return nil, err
+	}
+
+	log.Info("identity linked", slog.String("user_id", user.UUID.String()))
+
+	event := models.NewAuthEvent(eventType, user.UUID, meta)
+	event.Details = map[string]string{"provider": providerName}
+
+	o.events.Emit(ctx, event)
+
+	return user, nil
+}
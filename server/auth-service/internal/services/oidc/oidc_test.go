@@ -0,0 +1,237 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/config"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/domain/models"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/lib/logger/slogdiscard"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/lib/oidc"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/lib/oidc/oidctest"
+	storage "github.com/sergey-frey/cchat/server/auth-service/internal/provider"
+)
+
+type identityStore struct {
+	states   map[string]models.OIDCState
+	links    map[string]models.IdentityLink
+	accounts map[uuid.UUID]*models.Account
+}
+
+func (s *identityStore) SaveOIDCState(ctx context.Context, stateHash []byte, state models.OIDCState) error {
+	s.states[string(stateHash)] = state
+	return nil
+}
+
+func (s *identityStore) ConsumeOIDCState(ctx context.Context, stateHash []byte) (*models.OIDCState, error) {
+	state, ok := s.states[string(stateHash)]
+	if !ok {
+		return nil, storage.ErrOIDCStateNotFound
+	}
+
+	delete(s.states, string(stateHash))
+
+	return &state, nil
+}
+
+func (s *identityStore) IdentityLink(ctx context.Context, provider string, subject string) (*models.IdentityLink, error) {
+	link, ok := s.links[provider+"/"+subject]
+	if !ok {
+		return nil, storage.ErrIdentityLinkNotFound
+	}
+
+	return &link, nil
+}
+
+func (s *identityStore) LinkIdentity(ctx context.Context, link models.IdentityLink, emailVerified bool) error {
+	s.links[link.Provider+"/"+link.Subject] = link
+
+	account, ok := s.accounts[link.UserID]
+	if !ok {
+		account = &models.Account{UserID: link.UserID}
+		s.accounts[link.UserID] = account
+	}
+
+	account.EmailVerified = account.EmailVerified || emailVerified
+
+	return nil
+}
+
+func (s *identityStore) Account(ctx context.Context, uid uuid.UUID) (*models.Account, error) {
+	account, ok := s.accounts[uid]
+	if !ok {
+		return nil, storage.ErrUserNotFound
+	}
+
+	return account, nil
+}
+
+type users struct {
+	byEmail map[string]*models.NormalizedUser
+	created int
+}
+
+func (u *users) GetUser(ctx context.Context, email string) (*models.NormalizedUser, error) {
+	user, ok := u.byEmail[email]
+	if !ok {
+		return nil, storage.ErrUserNotFound
+	}
+
+	copied := *user
+
+	return &copied, nil
+}
+
+func (u *users) UserByID(ctx context.Context, uid uuid.UUID) (*models.NormalizedUser, error) {
+	for _, user := range u.byEmail {
+		if user.UUID == uid {
+			copied := *user
+
+			return &copied, nil
+		}
+	}
+
+	return nil, storage.ErrUserNotFound
+}
+
+func (u *users) CreateUser(ctx context.Context, email string) (*models.NormalizedUser, error) {
+	u.created++
+
+	user := &models.NormalizedUser{UUID: uuid.New(), Email: email, Username: "user"}
+	u.byEmail[email] = user
+
+	copied := *user
+
+	return &copied, nil
+}
+
+type sessions struct{}
+
+func (sessions) NewSession(ctx context.Context, user models.NormalizedUser, meta models.RequestMeta) (string, string, error) {
+	return "access", "refresh", nil
+}
+
+type challenges struct{}
+
+func (challenges) NewChallenge(ctx context.Context, user models.NormalizedUser) (*models.TwoFactorChallenge, error) {
+	return &models.TwoFactorChallenge{TwoFactorRequired: true, Challenge: "challenge"}, nil
+}
+
+type events struct{}
+
+func (events) Emit(ctx context.Context, event models.AuthEvent) {}
+
+func TestOIDC_LoginFlow(t *testing.T) {
+	ctx := context.Background()
+
+	provider := oidctest.NewServer("cchat")
+	defer provider.Close()
+
+	registry, err := oidc.NewRegistry(provider.Client(), []oidc.Config{{
+		Name:        "test",
+		Issuer:      provider.URL,
+		ClientID:    "cchat",
+		RedirectURL: "http://localhost/auth/oidc/test/callback",
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := &identityStore{
+		states:   make(map[string]models.OIDCState),
+		links:    make(map[string]models.IdentityLink),
+		accounts: make(map[uuid.UUID]*models.Account),
+	}
+	userProvider := &users{byEmail: make(map[string]*models.NormalizedUser)}
+
+	cfg := &config.Config{OIDC: config.OIDC{StateTTL: time.Minute}}
+
+	o := New(store, userProvider, sessions{}, challenges{}, events{}, registry, cfg, slogdiscard.NewDiscardLogger())
+
+	login := func(user oidctest.User) (*models.LoginResult, error) {
+		authURL, err := o.Start(ctx, "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		code, state, err := provider.Authorize(authURL, user)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return o.Complete(ctx, "test", code, state, models.RequestMeta{})
+	}
+
+	alice := oidctest.User{Subject: "alice-subject", Email: "alice@example.com", EmailVerified: true}
+
+	first, err := login(alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if userProvider.created != 1 {
+		t.Fatalf("expected the first login to create the user, created %d", userProvider.created)
+	}
+
+	if !first.User.EmailVerified {
+		t.Fatal("expected the email verified by the provider to be verified")
+	}
+
+	second, err := login(alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if userProvider.created != 1 || second.User.UUID != first.User.UUID {
+		t.Fatalf("expected the second login to reuse the linked user")
+	}
+
+	// The link follows the user, not the email it was made with.
+	changed := userProvider.byEmail["alice@example.com"]
+	delete(userProvider.byEmail, "alice@example.com")
+	changed.Email = "alice@work.example.com"
+	userProvider.byEmail[changed.Email] = changed
+
+	third, err := login(alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if userProvider.created != 1 || third.User.UUID != first.User.UUID || third.User.Email != changed.Email {
+		t.Fatalf("expected the login after an email change to reuse the linked user")
+	}
+
+	// An existing account is not taken over through an unverified email.
+	userProvider.byEmail["bob@example.com"] = &models.NormalizedUser{UUID: uuid.New(), Email: "bob@example.com"}
+
+	_, err = login(oidctest.User{Subject: "bob-subject", Email: "bob@example.com"})
+	if !errors.Is(err, ErrAccountExists) {
+		t.Fatalf("expected an existing account to be refused, got %v", err)
+	}
+
+	// The state is only good for one callback.
+	authURL, err := o.Start(ctx, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, state, err := provider.Authorize(authURL, alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := o.Complete(ctx, "test", code, state, models.RequestMeta{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := o.Complete(ctx, "test", code, state, models.RequestMeta{}); !errors.Is(err, ErrInvalidState) {
+		t.Fatalf("expected a replayed state to be refused, got %v", err)
+	}
+
+	if _, err := o.Start(ctx, "unknown"); !errors.Is(err, ErrUnknownProvider) {
+		t.Fatalf("expected an unknown provider to be refused, got %v", err)
+	}
+}
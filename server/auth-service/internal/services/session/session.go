@@ -0,0 +1,364 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/domain/models"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/lib/jwt"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/lib/logger/sl"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/lib/useragent"
+	storage "github.com/sergey-frey/cchat/server/auth-service/internal/provider"
+)
+
+type SessionProvider interface {
+	CreateSession(ctx context.Context, session models.Session, tokenID uuid.UUID) error
+	Session(ctx context.Context, sessionID uuid.UUID) (*models.Session, error)
+	RotateRefreshToken(ctx context.Context, userID uuid.UUID, sessionID uuid.UUID, tokenID uuid.UUID, newTokenID uuid.UUID, meta models.RequestMeta) (*models.ConsumedToken, error)
+	RevokeSession(ctx context.Context, sessionID uuid.UUID) error
+	UserSessions(ctx context.Context, userID uuid.UUID) ([]models.Session, error)
+	RevokeUserSession(ctx context.Context, userID uuid.UUID, sessionID uuid.UUID) error
+	RevokeOtherSessions(ctx context.Context, userID uuid.UUID, currentSessionID uuid.UUID) (int64, error)
+	RevokeUserSessions(ctx context.Context, userID uuid.UUID) error
+	Account(ctx context.Context, userID uuid.UUID) (*models.Account, error)
+}
+
+// UserProvider knows the current username and email of a user, see
+// userapi.
+type UserProvider interface {
+	UserByID(ctx context.Context, uid uuid.UUID) (*models.NormalizedUser, error)
+}
+
+// EventEmitter appends to the authentication audit log.
+type EventEmitter interface {
+	Emit(ctx context.Context, event models.AuthEvent)
+}
+
+// reuseGrace is how long after a rotation the consumed token still gets
+// its successor. Parallel requests made with an expired access token all
+// present the same refresh token, only the first one rotates it.
+const reuseGrace = 10 * time.Second
+
+type SessionService struct {
+	sessions SessionProvider
+	users    UserProvider
+	events   EventEmitter
+	log      *slog.Logger
+	now      func() time.Time
+}
+
+var (
+	ErrSessionNotActive   = fmt.Errorf("session is not active: %w", jwt.ErrUserUnauthorized)
+	ErrRefreshTokenReused = fmt.Errorf("refresh token reused: %w", jwt.ErrUserUnauthorized)
+	ErrSessionNotFound    = errors.New("session not found")
+	ErrAccountSuspended   = fmt.Errorf("account is suspended: %w", jwt.ErrUserUnauthorized)
+)
+
+func New(sessions SessionProvider, users UserProvider, events EventEmitter, log *slog.Logger) *SessionService {
+	return &SessionService{
+		sessions: sessions,
+		users:    users,
+		events:   events,
+		log:      log,
+		now:      time.Now,
+	}
+}
+
+// NewSession starts a server-side session for the user and issues the first token pair of its chain.
+func (s *SessionService) NewSession(ctx context.Context, user models.NormalizedUser, meta models.RequestMeta) (string, string, error) {
+	const op = "services.session.NewSession"
+
+	log := s.log.With(
+		slog.String("op", op),
+		slog.String("user_id", user.UUID.String()),
+	)
+
+	session := models.Session{
+		ID:        uuid.New(),
+		UserID:    user.UUID,
+		UserAgent: meta.UserAgent,
+		IP:        meta.IP,
+		ExpiresAt: time.Now().Add(jwt.RefreshDuration),
+	}
+	tokenID := uuid.New()
+
+	if err := s.sessions.CreateSession(ctx, session, tokenID); err != nil {
+		log.Error("failed to create session", sl.Err(err))
+
+		return "", "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	accessToken, refreshToken, err := jwt.NewPairTokens(user, session.ID, tokenID)
+	if err != nil {
+		log.Error("failed to generate tokens", sl.Err(err))
+
+		return "", "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("session created", slog.String("session_id", session.ID.String()))
+
+	return accessToken, refreshToken, nil
+}
+
+func (s *SessionService) ValidateSession(ctx context.Context, sessionID uuid.UUID) error {
+	const op = "services.session.ValidateSession"
+
+	session, err := s.sessions.Session(ctx, sessionID)
+	if err != nil {
+		if errors.Is(err, storage.ErrSessionNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrSessionNotActive)
+		}
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if session.RevokedAt != nil || session.ExpiresAt.Before(time.Now()) {
+		return fmt.Errorf("%s: %w", op, ErrSessionNotActive)
+	}
+
+	return nil
+}
+
+// RotateRefreshToken consumes the presented refresh token and returns the id of its successor
+// together with the current account state, so the new access token does not carry stale claims.
+// Presenting an already consumed token revokes the whole session, unless
+// it was rotated within reuseGrace and its successor is still unused, then
+// the successor is returned again.
+func (s *SessionService) RotateRefreshToken(ctx context.Context, userID uuid.UUID, sessionID uuid.UUID, tokenID uuid.UUID, meta models.RequestMeta) (uuid.UUID, *models.NormalizedUser, error) {
+	const op = "services.session.RotateRefreshToken"
+
+	log := s.log.With(
+		slog.String("op", op),
+		slog.String("session_id", sessionID.String()),
+	)
+
+	newTokenID := uuid.New()
+
+	consumed, err := s.sessions.RotateRefreshToken(ctx, userID, sessionID, tokenID, newTokenID, meta)
+	if err != nil && errors.Is(err, storage.ErrRefreshTokenReused) && s.racedRotation(consumed) {
+		log.Info("refresh token rotated by a parallel request, returning its successor")
+
+		newTokenID, err = consumed.SuccessorID, nil
+	}
+
+	if err != nil {
+		if errors.Is(err, storage.ErrRefreshTokenReused) {
+			log.Warn("refresh token reuse detected, revoking session", slog.String("ip", meta.IP))
+
+			if err := s.sessions.RevokeSession(ctx, sessionID); err != nil {
+				log.Error("failed to revoke session", sl.Err(err))
+
+				return uuid.Nil, nil, fmt.Errorf("%s: %w", op, err)
+			}
+
+			event := models.NewAuthEvent(models.EventSessionRevoked, userID, meta)
+			event.Details = map[string]string{
+				"session_id": sessionID.String(),
+				"reason":     "refresh_token_reused",
+			}
+
+			s.events.Emit(ctx, event)
+
+			return uuid.Nil, nil, fmt.Errorf("%s: %w", op, ErrRefreshTokenReused)
+		}
+
+		if errors.Is(err, storage.ErrSessionNotFound) || errors.Is(err, storage.ErrSessionRevoked) {
+			log.Warn("session is not active", sl.Err(err))
+
+			return uuid.Nil, nil, fmt.Errorf("%s: %w", op, ErrSessionNotActive)
+		}
+
+		log.Error("failed to rotate refresh token", sl.Err(err))
+
+		return uuid.Nil, nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	account, err := s.sessions.Account(ctx, userID)
+	if err != nil {
+		log.Error("failed to get account", sl.Err(err))
+
+		return uuid.Nil, nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Suspending revokes the sessions too, this only covers a refresh that
+	// raced with it.
+	if account.Suspended {
+		log.Warn("account is suspended")
+
+		return uuid.Nil, nil, fmt.Errorf("%s: %w", op, ErrAccountSuspended)
+	}
+
+	// The claims of the new pair follow the profile, a username or email
+	// changed since the last pair is picked up here.
+	user, err := s.users.UserByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.Warn("user not found", sl.Err(err))
+
+			return uuid.Nil, nil, fmt.Errorf("%s: %w", op, ErrSessionNotActive)
+		}
+
+		log.Error("failed to get user", sl.Err(err))
+
+		return uuid.Nil, nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	user.EmailVerified = account.EmailVerified
+	user.Role = account.Role
+	user.SessionID = sessionID
+
+	log.Info("refresh token rotated")
+
+	return newTokenID, user, nil
+}
+
+// racedRotation tells a parallel request that lost the race for the
+// rotation from a replay of a token the chain has moved past.
+func (s *SessionService) racedRotation(consumed *models.ConsumedToken) bool {
+	return consumed != nil &&
+		consumed.SuccessorID != uuid.Nil &&
+		!consumed.SuccessorUsed &&
+		s.now().Sub(consumed.UsedAt) < reuseGrace
+}
+
+// Logout ends the session the request was made with.
+func (s *SessionService) Logout(ctx context.Context, userID uuid.UUID, sessionID uuid.UUID, meta models.RequestMeta) error {
+	const op = "services.session.Logout"
+
+	log := s.log.With(
+		slog.String("op", op),
+		slog.String("session_id", sessionID.String()),
+	)
+
+	if err := s.sessions.RevokeSession(ctx, sessionID); err != nil {
+		log.Error("failed to revoke session", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("session revoked")
+
+	event := models.NewAuthEvent(models.EventLogout, userID, meta)
+	event.Details = map[string]string{"session_id": sessionID.String()}
+
+	s.events.Emit(ctx, event)
+
+	return nil
+}
+
+func (s *SessionService) ListSessions(ctx context.Context, userID uuid.UUID, currentSessionID uuid.UUID) ([]models.SessionInfo, error) {
+	const op = "services.session.ListSessions"
+
+	log := s.log.With(
+		slog.String("op", op),
+		slog.String("user_id", userID.String()),
+	)
+
+	log.Info("getting sessions")
+
+	sessions, err := s.sessions.UserSessions(ctx, userID)
+	if err != nil {
+		log.Error("failed to get sessions", sl.Err(err))
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	infos := make([]models.SessionInfo, len(sessions))
+	for i, session := range sessions {
+		infos[i] = models.SessionInfo{
+			ID:           session.ID,
+			Device:       useragent.Label(session.UserAgent),
+			IP:           session.IP,
+			CreatedAt:    session.CreatedAt,
+			LastActivity: session.LastUsedAt,
+			Current:      session.ID == currentSessionID,
+		}
+	}
+
+	log.Info("got sessions")
+
+	return infos, nil
+}
+
+func (s *SessionService) RevokeUserSession(ctx context.Context, userID uuid.UUID, sessionID uuid.UUID, meta models.RequestMeta) error {
+	const op = "services.session.RevokeUserSession"
+
+	log := s.log.With(
+		slog.String("op", op),
+		slog.String("user_id", userID.String()),
+		slog.String("session_id", sessionID.String()),
+	)
+
+	if err := s.sessions.RevokeUserSession(ctx, userID, sessionID); err != nil {
+		if errors.Is(err, storage.ErrSessionNotFound) {
+			log.Warn("session not found", sl.Err(err))
+
+			return fmt.Errorf("%s: %w", op, ErrSessionNotFound)
+		}
+
+		log.Error("failed to revoke session", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("session revoked")
+
+	event := models.NewAuthEvent(models.EventSessionRevoked, userID, meta)
+	event.Details = map[string]string{"session_id": sessionID.String()}
+
+	s.events.Emit(ctx, event)
+
+	return nil
+}
+
+func (s *SessionService) RevokeOtherSessions(ctx context.Context, userID uuid.UUID, currentSessionID uuid.UUID, meta models.RequestMeta) (int64, error) {
+	const op = "services.session.RevokeOtherSessions"
+
+	log := s.log.With(
+		slog.String("op", op),
+		slog.String("user_id", userID.String()),
+	)
+
+	revoked, err := s.sessions.RevokeOtherSessions(ctx, userID, currentSessionID)
+	if err != nil {
+		log.Error("failed to revoke sessions", sl.Err(err))
+
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("other sessions revoked", slog.Int64("revoked", revoked))
+
+	event := models.NewAuthEvent(models.EventSessionRevoked, userID, meta)
+	event.Details = map[string]string{
+		"scope":   "others",
+		"revoked": strconv.FormatInt(revoked, 10),
+	}
+
+	s.events.Emit(ctx, event)
+
+	return revoked, nil
+}
+
+func (s *SessionService) RevokeUserSessions(ctx context.Context, userID uuid.UUID) error {
+	const op = "services.session.RevokeUserSessions"
+
+	log := s.log.With(
+		slog.String("op", op),
+		slog.String("user_id", userID.String()),
+	)
+
+	if err := s.sessions.RevokeUserSessions(ctx, userID); err != nil {
+		log.Error("failed to revoke sessions", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("all sessions revoked")
+
+	return nil
+}
@@ -0,0 +1,274 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/domain/models"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/lib/logger/slogdiscard"
+	storage "github.com/sergey-frey/cchat/server/auth-service/internal/provider"
+)
+
+type refreshToken struct {
+	parent uuid.UUID
+	usedAt *time.Time
+}
+
+// store keeps the refresh token chain of one session. The mutex stands in
+// for the row lock the postgres store takes.
+type store struct {
+	mu      sync.Mutex
+	now     func() time.Time
+	session models.Session
+	tokens  map[uuid.UUID]*refreshToken
+}
+
+func (s *store) CreateSession(ctx context.Context, session models.Session, tokenID uuid.UUID) error {
+	s.session = session
+	s.tokens[tokenID] = &refreshToken{}
+
+	return nil
+}
+
+func (s *store) Session(ctx context.Context, sessionID uuid.UUID) (*models.Session, error) {
+	copied := s.session
+
+	return &copied, nil
+}
+
+func (s *store) RotateRefreshToken(ctx context.Context, userID uuid.UUID, sessionID uuid.UUID, tokenID uuid.UUID, newTokenID uuid.UUID, meta models.RequestMeta) (*models.ConsumedToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, ok := s.tokens[tokenID]
+	if !ok || sessionID != s.session.ID || userID != s.session.UserID {
+		return nil, storage.ErrSessionNotFound
+	}
+
+	if s.session.RevokedAt != nil {
+		return nil, storage.ErrSessionRevoked
+	}
+
+	if token.usedAt != nil {
+		consumed := &models.ConsumedToken{UsedAt: *token.usedAt}
+
+		for id, successor := range s.tokens {
+			if successor.parent == tokenID {
+				consumed.SuccessorID = id
+				consumed.SuccessorUsed = successor.usedAt != nil
+			}
+		}
+
+		return consumed, storage.ErrRefreshTokenReused
+	}
+
+	usedAt := s.now()
+	token.usedAt = &usedAt
+	s.tokens[newTokenID] = &refreshToken{parent: tokenID}
+
+	return nil, nil
+}
+
+func (s *store) RevokeSession(ctx context.Context, sessionID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	revokedAt := s.now()
+	s.session.RevokedAt = &revokedAt
+
+	return nil
+}
+
+func (s *store) UserSessions(ctx context.Context, userID uuid.UUID) ([]models.Session, error) {
+	return []models.Session{s.session}, nil
+}
+
+func (s *store) RevokeUserSession(ctx context.Context, userID uuid.UUID, sessionID uuid.UUID) error {
+	return s.RevokeSession(ctx, sessionID)
+}
+
+func (s *store) RevokeOtherSessions(ctx context.Context, userID uuid.UUID, currentSessionID uuid.UUID) (int64, error) {
+	return 0, nil
+}
+
+func (s *store) RevokeUserSessions(ctx context.Context, userID uuid.UUID) error {
+	return s.RevokeSession(ctx, s.session.ID)
+}
+
+func (s *store) Account(ctx context.Context, userID uuid.UUID) (*models.Account, error) {
+	return &models.Account{UserID: userID, Role: models.RoleUser}, nil
+}
+
+// users answers with the current profile of every user.
+type users struct {
+	username string
+}
+
+func (u *users) UserByID(ctx context.Context, uid uuid.UUID) (*models.NormalizedUser, error) {
+	return &models.NormalizedUser{UUID: uid, Username: u.username, Email: u.username + "@example.com"}, nil
+}
+
+type events struct {
+	mu    sync.Mutex
+	types []string
+}
+
+func (e *events) Emit(ctx context.Context, event models.AuthEvent) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.types = append(e.types, event.Type)
+}
+
+func newSession(t *testing.T, now func() time.Time) (*SessionService, *store, *events, uuid.UUID) {
+	st := &store{now: now, tokens: make(map[uuid.UUID]*refreshToken)}
+	log := &events{}
+
+	s := New(st, &users{username: "alice"}, log, slogdiscard.NewDiscardLogger())
+	s.now = now
+
+	tokenID := uuid.New()
+
+	err := st.CreateSession(context.Background(), models.Session{
+		ID:        uuid.New(),
+		UserID:    uuid.New(),
+		ExpiresAt: now().Add(time.Hour),
+	}, tokenID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s, st, log, tokenID
+}
+
+func TestRotateRefreshToken_ParallelRefreshes(t *testing.T) {
+	ctx := context.Background()
+
+	now := time.Now()
+	s, st, log, tokenID := newSession(t, func() time.Time { return now })
+
+	const parallel = 2
+
+	var wg sync.WaitGroup
+
+	successors := make([]uuid.UUID, parallel)
+	errs := make([]error, parallel)
+
+	for i := range parallel {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			successors[i], _, errs[i] = s.RotateRefreshToken(ctx, st.session.UserID, st.session.ID, tokenID, models.RequestMeta{})
+		}()
+	}
+
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("expected refresh %d to succeed, got %v", i, err)
+		}
+	}
+
+	if successors[0] != successors[1] {
+		t.Fatalf("expected both refreshes to get the same successor, got %v", successors)
+	}
+
+	if st.session.RevokedAt != nil {
+		t.Fatal("expected the session to stay active")
+	}
+
+	if len(log.types) != 0 {
+		t.Fatalf("expected no events, got %v", log.types)
+	}
+
+	// The chain goes on from the shared successor.
+	if _, _, err := s.RotateRefreshToken(ctx, st.session.UserID, st.session.ID, successors[0], models.RequestMeta{}); err != nil {
+		t.Fatalf("expected the successor to rotate, got %v", err)
+	}
+}
+
+func TestRotateRefreshToken_ReuseRevokesSession(t *testing.T) {
+	ctx := context.Background()
+
+	now := time.Now()
+	s, st, log, tokenID := newSession(t, func() time.Time { return now })
+
+	successor, _, err := s.RotateRefreshToken(ctx, st.session.UserID, st.session.ID, tokenID, models.RequestMeta{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := s.RotateRefreshToken(ctx, st.session.UserID, st.session.ID, successor, models.RequestMeta{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Within the grace period but the chain has moved past the successor.
+	if _, _, err := s.RotateRefreshToken(ctx, st.session.UserID, st.session.ID, tokenID, models.RequestMeta{}); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("expected a replay behind the chain to be reuse, got %v", err)
+	}
+
+	if st.session.RevokedAt == nil {
+		t.Fatal("expected the session to be revoked")
+	}
+
+	if len(log.types) != 1 || log.types[0] != models.EventSessionRevoked {
+		t.Fatalf("expected a revocation event, got %v", log.types)
+	}
+}
+
+func TestRotateRefreshToken_ReuseAfterGrace(t *testing.T) {
+	ctx := context.Background()
+
+	now := time.Now()
+	s, st, _, tokenID := newSession(t, func() time.Time { return now })
+
+	if _, _, err := s.RotateRefreshToken(ctx, st.session.UserID, st.session.ID, tokenID, models.RequestMeta{}); err != nil {
+		t.Fatal(err)
+	}
+
+	now = now.Add(reuseGrace)
+
+	if _, _, err := s.RotateRefreshToken(ctx, st.session.UserID, st.session.ID, tokenID, models.RequestMeta{}); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("expected a replay after the grace period to be reuse, got %v", err)
+	}
+
+	if st.session.RevokedAt == nil {
+		t.Fatal("expected the session to be revoked")
+	}
+}
+
+func TestRotateRefreshToken_FollowsProfile(t *testing.T) {
+	ctx := context.Background()
+
+	s, st, _, tokenID := newSession(t, time.Now)
+
+	profile := &users{username: "alice"}
+	s.users = profile
+
+	successor, user, err := s.RotateRefreshToken(ctx, st.session.UserID, st.session.ID, tokenID, models.RequestMeta{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if user.Username != "alice" || user.SessionID != st.session.ID {
+		t.Fatalf("expected the claims of alice in the same session, got %+v", user)
+	}
+
+	profile.username = "alice2"
+
+	_, user, err = s.RotateRefreshToken(ctx, st.session.UserID, st.session.ID, successor, models.RequestMeta{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if user.Username != "alice2" || user.Email != "alice2@example.com" {
+		t.Fatalf("expected the renamed profile in the new claims, got %+v", user)
+	}
+}
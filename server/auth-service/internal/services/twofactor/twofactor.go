@@ -0,0 +1,435 @@
+package twofactor
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/config"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/domain/models"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/lib/logger/sl"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/lib/token"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/lib/totp"
+	storage "github.com/sergey-frey/cchat/server/auth-service/internal/provider"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type TwoFactorProvider interface {
+	TwoFactor(ctx context.Context, uid uuid.UUID) (*models.TwoFactor, error)
+	SaveTwoFactorSecret(ctx context.Context, uid uuid.UUID, secret string) error
+	EnableTwoFactor(ctx context.Context, uid uuid.UUID, step int64, recoveryHashes [][]byte) error
+	DisableTwoFactor(ctx context.Context, uid uuid.UUID) error
+	UseTOTPStep(ctx context.Context, uid uuid.UUID, step int64) error
+	UseRecoveryCode(ctx context.Context, uid uuid.UUID, codeHash []byte) error
+	SaveLoginChallenge(ctx context.Context, challengeHash []byte, challenge models.LoginChallenge) error
+	LoginChallenge(ctx context.Context, challengeHash []byte, maxAttempts int) (*models.LoginChallenge, error)
+	FailLoginChallenge(ctx context.Context, challengeHash []byte) error
+	ConsumeLoginChallenge(ctx context.Context, challengeHash []byte) error
+	Password(ctx context.Context, uid uuid.UUID) ([]byte, error)
+	Account(ctx context.Context, uid uuid.UUID) (*models.Account, error)
+}
+
+type UserProvider interface {
+	GetUser(ctx context.Context, email string) (*models.NormalizedUser, error)
+}
+
+type SessionIssuer interface {
+	NewSession(ctx context.Context, user models.NormalizedUser, meta models.RequestMeta) (accessToken string, refreshToken string, err error)
+}
+
+// LoginGuard throttles failed logins per account and per IP. A wrong
+// second factor counts like a wrong password.
+type LoginGuard interface {
+	Check(ctx context.Context, uid uuid.UUID, ip string) error
+	Fail(ctx context.Context, user *models.NormalizedUser, meta models.RequestMeta) error
+	Succeed(ctx context.Context, uid uuid.UUID) error
+}
+
+// EventEmitter appends to the authentication audit log.
+type EventEmitter interface {
+	Emit(ctx context.Context, event models.AuthEvent)
+}
+
+type TwoFactorService struct {
+	twoFactor TwoFactorProvider
+	user      UserProvider
+	sessions  SessionIssuer
+	guard     LoginGuard
+	events    EventEmitter
+	cfg       *config.Config
+	log       *slog.Logger
+}
+
+var (
+	ErrTwoFactorEnabled     = errors.New("two-factor authentication already enabled")
+	ErrTwoFactorNotEnrolled = errors.New("two-factor authentication is not enrolled")
+	ErrTwoFactorDisabled    = errors.New("two-factor authentication is not enabled")
+	ErrInvalidCode          = errors.New("invalid code")
+	ErrInvalidChallenge     = errors.New("invalid or expired login challenge")
+	ErrInvalidCredentials   = errors.New("invalid credentials")
+	ErrAccountSuspended     = errors.New("account is suspended")
+)
+
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+func New(twoFactor TwoFactorProvider, user UserProvider, sessions SessionIssuer, guard LoginGuard, events EventEmitter, cfg *config.Config, log *slog.Logger) *TwoFactorService {
+	return &TwoFactorService{
+		twoFactor: twoFactor,
+		user:      user,
+		sessions:  sessions,
+		guard:     guard,
+		events:    events,
+		cfg:       cfg,
+		log:       log,
+	}
+}
+
+// Enroll generates a new secret for the user. The second factor is not
+// enforced until the user confirms it with a first code.
+func (t *TwoFactorService) Enroll(ctx context.Context, user models.NormalizedUser) (*models.TwoFactorEnrollment, error) {
+	const op = "services.twofactor.Enroll"
+
+	log := t.log.With(
+		slog.String("op", op),
+		slog.String("user_id", user.UUID.String()),
+	)
+
+	secret, err := totp.NewSecret()
+	if err != nil {
+		log.Error("failed to generate secret", sl.Err(err))
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = t.twoFactor.SaveTwoFactorSecret(ctx, user.UUID, secret)
+	if err != nil {
+		if errors.Is(err, storage.ErrTwoFactorEnabled) {
+			log.Warn("two-factor authentication already enabled")
+
+			return nil, fmt.Errorf("%s: %w", op, ErrTwoFactorEnabled)
+		}
+
+		log.Error("failed to save secret", sl.Err(err))
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("two-factor enrollment started")
+
+	return &models.TwoFactorEnrollment{
+		Secret: secret,
+		URI:    totp.URI(t.cfg.TwoFactor.Issuer, user.Email, secret),
+	}, nil
+}
+
+// Confirm enables the second factor if the code matches the enrolled
+// secret and returns the recovery codes. They are shown only once.
+func (t *TwoFactorService) Confirm(ctx context.Context, uid uuid.UUID, code models.TwoFactorCode, meta models.RequestMeta) (*models.RecoveryCodes, error) {
+	const op = "services.twofactor.Confirm"
+
+	log := t.log.With(
+		slog.String("op", op),
+		slog.String("user_id", uid.String()),
+	)
+
+	twoFactor, err := t.twoFactor.TwoFactor(ctx, uid)
+	if err != nil {
+		if errors.Is(err, storage.ErrTwoFactorNotFound) {
+			log.Warn("two-factor authentication is not enrolled")
+
+			return nil, fmt.Errorf("%s: %w", op, ErrTwoFactorNotEnrolled)
+		}
+
+		log.Error("failed to get two-factor authentication", sl.Err(err))
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if twoFactor.EnabledAt != nil {
+		return nil, fmt.Errorf("%s: %w", op, ErrTwoFactorEnabled)
+	}
+
+	step, ok := totp.Validate(twoFactor.Secret, code.Code, time.Now())
+	if !ok {
+		log.Warn("invalid code")
+
+		return nil, fmt.Errorf("%s: %w", op, ErrInvalidCode)
+	}
+
+	codes, hashes, err := newRecoveryCodes(t.cfg.TwoFactor.RecoveryCodes)
+	if err != nil {
+		log.Error("failed to generate recovery codes", sl.Err(err))
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = t.twoFactor.EnableTwoFactor(ctx, uid, step, hashes)
+	if err != nil {
+		if errors.Is(err, storage.ErrTwoFactorEnabled) {
+			return nil, fmt.Errorf("%s: %w", op, ErrTwoFactorEnabled)
+		}
+
+		log.Error("failed to enable two-factor authentication", sl.Err(err))
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("two-factor authentication enabled")
+
+	t.events.Emit(ctx, models.NewAuthEvent(models.EventTwoFactorEnabled, uid, meta))
+
+	return &models.RecoveryCodes{Codes: codes}, nil
+}
+
+// Disable turns the second factor off. Both the password and a valid
+// code are required, a stolen session alone is not enough.
+func (t *TwoFactorService) Disable(ctx context.Context, uid uuid.UUID, disable models.DisableTwoFactor, meta models.RequestMeta) error {
+	const op = "services.twofactor.Disable"
+
+	log := t.log.With(
+		slog.String("op", op),
+		slog.String("user_id", uid.String()),
+	)
+
+	passHash, err := t.twoFactor.Password(ctx, uid)
+	if err != nil {
+		log.Error("failed to get password", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := bcrypt.CompareHashAndPassword(passHash, []byte(disable.Password)); err != nil {
+		log.Warn("invalid credentials", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, ErrInvalidCredentials)
+	}
+
+	if err := t.verifyCode(ctx, uid, disable.Code); err != nil {
+		log.Warn("invalid code", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := t.twoFactor.DisableTwoFactor(ctx, uid); err != nil {
+		log.Error("failed to disable two-factor authentication", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("two-factor authentication disabled")
+
+	t.events.Emit(ctx, models.NewAuthEvent(models.EventTwoFactorDisabled, uid, meta))
+
+	return nil
+}
+
+// NewChallenge is issued instead of a session when the password was
+// correct but the account has a second factor.
+func (t *TwoFactorService) NewChallenge(ctx context.Context, user models.NormalizedUser) (*models.TwoFactorChallenge, error) {
+	const op = "services.twofactor.NewChallenge"
+
+	plain, hash, err := token.New()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	challenge := models.LoginChallenge{
+		UserID:    user.UUID,
+		Email:     user.Email,
+		ExpiresAt: time.Now().Add(t.cfg.TwoFactor.ChallengeTTL),
+	}
+
+	if err := t.twoFactor.SaveLoginChallenge(ctx, hash, challenge); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &models.TwoFactorChallenge{
+		TwoFactorRequired: true,
+		Challenge:         plain,
+		ExpiresAt:         challenge.ExpiresAt,
+	}, nil
+}
+
+// CompleteLogin starts the session of a login challenge once a TOTP
+// or recovery code has been presented.
+func (t *TwoFactorService) CompleteLogin(ctx context.Context, login models.TwoFactorLogin, meta models.RequestMeta) (*models.NormalizedUser, string, string, error) {
+	const op = "services.twofactor.CompleteLogin"
+
+	log := t.log.With(
+		slog.String("op", op),
+	)
+
+	challengeHash := token.Hash(login.Challenge)
+
+	challenge, err := t.twoFactor.LoginChallenge(ctx, challengeHash, t.cfg.TwoFactor.MaxAttempts)
+	if err != nil {
+		if errors.Is(err, storage.ErrChallengeNotFound) {
+			log.Warn("invalid login challenge")
+
+			return nil, "", "", fmt.Errorf("%s: %w", op, ErrInvalidChallenge)
+		}
+
+		log.Error("failed to get login challenge", sl.Err(err))
+
+		return nil, "", "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	log = log.With(slog.String("user_id", challenge.UserID.String()))
+
+	// A challenge only limits the guesses made with it, the account and IP
+	// counters keep new challenges from starting the count over.
+	if err := t.guard.Check(ctx, challenge.UserID, meta.IP); err != nil {
+		log.Warn("login blocked", sl.Err(err))
+
+		return nil, "", "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := t.verifyCode(ctx, challenge.UserID, login.Code); err != nil {
+		if errors.Is(err, ErrInvalidCode) {
+			log.Warn("invalid code")
+
+			if err := t.twoFactor.FailLoginChallenge(ctx, challengeHash); err != nil {
+				log.Error("failed to count attempt", sl.Err(err))
+			}
+
+			if err := t.guard.Fail(ctx, &models.NormalizedUser{UUID: challenge.UserID, Email: challenge.Email}, meta); err != nil {
+				log.Error("failed to count failed login", sl.Err(err))
+			}
+
+			event := models.NewAuthEvent(models.EventLoginFailed, challenge.UserID, meta)
+			event.Details = map[string]string{
+				"email":  challenge.Email,
+				"reason": "invalid_second_factor",
+			}
+
+			t.events.Emit(ctx, event)
+		}
+
+		return nil, "", "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := t.twoFactor.ConsumeLoginChallenge(ctx, challengeHash); err != nil {
+		if errors.Is(err, storage.ErrChallengeNotFound) {
+			return nil, "", "", fmt.Errorf("%s: %w", op, ErrInvalidChallenge)
+		}
+
+		log.Error("failed to consume login challenge", sl.Err(err))
+
+		return nil, "", "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	user, err := t.user.GetUser(ctx, challenge.Email)
+	if err != nil {
+		log.Error("failed to get user", sl.Err(err))
+
+		return nil, "", "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	account, err := t.twoFactor.Account(ctx, user.UUID)
+	if err != nil {
+		log.Error("failed to get account", sl.Err(err))
+
+		return nil, "", "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	// The account may have been suspended while the challenge was open.
+	if account.Suspended {
+		log.Warn("account is suspended")
+
+		return nil, "", "", fmt.Errorf("%s: %w", op, ErrAccountSuspended)
+	}
+
+	user.EmailVerified = account.EmailVerified
+	user.Role = account.Role
+
+	// Like a login without a second factor, only a session resets the counters.
+	if err := t.guard.Succeed(ctx, challenge.UserID); err != nil {
+		log.Error("failed to reset login attempts", sl.Err(err))
+	}
+
+	accessToken, refreshToken, err := t.sessions.NewSession(ctx, *user, meta)
+	if err != nil {
+		log.Error("failed to start session", sl.Err(err))
+
+		return nil, "", "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("user logged in with second factor")
+
+	event := models.NewAuthEvent(models.EventLoginSucceeded, user.UUID, meta)
+	event.Details = map[string]string{"second_factor": "true"}
+
+	t.events.Emit(ctx, event)
+
+	return user, accessToken, refreshToken, nil
+}
+
+// verifyCode accepts either a TOTP code or one of the unused recovery codes.
+func (t *TwoFactorService) verifyCode(ctx context.Context, uid uuid.UUID, code string) error {
+	twoFactor, err := t.twoFactor.TwoFactor(ctx, uid)
+	if err != nil {
+		if errors.Is(err, storage.ErrTwoFactorNotFound) {
+			return ErrTwoFactorDisabled
+		}
+
+		return err
+	}
+
+	if twoFactor.EnabledAt == nil {
+		return ErrTwoFactorDisabled
+	}
+
+	if totp.IsCode(code) {
+		step, ok := totp.Validate(twoFactor.Secret, code, time.Now())
+		if !ok {
+			return ErrInvalidCode
+		}
+
+		err := t.twoFactor.UseTOTPStep(ctx, uid, step)
+		if errors.Is(err, storage.ErrTOTPCodeReused) {
+			return ErrInvalidCode
+		}
+
+		return err
+	}
+
+	err = t.twoFactor.UseRecoveryCode(ctx, uid, token.Hash(normalizeRecoveryCode(code)))
+	if errors.Is(err, storage.ErrRecoveryCodeNotFound) {
+		return ErrInvalidCode
+	}
+
+	return err
+}
+
+func newRecoveryCodes(n int) ([]string, [][]byte, error) {
+	codes := make([]string, 0, n)
+	hashes := make([][]byte, 0, n)
+
+	for range n {
+		raw := make([]byte, 10)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, nil, err
+		}
+
+		code := strings.ToLower(recoveryEncoding.EncodeToString(raw)[:10])
+
+		codes = append(codes, code[:5]+"-"+code[5:])
+		hashes = append(hashes, token.Hash(code))
+	}
+
+	return codes, hashes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.ReplaceAll(code, "-", "")
+	code = strings.ReplaceAll(code, " ", "")
+
+	return code
+}
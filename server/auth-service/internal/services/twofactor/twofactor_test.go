@@ -0,0 +1,248 @@
+package twofactor
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/config"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/domain/models"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/lib/logger/slogdiscard"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/lib/token"
+	storage "github.com/sergey-frey/cchat/server/auth-service/internal/provider"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/provider/storage/memory"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/services/lockout"
+)
+
+const recoveryCode = "abcde-fghij"
+
+// store holds one account with a second factor and its recovery code.
+type store struct {
+	user       models.NormalizedUser
+	recovery   []byte
+	challenges map[string]*models.LoginChallenge
+	suspended  bool
+}
+
+func (s *store) TwoFactor(ctx context.Context, uid uuid.UUID) (*models.TwoFactor, error) {
+	enabledAt := time.Now()
+
+	return &models.TwoFactor{UserID: uid, Secret: "JBSWY3DPEHPK3PXP", EnabledAt: &enabledAt}, nil
+}
+
+func (s *store) SaveTwoFactorSecret(ctx context.Context, uid uuid.UUID, secret string) error {
+	return nil
+}
+
+func (s *store) EnableTwoFactor(ctx context.Context, uid uuid.UUID, step int64, recoveryHashes [][]byte) error {
+	return nil
+}
+
+func (s *store) DisableTwoFactor(ctx context.Context, uid uuid.UUID) error {
+	return nil
+}
+
+func (s *store) UseTOTPStep(ctx context.Context, uid uuid.UUID, step int64) error {
+	return storage.ErrTOTPCodeReused
+}
+
+func (s *store) UseRecoveryCode(ctx context.Context, uid uuid.UUID, codeHash []byte) error {
+	if string(codeHash) != string(s.recovery) {
+		return storage.ErrRecoveryCodeNotFound
+	}
+
+	return nil
+}
+
+func (s *store) SaveLoginChallenge(ctx context.Context, challengeHash []byte, challenge models.LoginChallenge) error {
+	s.challenges[string(challengeHash)] = &challenge
+
+	return nil
+}
+
+func (s *store) LoginChallenge(ctx context.Context, challengeHash []byte, maxAttempts int) (*models.LoginChallenge, error) {
+	challenge, ok := s.challenges[string(challengeHash)]
+	if !ok {
+		return nil, storage.ErrChallengeNotFound
+	}
+
+	return challenge, nil
+}
+
+func (s *store) FailLoginChallenge(ctx context.Context, challengeHash []byte) error {
+	return nil
+}
+
+func (s *store) ConsumeLoginChallenge(ctx context.Context, challengeHash []byte) error {
+	delete(s.challenges, string(challengeHash))
+
+	return nil
+}
+
+func (s *store) Password(ctx context.Context, uid uuid.UUID) ([]byte, error) {
+	return nil, nil
+}
+
+func (s *store) Account(ctx context.Context, uid uuid.UUID) (*models.Account, error) {
+	return &models.Account{UserID: uid, Role: models.RoleUser, TwoFactorEnabled: true, Suspended: s.suspended}, nil
+}
+
+func (s *store) GetUser(ctx context.Context, email string) (*models.NormalizedUser, error) {
+	user := s.user
+
+	return &user, nil
+}
+
+type sessions struct{}
+
+func (sessions) NewSession(ctx context.Context, user models.NormalizedUser, meta models.RequestMeta) (string, string, error) {
+	return "access", "refresh", nil
+}
+
+type mailer struct{}
+
+func (mailer) Send(ctx context.Context, mail models.Mail) error {
+	return nil
+}
+
+type events struct{}
+
+func (events) Emit(ctx context.Context, event models.AuthEvent) {}
+
+func newTwoFactor(t *testing.T) (*TwoFactorService, *store) {
+	st := &store{
+		user:       models.NormalizedUser{UUID: uuid.New(), Email: "user@example.com"},
+		recovery:   token.Hash(normalizeRecoveryCode(recoveryCode)),
+		challenges: make(map[string]*models.LoginChallenge),
+	}
+
+	cfg := &config.Config{
+		TwoFactor: config.TwoFactor{ChallengeTTL: time.Minute, MaxAttempts: 5},
+		Lockout: config.Lockout{
+			Window:       time.Hour,
+			BackoffAfter: 100,
+			AccountLimit: 3,
+			IPLimit:      100,
+			Duration:     30 * time.Minute,
+		},
+	}
+
+	log := slogdiscard.NewDiscardLogger()
+	guard := lockout.New(memory.New(), events{}, mailer{}, cfg, log)
+
+	return New(st, st, sessions{}, guard, events{}, cfg, log), st
+}
+
+func TestCompleteLogin_FailuresLockTheAccount(t *testing.T) {
+	ctx := context.Background()
+
+	tf, st := newTwoFactor(t)
+	meta := models.RequestMeta{IP: "10.0.0.1"}
+
+	// Every guess comes with a fresh challenge, so only the account
+	// counter stops them.
+	for i := range 3 {
+		challenge, err := tf.NewChallenge(ctx, st.user)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, _, _, err = tf.CompleteLogin(ctx, models.TwoFactorLogin{Challenge: challenge.Challenge, Code: "zzzzz-zzzzz"}, meta)
+		if !errors.Is(err, ErrInvalidCode) {
+			t.Fatalf("attempt %d: expected an invalid code, got %v", i+1, err)
+		}
+	}
+
+	challenge, err := tf.NewChallenge(ctx, st.user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, _, err = tf.CompleteLogin(ctx, models.TwoFactorLogin{Challenge: challenge.Challenge, Code: recoveryCode}, meta)
+	if !errors.Is(err, lockout.ErrTooManyAttempts) {
+		t.Fatalf("expected the account to be locked, got %v", err)
+	}
+}
+
+func TestCompleteLogin_SuccessResetsFailures(t *testing.T) {
+	ctx := context.Background()
+
+	tf, st := newTwoFactor(t)
+	meta := models.RequestMeta{IP: "10.0.0.1"}
+
+	attempt := func(code string) error {
+		challenge, err := tf.NewChallenge(ctx, st.user)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, _, _, err = tf.CompleteLogin(ctx, models.TwoFactorLogin{Challenge: challenge.Challenge, Code: code}, meta)
+
+		return err
+	}
+
+	for range 2 {
+		if err := attempt("zzzzz-zzzzz"); !errors.Is(err, ErrInvalidCode) {
+			t.Fatalf("expected an invalid code, got %v", err)
+		}
+	}
+
+	if err := attempt(recoveryCode); err != nil {
+		t.Fatalf("expected the login to complete, got %v", err)
+	}
+
+	// Without the reset the third failure would lock the account.
+	for range 2 {
+		if err := attempt("zzzzz-zzzzz"); !errors.Is(err, ErrInvalidCode) {
+			t.Fatalf("expected an invalid code, got %v", err)
+		}
+	}
+
+	if err := attempt(recoveryCode); err != nil {
+		t.Fatalf("expected the login to complete, got %v", err)
+	}
+}
+
+func TestCompleteLogin_SuspendedKeepsFailures(t *testing.T) {
+	ctx := context.Background()
+
+	tf, st := newTwoFactor(t)
+	meta := models.RequestMeta{IP: "10.0.0.1"}
+
+	attempt := func(code string) error {
+		challenge, err := tf.NewChallenge(ctx, st.user)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, _, _, err = tf.CompleteLogin(ctx, models.TwoFactorLogin{Challenge: challenge.Challenge, Code: code}, meta)
+
+		return err
+	}
+
+	for range 2 {
+		if err := attempt("zzzzz-zzzzz"); !errors.Is(err, ErrInvalidCode) {
+			t.Fatalf("expected an invalid code, got %v", err)
+		}
+	}
+
+	st.suspended = true
+
+	if err := attempt(recoveryCode); !errors.Is(err, ErrAccountSuspended) {
+		t.Fatalf("expected the account to be suspended, got %v", err)
+	}
+
+	st.suspended = false
+
+	// The refused login did not reset the counters, the third failure
+	// locks the account.
+	if err := attempt("zzzzz-zzzzz"); !errors.Is(err, ErrInvalidCode) {
+		t.Fatalf("expected an invalid code, got %v", err)
+	}
+
+	if err := attempt(recoveryCode); !errors.Is(err, lockout.ErrTooManyAttempts) {
+		t.Fatalf("expected the account to be locked, got %v", err)
+	}
+}
@@ -0,0 +1,26 @@
+CREATE TABLE IF NOT EXISTS
+    sessions (
+        "session_id" UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+        "user_id" UUID NOT NULL,
+        "user_agent" TEXT NOT NULL DEFAULT '',
+        "ip" TEXT NOT NULL DEFAULT '',
+        "created_at" TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+        "last_used_at" TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+        "expires_at" TIMESTAMPTZ NOT NULL,
+        "revoked_at" TIMESTAMPTZ
+    );
+
+CREATE INDEX IF NOT EXISTS
+    idx_sessions_user_id ON sessions ("user_id");
+
+CREATE TABLE IF NOT EXISTS
+    refresh_tokens (
+        "token_id" UUID PRIMARY KEY,
+        "session_id" UUID NOT NULL REFERENCES sessions ("session_id") ON DELETE CASCADE,
+        "parent_id" UUID REFERENCES refresh_tokens ("token_id") ON DELETE CASCADE,
+        "created_at" TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+        "used_at" TIMESTAMPTZ
+    );
+
+CREATE INDEX IF NOT EXISTS
+    idx_refresh_tokens_session_id ON refresh_tokens ("session_id");
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS
+    password_resets (
+        "token_hash" BYTEA PRIMARY KEY,
+        "user_id" UUID NOT NULL,
+        "created_at" TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+        "expires_at" TIMESTAMPTZ NOT NULL,
+        "used_at" TIMESTAMPTZ
+    );
+
+CREATE INDEX IF NOT EXISTS
+    idx_password_resets_user_id ON password_resets ("user_id");
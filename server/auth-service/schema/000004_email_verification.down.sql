@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_email_verifications_user_id;
+
+DROP TABLE IF EXISTS email_verifications;
+
+ALTER TABLE credentials
+    DROP COLUMN IF EXISTS "email_verified_at";
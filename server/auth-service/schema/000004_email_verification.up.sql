@@ -0,0 +1,19 @@
+ALTER TABLE credentials
+    ADD COLUMN IF NOT EXISTS "email_verified_at" TIMESTAMPTZ;
+
+-- Accounts created before verification existed are trusted as they are.
+UPDATE credentials
+SET email_verified_at = created_at
+WHERE email_verified_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS
+    email_verifications (
+        "token_hash" BYTEA PRIMARY KEY,
+        "user_id" UUID NOT NULL REFERENCES credentials ("user_id") ON DELETE CASCADE,
+        "created_at" TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+        "expires_at" TIMESTAMPTZ NOT NULL,
+        "used_at" TIMESTAMPTZ
+    );
+
+CREATE INDEX IF NOT EXISTS
+    idx_email_verifications_user_id ON email_verifications ("user_id");
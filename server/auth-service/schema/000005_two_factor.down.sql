@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_login_challenges_user_id;
+
+DROP TABLE IF EXISTS login_challenges;
+
+DROP TABLE IF EXISTS recovery_codes;
+
+DROP TABLE IF EXISTS two_factor;
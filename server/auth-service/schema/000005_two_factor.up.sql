@@ -0,0 +1,31 @@
+CREATE TABLE IF NOT EXISTS
+    two_factor (
+        "user_id" UUID PRIMARY KEY REFERENCES credentials ("user_id") ON DELETE CASCADE,
+        "secret" TEXT NOT NULL,
+        "last_step" BIGINT NOT NULL DEFAULT 0,
+        "created_at" TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+        "enabled_at" TIMESTAMPTZ
+    );
+
+CREATE TABLE IF NOT EXISTS
+    recovery_codes (
+        "user_id" UUID NOT NULL REFERENCES credentials ("user_id") ON DELETE CASCADE,
+        "code_hash" BYTEA NOT NULL,
+        "created_at" TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+        "used_at" TIMESTAMPTZ,
+        PRIMARY KEY ("user_id", "code_hash")
+    );
+
+CREATE TABLE IF NOT EXISTS
+    login_challenges (
+        "challenge_hash" BYTEA PRIMARY KEY,
+        "user_id" UUID NOT NULL REFERENCES credentials ("user_id") ON DELETE CASCADE,
+        "email" TEXT NOT NULL,
+        "attempts" INT NOT NULL DEFAULT 0,
+        "created_at" TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+        "expires_at" TIMESTAMPTZ NOT NULL,
+        "used_at" TIMESTAMPTZ
+    );
+
+CREATE INDEX IF NOT EXISTS
+    idx_login_challenges_user_id ON login_challenges ("user_id");
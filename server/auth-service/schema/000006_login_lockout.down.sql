@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS idx_unlock_tokens_user_id;
+
+DROP TABLE IF EXISTS unlock_tokens;
+
+DROP INDEX IF EXISTS idx_lockouts_user_id;
+
+DROP TABLE IF EXISTS lockouts;
+
+DROP TABLE IF EXISTS login_attempts;
@@ -0,0 +1,33 @@
+CREATE TABLE IF NOT EXISTS
+    login_attempts (
+        "key" TEXT PRIMARY KEY,
+        "failures" INT NOT NULL DEFAULT 0,
+        "last_failed_at" TIMESTAMPTZ NOT NULL,
+        "blocked_until" TIMESTAMPTZ
+    );
+
+CREATE TABLE IF NOT EXISTS
+    lockouts (
+        "lockout_id" UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+        "key" TEXT NOT NULL,
+        "user_id" UUID REFERENCES credentials ("user_id") ON DELETE SET NULL,
+        "ip" TEXT NOT NULL DEFAULT '',
+        "failures" INT NOT NULL,
+        "locked_until" TIMESTAMPTZ NOT NULL,
+        "created_at" TIMESTAMPTZ NOT NULL DEFAULT NOW()
+    );
+
+CREATE INDEX IF NOT EXISTS
+    idx_lockouts_user_id ON lockouts ("user_id");
+
+CREATE TABLE IF NOT EXISTS
+    unlock_tokens (
+        "token_hash" BYTEA PRIMARY KEY,
+        "user_id" UUID NOT NULL REFERENCES credentials ("user_id") ON DELETE CASCADE,
+        "created_at" TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+        "expires_at" TIMESTAMPTZ NOT NULL,
+        "used_at" TIMESTAMPTZ
+    );
+
+CREATE INDEX IF NOT EXISTS
+    idx_unlock_tokens_user_id ON unlock_tokens ("user_id");
@@ -0,0 +1,11 @@
+DROP TRIGGER IF EXISTS auth_events_append_only ON auth_events;
+
+DROP FUNCTION IF EXISTS auth_events_append_only;
+
+DROP INDEX IF EXISTS idx_auth_events_created_at;
+
+DROP INDEX IF EXISTS idx_auth_events_type;
+
+DROP INDEX IF EXISTS idx_auth_events_user_id;
+
+DROP TABLE IF EXISTS auth_events;
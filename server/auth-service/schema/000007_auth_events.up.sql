@@ -0,0 +1,31 @@
+CREATE TABLE IF NOT EXISTS
+    auth_events (
+        "event_id" BIGSERIAL PRIMARY KEY,
+        "user_id" UUID,
+        "type" TEXT NOT NULL,
+        "ip" TEXT NOT NULL DEFAULT '',
+        "user_agent" TEXT NOT NULL DEFAULT '',
+        "request_id" TEXT NOT NULL DEFAULT '',
+        "details" JSONB NOT NULL DEFAULT '{}',
+        "created_at" TIMESTAMPTZ NOT NULL DEFAULT NOW()
+    );
+
+CREATE INDEX IF NOT EXISTS
+    idx_auth_events_user_id ON auth_events ("user_id", "event_id" DESC);
+
+CREATE INDEX IF NOT EXISTS
+    idx_auth_events_type ON auth_events ("type", "event_id" DESC);
+
+CREATE INDEX IF NOT EXISTS
+    idx_auth_events_created_at ON auth_events ("created_at");
+
+-- The log is append-only, rows are never changed or removed.
+CREATE OR REPLACE FUNCTION auth_events_append_only() RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION 'auth_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER auth_events_append_only
+    BEFORE UPDATE OR DELETE ON auth_events
+    FOR EACH ROW EXECUTE FUNCTION auth_events_append_only();
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS
+    personal_access_tokens (
+        "token_id" UUID PRIMARY KEY,
+        "user_id" UUID NOT NULL REFERENCES credentials ("user_id") ON DELETE CASCADE,
+        "name" TEXT NOT NULL,
+        "token_hash" BYTEA NOT NULL UNIQUE,
+        "scopes" TEXT[] NOT NULL DEFAULT '{}',
+        "created_at" TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+        "last_used_at" TIMESTAMPTZ,
+        "expires_at" TIMESTAMPTZ,
+        "revoked_at" TIMESTAMPTZ
+    );
+
+CREATE INDEX IF NOT EXISTS
+    idx_personal_access_tokens_user_id ON personal_access_tokens ("user_id");
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_oidc_states_expires_at;
+
+DROP TABLE IF EXISTS oidc_states;
+
+DROP INDEX IF EXISTS idx_identity_links_user_id;
+
+DROP TABLE IF EXISTS identity_links;
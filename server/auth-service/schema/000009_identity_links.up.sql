@@ -0,0 +1,26 @@
+CREATE TABLE IF NOT EXISTS
+    identity_links (
+        "provider" TEXT NOT NULL,
+        "subject" TEXT NOT NULL,
+        "user_id" UUID NOT NULL REFERENCES credentials ("user_id") ON DELETE CASCADE,
+        "email" TEXT NOT NULL DEFAULT '',
+        "created_at" TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+        "last_login_at" TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+        PRIMARY KEY ("provider", "subject")
+    );
+
+CREATE INDEX IF NOT EXISTS
+    idx_identity_links_user_id ON identity_links ("user_id");
+
+CREATE TABLE IF NOT EXISTS
+    oidc_states (
+        "state_hash" BYTEA PRIMARY KEY,
+        "provider" TEXT NOT NULL,
+        "code_verifier" TEXT NOT NULL,
+        "nonce" TEXT NOT NULL,
+        "created_at" TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+        "expires_at" TIMESTAMPTZ NOT NULL
+    );
+
+CREATE INDEX IF NOT EXISTS
+    idx_oidc_states_expires_at ON oidc_states ("expires_at");
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_account_deletions_next_attempt_at;
+
+DROP TABLE IF EXISTS account_deletions;
+
+ALTER TABLE credentials
+    DROP COLUMN IF EXISTS "deactivated_at";
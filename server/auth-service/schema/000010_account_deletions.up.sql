@@ -0,0 +1,23 @@
+ALTER TABLE credentials
+    ADD COLUMN IF NOT EXISTS "deactivated_at" TIMESTAMPTZ;
+
+-- A deletion outlives the credentials, so a run cut short by a failing
+-- service is picked up again. completed_steps lists the services the
+-- user is already erased from.
+CREATE TABLE IF NOT EXISTS
+    account_deletions (
+        "user_id" UUID PRIMARY KEY,
+        "status" TEXT NOT NULL,
+        "restore_token_hash" BYTEA UNIQUE,
+        "requested_at" TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+        "scheduled_for" TIMESTAMPTZ NOT NULL,
+        "completed_steps" TEXT[] NOT NULL DEFAULT '{}',
+        "attempts" INT NOT NULL DEFAULT 0,
+        "last_error" TEXT NOT NULL DEFAULT '',
+        "next_attempt_at" TIMESTAMPTZ NOT NULL,
+        "finished_at" TIMESTAMPTZ
+    );
+
+CREATE INDEX IF NOT EXISTS
+    idx_account_deletions_next_attempt_at ON account_deletions ("next_attempt_at")
+    WHERE "status" = 'pending';
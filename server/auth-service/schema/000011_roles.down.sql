@@ -0,0 +1,4 @@
+ALTER TABLE credentials
+    DROP COLUMN IF EXISTS "suspended_reason",
+    DROP COLUMN IF EXISTS "suspended_at",
+    DROP COLUMN IF EXISTS "role";
@@ -0,0 +1,5 @@
+ALTER TABLE credentials
+    ADD COLUMN IF NOT EXISTS "role" TEXT NOT NULL DEFAULT 'user'
+        CHECK ("role" IN ('user', 'moderator', 'admin')),
+    ADD COLUMN IF NOT EXISTS "suspended_at" TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS "suspended_reason" TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_data_exports_expires_at;
+
+DROP INDEX IF EXISTS idx_data_exports_next_attempt_at;
+
+DROP INDEX IF EXISTS idx_data_exports_pending_user_id;
+
+DROP TABLE IF EXISTS data_exports;
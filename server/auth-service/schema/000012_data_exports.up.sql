@@ -0,0 +1,26 @@
+-- The archive of a ready export is stored as <id>.zip in the export
+-- directory until expires_at. A user has at most one pending export.
+CREATE TABLE IF NOT EXISTS
+    data_exports (
+        "id" UUID PRIMARY KEY,
+        "user_id" UUID NOT NULL,
+        "status" TEXT NOT NULL,
+        "requested_at" TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+        "attempts" INT NOT NULL DEFAULT 0,
+        "last_error" TEXT NOT NULL DEFAULT '',
+        "next_attempt_at" TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+        "finished_at" TIMESTAMPTZ,
+        "expires_at" TIMESTAMPTZ
+    );
+
+CREATE UNIQUE INDEX IF NOT EXISTS
+    idx_data_exports_pending_user_id ON data_exports ("user_id")
+    WHERE "status" = 'pending';
+
+CREATE INDEX IF NOT EXISTS
+    idx_data_exports_next_attempt_at ON data_exports ("next_attempt_at")
+    WHERE "status" = 'pending';
+
+CREATE INDEX IF NOT EXISTS
+    idx_data_exports_expires_at ON data_exports ("expires_at")
+    WHERE "status" = 'ready';
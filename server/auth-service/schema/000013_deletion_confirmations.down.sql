@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_deletion_confirmations_user_id;
+
+DROP TABLE IF EXISTS deletion_confirmations;
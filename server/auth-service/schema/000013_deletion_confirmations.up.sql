@@ -0,0 +1,13 @@
+-- Accounts without a password, made through an identity provider,
+-- confirm their deletion through a mailed link instead.
+CREATE TABLE IF NOT EXISTS
+    deletion_confirmations (
+        "token_hash" BYTEA PRIMARY KEY,
+        "user_id" UUID NOT NULL REFERENCES credentials ("user_id") ON DELETE CASCADE,
+        "created_at" TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+        "expires_at" TIMESTAMPTZ NOT NULL,
+        "used_at" TIMESTAMPTZ
+    );
+
+CREATE INDEX IF NOT EXISTS
+    idx_deletion_confirmations_user_id ON deletion_confirmations ("user_id");
@@ -4,10 +4,13 @@ import (
 	"net/http"
 	"net/url"
 	"testing"
+	"time"
 
 	"github.com/brianvoe/gofakeit/v6"
 	"github.com/gavv/httpexpect/v2"
+	"github.com/google/uuid"
 	"github.com/sergey-frey/cchat/server/auth-service/internal/domain/models"
+	"github.com/sergey-frey/cchat/server/auth-service/internal/lib/totp"
 )
 
 const (
@@ -44,6 +47,581 @@ func TestCchatAuth_HappyPath(t *testing.T) {
 		Status(http.StatusOK)
 }
 
+func TestLogout_RevokesSession(t *testing.T) {
+	u := url.URL{
+		Scheme: "http",
+		Host:   host,
+	}
+
+	e := httpexpect.Default(t, u.String())
+
+	resp := e.POST("/cchat/auth/register").
+		WithJSON(models.RegisterUser{
+			Email:    gofakeit.Email(),
+			Password: randomFakePassword(normalLengthPass),
+		}).
+		Expect().
+		Status(http.StatusOK)
+
+	accessToken := resp.Cookie("access_token").Value().Raw()
+	refreshToken := resp.Cookie("refresh_token").Value().Raw()
+
+	e.POST("/cchat/auth/logout").
+		Expect().
+		Status(http.StatusOK)
+
+	stolen := httpexpect.WithConfig(httpexpect.Config{
+		BaseURL:  u.String(),
+		Reporter: httpexpect.NewAssertReporter(t),
+	})
+
+	stolen.POST("/cchat/auth/session").
+		WithCookie("access_token", accessToken).
+		WithCookie("refresh_token", refreshToken).
+		Expect().
+		Status(http.StatusUnauthorized)
+}
+
+func TestSessions_RevokeOthers(t *testing.T) {
+	u := url.URL{
+		Scheme: "http",
+		Host:   host,
+	}
+
+	email := gofakeit.Email()
+	password := randomFakePassword(normalLengthPass)
+
+	first := httpexpect.Default(t, u.String())
+	second := httpexpect.Default(t, u.String())
+
+	first.POST("/cchat/auth/register").
+		WithJSON(models.RegisterUser{
+			Email:    email,
+			Password: password,
+		}).
+		Expect().
+		Status(http.StatusOK)
+
+	second.POST("/cchat/auth/login").
+		WithJSON(models.LoginUser{
+			Email:    email,
+			Password: password,
+		}).
+		Expect().
+		Status(http.StatusOK)
+
+	sessions := first.GET("/cchat/auth/sessions").
+		Expect().
+		Status(http.StatusOK).
+		JSON().Object().Value("data").Array()
+
+	sessions.Length().IsEqual(2)
+
+	first.POST("/cchat/auth/sessions/revoke-others").
+		Expect().
+		Status(http.StatusOK).
+		JSON().Object().Value("data").Object().Value("revoked").Number().IsEqual(1)
+
+	second.GET("/cchat/auth/sessions").
+		Expect().
+		Status(http.StatusUnauthorized)
+
+	first.GET("/cchat/auth/sessions").
+		Expect().
+		Status(http.StatusOK).
+		JSON().Object().Value("data").Array().Value(0).Object().Value("current").Boolean().IsTrue()
+}
+
+func TestValidate_ForwardAuth(t *testing.T) {
+	u := url.URL{
+		Scheme: "http",
+		Host:   host,
+	}
+
+	e := httpexpect.Default(t, u.String())
+
+	user := e.POST("/cchat/auth/register").
+		WithJSON(models.RegisterUser{
+			Email:    gofakeit.Email(),
+			Password: randomFakePassword(normalLengthPass),
+		}).
+		Expect().
+		Status(http.StatusOK).
+		JSON().Object().Value("data").Object()
+
+	resp := e.GET("/cchat/internal/validate").
+		Expect().
+		Status(http.StatusOK)
+
+	resp.Header("X-User-Id").IsEqual(user.Value("id").String().Raw())
+	resp.Header("X-Session-Id").NotEmpty()
+
+	anonymous := httpexpect.WithConfig(httpexpect.Config{
+		BaseURL:  u.String(),
+		Reporter: httpexpect.NewAssertReporter(t),
+	})
+
+	anonymous.GET("/cchat/internal/validate").
+		Expect().
+		Status(http.StatusUnauthorized)
+
+	anonymous.GET("/cchat/internal/validate").
+		WithHeader("Authorization", "Bearer "+gofakeit.UUID()).
+		Expect().
+		Status(http.StatusUnauthorized)
+}
+
+func TestPasswordReset_InvalidToken(t *testing.T) {
+	u := url.URL{
+		Scheme: "http",
+		Host:   host,
+	}
+
+	e := httpexpect.Default(t, u.String())
+
+	e.POST("/cchat/auth/password/reset").
+		WithJSON(models.ResetPassword{
+			Email: gofakeit.Email(),
+		}).
+		Expect().
+		Status(http.StatusOK)
+
+	e.POST("/cchat/auth/password/reset/confirm").
+		WithJSON(models.ConfirmPasswordReset{
+			Token:       gofakeit.UUID(),
+			NewPassword: randomFakePassword(normalLengthPass),
+		}).
+		Expect().
+		Status(http.StatusBadRequest)
+}
+
+func TestChangePassword_FailCases(t *testing.T) {
+	email := gofakeit.Email()
+	password := randomFakePassword(normalLengthPass)
+
+	u := url.URL{
+		Scheme: "http",
+		Host:   host,
+	}
+
+	e := httpexpect.Default(t, u.String())
+
+	e.POST("/cchat/auth/register").
+		WithJSON(models.RegisterUser{
+			Email:    email,
+			Password: password,
+		}).
+		Expect().
+		Status(http.StatusOK)
+
+	cases := []struct {
+		name             string
+		previousPassword string
+		newPassword      string
+		expectedErr      string
+	}{
+		{
+			name:             "Change password with incorrect previous password",
+			previousPassword: randomFakePassword(normalLengthPass),
+			newPassword:      randomFakePassword(normalLengthPass),
+			expectedErr:      "invalid email or password",
+		},
+		{
+			name:             "Change password with invalid new password",
+			previousPassword: password,
+			newPassword:      randomFakePassword(notEnoughLengthPass),
+			expectedErr:      "field NewPassword must have at least 8 characters",
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := e.PATCH("/cchat/auth/password/change").
+				WithJSON(models.NewPassword{
+					Email:            email,
+					PreviousPassword: tt.previousPassword,
+					NewPassword:      tt.newPassword,
+				}).Expect().JSON().Object()
+
+			resp.NotContainsKey("data")
+
+			resp.Value("error").String().IsEqual(tt.expectedErr)
+		})
+	}
+}
+
+func TestVerifyEmail_InvalidToken(t *testing.T) {
+	u := url.URL{
+		Scheme: "http",
+		Host:   host,
+	}
+
+	e := httpexpect.Default(t, u.String())
+
+	e.POST("/cchat/auth/verify-email").
+		WithJSON(models.VerifyEmail{
+			Token: gofakeit.UUID(),
+		}).
+		Expect().
+		Status(http.StatusBadRequest)
+
+	e.POST("/cchat/auth/verify-email/resend").
+		WithJSON(models.ResendVerification{
+			Email: gofakeit.Email(),
+		}).
+		Expect().
+		Status(http.StatusOK)
+}
+
+func TestUnlock_InvalidToken(t *testing.T) {
+	u := url.URL{
+		Scheme: "http",
+		Host:   host,
+	}
+
+	e := httpexpect.Default(t, u.String())
+
+	e.POST("/cchat/auth/unlock").
+		WithJSON(models.UnlockAccount{
+			Token: gofakeit.UUID(),
+		}).
+		Expect().
+		Status(http.StatusBadRequest)
+}
+
+func TestEvents_OwnHistory(t *testing.T) {
+	u := url.URL{
+		Scheme: "http",
+		Host:   host,
+	}
+
+	e := httpexpect.Default(t, u.String())
+
+	e.POST("/cchat/auth/register").
+		WithJSON(models.RegisterUser{
+			Email:    gofakeit.Email(),
+			Password: randomFakePassword(normalLengthPass),
+		}).
+		Expect().
+		Status(http.StatusOK)
+
+	events := e.GET("/cchat/auth/events").
+		Expect().
+		Status(http.StatusOK).
+		JSON().Object().Value("data").Object().Value("events").Array()
+
+	events.Length().IsEqual(1)
+	events.Value(0).Object().Value("type").String().IsEqual("register")
+
+	e.GET("/cchat/admin/events").
+		Expect().
+		Status(http.StatusForbidden)
+}
+
+func TestBearer_AccessToken(t *testing.T) {
+	u := url.URL{
+		Scheme: "http",
+		Host:   host,
+	}
+
+	e := httpexpect.Default(t, u.String())
+
+	accessToken := e.POST("/cchat/auth/register").
+		WithJSON(models.RegisterUser{
+			Email:    gofakeit.Email(),
+			Password: randomFakePassword(normalLengthPass),
+		}).
+		Expect().
+		Status(http.StatusOK).
+		Cookie("access_token").Value().Raw()
+
+	anonymous := httpexpect.WithConfig(httpexpect.Config{
+		BaseURL:  u.String(),
+		Reporter: httpexpect.NewAssertReporter(t),
+	})
+
+	anonymous.GET("/cchat/auth/sessions").
+		WithHeader("Authorization", "Bearer "+accessToken).
+		Expect().
+		Status(http.StatusOK)
+}
+
+func TestAccessTokens_CreateUseRevoke(t *testing.T) {
+	u := url.URL{
+		Scheme: "http",
+		Host:   host,
+	}
+
+	e := httpexpect.Default(t, u.String())
+
+	user := e.POST("/cchat/auth/register").
+		WithJSON(models.RegisterUser{
+			Email:    gofakeit.Email(),
+			Password: randomFakePassword(normalLengthPass),
+		}).
+		Expect().
+		Status(http.StatusOK).
+		JSON().Object().Value("data").Object()
+
+	e.POST("/cchat/auth/tokens").
+		WithJSON(models.CreateAccessToken{
+			Name:   "bot",
+			Scopes: []string{"chats:admin"},
+		}).
+		Expect().
+		Status(http.StatusBadRequest)
+
+	created := e.POST("/cchat/auth/tokens").
+		WithJSON(models.CreateAccessToken{
+			Name:   "bot",
+			Scopes: []string{models.ScopeChatsRead, models.ScopeMessagesRead},
+		}).
+		Expect().
+		Status(http.StatusCreated).
+		JSON().Object().Value("data").Object()
+
+	token := created.Value("token").String().Raw()
+	tokenID := created.Value("id").String().Raw()
+
+	tokens := e.GET("/cchat/auth/tokens").
+		Expect().
+		Status(http.StatusOK).
+		JSON().Object().Value("data").Array()
+
+	tokens.Length().IsEqual(1)
+	tokens.Value(0).Object().NotContainsKey("token")
+
+	anonymous := httpexpect.WithConfig(httpexpect.Config{
+		BaseURL:  u.String(),
+		Reporter: httpexpect.NewAssertReporter(t),
+	})
+
+	resp := anonymous.GET("/cchat/internal/validate").
+		WithHeader("Authorization", "Bearer "+token).
+		Expect().
+		Status(http.StatusOK)
+
+	resp.Header("X-User-Id").IsEqual(user.Value("id").String().Raw())
+	resp.Header("X-Token-Scopes").IsEqual("chats:read,messages:read")
+
+	// A personal access token can not manage the account.
+	anonymous.GET("/cchat/auth/tokens").
+		WithHeader("Authorization", "Bearer "+token).
+		Expect().
+		Status(http.StatusUnauthorized)
+
+	e.DELETE("/cchat/auth/tokens/" + tokenID).
+		Expect().
+		Status(http.StatusOK)
+
+	anonymous.GET("/cchat/internal/validate").
+		WithHeader("Authorization", "Bearer "+token).
+		Expect().
+		Status(http.StatusUnauthorized)
+}
+
+func TestDeleteAccount_ScheduledAndDeactivated(t *testing.T) {
+	u := url.URL{
+		Scheme: "http",
+		Host:   host,
+	}
+
+	e := httpexpect.Default(t, u.String())
+
+	email := gofakeit.Email()
+	password := randomFakePassword(normalLengthPass)
+
+	e.POST("/cchat/auth/register").
+		WithJSON(models.RegisterUser{
+			Email:    email,
+			Password: password,
+		}).
+		Expect().
+		Status(http.StatusOK)
+
+	e.DELETE("/cchat/auth/account").
+		WithJSON(models.DeleteAccount{Password: randomFakePassword(normalLengthPass)}).
+		Expect().
+		Status(http.StatusForbidden)
+
+	e.DELETE("/cchat/auth/account").
+		WithJSON(models.DeleteAccount{Password: password}).
+		Expect().
+		Status(http.StatusAccepted).
+		JSON().Object().Value("data").Object().ContainsKey("scheduled_for")
+
+	e.GET("/cchat/auth/sessions").
+		Expect().
+		Status(http.StatusUnauthorized)
+
+	e.POST("/cchat/auth/login").
+		WithJSON(models.LoginUser{
+			Email:    email,
+			Password: password,
+		}).
+		Expect().
+		Status(http.StatusForbidden)
+
+	e.POST("/cchat/auth/account/restore").
+		WithJSON(models.RestoreAccount{Token: "unknown"}).
+		Expect().
+		Status(http.StatusBadRequest)
+}
+
+func TestExport_RequestedAndTracked(t *testing.T) {
+	u := url.URL{
+		Scheme: "http",
+		Host:   host,
+	}
+
+	e := httpexpect.Default(t, u.String())
+
+	e.POST("/cchat/auth/register").
+		WithJSON(models.RegisterUser{
+			Email:    gofakeit.Email(),
+			Password: randomFakePassword(normalLengthPass),
+		}).
+		Expect().
+		Status(http.StatusOK)
+
+	job := e.POST("/cchat/auth/exports").
+		Expect().
+		Status(http.StatusAccepted).
+		JSON().Object().Value("data").Object()
+
+	job.HasValue("status", models.ExportPending)
+
+	id := job.Value("id").String().Raw()
+
+	e.POST("/cchat/auth/exports").
+		Expect().
+		Status(http.StatusAccepted).
+		JSON().Object().Value("data").Object().HasValue("id", id)
+
+	e.GET("/cchat/auth/exports/{id}", id).
+		Expect().
+		Status(http.StatusOK).
+		JSON().Object().Value("data").Object().ContainsKey("status")
+
+	e.GET("/cchat/auth/exports/{id}", gofakeit.UUID()).
+		Expect().
+		Status(http.StatusNotFound)
+
+	e.GET("/cchat/auth/exports/{id}/download", id).
+		WithQuery("expires", time.Now().Add(time.Hour).Unix()).
+		WithQuery("signature", "forged").
+		Expect().
+		Status(http.StatusForbidden)
+}
+
+func TestAdmin_RequiresRole(t *testing.T) {
+	u := url.URL{
+		Scheme: "http",
+		Host:   host,
+	}
+
+	anonymous := httpexpect.Default(t, u.String())
+
+	anonymous.POST("/cchat/admin/users/" + uuid.NewString() + "/logout").
+		Expect().
+		Status(http.StatusUnauthorized)
+
+	e := httpexpect.Default(t, u.String())
+
+	email := gofakeit.Email()
+	password := randomFakePassword(normalLengthPass)
+
+	e.POST("/cchat/auth/register").
+		WithJSON(models.RegisterUser{
+			Email:    email,
+			Password: password,
+		}).
+		Expect().
+		Status(http.StatusOK)
+
+	e.POST("/cchat/auth/login").
+		WithJSON(models.LoginUser{
+			Email:    email,
+			Password: password,
+		}).
+		Expect().
+		Status(http.StatusOK).
+		JSON().Object().Value("data").Object().Value("role").String().IsEqual(models.RoleUser)
+
+	e.POST("/cchat/admin/users/" + uuid.NewString() + "/suspend").
+		WithJSON(models.SuspendAccount{Reason: "spam"}).
+		Expect().
+		Status(http.StatusForbidden)
+
+	e.PUT("/cchat/admin/users/" + uuid.NewString() + "/role").
+		WithJSON(models.ChangeRole{Role: models.RoleAdmin}).
+		Expect().
+		Status(http.StatusForbidden)
+}
+
+func TestTwoFactor_LoginWithRecoveryCode(t *testing.T) {
+	u := url.URL{
+		Scheme: "http",
+		Host:   host,
+	}
+
+	e := httpexpect.Default(t, u.String())
+
+	email := gofakeit.Email()
+	password := randomFakePassword(normalLengthPass)
+
+	e.POST("/cchat/auth/register").
+		WithJSON(models.RegisterUser{
+			Email:    email,
+			Password: password,
+		}).
+		Expect().
+		Status(http.StatusOK)
+
+	secret := e.POST("/cchat/auth/2fa/enroll").
+		Expect().
+		Status(http.StatusOK).
+		JSON().Object().Value("data").Object().Value("secret").String().Raw()
+
+	code, err := totp.Code(secret, totp.Step(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recoveryCodes := e.POST("/cchat/auth/2fa/confirm").
+		WithJSON(models.TwoFactorCode{Code: code}).
+		Expect().
+		Status(http.StatusOK).
+		JSON().Object().Value("data").Object().Value("recovery_codes").Array()
+
+	challenge := e.POST("/cchat/auth/login").
+		WithJSON(models.LoginUser{
+			Email:    email,
+			Password: password,
+		}).
+		Expect().
+		Status(http.StatusOK).
+		JSON().Object().Value("data").Object().Value("challenge").String().Raw()
+
+	recoveryCode := recoveryCodes.Value(0).String().Raw()
+
+	e.POST("/cchat/auth/login/2fa").
+		WithJSON(models.TwoFactorLogin{
+			Challenge: challenge,
+			Code:      recoveryCode,
+		}).
+		Expect().
+		Status(http.StatusOK)
+
+	e.POST("/cchat/auth/login/2fa").
+		WithJSON(models.TwoFactorLogin{
+			Challenge: challenge,
+			Code:      recoveryCode,
+		}).
+		Expect().
+		Status(http.StatusUnauthorized)
+}
+
 func TestRegister_FailCases(t *testing.T) {
 	cases := []struct {
 		name      string
@@ -10,17 +10,43 @@ import (
 )
 
 type Config struct {
-	Env            string     `yaml:"env" env-default:"local"`
-	ClientDomen    string     `yaml:"client_domen"`
-	Server         HTTPServer `yaml:"http_server"`
-	PostgreStorage PostgresDB `yaml:"psql"`
-	RedisStorage   RedisDB    `yaml:"redis"`
+	Env                  string     `yaml:"env" env-default:"local"`
+	ClientDomen          string     `yaml:"client_domen"`
+	Server               HTTPServer `yaml:"http_server"`
+	PostgreStorage       PostgresDB `yaml:"psql"`
+	RedisStorage         RedisDB    `yaml:"redis"`
+	JWKS                 JWKS       `yaml:"jwks"`
+	Gateway              Gateway    `yaml:"gateway"`
+	Internal             Internal   `yaml:"internal"`
+	RequireVerifiedEmail bool       `yaml:"require_verified_email" env-default:"false"`
 	// TokenTTL time.Duration `yaml:"token_ttl" env-required:"true"`
 	//Clients ClientConfig `yaml:"clients"`
 	//AppSecret string `yaml:"app_secret"`
 
 }
 
+// JWKS is where the public keys of auth-service are fetched from.
+type JWKS struct {
+	URL string        `yaml:"url" env:"JWKS_URL" env-default:"http://auth-service:8080/.well-known/jwks.json"`
+	TTL time.Duration `yaml:"ttl" env-default:"5m"`
+}
+
+// Gateway lists the networks the nginx gateway reaches the service from.
+// Identity headers on requests from anywhere else are ignored. List the
+// address of the gateway alone: every host in these networks can act as
+// any user.
+type Gateway struct {
+	TrustedNetworks []string `yaml:"trusted_networks" env:"GATEWAY_TRUSTED_NETWORKS" env-default:"127.0.0.1/32,::1/128"`
+}
+
+// Internal restricts the /internal routes to the other services. Their
+// requests come from TrustedNetworks and carry Token, with no token set the
+// routes refuse everyone.
+type Internal struct {
+	TrustedNetworks []string `yaml:"trusted_networks" env:"INTERNAL_TRUSTED_NETWORKS" env-default:"127.0.0.1/32,::1/128"`
+	Token           string   `env:"SERVICE_TOKEN"`
+}
+
 type HTTPServer struct {
 	Port         string        `yaml:"server_port" env-default:"localhost:8040"`
 	Timeout      time.Duration `yaml:"timeout" env-default:"4s"`
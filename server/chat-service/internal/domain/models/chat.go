@@ -1,14 +1,80 @@
 package models
 
-import "github.com/google/uuid"
+import (
+	"time"
 
+	"github.com/google/uuid"
+)
+
+// Types of a chat. Two users share at most one direct chat.
+const (
+	ChatDirect  = "direct"
+	ChatGroup   = "group"
+	ChatChannel = "channel"
+)
+
+// NewChat lists the users to chat with besides the initiator. Without a
+// type one user makes a direct chat and more make a group.
 type NewChat struct {
-	ChatName string `json:"chat_name"`
-	Users []uuid.UUID `json:"users"`
+	Type     string      `json:"type,omitempty" validate:"omitempty,oneof=direct group channel" example:"direct"`
+	ChatName string      `json:"chat_name"`
+	Users    []uuid.UUID `json:"users"`
 }
 
+// Chat is a chat as its member sees it. A direct chat is named and
+// pictured after the other member.
 type Chat struct {
-	UUID          uuid.UUID `json:"id"`
+	UUID        uuid.UUID    `json:"id"`
+	Type        string       `json:"type"`
+	Name        string       `json:"name"`
+	Description string       `json:"description,omitempty"`
+	Avatar      string       `json:"avatar,omitempty"`
+	Settings    ChatSettings `json:"settings"`
+	Seq         int64        `json:"-"`
 	Users       []UserInfo
 	LastMessage *Message `json:"last_message"`
 }
+
+// Membership is a chat the user belongs to, as it goes into their data
+// export.
+type Membership struct {
+	ChatID    uuid.UUID `json:"chat_id"`
+	Type      string    `json:"type"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ChatSettings say who may do what in a group or a channel besides the
+// owner and the admins. OnlyAdminsPost is enforced by message-service,
+// which asks for it when a message is sent.
+type ChatSettings struct {
+	OnlyAdminsPost       bool `json:"only_admins_post"`
+	OnlyAdminsAddMembers bool `json:"only_admins_add_members"`
+}
+
+// ChatDetails is the metadata of a chat as it is edited.
+type ChatDetails struct {
+	UUID        uuid.UUID    `json:"id"`
+	Type        string       `json:"type"`
+	Name        string       `json:"name"`
+	Description string       `json:"description"`
+	Avatar      string       `json:"avatar"`
+	Settings    ChatSettings `json:"settings"`
+	CreatedAt   time.Time    `json:"created_at"`
+	UpdatedAt   time.Time    `json:"updated_at"`
+}
+
+// UpdateChat changes the fields that are set and leaves the rest. An
+// empty description or avatar clears it, the avatar is a link to the
+// picture.
+type UpdateChat struct {
+	Name        *string         `json:"name,omitempty" validate:"omitnil,min=1,max=128" example:"Weekend trip"`
+	Description *string         `json:"description,omitempty" validate:"omitnil,max=1024"`
+	Avatar      *string         `json:"avatar,omitempty" validate:"omitempty,url,max=2048"`
+	Settings    *UpdateSettings `json:"settings,omitempty"`
+}
+
+type UpdateSettings struct {
+	OnlyAdminsPost       *bool `json:"only_admins_post,omitempty"`
+	OnlyAdminsAddMembers *bool `json:"only_admins_add_members,omitempty"`
+}
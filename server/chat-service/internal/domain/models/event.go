@@ -0,0 +1,25 @@
+package models
+
+import "github.com/google/uuid"
+
+// Events of the system messages posted to message-service when a chat
+// changes. Clients follow a chat through its history, so the messages are
+// also how they learn about the change.
+const (
+	EventMemberAdded          = "member_added"
+	EventMemberRemoved        = "member_removed"
+	EventMemberLeft           = "member_left"
+	EventOwnershipTransferred = "ownership_transferred"
+	EventAdminPromoted        = "admin_promoted"
+	EventAdminDemoted         = "admin_demoted"
+	EventChatUpdated          = "chat_updated"
+)
+
+// ChatEvent is a change of a chat, Actor did it to Target. An update
+// lists the Fields it changed, the new values are fetched with the chat.
+type ChatEvent struct {
+	Event  string    `json:"event"`
+	Actor  uuid.UUID `json:"actor"`
+	Target uuid.UUID `json:"target,omitempty"`
+	Fields []string  `json:"fields,omitempty"`
+}
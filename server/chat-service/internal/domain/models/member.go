@@ -0,0 +1,49 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Roles of a chat member. The owner manages the admins and hands the
+// chat over, admins manage the members. Members of a direct chat have
+// no say over it.
+const (
+	MemberOwner  = "owner"
+	MemberAdmin  = "admin"
+	MemberMember = "member"
+)
+
+type Member struct {
+	UserID    uuid.UUID  `json:"user_id"`
+	Role      string     `json:"role" example:"member"`
+	JoinedAt  time.Time  `json:"joined_at"`
+	InvitedBy *uuid.UUID `json:"invited_by,omitempty"`
+}
+
+// ChatRole is the role of a user in a chat together with the type of the
+// chat, which is what a permission check needs.
+type ChatRole struct {
+	ChatType string
+	Role     string
+	Settings ChatSettings
+}
+
+// Sender is what message-service needs to accept a message from a
+// member: who may post in the chat and, in a direct chat, who the message
+// goes to so a block between the two can be checked.
+type Sender struct {
+	ChatType string       `json:"chat_type" example:"group"`
+	Role     string       `json:"role" example:"member"`
+	Settings ChatSettings `json:"settings"`
+	Peer     *uuid.UUID   `json:"peer,omitempty"`
+}
+
+type AddMembers struct {
+	Users []uuid.UUID `json:"users" validate:"required,min=1,max=100,dive,required"`
+}
+
+type TransferOwnership struct {
+	UserID uuid.UUID `json:"user_id" validate:"required"`
+}
@@ -2,6 +2,13 @@ package models
 
 import "github.com/google/uuid"
 
+// Roles issued by auth-service.
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
 type User struct {
 	UUID       uuid.UUID  `json:"id"`
 	Username string `json:"username"`
@@ -24,6 +31,7 @@ type UserInfo struct {
 	Email    string `json:"email"`
 	Username string `json:"username"`
 	Name     string `json:"name"`
+	Avatar   string `json:"avatar,omitempty"`
 }
 
 type NewUserInfo struct {
@@ -38,6 +46,11 @@ type NormalizedUser struct {
 	UUID       uuid.UUID  `json:"id"`
 	Username string `json:"username"`
 	Email    string `json:"email"`
+	EmailVerified bool `json:"email_verified"`
+	Role          string    `json:"role"`
+	SessionID     uuid.UUID `json:"-"`
+	// Scopes limit a personal access token, empty means no limit.
+	Scopes []string `json:"-"`
 }
 
 func UserToNormalized(user *User) NormalizedUser {
@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"strconv"
 
+	"github.com/go-chi/chi"
 	"github.com/go-chi/chi/middleware"
 	"github.com/go-chi/render"
 	"github.com/google/uuid"
@@ -19,8 +20,19 @@ import (
 )
 
 type Chat interface {
-	NewChat(ctx context.Context, chatName string, users []uuid.UUID) (chatID uuid.UUID, err error)
+	NewChat(ctx context.Context, initiator uuid.UUID, newChat models.NewChat) (chatID uuid.UUID, created bool, err error)
 	ListChats(ctx context.Context, idUser uuid.UUID, cursor int64, limit int) (chats []models.Chat, cursors *models.Cursor, err error)
+	EraseUser(ctx context.Context, idUser uuid.UUID) (err error)
+	ExportUser(ctx context.Context, idUser uuid.UUID) (memberships []models.Membership, err error)
+	Members(ctx context.Context, viewer uuid.UUID, chatID uuid.UUID) (members []models.Member, err error)
+	AddMembers(ctx context.Context, actor uuid.UUID, chatID uuid.UUID, users []uuid.UUID) (added []uuid.UUID, err error)
+	RemoveMember(ctx context.Context, actor uuid.UUID, chatID uuid.UUID, target uuid.UUID) (err error)
+	Leave(ctx context.Context, idUser uuid.UUID, chatID uuid.UUID) (err error)
+	TransferOwnership(ctx context.Context, actor uuid.UUID, chatID uuid.UUID, target uuid.UUID) (err error)
+	Promote(ctx context.Context, actor uuid.UUID, chatID uuid.UUID, target uuid.UUID) (err error)
+	Demote(ctx context.Context, actor uuid.UUID, chatID uuid.UUID, target uuid.UUID) (err error)
+	UpdateChat(ctx context.Context, actor uuid.UUID, chatID uuid.UUID, update models.UpdateChat) (chat *models.ChatDetails, err error)
+	Sender(ctx context.Context, chatID uuid.UUID, idUser uuid.UUID) (sender *models.Sender, err error)
 }
 
 type ChatHandler struct {
@@ -42,13 +54,14 @@ type ChatResponse struct {
 
 // @Summary NewChat
 // @Tags chat
-// @Description Creates a new chat
+// @Description Creates a new chat of the caller and the users. A direct chat the caller already shares with the user is returned
+// @Description with 200 instead of creating another one. Without a type one user makes a direct chat and more make a group
 // @ID create-chat
 // @Accept  json
 // @Produce  json
 // @Param input body models.NewChat true "List of users ID's"
-// @Success 200 {object} response.SuccessResponse
-// @Failure 400,409 {object} response.ErrorResponse
+// @Success 200,201 {object} response.SuccessResponse
+// @Failure 400,403,404,409 {object} response.ErrorResponse
 // @Failure 500 {object} response.ErrorResponse
 // @Failure default {object} response.ErrorResponse
 // @Security CookieAuth
@@ -80,8 +93,46 @@ func (ch *ChatHandler) NewChat(ctx context.Context) http.HandlerFunc {
 			return
 		}
 
-		chatID, err := ch.chatHandler.NewChat(ctx, req.ChatName, req.Users)
+		userInfo, err := cookie.TakeUserInfo(w, r)
+		if flag := handlers.HandleGettingCookie(w, r, err, log); !flag {
+			return
+		}
+
+		chatID, created, err := ch.chatHandler.NewChat(ctx, userInfo.UUID, req)
 		if err != nil {
+			if errors.Is(err, chat.ErrInvalidDirectChat) {
+				render.Status(r, http.StatusBadRequest)
+
+				render.JSON(w, r, resp.ErrorResponse{
+					Status: http.StatusBadRequest,
+					Error:  "a direct chat takes exactly one other user",
+				})
+
+				return
+			}
+
+			if errors.Is(err, chat.ErrChatNotAllowed) {
+				render.Status(r, http.StatusForbidden)
+
+				render.JSON(w, r, resp.ErrorResponse{
+					Status: http.StatusForbidden,
+					Error:  "some users do not accept chats from you",
+				})
+
+				return
+			}
+
+			if errors.Is(err, chat.ErrUsersNotFound) {
+				render.Status(r, http.StatusNotFound)
+
+				render.JSON(w, r, resp.ErrorResponse{
+					Status: http.StatusNotFound,
+					Error:  "some users do not exist",
+				})
+
+				return
+			}
+
 			log.Error("failed to create new chat", sl.Err(err))
 
 			render.JSON(w, r, resp.ErrorResponse{
@@ -92,15 +143,85 @@ func (ch *ChatHandler) NewChat(ctx context.Context) http.HandlerFunc {
 			return
 		}
 
+		if !created {
+			log.Info("existing direct chat returned", slog.String("chat_id", chatID.String()))
+
+			render.JSON(w, r, resp.SuccessResponse{
+				Status: http.StatusOK,
+				Data:   chatID,
+			})
+
+			return
+		}
+
 		log.Info("new chat created", slog.String("chat_id", chatID.String()))
 
+		render.Status(r, http.StatusCreated)
+
 		render.JSON(w, r, resp.SuccessResponse{
-			Status: http.StatusOK,
+			Status: http.StatusCreated,
 			Data:   chatID,
 		})
 	}
 }
 
+// @Summary UpdateChat
+// @Tags chat
+// @Description Edits a group or a channel, the fields left out stay as they are. Admins change the name, description and avatar,
+// @Description the settings take the owner. Members see a system message listing what changed
+// @ID update-chat
+// @Accept  json
+// @Produce  json
+// @Param chat_id path string true "Chat ID"
+// @Param input body models.UpdateChat true "Fields to change"
+// @Success 200 {object} response.SuccessResponse{data=models.ChatDetails}
+// @Failure 400,401,403,404,409 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Failure default {object} response.ErrorResponse
+// @Security CookieAuth
+// @Router /chats/{chat_id} [patch]
+func (ch *ChatHandler) UpdateChat(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.chat.UpdateChat"
+
+		log := ch.log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		userInfo, err := cookie.TakeUserInfo(w, r)
+		if flag := handlers.HandleGettingCookie(w, r, err, log); !flag {
+			return
+		}
+
+		chatID, ok := pathUUID(w, r, "chat_id", log)
+		if !ok {
+			return
+		}
+
+		var req models.UpdateChat
+
+		err = render.Decode(r, &req)
+		if flag := handlers.HandleError(w, r, req, err, log); !flag {
+			return
+		}
+
+		updated, err := ch.chatHandler.UpdateChat(ctx, userInfo.UUID, chatID, req)
+		if err != nil {
+			renderChatError(w, r, err, "failed to update chat")
+
+			return
+		}
+
+		log.Info("chat updated", slog.String("chat_id", chatID.String()))
+
+		render.JSON(w, r, resp.SuccessResponse{
+			Status: http.StatusOK,
+			Data:   updated,
+		})
+	}
+}
+
 func (ch *ChatHandler) ListChats(ctx context.Context) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		const op = "handlers.chat.Chat"
@@ -229,3 +350,208 @@ func (ch *ChatHandler) ListChats(ctx context.Context) http.HandlerFunc {
 		})
 	}
 }
+
+// @Summary UserChats
+// @Tags admin
+// @Description Lists the chats of any user. Available to moderators and admins
+// @ID admin-user-chats
+// @Produce  json
+// @Param user_id path string true "User ID"
+// @Param cursor query int false "cursor of the previous page"
+// @Param limit query int true "page size"
+// @Success 200 {object} response.SuccessResponse{data=ChatResponse}
+// @Failure 400,401,403 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Failure default {object} response.ErrorResponse
+// @Security CookieAuth
+// @Router /admin/users/{user_id}/chats [get]
+func (ch *ChatHandler) UserChats(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.chat.UserChats"
+
+		log := ch.log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		idUser, err := uuid.Parse(chi.URLParam(r, "user_id"))
+		if err != nil {
+			log.Warn("invalid user id", sl.Err(err))
+
+			render.Status(r, http.StatusBadRequest)
+
+			render.JSON(w, r, resp.ErrorResponse{
+				Status: http.StatusBadRequest,
+				Error:  "invalid user id",
+			})
+
+			return
+		}
+
+		var cursor int64
+
+		if stringCursor := r.URL.Query().Get("cursor"); stringCursor != "" {
+			cursor, err = strconv.ParseInt(stringCursor, 10, 64)
+			if err != nil || cursor < 0 {
+				render.Status(r, http.StatusBadRequest)
+
+				render.JSON(w, r, resp.ErrorResponse{
+					Status: http.StatusBadRequest,
+					Error:  "invalid cursor",
+				})
+
+				return
+			}
+		}
+
+		limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+		if err != nil || limit < 1 {
+			render.Status(r, http.StatusBadRequest)
+
+			render.JSON(w, r, resp.ErrorResponse{
+				Status: http.StatusBadRequest,
+				Error:  "limit must be more than 0",
+			})
+
+			return
+		}
+
+		chats, cursors, err := ch.chatHandler.ListChats(ctx, idUser, cursor, limit)
+		if err != nil {
+			if errors.Is(err, chat.ErrChatsNotFound) {
+				render.JSON(w, r, resp.SuccessResponse{
+					Status: http.StatusOK,
+					Data: ChatResponse{
+						Chats:   []models.Chat{},
+						RCursor: models.Cursor{},
+					},
+				})
+
+				return
+			}
+
+			log.Error("failed to get chats", sl.Err(err))
+
+			render.Status(r, http.StatusInternalServerError)
+
+			render.JSON(w, r, resp.ErrorResponse{
+				Status: http.StatusInternalServerError,
+				Error:  "failed to get chats",
+			})
+
+			return
+		}
+
+		render.JSON(w, r, resp.SuccessResponse{
+			Status: http.StatusOK,
+			Data: ChatResponse{
+				Chats:   chats,
+				RCursor: *cursors,
+			},
+		})
+	}
+}
+
+// @Summary EraseUser
+// @Tags internal
+// @Description Called by auth-service when an account is deleted. Removes the user from every chat, a user without chats is not an error
+// @ID erase-user-chats
+// @Produce  json
+// @Param user_id path string true "User ID"
+// @Success 200 {object} response.SuccessResponse
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /internal/users/{user_id}/chats [delete]
+func (ch *ChatHandler) EraseUser(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.chat.EraseUser"
+
+		log := ch.log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		idUser, err := uuid.Parse(chi.URLParam(r, "user_id"))
+		if err != nil {
+			log.Warn("invalid user id", sl.Err(err))
+
+			render.Status(r, http.StatusBadRequest)
+
+			render.JSON(w, r, resp.ErrorResponse{
+				Status: http.StatusBadRequest,
+				Error:  "invalid user id",
+			})
+
+			return
+		}
+
+		err = ch.chatHandler.EraseUser(ctx, idUser)
+		if err != nil {
+			render.Status(r, http.StatusInternalServerError)
+
+			render.JSON(w, r, resp.ErrorResponse{
+				Status: http.StatusInternalServerError,
+				Error:  "failed to remove memberships",
+			})
+
+			return
+		}
+
+		render.JSON(w, r, resp.SuccessResponse{
+			Status: http.StatusOK,
+			Data:   "memberships removed",
+		})
+	}
+}
+
+// @Summary ExportUser
+// @Tags internal
+// @Description Called by auth-service for a data export. Lists the chats the user belongs to
+// @ID export-user-chats
+// @Produce  json
+// @Param user_id path string true "User ID"
+// @Success 200 {object} response.SuccessResponse{data=[]models.Membership}
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /internal/users/{user_id}/chats/export [get]
+func (ch *ChatHandler) ExportUser(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.chat.ExportUser"
+
+		log := ch.log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		idUser, err := uuid.Parse(chi.URLParam(r, "user_id"))
+		if err != nil {
+			log.Warn("invalid user id", sl.Err(err))
+
+			render.Status(r, http.StatusBadRequest)
+
+			render.JSON(w, r, resp.ErrorResponse{
+				Status: http.StatusBadRequest,
+				Error:  "invalid user id",
+			})
+
+			return
+		}
+
+		memberships, err := ch.chatHandler.ExportUser(ctx, idUser)
+		if err != nil {
+			render.Status(r, http.StatusInternalServerError)
+
+			render.JSON(w, r, resp.ErrorResponse{
+				Status: http.StatusInternalServerError,
+				Error:  "failed to export chats",
+			})
+
+			return
+		}
+
+		render.JSON(w, r, resp.SuccessResponse{
+			Status: http.StatusOK,
+			Data:   memberships,
+		})
+	}
+}
@@ -0,0 +1,411 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"github.com/go-chi/render"
+	"github.com/google/uuid"
+	"github.com/sergey-frey/cchat/server/chat-service/internal/domain/models"
+	"github.com/sergey-frey/cchat/server/chat-service/internal/http-server/handlers"
+	resp "github.com/sergey-frey/cchat/server/chat-service/internal/lib/api/response"
+	"github.com/sergey-frey/cchat/server/chat-service/internal/lib/cookie"
+	"github.com/sergey-frey/cchat/server/chat-service/internal/lib/logger/sl"
+	"github.com/sergey-frey/cchat/server/chat-service/internal/services/chat"
+)
+
+// @Summary Members
+// @Tags chat
+// @Description Lists the members of a chat the caller belongs to with their roles
+// @ID chat-members
+// @Produce  json
+// @Param chat_id path string true "Chat ID"
+// @Success 200 {object} response.SuccessResponse{data=[]models.Member}
+// @Failure 400,401,404 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Failure default {object} response.ErrorResponse
+// @Security CookieAuth
+// @Router /chats/{chat_id}/members [get]
+func (ch *ChatHandler) Members(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.chat.Members"
+
+		log := ch.log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		userInfo, err := cookie.TakeUserInfo(w, r)
+		if flag := handlers.HandleGettingCookie(w, r, err, log); !flag {
+			return
+		}
+
+		chatID, ok := pathUUID(w, r, "chat_id", log)
+		if !ok {
+			return
+		}
+
+		members, err := ch.chatHandler.Members(ctx, userInfo.UUID, chatID)
+		if err != nil {
+			renderChatError(w, r, err, "failed to list members")
+
+			return
+		}
+
+		render.JSON(w, r, resp.SuccessResponse{
+			Status: http.StatusOK,
+			Data:   members,
+		})
+	}
+}
+
+// @Summary AddMembers
+// @Tags chat
+// @Description Adds users to a group or a channel. Takes an admin or the owner, users already in the chat are skipped.
+// @Description Every added user gets a system message in the history
+// @ID add-chat-members
+// @Accept  json
+// @Produce  json
+// @Param chat_id path string true "Chat ID"
+// @Param input body models.AddMembers true "Users to add"
+// @Success 200 {object} response.SuccessResponse{data=[]string}
+// @Failure 400,401,403,404,409 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Failure default {object} response.ErrorResponse
+// @Security CookieAuth
+// @Router /chats/{chat_id}/members [post]
+func (ch *ChatHandler) AddMembers(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.chat.AddMembers"
+
+		log := ch.log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		userInfo, err := cookie.TakeUserInfo(w, r)
+		if flag := handlers.HandleGettingCookie(w, r, err, log); !flag {
+			return
+		}
+
+		chatID, ok := pathUUID(w, r, "chat_id", log)
+		if !ok {
+			return
+		}
+
+		var req models.AddMembers
+
+		err = render.Decode(r, &req)
+		if flag := handlers.HandleError(w, r, req, err, log); !flag {
+			return
+		}
+
+		added, err := ch.chatHandler.AddMembers(ctx, userInfo.UUID, chatID, req.Users)
+		if err != nil {
+			renderChatError(w, r, err, "failed to add members")
+
+			return
+		}
+
+		log.Info("members added", slog.String("chat_id", chatID.String()), slog.Int("count", len(added)))
+
+		render.JSON(w, r, resp.SuccessResponse{
+			Status: http.StatusOK,
+			Data:   added,
+		})
+	}
+}
+
+// @Summary RemoveMember
+// @Tags chat
+// @Description Removes a member from a group or a channel. Admins remove members, the owner removes anyone.
+// @Description Removing yourself is leaving the chat
+// @ID remove-chat-member
+// @Produce  json
+// @Param chat_id path string true "Chat ID"
+// @Param user_id path string true "User ID"
+// @Success 200 {object} response.SuccessResponse
+// @Failure 400,401,403,404,409 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Failure default {object} response.ErrorResponse
+// @Security CookieAuth
+// @Router /chats/{chat_id}/members/{user_id} [delete]
+func (ch *ChatHandler) RemoveMember(ctx context.Context) http.HandlerFunc {
+	return ch.memberAction(ctx, "handlers.chat.RemoveMember", "member removed", "failed to remove member", ch.chatHandler.RemoveMember)
+}
+
+// @Summary Leave
+// @Tags chat
+// @Description Leaves a group or a channel. The owner transfers the ownership first unless nobody else is in the chat
+// @ID leave-chat
+// @Produce  json
+// @Param chat_id path string true "Chat ID"
+// @Success 200 {object} response.SuccessResponse
+// @Failure 400,401,404,409 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Failure default {object} response.ErrorResponse
+// @Security CookieAuth
+// @Router /chats/{chat_id}/leave [post]
+func (ch *ChatHandler) Leave(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.chat.Leave"
+
+		log := ch.log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		userInfo, err := cookie.TakeUserInfo(w, r)
+		if flag := handlers.HandleGettingCookie(w, r, err, log); !flag {
+			return
+		}
+
+		chatID, ok := pathUUID(w, r, "chat_id", log)
+		if !ok {
+			return
+		}
+
+		err = ch.chatHandler.Leave(ctx, userInfo.UUID, chatID)
+		if err != nil {
+			renderChatError(w, r, err, "failed to leave chat")
+
+			return
+		}
+
+		render.JSON(w, r, resp.SuccessResponse{
+			Status: http.StatusOK,
+			Data:   "left chat",
+		})
+	}
+}
+
+// @Summary TransferOwnership
+// @Tags chat
+// @Description Hands a group or a channel over to another member. Only the owner can, and stays on as an admin
+// @ID transfer-chat-ownership
+// @Accept  json
+// @Produce  json
+// @Param chat_id path string true "Chat ID"
+// @Param input body models.TransferOwnership true "New owner"
+// @Success 200 {object} response.SuccessResponse
+// @Failure 400,401,403,404,409 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Failure default {object} response.ErrorResponse
+// @Security CookieAuth
+// @Router /chats/{chat_id}/owner [post]
+func (ch *ChatHandler) TransferOwnership(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.chat.TransferOwnership"
+
+		log := ch.log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		userInfo, err := cookie.TakeUserInfo(w, r)
+		if flag := handlers.HandleGettingCookie(w, r, err, log); !flag {
+			return
+		}
+
+		chatID, ok := pathUUID(w, r, "chat_id", log)
+		if !ok {
+			return
+		}
+
+		var req models.TransferOwnership
+
+		err = render.Decode(r, &req)
+		if flag := handlers.HandleError(w, r, req, err, log); !flag {
+			return
+		}
+
+		err = ch.chatHandler.TransferOwnership(ctx, userInfo.UUID, chatID, req.UserID)
+		if err != nil {
+			renderChatError(w, r, err, "failed to transfer ownership")
+
+			return
+		}
+
+		log.Info("ownership transferred", slog.String("chat_id", chatID.String()))
+
+		render.JSON(w, r, resp.SuccessResponse{
+			Status: http.StatusOK,
+			Data:   "ownership transferred",
+		})
+	}
+}
+
+// @Summary Promote
+// @Tags chat
+// @Description Makes a member of a group or a channel an admin. Only the owner can
+// @ID promote-chat-admin
+// @Produce  json
+// @Param chat_id path string true "Chat ID"
+// @Param user_id path string true "User ID"
+// @Success 200 {object} response.SuccessResponse
+// @Failure 400,401,403,404 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Failure default {object} response.ErrorResponse
+// @Security CookieAuth
+// @Router /chats/{chat_id}/admins/{user_id} [post]
+func (ch *ChatHandler) Promote(ctx context.Context) http.HandlerFunc {
+	return ch.memberAction(ctx, "handlers.chat.Promote", "admin promoted", "failed to promote member", ch.chatHandler.Promote)
+}
+
+// @Summary Demote
+// @Tags chat
+// @Description Makes an admin of a group or a channel a member again. Only the owner can
+// @ID demote-chat-admin
+// @Produce  json
+// @Param chat_id path string true "Chat ID"
+// @Param user_id path string true "User ID"
+// @Success 200 {object} response.SuccessResponse
+// @Failure 400,401,403,404 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Failure default {object} response.ErrorResponse
+// @Security CookieAuth
+// @Router /chats/{chat_id}/admins/{user_id} [delete]
+func (ch *ChatHandler) Demote(ctx context.Context) http.HandlerFunc {
+	return ch.memberAction(ctx, "handlers.chat.Demote", "admin demoted", "failed to demote admin", ch.chatHandler.Demote)
+}
+
+// memberAction serves the routes where the caller does something to the
+// member in the path.
+func (ch *ChatHandler) memberAction(ctx context.Context, op string, done string, failed string, action func(ctx context.Context, actor uuid.UUID, chatID uuid.UUID, target uuid.UUID) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := ch.log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		userInfo, err := cookie.TakeUserInfo(w, r)
+		if flag := handlers.HandleGettingCookie(w, r, err, log); !flag {
+			return
+		}
+
+		chatID, ok := pathUUID(w, r, "chat_id", log)
+		if !ok {
+			return
+		}
+
+		target, ok := pathUUID(w, r, "user_id", log)
+		if !ok {
+			return
+		}
+
+		err = action(ctx, userInfo.UUID, chatID, target)
+		if err != nil {
+			renderChatError(w, r, err, failed)
+
+			return
+		}
+
+		log.Info(done, slog.String("chat_id", chatID.String()), slog.String("target", target.String()))
+
+		render.JSON(w, r, resp.SuccessResponse{
+			Status: http.StatusOK,
+			Data:   done,
+		})
+	}
+}
+
+// @Summary Sender
+// @Tags internal
+// @Description Called by message-service before it accepts a message. Tells the role of the member, the settings of the chat and
+// @Description the other member of a direct chat
+// @ID chat-sender
+// @Produce  json
+// @Param chat_id path string true "Chat ID"
+// @Param user_id path string true "User ID"
+// @Success 200 {object} response.SuccessResponse{data=models.Sender}
+// @Failure 400,404 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /internal/chats/{chat_id}/members/{user_id} [get]
+func (ch *ChatHandler) Sender(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.chat.Sender"
+
+		log := ch.log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		chatID, ok := pathUUID(w, r, "chat_id", log)
+		if !ok {
+			return
+		}
+
+		idUser, ok := pathUUID(w, r, "user_id", log)
+		if !ok {
+			return
+		}
+
+		sender, err := ch.chatHandler.Sender(ctx, chatID, idUser)
+		if err != nil {
+			renderChatError(w, r, err, "failed to get member")
+
+			return
+		}
+
+		render.JSON(w, r, resp.SuccessResponse{
+			Status: http.StatusOK,
+			Data:   sender,
+		})
+	}
+}
+
+func pathUUID(w http.ResponseWriter, r *http.Request, name string, log *slog.Logger) (uuid.UUID, bool) {
+	id, err := uuid.Parse(chi.URLParam(r, name))
+	if err != nil {
+		log.Warn("invalid "+name, sl.Err(err))
+
+		render.Status(r, http.StatusBadRequest)
+
+		render.JSON(w, r, resp.ErrorResponse{
+			Status: http.StatusBadRequest,
+			Error:  "invalid " + name,
+		})
+
+		return uuid.Nil, false
+	}
+
+	return id, true
+}
+
+// renderChatError answers with the status the error of a change to the
+// chat or its members maps to, anything unexpected is failed.
+func renderChatError(w http.ResponseWriter, r *http.Request, err error, failed string) {
+	status, message := http.StatusInternalServerError, failed
+
+	switch {
+	case errors.Is(err, chat.ErrChatNotFound):
+		status, message = http.StatusNotFound, "chat not found"
+	case errors.Is(err, chat.ErrMemberNotFound):
+		status, message = http.StatusNotFound, "member not found"
+	case errors.Is(err, chat.ErrUsersNotFound):
+		status, message = http.StatusNotFound, "some users do not exist"
+	case errors.Is(err, chat.ErrNotAllowed):
+		status, message = http.StatusForbidden, "your role in the chat does not allow it"
+	case errors.Is(err, chat.ErrChatNotAllowed):
+		status, message = http.StatusForbidden, "some users do not accept chats from you"
+	case errors.Is(err, chat.ErrDirectChat):
+		status, message = http.StatusBadRequest, "a direct chat can not be managed"
+	case errors.Is(err, chat.ErrNothingToUpdate):
+		status, message = http.StatusBadRequest, "nothing to update"
+	case errors.Is(err, chat.ErrInvalidChatName):
+		status, message = http.StatusBadRequest, "chat name is empty"
+	case errors.Is(err, chat.ErrOwnerMustTransfer):
+		status, message = http.StatusConflict, "transfer the ownership before leaving"
+	}
+
+	render.Status(r, status)
+
+	render.JSON(w, r, resp.ErrorResponse{
+		Status: status,
+		Error:  message,
+	})
+}
@@ -2,16 +2,25 @@ package jwtcheck
 
 import (
 	"net/http"
+	"slices"
 
 	"github.com/go-chi/render"
 	resp "github.com/sergey-frey/cchat/server/chat-service/internal/lib/api/response"
 	"github.com/sergey-frey/cchat/server/chat-service/internal/lib/cookie"
+	"github.com/sergey-frey/cchat/server/chat-service/internal/lib/identity"
 )
 
+// JWTCheck lets through requests the gateway already authenticated.
+// Requests that reach the service directly are checked by their token.
 func JWTCheck(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		token, err := cookie.CheckCookie(w, r)
-		if err != nil || token == nil {
+		if _, ok := identity.User(r.Context()); ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		user, err := cookie.CheckCookie(w, r)
+		if err != nil || user == nil {
 			render.Status(r, http.StatusUnauthorized)
 
 			render.JSON(w, r, resp.ErrorResponse{
@@ -22,7 +31,111 @@ func JWTCheck(next http.Handler) http.Handler {
 			return
 		}
 
-		next.ServeHTTP(w, r)
+		next.ServeHTTP(w, r.WithContext(identity.WithUser(r.Context(), user)))
 	})
 
 }
+
+// RequireScope rejects personal access tokens that are limited to other
+// scopes. Sessions and tokens without scopes pass. It expects JWTCheck
+// to run before it.
+func RequireScope(scope string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, ok := identity.User(r.Context())
+			if !ok {
+				render.Status(r, http.StatusUnauthorized)
+
+				render.JSON(w, r, resp.ErrorResponse{
+					Status: http.StatusUnauthorized,
+					Error:  "user unauthorized",
+				})
+
+				return
+			}
+
+			if len(user.Scopes) > 0 && !slices.Contains(user.Scopes, scope) {
+				render.Status(r, http.StatusForbidden)
+
+				render.JSON(w, r, resp.ErrorResponse{
+					Status: http.StatusForbidden,
+					Error:  "token is missing scope " + scope,
+				})
+
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireRole lets through users with one of the roles. It expects
+// JWTCheck to run before it.
+func RequireRole(roles ...string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, ok := identity.User(r.Context())
+			if !ok {
+				render.Status(r, http.StatusUnauthorized)
+
+				render.JSON(w, r, resp.ErrorResponse{
+					Status: http.StatusUnauthorized,
+					Error:  "user unauthorized",
+				})
+
+				return
+			}
+
+			if !slices.Contains(roles, user.Role) {
+				render.Status(r, http.StatusForbidden)
+
+				render.JSON(w, r, resp.ErrorResponse{
+					Status: http.StatusForbidden,
+					Error:  "access denied",
+				})
+
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// EmailVerification rejects users whose email is not verified yet when required is set.
+// It expects JWTCheck to run before it.
+func EmailVerification(required bool) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if !required {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, ok := identity.User(r.Context())
+			if !ok {
+				render.Status(r, http.StatusUnauthorized)
+
+				render.JSON(w, r, resp.ErrorResponse{
+					Status: http.StatusUnauthorized,
+					Error:  "user unauthorized",
+				})
+
+				return
+			}
+
+			if !user.EmailVerified {
+				render.Status(r, http.StatusForbidden)
+
+				render.JSON(w, r, resp.ErrorResponse{
+					Status: http.StatusForbidden,
+					Error:  "email not verified",
+				})
+
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
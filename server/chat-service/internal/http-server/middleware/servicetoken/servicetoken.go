@@ -0,0 +1,84 @@
+// Package servicetoken guards the internal API. Only the other services
+// may call it: a request has to come from one of the internal networks and
+// carry the token they share.
+package servicetoken
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/go-chi/render"
+	resp "github.com/sergey-frey/cchat/server/chat-service/internal/lib/api/response"
+)
+
+// Header carries the service token.
+const Header = "X-Service-Token"
+
+func ParseNetworks(cidrs []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid internal network %q: %w", cidr, err)
+		}
+
+		networks = append(networks, network)
+	}
+
+	return networks, nil
+}
+
+// New lets through the requests from the networks that carry the token.
+// Without a token configured every request is refused.
+func New(networks []*net.IPNet, token string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !internal(r, networks) {
+				render.Status(r, http.StatusForbidden)
+
+				render.JSON(w, r, resp.ErrorResponse{
+					Status: http.StatusForbidden,
+					Error:  "access denied",
+				})
+
+				return
+			}
+
+			if token == "" || subtle.ConstantTimeCompare([]byte(r.Header.Get(Header)), []byte(token)) != 1 {
+				render.Status(r, http.StatusUnauthorized)
+
+				render.JSON(w, r, resp.ErrorResponse{
+					Status: http.StatusUnauthorized,
+					Error:  "invalid service token",
+				})
+
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func internal(r *http.Request, networks []*net.IPNet) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,51 @@
+package servicetoken
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	networks, err := ParseNetworks([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	tests := []struct {
+		name       string
+		configured string
+		remoteAddr string
+		token      string
+		want       int
+	}{
+		{"internal with token", "secret", "10.1.2.3:5000", "secret", http.StatusNoContent},
+		{"outside the network", "secret", "192.168.1.1:5000", "secret", http.StatusForbidden},
+		{"wrong token", "secret", "10.1.2.3:5000", "guess", http.StatusUnauthorized},
+		{"no token", "secret", "10.1.2.3:5000", "", http.StatusUnauthorized},
+		{"nothing configured", "", "10.1.2.3:5000", "", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/internal/users/batch", nil)
+			r.RemoteAddr = tt.remoteAddr
+
+			if tt.token != "" {
+				r.Header.Set(Header, tt.token)
+			}
+
+			w := httptest.NewRecorder()
+
+			New(networks, tt.configured)(ok).ServeHTTP(w, r)
+
+			if w.Code != tt.want {
+				t.Fatalf("expected %d, got %d", tt.want, w.Code)
+			}
+		})
+	}
+}
@@ -3,13 +3,19 @@ package cookie
 import (
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/sergey-frey/cchat/server/chat-service/internal/domain/models"
+	"github.com/sergey-frey/cchat/server/chat-service/internal/lib/identity"
 	"github.com/sergey-frey/cchat/server/chat-service/internal/lib/jwt"
 )
 
 func TakeUserInfo(w http.ResponseWriter, r *http.Request) (*models.NormalizedUser, error) {
+	if user, ok := identity.User(r.Context()); ok {
+		return user, nil
+	}
+
 	user, err := CheckCookie(w, r)
 	if err != nil {
 		return nil, fmt.Errorf("error with taking cookie")
@@ -38,29 +44,35 @@ func SetCookie(w http.ResponseWriter, accessToken string, refreshToken string) {
 	http.SetCookie(w, cookie2)
 }
 
+// CheckCookie verifies the access token of an "Authorization: Bearer"
+// header or, without one, of the access_token cookie.
 func CheckCookie(w http.ResponseWriter, r *http.Request) (*models.NormalizedUser, error) {
-	accessCookie, err := r.Cookie("access_token")
-	if err != nil {
-		return HandlerError(err)
-	}
+	accessToken, ok := BearerToken(r)
+	if !ok {
+		accessCookie, err := r.Cookie("access_token")
+		if err != nil {
+			return HandlerError(err)
+		}
 
-	refreshCookie, err := r.Cookie("refresh_token")
-	if err != nil {
-		return HandlerError(err)
+		accessToken = accessCookie.Value
 	}
 
-	accessToken, refreshToken := accessCookie.Value, refreshCookie.Value
-
-	accessToken, refreshToken, user, err := jwt.VerifyAccessToken(accessToken, refreshToken)
+	user, err := jwt.VerifyAccessToken(accessToken)
 	if err != nil {
 		return nil, fmt.Errorf("error with token: %w", err)
 	}
 
-	if accessToken != "" {
-		SetCookie(w, accessToken, refreshToken)
+	return user, nil
+}
+
+// BearerToken returns the access token of an "Authorization: Bearer" header.
+func BearerToken(r *http.Request) (string, bool) {
+	scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return "", false
 	}
 
-	return user, nil
+	return token, true
 }
 
 func DeleteCookie(w http.ResponseWriter) {
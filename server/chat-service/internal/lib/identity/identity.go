@@ -0,0 +1,20 @@
+package identity
+
+import (
+	"context"
+
+	"github.com/sergey-frey/cchat/server/chat-service/internal/domain/models"
+)
+
+type ctxKey struct{}
+
+// WithUser stores the authenticated user of the request.
+func WithUser(ctx context.Context, user *models.NormalizedUser) context.Context {
+	return context.WithValue(ctx, ctxKey{}, user)
+}
+
+// User returns the user stored by the auth middleware, if any.
+func User(ctx context.Context) (*models.NormalizedUser, bool) {
+	user, ok := ctx.Value(ctxKey{}).(*models.NormalizedUser)
+	return user, ok && user != nil
+}
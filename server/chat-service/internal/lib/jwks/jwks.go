@@ -0,0 +1,176 @@
+// Package jwks keeps the public keys of auth-service, the only service
+// that signs tokens. Keys are fetched from its JWKS endpoint and cached.
+package jwks
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sergey-frey/cchat/server/chat-service/internal/lib/logger/sl"
+)
+
+// minRefresh limits how often an unknown kid can trigger a fetch.
+const minRefresh = 30 * time.Second
+
+var ErrUnknownKey = errors.New("unknown signing key")
+
+type Key struct {
+	Alg    string
+	Public crypto.PublicKey
+}
+
+type Cache struct {
+	client    *http.Client
+	url       string
+	ttl       time.Duration
+	log       *slog.Logger
+	mu        sync.RWMutex
+	keys      map[string]Key
+	fetchedAt time.Time
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+func New(client *http.Client, url string, ttl time.Duration, log *slog.Logger) *Cache {
+	return &Cache{
+		client: client,
+		url:    url,
+		ttl:    ttl,
+		log:    log,
+		keys:   make(map[string]Key),
+	}
+}
+
+// Key returns the key with the given id. The set is refetched when it is
+// older than the ttl or when the id is unknown, a key rotation in
+// auth-service is picked up without a restart. If auth-service can not be
+// reached the cached keys keep being used.
+func (c *Cache) Key(ctx context.Context, kid string) (Key, error) {
+	const op = "jwks.Key"
+
+	c.mu.RLock()
+	key, ok := c.keys[kid]
+	age := time.Since(c.fetchedAt)
+	c.mu.RUnlock()
+
+	if ok && age < c.ttl {
+		return key, nil
+	}
+
+	if ok || age >= minRefresh {
+		if err := c.refresh(ctx); err != nil {
+			c.log.Warn("failed to refresh jwks", slog.String("op", op), sl.Err(err))
+		}
+	}
+
+	c.mu.RLock()
+	key, ok = c.keys[kid]
+	c.mu.RUnlock()
+
+	if !ok {
+		return Key{}, fmt.Errorf("%s: %w", op, ErrUnknownKey)
+	}
+
+	return key, nil
+}
+
+func (c *Cache) refresh(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Another request may have refreshed the set while this one waited.
+	if time.Since(c.fetchedAt) < minRefresh {
+		return nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return err
+	}
+
+	keys := make(map[string]Key, len(set.Keys))
+	for _, k := range set.Keys {
+		key, err := parse(k)
+		if err != nil {
+			c.log.Warn("skipping key", slog.String("kid", k.Kid), sl.Err(err))
+			continue
+		}
+
+		keys[k.Kid] = key
+	}
+
+	c.keys = keys
+	c.fetchedAt = time.Now()
+
+	return nil
+}
+
+func parse(k jwk) (Key, error) {
+	switch k.Kty {
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return Key{}, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return Key{}, errors.New("invalid ed25519 key")
+		}
+
+		return Key{Alg: "EdDSA", Public: ed25519.PublicKey(x)}, nil
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return Key{}, errors.New("invalid rsa modulus")
+		}
+
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return Key{}, errors.New("invalid rsa exponent")
+		}
+
+		return Key{Alg: "RS256", Public: &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}}, nil
+	default:
+		return Key{}, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
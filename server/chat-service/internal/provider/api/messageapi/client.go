@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"net/url"
 
+	"github.com/google/uuid"
 	"github.com/sergey-frey/cchat/server/chat-service/internal/domain/models"
 )
 
@@ -26,17 +27,25 @@ type EmailOfUser struct {
 	Email string `json:"email"`
 }
 
+// serviceTokenHeader carries the token message-service expects on its
+// internal routes.
+const serviceTokenHeader = "X-Service-Token"
+
 type Client struct {
 	httpClient *http.Client
 	baseURL    string
-	log *slog.Logger
+	token      string
+	log        *slog.Logger
 }
 
-func NewClient(httpClient *http.Client, baseURL string, log *slog.Logger) *Client {
+// NewClient takes the service token shared with message-service, PostEvent
+// calls an internal route that requires it.
+func NewClient(httpClient *http.Client, baseURL string, token string, log *slog.Logger) *Client {
 	return &Client{
 		httpClient: httpClient,
 		baseURL:    baseURL,
-		log: log,
+		token:      token,
+		log:        log,
 	}
 }
 
@@ -128,4 +137,38 @@ func (c *Client) CreateUser(ctx context.Context, email string) (*models.Normaliz
 	}
 
 	return &newUser.Data, nil
-}
\ No newline at end of file
+}
+
+// PostEvent posts the change of the chat to its history as a system
+// message.
+func (c *Client) PostEvent(ctx context.Context, chatID uuid.UUID, event models.ChatEvent) error {
+	const op = "api.messageapi.client.PostEvent"
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	endpoint := fmt.Sprintf("%s/internal/chats/%s/system-messages", c.baseURL, chatID)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(serviceTokenHeader, c.token)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("%s: unexpected status code %d", op, resp.StatusCode)
+	}
+
+	return nil
+}
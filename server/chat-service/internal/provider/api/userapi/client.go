@@ -1,13 +1,12 @@
 package userapi
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"log/slog"
 	"net/http"
-	"net/url"
-	"strings"
 
 	"github.com/google/uuid"
 	"github.com/sergey-frey/cchat/server/chat-service/internal/domain/models"
@@ -18,77 +17,160 @@ var (
 	ErrUserNotFound = fmt.Errorf("user not found")
 )
 
-type NormalizedUserResponse struct {
-	Status int                `json:"status"`
-	Data   models.NormalizedUser `json:"data"`
-}
-
-type ChecUsersRequest struct {
-	Email string `json:"email"`
-}
+// serviceTokenHeader carries the token user-service expects on its
+// internal routes.
+const serviceTokenHeader = "X-Service-Token"
 
 type Client struct {
 	httpClient *http.Client
 	baseURL    string
+	token      string
 	log *slog.Logger
 }
 
-func NewClient(httpClient *http.Client, baseURL string, log *slog.Logger) *Client {
+// NewClient takes the service token shared with user-service, every
+// request of the client carries it.
+func NewClient(httpClient *http.Client, baseURL string, token string, log *slog.Logger) *Client {
 	return &Client{
 		httpClient: httpClient,
 		baseURL:    baseURL,
+		token:      token,
 		log: log,
 	}
 }
 
+type batchRequest struct {
+	UUIDs  []uuid.UUID `json:"uuids"`
+	Viewer uuid.UUID   `json:"viewer,omitempty"`
+}
+
+type batchCheckResponse struct {
+	Status int `json:"status"`
+	Data   struct {
+		Existing []uuid.UUID `json:"existing"`
+		Missing  []uuid.UUID `json:"missing"`
+	} `json:"data"`
+}
+
+// CheckUser makes sure all the users exist, ErrUserNotFound tells that
+// some of them don't.
 func (c *Client) CheckUser(ctx context.Context, ids []uuid.UUID) error {
 	const op = "api.userapi.client.CheckUser"
 
-	log := c.log.With(
-		slog.String("op", op),
-	)
+	var result batchCheckResponse
 
-	param := url.Values{}
-	stringsIds := make([]string, len(ids))
-	for i, id := range ids {
-		stringsIds[i] = id.String()
+	if err := c.post(ctx, "/internal/users/batch-check", batchRequest{UUIDs: ids}, &result); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
 	}
 
-	stringIds := strings.Join(stringsIds, ",")
+	if len(result.Data.Missing) > 0 {
+		c.log.Warn("unknown users", slog.String("op", op), slog.Int("missing", len(result.Data.Missing)))
 
-	param.Add("email", stringIds)
+		return fmt.Errorf("%s: %w", op, ErrUserNotFound)
+	}
 
-	log.Info("email:")
+	return nil
+}
 
-    usersServiceURL := "http://users-service-2:8080"
-    checkURL := fmt.Sprintf("%s/internal/users/batch-check?uuids=%s", 
-        usersServiceURL, 
-        param.Encode())
+type batchUser struct {
+	UUID       uuid.UUID `json:"uuid"`
+	Email      string    `json:"email"`
+	Username   string    `json:"username"`
+	Name       string    `json:"name"`
+	Avatar     string    `json:"avatar"`
+	AvatarURLs *struct {
+		Medium string `json:"medium"`
+	} `json:"avatar_urls"`
+}
+
+type batchUsersResponse struct {
+	Status int         `json:"status"`
+	Data   []batchUser `json:"data"`
+}
+
+// Users looks up the profiles of the users in one request, as the viewer
+// may see them. Unknown users are left out.
+func (c *Client) Users(ctx context.Context, viewer uuid.UUID, ids []uuid.UUID) ([]models.UserInfo, error) {
+	const op = "api.userapi.client.Users"
+
+	var result batchUsersResponse
+
+	if err := c.post(ctx, "/internal/users/batch", batchRequest{UUIDs: ids, Viewer: viewer}, &result); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	users := make([]models.UserInfo, 0, len(result.Data))
+
+	for _, user := range result.Data {
+		// An uploaded avatar takes precedence over the link set by hand.
+		avatar := user.Avatar
+		if user.AvatarURLs != nil {
+			avatar = user.AvatarURLs.Medium
+		}
+
+		users = append(users, models.UserInfo{
+			UUID:     user.UUID,
+			Email:    user.Email,
+			Username: user.Username,
+			Name:     user.Name,
+			Avatar:   avatar,
+		})
+	}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, checkURL, nil)
+	return users, nil
+}
+
+type chatCheckRequest struct {
+	Initiator uuid.UUID   `json:"initiator"`
+	Users     []uuid.UUID `json:"users"`
+}
+
+type chatCheckResponse struct {
+	Status int `json:"status"`
+	Data   struct {
+		Denied []uuid.UUID `json:"denied"`
+	} `json:"data"`
+}
+
+// ChatDenied asks user-service which of the users do not accept a chat
+// started by the initiator.
+func (c *Client) ChatDenied(ctx context.Context, initiator uuid.UUID, users []uuid.UUID) ([]uuid.UUID, error) {
+	const op = "api.userapi.client.ChatDenied"
+
+	var result chatCheckResponse
+
+	if err := c.post(ctx, "/internal/privacy/chat-check", chatCheckRequest{Initiator: initiator, Users: users}, &result); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return result.Data.Denied, nil
+}
+
+// post sends the body as JSON to an internal route of user-service and
+// decodes the answer into result.
+func (c *Client) post(ctx context.Context, path string, body any, result any) error {
+	payload, err := json.Marshal(body)
 	if err != nil {
-		return fmt.Errorf("%s: %w", op, err)
+		return err
 	}
 
-	resp, err := c.httpClient.Do(req)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+path, bytes.NewReader(payload))
 	if err != nil {
-		return fmt.Errorf("%s: %w", op, err)
+		return err
 	}
 
-	if resp.StatusCode != http.StatusCreated {
-		if resp.StatusCode == http.StatusConflict {
-			return fmt.Errorf("%s: %s", op, "user not found")
-		}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(serviceTokenHeader, c.token)
 
-		return fmt.Errorf("%s: unexpected status code %d", op, resp.StatusCode)
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
 	}
-
 	defer resp.Body.Close()
 
-	var newUser NormalizedUserResponse
-	if err := json.NewDecoder(resp.Body).Decode(&newUser); err != nil {
-		return fmt.Errorf("%s: %w", op, err)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
 	}
 
-	return nil
-}
\ No newline at end of file
+	return json.NewDecoder(resp.Body).Decode(result)
+}
@@ -1,18 +1,20 @@
 package postgres
 
 import (
+	"bytes"
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 
 	"github.com/google/uuid"
-	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v4"
 	"github.com/sergey-frey/cchat/server/chat-service/internal/domain/models"
 	"github.com/sergey-frey/cchat/server/chat-service/internal/provider/storage"
 )
 
-func (s *Storage) NewChat(ctx context.Context, chatName string, users []uuid.UUID) (chatID uuid.UUID, err error) {
+// NewChat creates a group or a channel owned by owner, the users join it
+// as members invited by the owner. Direct chats go through DirectChat.
+func (s *Storage) NewChat(ctx context.Context, chatType string, chatName string, owner uuid.UUID, users []uuid.UUID) (chatID uuid.UUID, err error) {
 	const op = "storage.chat.NewChat"
 
 	tx, err := s.pool.Begin(ctx)
@@ -32,41 +34,44 @@ func (s *Storage) NewChat(ctx context.Context, chatName string, users []uuid.UUI
 		}
 	}()
 
-	row := s.pool.QueryRow(ctx, `
-		INSERT INTO chats DEFAULT VALUES
-		RETURNING id;
-	`)
+	row := tx.QueryRow(ctx, `
+		INSERT INTO chats(name, type, only_admins_post)
+		VALUES($1, $2, $3)
+		RETURNING chat_id;
+	`, chatName, chatType, chatType == models.ChatChannel)
 
 	err = row.Scan(&chatID)
 	if err != nil {
-		return uuid.Nil, fmt.Errorf("%s: %w", op, storage.ErrFailedToCreateChat)
+		return uuid.Nil, fmt.Errorf("%s: %w: %w", op, storage.ErrFailedToCreateChat, err)
 	}
 
-	rows := make([][]interface{}, len(users))
-	for i, userID := range users {
-		rows[i] = []interface{}{chatID, userID}
+	members := []models.Member{{UserID: owner, Role: models.MemberOwner}}
+	for _, user := range users {
+		members = append(members, models.Member{UserID: user, Role: models.MemberMember, InvitedBy: &owner})
 	}
 
-	_, err = s.pool.CopyFrom(
-		ctx,
-		[]string{"user_chats"},
-		[]string{"chat_id", "user_id"},
-		pgx.CopyFromRows(rows),
-	)
-
+	err = addMembers(ctx, tx, chatID, members)
 	if err != nil {
-		return uuid.Nil, fmt.Errorf("%s: %w", op, storage.ErrFailedToAddUsersInChat)
+		return uuid.Nil, fmt.Errorf("%s: %w: %w", op, storage.ErrFailedToAddUsersInChat, err)
 	}
 
 	return chatID, nil
 }
 
-func (s *Storage) ListChats(ctx context.Context, currUser uuid.UUID, cursor uuid.UUID, limit int) ([]models.Chat, *models.Cursor, error) {
-	const op = "storage.chat.Chat"
+// DirectChat returns the direct chat of the two users, created if they
+// do not share one yet. Of two concurrent calls for the same pair one
+// creates the chat and the other gets it.
+func (s *Storage) DirectChat(ctx context.Context, first uuid.UUID, second uuid.UUID) (chatID uuid.UUID, created bool, err error) {
+	const op = "storage.chat.DirectChat"
+
+	low, high := first, second
+	if bytes.Compare(low[:], high[:]) > 0 {
+		low, high = high, low
+	}
 
 	tx, err := s.pool.Begin(ctx)
 	if err != nil {
-		return nil, nil, fmt.Errorf("%s: %w", op, err)
+		return uuid.Nil, false, fmt.Errorf("%s: %w", op, err)
 	}
 
 	defer func() {
@@ -81,84 +86,89 @@ func (s *Storage) ListChats(ctx context.Context, currUser uuid.UUID, cursor uuid
 		}
 	}()
 
-	values := make([]interface{}, 0, 5)
-	pagination, users, limitQ := "", "", ""
-	username += "%"
+	row := tx.QueryRow(ctx, `
+		INSERT INTO chats(name, type, direct_low, direct_high)
+		VALUES('', $1, $2, $3)
+		ON CONFLICT (direct_low, direct_high) WHERE type = 'direct' DO NOTHING
+		RETURNING chat_id;
+	`, models.ChatDirect, low, high)
+
+	err = row.Scan(&chatID)
+	if err == nil {
+		err = addMembers(ctx, tx, chatID, []models.Member{
+			{UserID: low, Role: models.MemberMember},
+			{UserID: high, Role: models.MemberMember},
+		})
+		if err != nil {
+			return uuid.Nil, false, fmt.Errorf("%s: %w: %w", op, storage.ErrFailedToAddUsersInChat, err)
+		}
 
-	if cursor == 0 {
-		pagination += fmt.Sprintf("user_id = $%d", len(values)+1)
-		users += fmt.Sprintf("$%d", len(values)+2)
-		limitQ += fmt.Sprintf("$%d", len(values)+3)
-		values = append(values, currUser, username, limit+1)
+		return chatID, true, nil
 	}
 
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return uuid.Nil, false, fmt.Errorf("%s: %w: %w", op, storage.ErrFailedToCreateChat, err)
+	}
+
+	row = tx.QueryRow(ctx, `
+		SELECT chat_id
+		FROM chats
+		WHERE type = $1 AND direct_low = $2 AND direct_high = $3;
+	`, models.ChatDirect, low, high)
+
+	err = row.Scan(&chatID)
+	if err != nil {
+		return uuid.Nil, false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return chatID, false, nil
+}
+
+func addMembers(ctx context.Context, tx pgx.Tx, chatID uuid.UUID, members []models.Member) error {
+	rows := make([][]interface{}, len(members))
+	for i, member := range members {
+		rows[i] = []interface{}{chatID, member.UserID, member.Role, member.InvitedBy}
+	}
+
+	_, err := tx.CopyFrom(
+		ctx,
+		pgx.Identifier{"user_chats"},
+		[]string{"chat_id", "user_id", "role", "invited_by"},
+		pgx.CopyFromRows(rows),
+	)
+
+	return err
+}
+
+// ListChats returns a page of the chats of the user, the latest created
+// first, with their description, avatar and settings. The members carry
+// only their ids, the profiles live in user-service. cursor is the seq of the last chat of the previous page.
+func (s *Storage) ListChats(ctx context.Context, currUser uuid.UUID, cursor int64, limit int) ([]models.Chat, *models.Cursor, error) {
+	const op = "storage.chat.ListChats"
+
+	values := []interface{}{currUser, limit + 1}
+	pagination := ""
+
 	if cursor != 0 {
-		pagination += fmt.Sprintf("user_id = $%d AND chat_id < $%d", len(values)+1, len(values)+2)
-		users += fmt.Sprintf("$%d", len(values)+3)
-		limitQ += fmt.Sprintf("$%d", len(values)+4)
-		values = append(values, currUser, cursor, username, limit+1)
+		values = append(values, cursor)
+		pagination = fmt.Sprintf("AND c.seq < $%d", len(values))
 	}
 
 	stmt := fmt.Sprintf(`
-		WITH user_chats_cte AS (
-			SELECT chat_id
-			FROM user_chats
-			WHERE %s
-		),
-		chat_participants AS (
-			SELECT uc.chat_id, u.id AS user_id, u.username, u.name, u.email
-			FROM user_chats uc
-			JOIN users u ON uc.user_id = u.id
-			WHERE uc.chat_id IN (SELECT chat_id FROM user_chats_cte)
-		),
-		filtered_chats AS (
-			SELECT DISTINCT cp.chat_id
-			FROM chat_participants cp
-			WHERE cp.user_id != $1
-			AND (%s::text IS NULL OR cp.username ILIKE %s || '%%')
-		),
-		last_messages AS (
-			SELECT DISTINCT ON (m.chat_id)
-				m.chat_id,
-				m.id AS message_id,
-				m.content,
-				m.date,
-				m.type,
-				m.author_id
-			FROM messages m
-			WHERE m.chat_id IN (SELECT chat_id FROM filtered_chats)
-			ORDER BY m.chat_id, m.date DESC
-			LIMIT 1
-		)
-		SELECT fc.chat_id,
-			json_agg(
-				json_build_object(
-					'id', cp.user_id,
-					'username', cp.username,
-					'name', cp.name,
-					'email', cp.email
-				) ORDER BY cp.user_id
-			) AS participants,
-			json_build_object(
-				'id', lm.message_id,
-				'content', lm.content,
-				'date', lm.date,
-				'type', lm.type,
-				'author_id', lm.author_id
-			) AS last_message
-		FROM filtered_chats fc
-		JOIN chat_participants cp ON cp.chat_id = fc.chat_id
-		LEFT JOIN last_messages lm ON lm.chat_id = fc.chat_id
-		GROUP BY fc.chat_id, lm.message_id, lm.content, lm.date, lm.type, lm.author_id
-		ORDER BY fc.chat_id DESC
-		LIMIT %s;
-	`, pagination, users, users, limitQ)
+		SELECT c.chat_id, c.type, c.name, c.description, c.avatar,
+			c.only_admins_post, c.only_admins_add_members, c.seq,
+			array_agg(m.user_id ORDER BY m.user_id) AS members
+		FROM user_chats uc
+		JOIN chats c ON c.chat_id = uc.chat_id
+		JOIN user_chats m ON m.chat_id = c.chat_id
+		WHERE uc.user_id = $1 %s
+		GROUP BY c.chat_id
+		ORDER BY c.seq DESC
+		LIMIT $2;
+	`, pagination)
 
 	rows, err := s.pool.Query(ctx, stmt, values...)
 	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			return nil, nil, fmt.Errorf("%s: %w", op, storage.ErrChatsNotFound)
-		}
 		return nil, nil, fmt.Errorf("%s: %w", op, err)
 	}
 
@@ -167,55 +177,395 @@ func (s *Storage) ListChats(ctx context.Context, currUser uuid.UUID, cursor uuid
 	var chats []models.Chat
 	for rows.Next() {
 		var chat models.Chat
-		var userJSON []byte
-		var messageJSON []byte
-
-		if err := rows.Scan(&chat.ID, &userJSON, &messageJSON); err != nil {
-			return nil, nil, fmt.Errorf("%s: %w", op, err)
-		}
-
-		if err := json.Unmarshal(userJSON, &chat.Users); err != nil {
+		var members []uuid.UUID
+
+		err := rows.Scan(
+			&chat.UUID,
+			&chat.Type,
+			&chat.Name,
+			&chat.Description,
+			&chat.Avatar,
+			&chat.Settings.OnlyAdminsPost,
+			&chat.Settings.OnlyAdminsAddMembers,
+			&chat.Seq,
+			&members,
+		)
+		if err != nil {
 			return nil, nil, fmt.Errorf("%s: %w", op, err)
 		}
 
-		if len(messageJSON) > 0 {
-			var msg models.Message
-			if err := json.Unmarshal(messageJSON, &msg); err != nil {
-				return nil, nil, fmt.Errorf("%s: %w", op, err)
-			}
-			chat.LastMessage = &msg
+		chat.Users = make([]models.UserInfo, 0, len(members))
+		for _, member := range members {
+			chat.Users = append(chat.Users, models.UserInfo{UUID: member})
 		}
 
 		chats = append(chats, chat)
 	}
 
-	rcursor := &models.Cursor{}
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", op, err)
+	}
 
 	if len(chats) == 0 {
-		return nil, nil, fmt.Errorf("%s: %w", op, storage.ErrUsersNotFound)
+		return nil, nil, fmt.Errorf("%s: %w", op, storage.ErrChatsNotFound)
+	}
+
+	rcursor := &models.Cursor{PrevCursor: cursor}
+
+	if len(chats) > limit {
+		chats = chats[:limit]
+		rcursor.NextCursor = chats[limit-1].Seq
+	}
+
+	return chats, rcursor, nil
+}
+
+// RemoveUserChats drops every membership of the user. The chats stay for
+// the other members: where the user was the owner, the oldest admin takes
+// the chat over, or the oldest member when there are no admins.
+func (s *Storage) RemoveUserChats(ctx context.Context, uid uuid.UUID) (removed int64, err error) {
+	const op = "storage.chat.RemoveUserChats"
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback(ctx)
+			return
+		}
+
+		commitErr := tx.Commit(ctx)
+		if commitErr != nil {
+			err = fmt.Errorf("%s: %w", op, commitErr)
+		}
+	}()
+
+	rows, err := tx.Query(ctx, `
+		DELETE FROM user_chats
+		WHERE user_id = $1 AND role = $2
+		RETURNING chat_id;
+	`, uid, models.MemberOwner)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var owned []uuid.UUID
+
+	for rows.Next() {
+		var chatID uuid.UUID
+
+		err = rows.Scan(&chatID)
+		if err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+
+		owned = append(owned, chatID)
+	}
+
+	rows.Close()
+
+	err = rows.Err()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// The owner row is gone before the heir is promoted, so the chat never
+	// has two owners.
+	for _, chatID := range owned {
+		_, err = tx.Exec(ctx, `
+			UPDATE user_chats
+			SET role = $2
+			WHERE chat_id = $1 AND user_id = (
+				SELECT user_id
+				FROM user_chats
+				WHERE chat_id = $1
+				ORDER BY role = $3 DESC, joined_at, user_id
+				LIMIT 1
+			);
+		`, chatID, models.MemberOwner, models.MemberAdmin)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	tag, err := tx.Exec(ctx, `
+		DELETE FROM user_chats
+		WHERE user_id = $1;
+	`, uid)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return int64(len(owned)) + tag.RowsAffected(), nil
+}
+
+// UserChats lists every chat the user belongs to, the oldest first.
+func (s *Storage) UserChats(ctx context.Context, uid uuid.UUID) ([]models.Membership, error) {
+	const op = "storage.chat.UserChats"
+
+	rows, err := s.pool.Query(ctx, `
+		SELECT c.chat_id, c.type, c.name, c.created_at
+		FROM user_chats uc
+		JOIN chats c ON c.chat_id = uc.chat_id
+		WHERE uc.user_id = $1
+		ORDER BY c.created_at, c.chat_id;
+	`, uid)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	memberships := make([]models.Membership, 0)
+
+	for rows.Next() {
+		var membership models.Membership
+
+		if err := rows.Scan(&membership.ChatID, &membership.Type, &membership.Name, &membership.CreatedAt); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		memberships = append(memberships, membership)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	if len(chats) < 2 {
-		rcursor = &models.Cursor{
-			PrevCursor: chats[len(chats)-1].ID,
+	return memberships, nil
+}
+
+// ChatRole returns the role of the user in the chat. A chat the user is
+// not a member of is storage.ErrMemberNotFound, whether it exists or not.
+func (s *Storage) ChatRole(ctx context.Context, chatID uuid.UUID, uid uuid.UUID) (*models.ChatRole, error) {
+	const op = "storage.chat.ChatRole"
+
+	var role models.ChatRole
+
+	row := s.pool.QueryRow(ctx, `
+		SELECT c.type, uc.role, c.only_admins_post, c.only_admins_add_members
+		FROM user_chats uc
+		JOIN chats c ON c.chat_id = uc.chat_id
+		WHERE uc.chat_id = $1 AND uc.user_id = $2;
+	`, chatID, uid)
+
+	err := row.Scan(&role.ChatType, &role.Role, &role.Settings.OnlyAdminsPost, &role.Settings.OnlyAdminsAddMembers)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%s: %w", op, storage.ErrMemberNotFound)
+		}
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &role, nil
+}
+
+// Members lists the members of the chat in the order they joined.
+func (s *Storage) Members(ctx context.Context, chatID uuid.UUID) ([]models.Member, error) {
+	const op = "storage.chat.Members"
+
+	rows, err := s.pool.Query(ctx, `
+		SELECT user_id, role, joined_at, invited_by
+		FROM user_chats
+		WHERE chat_id = $1
+		ORDER BY joined_at, user_id;
+	`, chatID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	members := make([]models.Member, 0)
+
+	for rows.Next() {
+		var member models.Member
+
+		if err := rows.Scan(&member.UserID, &member.Role, &member.JoinedAt, &member.InvitedBy); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
 		}
-		return chats, rcursor, nil
+
+		members = append(members, member)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return members, nil
+}
+
+// AddMembers adds the users to the chat as members and returns the ones
+// that were not members yet.
+func (s *Storage) AddMembers(ctx context.Context, chatID uuid.UUID, invitedBy uuid.UUID, users []uuid.UUID) ([]uuid.UUID, error) {
+	const op = "storage.chat.AddMembers"
+
+	rows, err := s.pool.Query(ctx, `
+		INSERT INTO user_chats(chat_id, user_id, role, joined_at, invited_by)
+		SELECT $1, u, $3, NOW(), $4
+		FROM unnest($2::uuid[]) AS u
+		ON CONFLICT (chat_id, user_id) DO NOTHING
+		RETURNING user_id;
+	`, chatID, users, models.MemberMember, invitedBy)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	added := make([]uuid.UUID, 0, len(users))
+
+	for rows.Next() {
+		var uid uuid.UUID
+
+		if err := rows.Scan(&uid); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		added = append(added, uid)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return added, nil
+}
+
+func (s *Storage) RemoveMember(ctx context.Context, chatID uuid.UUID, uid uuid.UUID) error {
+	const op = "storage.chat.RemoveMember"
+
+	tag, err := s.pool.Exec(ctx, `
+		DELETE FROM user_chats
+		WHERE chat_id = $1 AND user_id = $2;
+	`, chatID, uid)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
 	}
 
-	if len(chats) >= 2 {
-		if len(chats) <= limit {
-			rcursor = &models.Cursor{
-				PrevCursor: chats[len(chats)-1].ID,
-			}
-			return chats, rcursor, nil
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrMemberNotFound)
+	}
+
+	return nil
+}
+
+// SetMemberRole makes a member an admin or an admin a member, the owner
+// only changes through TransferOwnership.
+func (s *Storage) SetMemberRole(ctx context.Context, chatID uuid.UUID, uid uuid.UUID, role string) error {
+	const op = "storage.chat.SetMemberRole"
+
+	tag, err := s.pool.Exec(ctx, `
+		UPDATE user_chats
+		SET role = $3
+		WHERE chat_id = $1 AND user_id = $2 AND role <> $4;
+	`, chatID, uid, role, models.MemberOwner)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrMemberNotFound)
+	}
+
+	return nil
+}
+
+// TransferOwnership makes the member the owner of the chat, the previous
+// owner stays as an admin.
+func (s *Storage) TransferOwnership(ctx context.Context, chatID uuid.UUID, from uuid.UUID, to uuid.UUID) (err error) {
+	const op = "storage.chat.TransferOwnership"
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback(ctx)
+			return
 		}
-		if len(chats) > limit {
-			rcursor = &models.Cursor{
-				PrevCursor: chats[len(chats)-2].ID,
-				NextCursor: chats[len(chats)-1].ID,
-			}
+
+		commitErr := tx.Commit(ctx)
+		if commitErr != nil {
+			err = fmt.Errorf("%s: %w", op, commitErr)
 		}
+	}()
+
+	tag, err := tx.Exec(ctx, `
+		UPDATE user_chats
+		SET role = $3
+		WHERE chat_id = $1 AND user_id = $2 AND role = $4;
+	`, chatID, from, models.MemberAdmin, models.MemberOwner)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrMemberNotFound)
+	}
+
+	tag, err = tx.Exec(ctx, `
+		UPDATE user_chats
+		SET role = $3
+		WHERE chat_id = $1 AND user_id = $2;
+	`, chatID, to, models.MemberOwner)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrMemberNotFound)
+	}
+
+	return nil
+}
+
+// UpdateChat sets the fields of the update that are not nil and bumps
+// updated_at, returning the chat as it is after the update.
+func (s *Storage) UpdateChat(ctx context.Context, chatID uuid.UUID, update models.UpdateChat) (*models.ChatDetails, error) {
+	const op = "storage.chat.UpdateChat"
+
+	var settings models.UpdateSettings
+	if update.Settings != nil {
+		settings = *update.Settings
+	}
+
+	var chat models.ChatDetails
+
+	row := s.pool.QueryRow(ctx, `
+		UPDATE chats
+		SET name = COALESCE($2, name),
+			description = COALESCE($3, description),
+			avatar = COALESCE($4, avatar),
+			only_admins_post = COALESCE($5, only_admins_post),
+			only_admins_add_members = COALESCE($6, only_admins_add_members),
+			updated_at = NOW()
+		WHERE chat_id = $1
+		RETURNING chat_id, type, name, description, avatar, only_admins_post, only_admins_add_members, created_at, updated_at;
+	`, chatID, update.Name, update.Description, update.Avatar, settings.OnlyAdminsPost, settings.OnlyAdminsAddMembers)
+
+	err := row.Scan(
+		&chat.UUID,
+		&chat.Type,
+		&chat.Name,
+		&chat.Description,
+		&chat.Avatar,
+		&chat.Settings.OnlyAdminsPost,
+		&chat.Settings.OnlyAdminsAddMembers,
+		&chat.CreatedAt,
+		&chat.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%s: %w", op, storage.ErrChatNotFound)
+		}
+
+		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	return chats[:len(chats)-1], rcursor, nil
+	return &chat, nil
 }
@@ -11,4 +11,6 @@ var (
 	ErrFailedToCreateChat     = errors.New("failed to create new chat")
 	ErrFailedToAddUsersInChat = errors.New("failed to add users in chat")
 	ErrChatsNotFound          = errors.New("chats not found")
+	ErrMemberNotFound         = errors.New("member not found")
+	ErrChatNotFound           = errors.New("chat not found")
 )
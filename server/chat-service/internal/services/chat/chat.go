@@ -5,62 +5,153 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"slices"
+	"strings"
 
 	"github.com/google/uuid"
 	"github.com/sergey-frey/cchat/server/chat-service/internal/domain/models"
 	"github.com/sergey-frey/cchat/server/chat-service/internal/lib/logger/sl"
+	"github.com/sergey-frey/cchat/server/chat-service/internal/provider/api/userapi"
 	"github.com/sergey-frey/cchat/server/chat-service/internal/provider/storage"
 )
 
 type ChatProvider interface {
-	NewChat(ctx context.Context, chatName string,users []uuid.UUID) (chatID uuid.UUID, err error)
+	NewChat(ctx context.Context, chatType string, chatName string, owner uuid.UUID, users []uuid.UUID) (chatID uuid.UUID, err error)
+	DirectChat(ctx context.Context, first uuid.UUID, second uuid.UUID) (chatID uuid.UUID, created bool, err error)
 	ListChats(ctx context.Context, idUser uuid.UUID, cursor int64, limit int) (chats []models.Chat, cursors *models.Cursor, err error)
+	RemoveUserChats(ctx context.Context, idUser uuid.UUID) (removed int64, err error)
+	UserChats(ctx context.Context, idUser uuid.UUID) (memberships []models.Membership, err error)
+	ChatRole(ctx context.Context, chatID uuid.UUID, idUser uuid.UUID) (role *models.ChatRole, err error)
+	Members(ctx context.Context, chatID uuid.UUID) (members []models.Member, err error)
+	AddMembers(ctx context.Context, chatID uuid.UUID, invitedBy uuid.UUID, users []uuid.UUID) (added []uuid.UUID, err error)
+	RemoveMember(ctx context.Context, chatID uuid.UUID, idUser uuid.UUID) (err error)
+	SetMemberRole(ctx context.Context, chatID uuid.UUID, idUser uuid.UUID, role string) (err error)
+	TransferOwnership(ctx context.Context, chatID uuid.UUID, from uuid.UUID, to uuid.UUID) (err error)
+	UpdateChat(ctx context.Context, chatID uuid.UUID, update models.UpdateChat) (chat *models.ChatDetails, err error)
 }
 
 type UserProvider interface {
 	CheckUser(ctx context.Context, ids []uuid.UUID) (error)
+	ChatDenied(ctx context.Context, initiator uuid.UUID, users []uuid.UUID) (denied []uuid.UUID, err error)
+	Users(ctx context.Context, viewer uuid.UUID, ids []uuid.UUID) (users []models.UserInfo, err error)
+}
+
+// Announcer posts changes of a chat to its history, see
+// messageapi.
+type Announcer interface {
+	PostEvent(ctx context.Context, chatID uuid.UUID, event models.ChatEvent) error
 }
 
 type ChatService struct {
 	chatProvider      ChatProvider
 	userProvider	 	UserProvider
+	announcer        Announcer
 	log              *slog.Logger
 }
 
-func New(chatProvider ChatProvider, userProvider UserProvider, log *slog.Logger) *ChatService {
+func New(chatProvider ChatProvider, userProvider UserProvider, announcer Announcer, log *slog.Logger) *ChatService {
 	return &ChatService{
 		chatProvider:      chatProvider,
 		userProvider:    userProvider,
+		announcer:        announcer,
 		log:              log,
 	}
 }
 
 var (
 	ErrChatsNotFound = errors.New("chats not found")
+	ErrChatNotAllowed = errors.New("users do not accept a chat from the initiator")
+	ErrUsersNotFound = errors.New("users not found")
+	ErrInvalidDirectChat = errors.New("a direct chat takes exactly one other user")
+	ErrChatNotFound = errors.New("chat not found")
+	ErrMemberNotFound = errors.New("member not found")
+	ErrDirectChat = errors.New("a direct chat can not be managed")
+	ErrNotAllowed = errors.New("not allowed by the role in the chat")
+	ErrOwnerMustTransfer = errors.New("the owner has to transfer the chat before leaving")
+	ErrNothingToUpdate = errors.New("nothing to update")
+	ErrInvalidChatName = errors.New("chat name is empty")
 )
 
-func (cs *ChatService) NewChat(ctx context.Context, chatName string, users []uuid.UUID) (chatID uuid.UUID, err error) {
+// NewChat creates a chat of the initiator and the users. Every user has
+// to accept chats from the initiator by their privacy settings. A direct
+// chat the two users already share is returned instead of a new one,
+// created tells which happened.
+func (cs *ChatService) NewChat(ctx context.Context, initiator uuid.UUID, newChat models.NewChat) (chatID uuid.UUID, created bool, err error) {
 	const op = "services.chat.NewChat"
 
 	log := cs.log.With(
 		slog.String("op", op),
+		slog.String("initiator", initiator.String()),
 	)
 
+	users := make([]uuid.UUID, 0, len(newChat.Users))
+	for _, user := range newChat.Users {
+		if user != initiator && !slices.Contains(users, user) {
+			users = append(users, user)
+		}
+	}
+
+	chatType := newChat.Type
+	if chatType == "" {
+		chatType = models.ChatGroup
+		if len(users) == 1 {
+			chatType = models.ChatDirect
+		}
+	}
+
+	if chatType == models.ChatDirect && len(users) != 1 {
+		log.Warn("direct chat with a wrong number of users", slog.Int("users", len(users)))
+
+		return uuid.Nil, false, fmt.Errorf("%s: %w", op, ErrInvalidDirectChat)
+	}
+
 	log.Info("checking users")
 
 	err = cs.userProvider.CheckUser(ctx, users)
 	if err != nil {
-		return uuid.Nil, fmt.Errorf("%s: %w", op, err)
+		if errors.Is(err, userapi.ErrUserNotFound) {
+			return uuid.Nil, false, fmt.Errorf("%s: %w", op, ErrUsersNotFound)
+		}
+
+		log.Error("failed to check users", sl.Err(err))
+
+		return uuid.Nil, false, fmt.Errorf("%s: %w", op, err)
 	}
 
-	log.Info("creating chat")
+	denied, err := cs.userProvider.ChatDenied(ctx, initiator, users)
+	if err != nil {
+		log.Error("failed to check privacy settings", sl.Err(err))
 
-	chatID, err = cs.chatProvider.NewChat(ctx, chatName,users)
+		return uuid.Nil, false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if len(denied) > 0 {
+		log.Warn("chat refused by privacy settings", slog.Int("denied", len(denied)))
+
+		return uuid.Nil, false, fmt.Errorf("%s: %w", op, ErrChatNotAllowed)
+	}
+
+	if chatType == models.ChatDirect {
+		chatID, created, err = cs.chatProvider.DirectChat(ctx, initiator, users[0])
+		if err != nil {
+			log.Error("failed to get direct chat", sl.Err(err))
+
+			return uuid.Nil, false, fmt.Errorf("%s: %w", op, err)
+		}
+
+		return chatID, created, nil
+	}
+
+	log.Info("creating chat", slog.String("type", chatType))
+
+	chatID, err = cs.chatProvider.NewChat(ctx, chatType, newChat.ChatName, initiator, users)
 	if err != nil {
-		return uuid.Nil, fmt.Errorf("%s: %w", op, err)
+		log.Error("failed to create chat", sl.Err(err))
+
+		return uuid.Nil, false, fmt.Errorf("%s: %w", op, err)
 	}
 
-	return chatID, nil
+	return chatID, true, nil
 }
 
 func (cs *ChatService) ListChats(ctx context.Context, idUser uuid.UUID, cursor int64, limit int) (chats []models.Chat, cursors *models.Cursor, err error) {
@@ -87,5 +178,194 @@ func (cs *ChatService) ListChats(ctx context.Context, idUser uuid.UUID, cursor i
 
 	log.Info("got chats")
 
+	cs.hydrateMembers(ctx, idUser, chats)
+	nameDirectChats(idUser, chats)
+
 	return chats, rcursor, nil
 }
+
+// hydrateMembers replaces the members of the chats with their current
+// profiles, looked up in one request. If user-service is unavailable the
+// chats keep what was stored with them.
+func (cs *ChatService) hydrateMembers(ctx context.Context, viewer uuid.UUID, chats []models.Chat) {
+	const op = "services.chat.hydrateMembers"
+
+	seen := make(map[uuid.UUID]struct{})
+	ids := make([]uuid.UUID, 0)
+
+	for _, chat := range chats {
+		for _, member := range chat.Users {
+			if _, ok := seen[member.UUID]; !ok {
+				seen[member.UUID] = struct{}{}
+				ids = append(ids, member.UUID)
+			}
+		}
+	}
+
+	if len(ids) == 0 {
+		return
+	}
+
+	users, err := cs.userProvider.Users(ctx, viewer, ids)
+	if err != nil {
+		cs.log.Warn("failed to look up members", slog.String("op", op), sl.Err(err))
+
+		return
+	}
+
+	profiles := make(map[uuid.UUID]models.UserInfo, len(users))
+	for _, user := range users {
+		profiles[user.UUID] = user
+	}
+
+	for i := range chats {
+		for j, member := range chats[i].Users {
+			if profile, ok := profiles[member.UUID]; ok {
+				chats[i].Users[j] = profile
+			}
+		}
+	}
+}
+
+// nameDirectChats names and pictures every direct chat after the member
+// that is not the viewer.
+func nameDirectChats(viewer uuid.UUID, chats []models.Chat) {
+	for i := range chats {
+		if chats[i].Type != models.ChatDirect {
+			continue
+		}
+
+		for _, member := range chats[i].Users {
+			if member.UUID == viewer {
+				continue
+			}
+
+			chats[i].Name = member.Name
+			if chats[i].Name == "" {
+				chats[i].Name = member.Username
+			}
+
+			chats[i].Avatar = member.Avatar
+		}
+	}
+}
+
+// EraseUser is the part of an account deletion that happens here.
+func (cs *ChatService) EraseUser(ctx context.Context, idUser uuid.UUID) error {
+	const op = "services.chat.EraseUser"
+
+	log := cs.log.With(
+		slog.String("op", op),
+		slog.String("user_id", idUser.String()),
+	)
+
+	removed, err := cs.chatProvider.RemoveUserChats(ctx, idUser)
+	if err != nil {
+		log.Error("failed to remove memberships", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("memberships removed", slog.Int64("count", removed))
+
+	return nil
+}
+
+// ExportUser lists the chats of the user for their data export.
+func (cs *ChatService) ExportUser(ctx context.Context, idUser uuid.UUID) ([]models.Membership, error) {
+	const op = "services.chat.ExportUser"
+
+	memberships, err := cs.chatProvider.UserChats(ctx, idUser)
+	if err != nil {
+		cs.log.Error("failed to list memberships", slog.String("op", op), slog.String("user_id", idUser.String()), sl.Err(err))
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return memberships, nil
+}
+
+// UpdateChat edits a group or a channel. Admins change its name,
+// description and avatar, the settings are left to the owner. Members
+// learn about the change from a system message listing what changed.
+func (cs *ChatService) UpdateChat(ctx context.Context, actor uuid.UUID, chatID uuid.UUID, update models.UpdateChat) (*models.ChatDetails, error) {
+	const op = "services.chat.UpdateChat"
+
+	log := cs.log.With(
+		slog.String("op", op),
+		slog.String("actor", actor.String()),
+		slog.String("chat_id", chatID.String()),
+	)
+
+	if update.Name != nil {
+		name := strings.TrimSpace(*update.Name)
+		if name == "" {
+			return nil, fmt.Errorf("%s: %w", op, ErrInvalidChatName)
+		}
+
+		update.Name = &name
+	}
+
+	fields := updatedFields(update)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("%s: %w", op, ErrNothingToUpdate)
+	}
+
+	role, err := cs.role(ctx, op, chatID, actor)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := manageable(role); err != nil {
+		log.Warn("chat update refused", sl.Err(err))
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if slices.Contains(fields, "settings") && role.Role != models.MemberOwner {
+		log.Warn("settings update refused", slog.String("role", role.Role))
+
+		return nil, fmt.Errorf("%s: %w", op, ErrNotAllowed)
+	}
+
+	chat, err := cs.chatProvider.UpdateChat(ctx, chatID, update)
+	if err != nil {
+		if errors.Is(err, storage.ErrChatNotFound) {
+			return nil, fmt.Errorf("%s: %w", op, ErrChatNotFound)
+		}
+
+		log.Error("failed to update chat", sl.Err(err))
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("chat updated", slog.Any("fields", fields))
+
+	cs.announce(ctx, chatID, models.ChatEvent{Event: models.EventChatUpdated, Actor: actor, Fields: fields})
+
+	return chat, nil
+}
+
+// updatedFields names the parts of the chat the update changes, as they
+// go into the system message.
+func updatedFields(update models.UpdateChat) []string {
+	var fields []string
+
+	if update.Name != nil {
+		fields = append(fields, "name")
+	}
+
+	if update.Description != nil {
+		fields = append(fields, "description")
+	}
+
+	if update.Avatar != nil {
+		fields = append(fields, "avatar")
+	}
+
+	if settings := update.Settings; settings != nil && (settings.OnlyAdminsPost != nil || settings.OnlyAdminsAddMembers != nil) {
+		fields = append(fields, "settings")
+	}
+
+	return fields
+}
@@ -0,0 +1,262 @@
+package chat
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/sergey-frey/cchat/server/chat-service/internal/domain/models"
+	"github.com/sergey-frey/cchat/server/chat-service/internal/lib/logger/slogdiscard"
+	"github.com/sergey-frey/cchat/server/chat-service/internal/provider/storage"
+)
+
+type chat struct {
+	chatType string
+	settings models.ChatSettings
+	roles    map[uuid.UUID]string
+}
+
+// store keeps the chats in memory. A direct chat is found by its pair of
+// users whichever of the two asks, as the unique index does it.
+type store struct {
+	ChatProvider
+	chats  map[uuid.UUID]*chat
+	direct map[[2]uuid.UUID]uuid.UUID
+}
+
+func newStore() *store {
+	return &store{
+		chats:  make(map[uuid.UUID]*chat),
+		direct: make(map[[2]uuid.UUID]uuid.UUID),
+	}
+}
+
+func (s *store) NewChat(ctx context.Context, chatType string, chatName string, owner uuid.UUID, users []uuid.UUID) (uuid.UUID, error) {
+	chatID := uuid.New()
+
+	roles := map[uuid.UUID]string{owner: models.MemberOwner}
+	for _, user := range users {
+		roles[user] = models.MemberMember
+	}
+
+	s.chats[chatID] = &chat{chatType: chatType, roles: roles}
+
+	return chatID, nil
+}
+
+func (s *store) DirectChat(ctx context.Context, first uuid.UUID, second uuid.UUID) (uuid.UUID, bool, error) {
+	pair := [2]uuid.UUID{first, second}
+	if bytes.Compare(first[:], second[:]) > 0 {
+		pair = [2]uuid.UUID{second, first}
+	}
+
+	if chatID, ok := s.direct[pair]; ok {
+		return chatID, false, nil
+	}
+
+	chatID := uuid.New()
+
+	s.direct[pair] = chatID
+	s.chats[chatID] = &chat{
+		chatType: models.ChatDirect,
+		roles:    map[uuid.UUID]string{first: models.MemberMember, second: models.MemberMember},
+	}
+
+	return chatID, true, nil
+}
+
+func (s *store) ChatRole(ctx context.Context, chatID uuid.UUID, idUser uuid.UUID) (*models.ChatRole, error) {
+	chat, ok := s.chats[chatID]
+	if !ok {
+		return nil, storage.ErrMemberNotFound
+	}
+
+	role, ok := chat.roles[idUser]
+	if !ok {
+		return nil, storage.ErrMemberNotFound
+	}
+
+	return &models.ChatRole{ChatType: chat.chatType, Role: role, Settings: chat.settings}, nil
+}
+
+func (s *store) UpdateChat(ctx context.Context, chatID uuid.UUID, update models.UpdateChat) (*models.ChatDetails, error) {
+	chat := s.chats[chatID]
+
+	if settings := update.Settings; settings != nil {
+		if settings.OnlyAdminsPost != nil {
+			chat.settings.OnlyAdminsPost = *settings.OnlyAdminsPost
+		}
+
+		if settings.OnlyAdminsAddMembers != nil {
+			chat.settings.OnlyAdminsAddMembers = *settings.OnlyAdminsAddMembers
+		}
+	}
+
+	return &models.ChatDetails{UUID: chatID, Type: chat.chatType, Settings: chat.settings}, nil
+}
+
+type users struct{}
+
+func (users) CheckUser(ctx context.Context, ids []uuid.UUID) error {
+	return nil
+}
+
+func (users) ChatDenied(ctx context.Context, initiator uuid.UUID, users []uuid.UUID) ([]uuid.UUID, error) {
+	return nil, nil
+}
+
+func (users) Users(ctx context.Context, viewer uuid.UUID, ids []uuid.UUID) ([]models.UserInfo, error) {
+	return nil, nil
+}
+
+// announcer records the events posted to the chat histories.
+type announcer struct {
+	events []string
+}
+
+func (a *announcer) PostEvent(ctx context.Context, chatID uuid.UUID, event models.ChatEvent) error {
+	a.events = append(a.events, event.Event)
+
+	return nil
+}
+
+func newChatService() (*ChatService, *store, *announcer) {
+	st := newStore()
+	events := &announcer{}
+
+	return New(st, users{}, events, slogdiscard.NewDiscardLogger()), st, events
+}
+
+func TestNewChat_DirectChatPerPair(t *testing.T) {
+	ctx := context.Background()
+
+	cs, st, _ := newChatService()
+
+	alice, bob := uuid.New(), uuid.New()
+
+	first, created, err := cs.NewChat(ctx, alice, models.NewChat{Users: []uuid.UUID{bob}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !created || st.chats[first].chatType != models.ChatDirect {
+		t.Fatal("expected a chat with one other user to be a new direct chat")
+	}
+
+	// The pair shares one chat, whoever starts it and however it is asked.
+	again := []struct {
+		initiator uuid.UUID
+		newChat   models.NewChat
+	}{
+		{alice, models.NewChat{Users: []uuid.UUID{bob}}},
+		{bob, models.NewChat{Users: []uuid.UUID{alice}}},
+		{bob, models.NewChat{Type: models.ChatDirect, Users: []uuid.UUID{alice, bob, alice}}},
+	}
+
+	for _, tt := range again {
+		chatID, created, err := cs.NewChat(ctx, tt.initiator, tt.newChat)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if created || chatID != first {
+			t.Fatalf("expected the existing direct chat %s, got %s (created %v)", first, chatID, created)
+		}
+	}
+
+	if len(st.chats) != 1 {
+		t.Fatalf("expected one chat, got %d", len(st.chats))
+	}
+
+	// A group of the same two users is a chat of its own.
+	group, created, err := cs.NewChat(ctx, alice, models.NewChat{Type: models.ChatGroup, Users: []uuid.UUID{bob}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !created || group == first {
+		t.Fatal("expected the group to be created next to the direct chat")
+	}
+}
+
+func TestNewChat_DirectChatTakesOneUser(t *testing.T) {
+	ctx := context.Background()
+
+	cs, st, _ := newChatService()
+
+	alice := uuid.New()
+
+	for _, others := range [][]uuid.UUID{{}, {alice}, {uuid.New(), uuid.New()}} {
+		_, _, err := cs.NewChat(ctx, alice, models.NewChat{Type: models.ChatDirect, Users: others})
+		if !errors.Is(err, ErrInvalidDirectChat) {
+			t.Fatalf("expected a direct chat with %d others to be refused, got %v", len(others), err)
+		}
+	}
+
+	if len(st.chats) != 0 {
+		t.Fatalf("expected no chat, got %d", len(st.chats))
+	}
+}
+
+func TestUpdateChat_SettingsAreTheOwners(t *testing.T) {
+	ctx := context.Background()
+
+	cs, st, events := newChatService()
+
+	owner, admin, member := uuid.New(), uuid.New(), uuid.New()
+	chatID := uuid.New()
+
+	st.chats[chatID] = &chat{
+		chatType: models.ChatChannel,
+		settings: models.ChatSettings{OnlyAdminsPost: true},
+		roles: map[uuid.UUID]string{
+			owner:  models.MemberOwner,
+			admin:  models.MemberAdmin,
+			member: models.MemberMember,
+		},
+	}
+
+	name := "Announcements"
+	open := false
+	everyonePosts := models.UpdateChat{Settings: &models.UpdateSettings{OnlyAdminsPost: &open}}
+
+	if _, err := cs.UpdateChat(ctx, member, chatID, models.UpdateChat{Name: &name}); !errors.Is(err, ErrNotAllowed) {
+		t.Fatalf("expected a member not to edit the chat, got %v", err)
+	}
+
+	if _, err := cs.UpdateChat(ctx, admin, chatID, models.UpdateChat{Name: &name}); err != nil {
+		t.Fatalf("expected an admin to rename the chat, got %v", err)
+	}
+
+	for _, actor := range []uuid.UUID{member, admin} {
+		if _, err := cs.UpdateChat(ctx, actor, chatID, everyonePosts); !errors.Is(err, ErrNotAllowed) {
+			t.Fatalf("expected a %s not to change the settings, got %v", st.chats[chatID].roles[actor], err)
+		}
+	}
+
+	// A rename together with the settings is refused as a whole.
+	if _, err := cs.UpdateChat(ctx, admin, chatID, models.UpdateChat{Name: &name, Settings: everyonePosts.Settings}); !errors.Is(err, ErrNotAllowed) {
+		t.Fatalf("expected an admin not to change the settings, got %v", err)
+	}
+
+	if !st.chats[chatID].settings.OnlyAdminsPost {
+		t.Fatal("expected the refused updates to keep the settings")
+	}
+
+	chat, err := cs.UpdateChat(ctx, owner, chatID, everyonePosts)
+	if err != nil {
+		t.Fatalf("expected the owner to change the settings, got %v", err)
+	}
+
+	if chat.Settings.OnlyAdminsPost {
+		t.Fatal("expected everyone to post after the update")
+	}
+
+	want := []string{models.EventChatUpdated, models.EventChatUpdated}
+	if !slices.Equal(events.events, want) {
+		t.Fatalf("expected events %v, got %v", want, events.events)
+	}
+}
@@ -0,0 +1,448 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+
+	"github.com/google/uuid"
+	"github.com/sergey-frey/cchat/server/chat-service/internal/domain/models"
+	"github.com/sergey-frey/cchat/server/chat-service/internal/lib/logger/sl"
+	"github.com/sergey-frey/cchat/server/chat-service/internal/provider/api/userapi"
+	"github.com/sergey-frey/cchat/server/chat-service/internal/provider/storage"
+)
+
+// Members lists the members of a chat the viewer belongs to.
+func (cs *ChatService) Members(ctx context.Context, viewer uuid.UUID, chatID uuid.UUID) ([]models.Member, error) {
+	const op = "services.chat.Members"
+
+	if _, err := cs.role(ctx, op, chatID, viewer); err != nil {
+		return nil, err
+	}
+
+	members, err := cs.chatProvider.Members(ctx, chatID)
+	if err != nil {
+		cs.log.Error("failed to list members", slog.String("op", op), slog.String("chat_id", chatID.String()), sl.Err(err))
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return members, nil
+}
+
+// Sender tells message-service what the member may do in the chat. A
+// user outside the chat is not found.
+func (cs *ChatService) Sender(ctx context.Context, chatID uuid.UUID, idUser uuid.UUID) (*models.Sender, error) {
+	const op = "services.chat.Sender"
+
+	role, err := cs.role(ctx, op, chatID, idUser)
+	if err != nil {
+		return nil, err
+	}
+
+	sender := &models.Sender{
+		ChatType: role.ChatType,
+		Role:     role.Role,
+		Settings: role.Settings,
+	}
+
+	if role.ChatType != models.ChatDirect {
+		return sender, nil
+	}
+
+	members, err := cs.chatProvider.Members(ctx, chatID)
+	if err != nil {
+		cs.log.Error("failed to list members", slog.String("op", op), slog.String("chat_id", chatID.String()), sl.Err(err))
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	for _, member := range members {
+		if member.UserID != idUser {
+			sender.Peer = &member.UserID
+		}
+	}
+
+	return sender, nil
+}
+
+// AddMembers adds the users to a group or a channel. It takes an admin
+// unless the chat lets its members invite too. Like a new chat, it needs
+// every user to accept chats from the actor. Users already in the chat
+// are skipped, the added ones are returned.
+func (cs *ChatService) AddMembers(ctx context.Context, actor uuid.UUID, chatID uuid.UUID, users []uuid.UUID) ([]uuid.UUID, error) {
+	const op = "services.chat.AddMembers"
+
+	log := cs.log.With(
+		slog.String("op", op),
+		slog.String("actor", actor.String()),
+		slog.String("chat_id", chatID.String()),
+	)
+
+	role, err := cs.role(ctx, op, chatID, actor)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := canAddMembers(role); err != nil {
+		log.Warn("adding members refused", sl.Err(err))
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	invited := make([]uuid.UUID, 0, len(users))
+	for _, user := range users {
+		if user != actor && !slices.Contains(invited, user) {
+			invited = append(invited, user)
+		}
+	}
+
+	if len(invited) == 0 {
+		return []uuid.UUID{}, nil
+	}
+
+	err = cs.userProvider.CheckUser(ctx, invited)
+	if err != nil {
+		if errors.Is(err, userapi.ErrUserNotFound) {
+			return nil, fmt.Errorf("%s: %w", op, ErrUsersNotFound)
+		}
+
+		log.Error("failed to check users", sl.Err(err))
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	denied, err := cs.userProvider.ChatDenied(ctx, actor, invited)
+	if err != nil {
+		log.Error("failed to check privacy settings", sl.Err(err))
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if len(denied) > 0 {
+		log.Warn("members refused by privacy settings", slog.Int("denied", len(denied)))
+
+		return nil, fmt.Errorf("%s: %w", op, ErrChatNotAllowed)
+	}
+
+	added, err := cs.chatProvider.AddMembers(ctx, chatID, actor, invited)
+	if err != nil {
+		log.Error("failed to add members", sl.Err(err))
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("members added", slog.Int("count", len(added)))
+
+	for _, user := range added {
+		cs.announce(ctx, chatID, models.ChatEvent{Event: models.EventMemberAdded, Actor: actor, Target: user})
+	}
+
+	return added, nil
+}
+
+// RemoveMember removes the target from the chat. Admins remove members,
+// the owner removes anyone. Removing oneself is leaving.
+func (cs *ChatService) RemoveMember(ctx context.Context, actor uuid.UUID, chatID uuid.UUID, target uuid.UUID) error {
+	const op = "services.chat.RemoveMember"
+
+	if actor == target {
+		return cs.Leave(ctx, actor, chatID)
+	}
+
+	log := cs.log.With(
+		slog.String("op", op),
+		slog.String("actor", actor.String()),
+		slog.String("chat_id", chatID.String()),
+		slog.String("target", target.String()),
+	)
+
+	role, err := cs.role(ctx, op, chatID, actor)
+	if err != nil {
+		return err
+	}
+
+	if err := manageable(role); err != nil {
+		log.Warn("removing member refused", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	targetRole, err := cs.memberRole(ctx, op, chatID, target)
+	if err != nil {
+		return err
+	}
+
+	if !outranks(role.Role, targetRole.Role) {
+		log.Warn("removing member refused", slog.String("role", role.Role), slog.String("target_role", targetRole.Role))
+
+		return fmt.Errorf("%s: %w", op, ErrNotAllowed)
+	}
+
+	err = cs.chatProvider.RemoveMember(ctx, chatID, target)
+	if err != nil {
+		if errors.Is(err, storage.ErrMemberNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrMemberNotFound)
+		}
+
+		log.Error("failed to remove member", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("member removed")
+
+	cs.announce(ctx, chatID, models.ChatEvent{Event: models.EventMemberRemoved, Actor: actor, Target: target})
+
+	return nil
+}
+
+// Leave takes the user out of a group or a channel. The owner hands the
+// chat over first, unless nobody else is left in it.
+func (cs *ChatService) Leave(ctx context.Context, idUser uuid.UUID, chatID uuid.UUID) error {
+	const op = "services.chat.Leave"
+
+	log := cs.log.With(
+		slog.String("op", op),
+		slog.String("user_id", idUser.String()),
+		slog.String("chat_id", chatID.String()),
+	)
+
+	role, err := cs.role(ctx, op, chatID, idUser)
+	if err != nil {
+		return err
+	}
+
+	if role.ChatType == models.ChatDirect {
+		return fmt.Errorf("%s: %w", op, ErrDirectChat)
+	}
+
+	if role.Role == models.MemberOwner {
+		members, err := cs.chatProvider.Members(ctx, chatID)
+		if err != nil {
+			log.Error("failed to list members", sl.Err(err))
+
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		if len(members) > 1 {
+			log.Warn("owner tried to leave without a transfer")
+
+			return fmt.Errorf("%s: %w", op, ErrOwnerMustTransfer)
+		}
+	}
+
+	err = cs.chatProvider.RemoveMember(ctx, chatID, idUser)
+	if err != nil {
+		if errors.Is(err, storage.ErrMemberNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrChatNotFound)
+		}
+
+		log.Error("failed to leave chat", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("left chat")
+
+	cs.announce(ctx, chatID, models.ChatEvent{Event: models.EventMemberLeft, Actor: idUser})
+
+	return nil
+}
+
+// TransferOwnership hands the chat over to another member, the owner
+// stays on as an admin.
+func (cs *ChatService) TransferOwnership(ctx context.Context, actor uuid.UUID, chatID uuid.UUID, target uuid.UUID) error {
+	const op = "services.chat.TransferOwnership"
+
+	log := cs.log.With(
+		slog.String("op", op),
+		slog.String("actor", actor.String()),
+		slog.String("chat_id", chatID.String()),
+		slog.String("target", target.String()),
+	)
+
+	role, err := cs.ownerRole(ctx, op, chatID, actor)
+	if err != nil {
+		return err
+	}
+
+	if actor == target {
+		return nil
+	}
+
+	if _, err := cs.memberRole(ctx, op, chatID, target); err != nil {
+		return err
+	}
+
+	err = cs.chatProvider.TransferOwnership(ctx, chatID, actor, target)
+	if err != nil {
+		if errors.Is(err, storage.ErrMemberNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrMemberNotFound)
+		}
+
+		log.Error("failed to transfer ownership", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("ownership transferred", slog.String("chat_type", role.ChatType))
+
+	cs.announce(ctx, chatID, models.ChatEvent{Event: models.EventOwnershipTransferred, Actor: actor, Target: target})
+
+	return nil
+}
+
+// Promote makes a member an admin, only the owner can.
+func (cs *ChatService) Promote(ctx context.Context, actor uuid.UUID, chatID uuid.UUID, target uuid.UUID) error {
+	return cs.setAdmin(ctx, "services.chat.Promote", actor, chatID, target, models.MemberAdmin, models.EventAdminPromoted)
+}
+
+// Demote makes an admin a member again, only the owner can.
+func (cs *ChatService) Demote(ctx context.Context, actor uuid.UUID, chatID uuid.UUID, target uuid.UUID) error {
+	return cs.setAdmin(ctx, "services.chat.Demote", actor, chatID, target, models.MemberMember, models.EventAdminDemoted)
+}
+
+func (cs *ChatService) setAdmin(ctx context.Context, op string, actor uuid.UUID, chatID uuid.UUID, target uuid.UUID, newRole string, event string) error {
+	log := cs.log.With(
+		slog.String("op", op),
+		slog.String("actor", actor.String()),
+		slog.String("chat_id", chatID.String()),
+		slog.String("target", target.String()),
+	)
+
+	if _, err := cs.ownerRole(ctx, op, chatID, actor); err != nil {
+		return err
+	}
+
+	targetRole, err := cs.memberRole(ctx, op, chatID, target)
+	if err != nil {
+		return err
+	}
+
+	if targetRole.Role == models.MemberOwner {
+		return fmt.Errorf("%s: %w", op, ErrNotAllowed)
+	}
+
+	// Nothing changes, and nothing goes into the history.
+	if targetRole.Role == newRole {
+		return nil
+	}
+
+	err = cs.chatProvider.SetMemberRole(ctx, chatID, target, newRole)
+	if err != nil {
+		if errors.Is(err, storage.ErrMemberNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrMemberNotFound)
+		}
+
+		log.Error("failed to change role", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("role changed", slog.String("role", newRole))
+
+	cs.announce(ctx, chatID, models.ChatEvent{Event: event, Actor: actor, Target: target})
+
+	return nil
+}
+
+// role returns the role of a user acting in the chat. A chat the user is
+// not in is not found, so its existence is not given away.
+func (cs *ChatService) role(ctx context.Context, op string, chatID uuid.UUID, idUser uuid.UUID) (*models.ChatRole, error) {
+	role, err := cs.chatProvider.ChatRole(ctx, chatID, idUser)
+	if err != nil {
+		if errors.Is(err, storage.ErrMemberNotFound) {
+			return nil, fmt.Errorf("%s: %w", op, ErrChatNotFound)
+		}
+
+		cs.log.Error("failed to get role", slog.String("op", op), sl.Err(err))
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return role, nil
+}
+
+// memberRole returns the role of the user an action is aimed at.
+func (cs *ChatService) memberRole(ctx context.Context, op string, chatID uuid.UUID, idUser uuid.UUID) (*models.ChatRole, error) {
+	role, err := cs.chatProvider.ChatRole(ctx, chatID, idUser)
+	if err != nil {
+		if errors.Is(err, storage.ErrMemberNotFound) {
+			return nil, fmt.Errorf("%s: %w", op, ErrMemberNotFound)
+		}
+
+		cs.log.Error("failed to get role", slog.String("op", op), sl.Err(err))
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return role, nil
+}
+
+func (cs *ChatService) ownerRole(ctx context.Context, op string, chatID uuid.UUID, idUser uuid.UUID) (*models.ChatRole, error) {
+	role, err := cs.role(ctx, op, chatID, idUser)
+	if err != nil {
+		return nil, err
+	}
+
+	if role.ChatType == models.ChatDirect {
+		return nil, fmt.Errorf("%s: %w", op, ErrDirectChat)
+	}
+
+	if role.Role != models.MemberOwner {
+		return nil, fmt.Errorf("%s: %w", op, ErrNotAllowed)
+	}
+
+	return role, nil
+}
+
+// manageable tells whether the role lets its holder manage the members.
+func manageable(role *models.ChatRole) error {
+	if role.ChatType == models.ChatDirect {
+		return ErrDirectChat
+	}
+
+	if role.Role != models.MemberOwner && role.Role != models.MemberAdmin {
+		return ErrNotAllowed
+	}
+
+	return nil
+}
+
+// canAddMembers is manageable, loosened for chats whose settings let
+// every member invite.
+func canAddMembers(role *models.ChatRole) error {
+	if role.ChatType != models.ChatDirect && !role.Settings.OnlyAdminsAddMembers {
+		return nil
+	}
+
+	return manageable(role)
+}
+
+// outranks tells whether a member with the role may remove one with the
+// other: the owner removes anyone, admins remove members.
+func outranks(role string, other string) bool {
+	switch role {
+	case models.MemberOwner:
+		return other != models.MemberOwner
+	case models.MemberAdmin:
+		return other == models.MemberMember
+	default:
+		return false
+	}
+}
+
+// announce posts the change to the chat history. The change is made by
+// then, a history without it is better than failing the request.
+func (cs *ChatService) announce(ctx context.Context, chatID uuid.UUID, event models.ChatEvent) {
+	if err := cs.announcer.PostEvent(ctx, chatID, event); err != nil {
+		cs.log.Warn("failed to post system message",
+			slog.String("chat_id", chatID.String()),
+			slog.String("event", event.Event),
+			sl.Err(err),
+		)
+	}
+}
@@ -0,0 +1,157 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/sergey-frey/cchat/server/chat-service/internal/domain/models"
+	"github.com/sergey-frey/cchat/server/chat-service/internal/provider/storage"
+)
+
+func (s *store) Members(ctx context.Context, chatID uuid.UUID) ([]models.Member, error) {
+	members := make([]models.Member, 0)
+
+	for user, role := range s.chats[chatID].roles {
+		members = append(members, models.Member{UserID: user, Role: role})
+	}
+
+	return members, nil
+}
+
+func (s *store) RemoveMember(ctx context.Context, chatID uuid.UUID, idUser uuid.UUID) error {
+	chat := s.chats[chatID]
+	if _, ok := chat.roles[idUser]; !ok {
+		return storage.ErrMemberNotFound
+	}
+
+	delete(chat.roles, idUser)
+
+	return nil
+}
+
+func (s *store) TransferOwnership(ctx context.Context, chatID uuid.UUID, from uuid.UUID, to uuid.UUID) error {
+	chat := s.chats[chatID]
+	if chat.roles[from] != models.MemberOwner {
+		return storage.ErrMemberNotFound
+	}
+
+	if _, ok := chat.roles[to]; !ok {
+		return storage.ErrMemberNotFound
+	}
+
+	chat.roles[from] = models.MemberAdmin
+	chat.roles[to] = models.MemberOwner
+
+	return nil
+}
+
+// newGroup creates a group of an owner, two admins and a member.
+func newGroup(st *store) (chatID uuid.UUID, owner uuid.UUID, admins [2]uuid.UUID, member uuid.UUID) {
+	chatID, owner, member = uuid.New(), uuid.New(), uuid.New()
+	admins = [2]uuid.UUID{uuid.New(), uuid.New()}
+
+	st.chats[chatID] = &chat{
+		chatType: models.ChatGroup,
+		roles: map[uuid.UUID]string{
+			owner:     models.MemberOwner,
+			admins[0]: models.MemberAdmin,
+			admins[1]: models.MemberAdmin,
+			member:    models.MemberMember,
+		},
+	}
+
+	return chatID, owner, admins, member
+}
+
+func TestRemoveMember_AdminsRemoveOnlyMembers(t *testing.T) {
+	ctx := context.Background()
+
+	cs, st, events := newChatService()
+	chatID, owner, admins, member := newGroup(st)
+
+	for _, target := range []uuid.UUID{admins[1], owner} {
+		if err := cs.RemoveMember(ctx, admins[0], chatID, target); !errors.Is(err, ErrNotAllowed) {
+			t.Fatalf("expected an admin not to remove a %s, got %v", st.chats[chatID].roles[target], err)
+		}
+	}
+
+	if err := cs.RemoveMember(ctx, member, chatID, admins[0]); !errors.Is(err, ErrNotAllowed) {
+		t.Fatalf("expected a member not to remove anyone, got %v", err)
+	}
+
+	if len(st.chats[chatID].roles) != 4 || len(events.events) != 0 {
+		t.Fatal("expected the refused removals to change nothing")
+	}
+
+	if err := cs.RemoveMember(ctx, admins[0], chatID, member); err != nil {
+		t.Fatalf("expected an admin to remove a member, got %v", err)
+	}
+
+	if err := cs.RemoveMember(ctx, owner, chatID, admins[1]); err != nil {
+		t.Fatalf("expected the owner to remove an admin, got %v", err)
+	}
+
+	if _, ok := st.chats[chatID].roles[admins[1]]; ok {
+		t.Fatal("expected the admin to be removed")
+	}
+
+	want := []string{models.EventMemberRemoved, models.EventMemberRemoved}
+	if !slices.Equal(events.events, want) {
+		t.Fatalf("expected events %v, got %v", want, events.events)
+	}
+}
+
+func TestLeave_OwnerMustTransfer(t *testing.T) {
+	ctx := context.Background()
+
+	cs, st, events := newChatService()
+	chatID, owner, _, member := newGroup(st)
+
+	if err := cs.Leave(ctx, owner, chatID); !errors.Is(err, ErrOwnerMustTransfer) {
+		t.Fatalf("expected the owner to be held back, got %v", err)
+	}
+
+	// Removing oneself is leaving, it is held back the same way.
+	if err := cs.RemoveMember(ctx, owner, chatID, owner); !errors.Is(err, ErrOwnerMustTransfer) {
+		t.Fatalf("expected the owner to be held back, got %v", err)
+	}
+
+	if st.chats[chatID].roles[owner] != models.MemberOwner {
+		t.Fatal("expected the chat to keep its owner")
+	}
+
+	if err := cs.TransferOwnership(ctx, owner, chatID, member); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cs.Leave(ctx, owner, chatID); err != nil {
+		t.Fatalf("expected the former owner to leave, got %v", err)
+	}
+
+	if st.chats[chatID].roles[member] != models.MemberOwner {
+		t.Fatal("expected the member to own the chat")
+	}
+
+	want := []string{models.EventOwnershipTransferred, models.EventMemberLeft}
+	if !slices.Equal(events.events, want) {
+		t.Fatalf("expected events %v, got %v", want, events.events)
+	}
+}
+
+func TestLeave_LastOwnerLeaves(t *testing.T) {
+	ctx := context.Background()
+
+	cs, st, _ := newChatService()
+
+	owner := uuid.New()
+	chatID := uuid.New()
+
+	st.chats[chatID] = &chat{chatType: models.ChatChannel, roles: map[uuid.UUID]string{owner: models.MemberOwner}}
+
+	if err := cs.Leave(ctx, owner, chatID); err != nil {
+		t.Fatalf("expected the owner alone in the chat to leave, got %v", err)
+	}
+}
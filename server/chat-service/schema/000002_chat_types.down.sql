@@ -0,0 +1,12 @@
+DROP INDEX IF EXISTS idx_user_chats_user_id;
+
+DROP INDEX IF EXISTS chats_seq_key;
+
+DROP INDEX IF EXISTS chats_direct_pair_key;
+
+ALTER TABLE chats
+    DROP CONSTRAINT IF EXISTS chats_direct_pair_check,
+    DROP COLUMN IF EXISTS "direct_high",
+    DROP COLUMN IF EXISTS "direct_low",
+    DROP COLUMN IF EXISTS "seq",
+    DROP COLUMN IF EXISTS "type";
@@ -0,0 +1,24 @@
+-- Chats existing before types are treated as groups, even the ones with
+-- two members, so no pair ends up with two direct chats.
+ALTER TABLE chats
+    ADD COLUMN IF NOT EXISTS "type" TEXT NOT NULL DEFAULT 'group'
+        CHECK ("type" IN ('direct', 'group', 'channel')),
+    ADD COLUMN IF NOT EXISTS "seq" BIGSERIAL,
+    -- The members of a direct chat in a fixed order, the unique index
+    -- keeps a pair of users to one direct chat.
+    ADD COLUMN IF NOT EXISTS "direct_low" UUID,
+    ADD COLUMN IF NOT EXISTS "direct_high" UUID,
+    ADD CONSTRAINT chats_direct_pair_check CHECK (
+        ("type" = 'direct' AND "direct_low" < "direct_high")
+        OR ("type" <> 'direct' AND "direct_low" IS NULL AND "direct_high" IS NULL)
+    );
+
+CREATE UNIQUE INDEX IF NOT EXISTS
+    chats_direct_pair_key ON chats ("direct_low", "direct_high")
+    WHERE "type" = 'direct';
+
+CREATE UNIQUE INDEX IF NOT EXISTS
+    chats_seq_key ON chats ("seq");
+
+CREATE INDEX IF NOT EXISTS
+    idx_user_chats_user_id ON user_chats ("user_id");
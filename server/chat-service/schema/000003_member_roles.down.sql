@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS user_chats_owner_key;
+
+ALTER TABLE user_chats
+    DROP CONSTRAINT IF EXISTS user_chats_pkey,
+    DROP COLUMN IF EXISTS "invited_by",
+    DROP COLUMN IF EXISTS "joined_at",
+    DROP COLUMN IF EXISTS "role";
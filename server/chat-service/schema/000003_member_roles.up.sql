@@ -0,0 +1,32 @@
+-- A user is a member of a chat once.
+DELETE FROM user_chats a
+USING user_chats b
+WHERE a.ctid > b.ctid AND a.chat_id = b.chat_id AND a.user_id = b.user_id;
+
+ALTER TABLE user_chats
+    ADD COLUMN IF NOT EXISTS "role" TEXT NOT NULL DEFAULT 'member'
+        CHECK ("role" IN ('owner', 'admin', 'member')),
+    ADD COLUMN IF NOT EXISTS "joined_at" TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    ADD COLUMN IF NOT EXISTS "invited_by" UUID,
+    ADD PRIMARY KEY ("chat_id", "user_id");
+
+-- Who created the chats made before roles is not known, and neither is the
+-- order the members joined in: joined_at is the same for all of them. So
+-- every chat can still be managed, the member with the lowest id becomes
+-- the owner, a fixed rule that gives the same owner on every run. The
+-- others stay members, the owner can hand the chat over to any of them.
+UPDATE user_chats uc
+SET role = 'owner'
+FROM (
+    SELECT DISTINCT ON (m.chat_id) m.chat_id, m.user_id
+    FROM user_chats m
+    JOIN chats c ON c.chat_id = m.chat_id
+    WHERE c.type <> 'direct'
+    ORDER BY m.chat_id, m.joined_at, m.user_id
+) first
+WHERE uc.chat_id = first.chat_id AND uc.user_id = first.user_id;
+
+-- Only one owner per chat.
+CREATE UNIQUE INDEX IF NOT EXISTS
+    user_chats_owner_key ON user_chats ("chat_id")
+    WHERE "role" = 'owner';
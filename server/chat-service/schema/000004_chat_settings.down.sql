@@ -0,0 +1,5 @@
+ALTER TABLE chats
+    DROP COLUMN IF EXISTS "only_admins_add_members",
+    DROP COLUMN IF EXISTS "only_admins_post",
+    DROP COLUMN IF EXISTS "avatar",
+    DROP COLUMN IF EXISTS "description";
@@ -0,0 +1,10 @@
+ALTER TABLE chats
+    ADD COLUMN IF NOT EXISTS "description" TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS "avatar" TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS "only_admins_post" BOOLEAN NOT NULL DEFAULT FALSE,
+    -- Members were added by admins only before the setting existed.
+    ADD COLUMN IF NOT EXISTS "only_admins_add_members" BOOLEAN NOT NULL DEFAULT TRUE;
+
+UPDATE chats
+SET only_admins_post = TRUE
+WHERE "type" = 'channel';
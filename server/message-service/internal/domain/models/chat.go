@@ -1,5 +1,21 @@
 package models
 
+import "github.com/google/uuid"
+
+// Types of a chat, see chat-service.
+const (
+	ChatDirect  = "direct"
+	ChatGroup   = "group"
+	ChatChannel = "channel"
+)
+
+// Roles of a chat member, see chat-service.
+const (
+	MemberOwner  = "owner"
+	MemberAdmin  = "admin"
+	MemberMember = "member"
+)
+
 type NewChat struct {
 	Users []int64 `json:"users"`
 }
@@ -9,3 +25,19 @@ type Chat struct {
 	Users       []UserInfo
 	LastMessage *Message `json:"last_message"`
 }
+
+// ChatSettings say who may do what in a group or a channel besides the
+// owner and the admins.
+type ChatSettings struct {
+	OnlyAdminsPost       bool `json:"only_admins_post"`
+	OnlyAdminsAddMembers bool `json:"only_admins_add_members"`
+}
+
+// Sender is what chat-service tells about the author of a message: their
+// role, the settings of the chat and the other member of a direct chat.
+type Sender struct {
+	ChatType string       `json:"chat_type"`
+	Role     string       `json:"role"`
+	Settings ChatSettings `json:"settings"`
+	Peer     *uuid.UUID   `json:"peer,omitempty"`
+}
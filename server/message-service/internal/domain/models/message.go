@@ -1,6 +1,10 @@
 package models
 
-import "time"
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
 
 type Message struct {
 	ID          int64     `json:"message_id"`
@@ -10,3 +14,45 @@ type Message struct {
 	ChatID      int       `json:"chat_id"`
 	AuthorID    int       `json:"author_id"`
 }
+
+// AuthoredMessage is a message the user wrote, as it goes into their data
+// export.
+type AuthoredMessage struct {
+	ID        uuid.UUID `json:"id"`
+	ChatID    uuid.UUID `json:"chat_id"`
+	Type      string    `json:"type"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// MessageText is the type of the messages members write.
+const MessageText = "text"
+
+type SendMessage struct {
+	Content string `json:"content" validate:"required,max=4096" example:"Hello!"`
+}
+
+// MessageSystem is the type of the messages chat-service posts when a
+// chat or its members change. They have no author.
+const MessageSystem = "system"
+
+// Events a system message describes.
+const (
+	EventMemberAdded          = "member_added"
+	EventMemberRemoved        = "member_removed"
+	EventMemberLeft           = "member_left"
+	EventOwnershipTransferred = "ownership_transferred"
+	EventAdminPromoted        = "admin_promoted"
+	EventAdminDemoted         = "admin_demoted"
+	EventChatUpdated          = "chat_updated"
+)
+
+// SystemEvent is the content of a system message. It keeps the ids only,
+// clients show it with the current names, as in "X added Y". A chat
+// update names the fields it changed instead of a target.
+type SystemEvent struct {
+	Event  string    `json:"event" validate:"required,oneof=member_added member_removed member_left ownership_transferred admin_promoted admin_demoted chat_updated" example:"member_added"`
+	Actor  uuid.UUID `json:"actor" validate:"required"`
+	Target uuid.UUID `json:"target,omitempty"`
+	Fields []string  `json:"fields,omitempty" validate:"dive,oneof=name description avatar settings"`
+}
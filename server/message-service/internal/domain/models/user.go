@@ -1,10 +1,19 @@
 package models
 
+import "github.com/google/uuid"
+
+// Roles issued by auth-service.
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
 type User struct {
-	ID       int64  `json:"id"`
-	Username string `json:"username"`
-	Email    string `json:"email" validate:"required"`
-	PassHash []byte `json:"password" validate:"required"`
+	UUID     uuid.UUID `json:"id"`
+	Username string    `json:"username"`
+	Email    string    `json:"email" validate:"required"`
+	PassHash []byte    `json:"password" validate:"required"`
 }
 
 type RegisterUser struct {
@@ -18,10 +27,10 @@ type LoginUser struct {
 }
 
 type UserInfo struct {
-	ID       int64  `json:"id"`
-	Email    string `json:"email"`
-	Username string `json:"username"`
-	Name     string `json:"name"`
+	UUID     uuid.UUID `json:"id"`
+	Email    string    `json:"email"`
+	Username string    `json:"username"`
+	Name     string    `json:"name"`
 }
 
 type NewUserInfo struct {
@@ -33,14 +42,19 @@ type NewUserInfo struct {
 }
 
 type NormalizedUser struct {
-	ID       int64  `json:"id"`
-	Username string `json:"username"`
-	Email    string `json:"email"`
+	UUID          uuid.UUID `json:"id"`
+	Username      string    `json:"username"`
+	Email         string    `json:"email"`
+	EmailVerified bool      `json:"email_verified"`
+	Role          string    `json:"role"`
+	SessionID     uuid.UUID `json:"-"`
+	// Scopes limit a personal access token, empty means no limit.
+	Scopes []string `json:"-"`
 }
 
 func UserToNormalized(user *User) NormalizedUser {
 	return NormalizedUser{
-		ID:       user.ID,
+		UUID:     user.UUID,
 		Username: user.Username,
 		Email:    user.Email,
 	}
@@ -48,7 +62,7 @@ func UserToNormalized(user *User) NormalizedUser {
 
 func InfoToNormalized(info *UserInfo) NormalizedUser {
 	return NormalizedUser{
-		ID:       info.ID,
+		UUID:     info.UUID,
 		Username: info.Username,
 		Email:    info.Email,
 	}
@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"strconv"
 
+	"github.com/go-chi/chi"
 	"github.com/go-chi/chi/middleware"
 	"github.com/go-chi/render"
 	"github.com/google/uuid"
@@ -19,8 +20,11 @@ import (
 )
 
 type Message interface {
-	NewChat(ctx context.Context, users []int64) (chatID int64, err error)
-	ListChats(ctx context.Context, currUser int64, username string, cursor int64, limit int) (messages []models.Message, cursors *models.Cursor, err error)
+	Send(ctx context.Context, author uuid.UUID, chatID uuid.UUID, message models.SendMessage) (messageID uuid.UUID, err error)
+	ListChats(ctx context.Context, currUser uuid.UUID, username string, cursor int64, limit int) (messages []models.Message, cursors *models.Cursor, err error)
+	EraseUser(ctx context.Context, authorID uuid.UUID) (err error)
+	ExportUser(ctx context.Context, authorID uuid.UUID) (messages []models.AuthoredMessage, err error)
+	PostSystemMessage(ctx context.Context, chatID uuid.UUID, event models.SystemEvent) (messageID uuid.UUID, err error)
 }
 
 type MessageHandler struct {
@@ -41,50 +45,84 @@ type HistoryResponse struct {
 	RCursor  models.Cursor    `json:"r_cursor"`
 }
 
+// @Summary SendMessage
+// @Tags message
+// @Description Posts a message of the caller to a chat they belong to. Members of a chat where only admins post, as in a channel,
+// @Description are refused, so is a message in a direct chat when either user blocked the other
+// @ID send-message
+// @Accept  json
+// @Produce  json
+// @Param chat_id path string true "Chat ID"
+// @Param input body models.SendMessage true "message"
+// @Success 201 {object} response.SuccessResponse
+// @Failure 400,401,403,404,409 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Failure default {object} response.ErrorResponse
+// @Security CookieAuth
+// @Router /message/{chat_id}/send [post]
 func (mh *MessageHandler) SendMessage(ctx context.Context) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		const op = "handlers.chat.NewChat"
+		const op = "handlers.message.SendMessage"
 
 		log := mh.log.With(
 			slog.String("op", op),
 			slog.String("request_id", middleware.GetReqID(r.Context())),
 		)
 
-		var req models.NewChat
-
-		err := render.Decode(r, &req)
-		if flag := handlers.HandleError(w, r, req, err, log); !flag {
+		userInfo, err := cookie.TakeUserInfo(w, r)
+		if flag := handlers.HandleGettingCookie(w, r, err, log); !flag {
 			return
 		}
 
-		if len(req.Users) == 0 {
-			log.Error("list of users is empty", sl.Err(err))
+		chatID, err := uuid.Parse(chi.URLParam(r, "chat_id"))
+		if err != nil {
+			log.Warn("invalid chat id", sl.Err(err))
+
+			render.Status(r, http.StatusBadRequest)
 
 			render.JSON(w, r, resp.ErrorResponse{
 				Status: http.StatusBadRequest,
-				Error:  "list of users is empty",
+				Error:  "invalid chat id",
 			})
 
 			return
 		}
 
-		chatID, err := mh.messageHandler.NewChat(ctx, req.Users)
+		var req models.SendMessage
+
+		err = render.Decode(r, &req)
+		if flag := handlers.HandleError(w, r, req, err, log); !flag {
+			return
+		}
+
+		messageID, err := mh.messageHandler.Send(ctx, userInfo.UUID, chatID, req)
 		if err != nil {
-			log.Error("failed to create new chat", sl.Err(err))
+			status, reason := http.StatusInternalServerError, "failed to send message"
+
+			switch {
+			case errors.Is(err, message.ErrChatNotFound):
+				status, reason = http.StatusNotFound, "chat not found"
+			case errors.Is(err, message.ErrOnlyAdmins):
+				status, reason = http.StatusForbidden, "only admins post in this chat"
+			case errors.Is(err, message.ErrBlocked):
+				status, reason = http.StatusForbidden, "messages between these users are blocked"
+			}
+
+			render.Status(r, status)
 
 			render.JSON(w, r, resp.ErrorResponse{
-				Status: http.StatusInternalServerError,
-				Error:  "failed to create new chat",
+				Status: status,
+				Error:  reason,
 			})
 
 			return
 		}
 
-		log.Info("new chat created", slog.Int64("chat_id", chatID))
+		render.Status(r, http.StatusCreated)
 
 		render.JSON(w, r, resp.SuccessResponse{
-			Status: http.StatusOK,
-			Data:   chatID,
+			Status: http.StatusCreated,
+			Data:   messageID,
 		})
 	}
 }
@@ -184,7 +222,7 @@ func (mh *MessageHandler) ChatHistory(ctx context.Context) http.HandlerFunc {
 			return
 		}
 
-		messages, cursors, err := mh.messageHandler.ListChats(ctx, userInfo.ID, username, cursor, limit)
+		messages, cursors, err := mh.messageHandler.ListChats(ctx, userInfo.UUID, username, cursor, limit)
 		if err != nil {
 			if errors.Is(err, message.ErrChatsNotFound) {
 				log.Warn("chats not found")
@@ -220,3 +258,170 @@ func (mh *MessageHandler) ChatHistory(ctx context.Context) http.HandlerFunc {
 		})
 	}
 }
+
+// @Summary EraseUser
+// @Tags internal
+// @Description Called by auth-service when an account is deleted. Deletes the messages the user wrote, a user without messages is not an error
+// @ID erase-user-messages
+// @Produce  json
+// @Param user_id path string true "User ID"
+// @Success 200 {object} response.SuccessResponse
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /internal/users/{user_id}/messages [delete]
+func (mh *MessageHandler) EraseUser(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.message.EraseUser"
+
+		log := mh.log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		authorID, err := uuid.Parse(chi.URLParam(r, "user_id"))
+		if err != nil {
+			log.Warn("invalid user id", sl.Err(err))
+
+			render.Status(r, http.StatusBadRequest)
+
+			render.JSON(w, r, resp.ErrorResponse{
+				Status: http.StatusBadRequest,
+				Error:  "invalid user id",
+			})
+
+			return
+		}
+
+		err = mh.messageHandler.EraseUser(ctx, authorID)
+		if err != nil {
+			render.Status(r, http.StatusInternalServerError)
+
+			render.JSON(w, r, resp.ErrorResponse{
+				Status: http.StatusInternalServerError,
+				Error:  "failed to delete messages",
+			})
+
+			return
+		}
+
+		render.JSON(w, r, resp.SuccessResponse{
+			Status: http.StatusOK,
+			Data:   "messages deleted",
+		})
+	}
+}
+
+// @Summary ExportUser
+// @Tags internal
+// @Description Called by auth-service for a data export. Lists the messages the user wrote
+// @ID export-user-messages
+// @Produce  json
+// @Param user_id path string true "User ID"
+// @Success 200 {object} response.SuccessResponse{data=[]models.AuthoredMessage}
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /internal/users/{user_id}/messages/export [get]
+func (mh *MessageHandler) ExportUser(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.message.ExportUser"
+
+		log := mh.log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		authorID, err := uuid.Parse(chi.URLParam(r, "user_id"))
+		if err != nil {
+			log.Warn("invalid user id", sl.Err(err))
+
+			render.Status(r, http.StatusBadRequest)
+
+			render.JSON(w, r, resp.ErrorResponse{
+				Status: http.StatusBadRequest,
+				Error:  "invalid user id",
+			})
+
+			return
+		}
+
+		messages, err := mh.messageHandler.ExportUser(ctx, authorID)
+		if err != nil {
+			render.Status(r, http.StatusInternalServerError)
+
+			render.JSON(w, r, resp.ErrorResponse{
+				Status: http.StatusInternalServerError,
+				Error:  "failed to export messages",
+			})
+
+			return
+		}
+
+		render.JSON(w, r, resp.SuccessResponse{
+			Status: http.StatusOK,
+			Data:   messages,
+		})
+	}
+}
+
+// @Summary SystemMessage
+// @Tags internal
+// @Description Called by chat-service when a chat or its members change. Posts the change to the history of the chat
+// @ID post-system-message
+// @Accept  json
+// @Produce  json
+// @Param chat_id path string true "Chat ID"
+// @Param input body models.SystemEvent true "change of the chat"
+// @Success 201 {object} response.SuccessResponse
+// @Failure 400,409 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /internal/chats/{chat_id}/system-messages [post]
+func (mh *MessageHandler) SystemMessage(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.message.SystemMessage"
+
+		log := mh.log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		chatID, err := uuid.Parse(chi.URLParam(r, "chat_id"))
+		if err != nil {
+			log.Warn("invalid chat id", sl.Err(err))
+
+			render.Status(r, http.StatusBadRequest)
+
+			render.JSON(w, r, resp.ErrorResponse{
+				Status: http.StatusBadRequest,
+				Error:  "invalid chat id",
+			})
+
+			return
+		}
+
+		var req models.SystemEvent
+
+		err = render.Decode(r, &req)
+		if flag := handlers.HandleError(w, r, req, err, log); !flag {
+			return
+		}
+
+		messageID, err := mh.messageHandler.PostSystemMessage(ctx, chatID, req)
+		if err != nil {
+			render.Status(r, http.StatusInternalServerError)
+
+			render.JSON(w, r, resp.ErrorResponse{
+				Status: http.StatusInternalServerError,
+				Error:  "failed to post system message",
+			})
+
+			return
+		}
+
+		render.Status(r, http.StatusCreated)
+
+		render.JSON(w, r, resp.SuccessResponse{
+			Status: http.StatusCreated,
+			Data:   messageID,
+		})
+	}
+}
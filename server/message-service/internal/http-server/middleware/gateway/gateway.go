@@ -0,0 +1,106 @@
+package gateway
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/sergey-frey/cchat/message-service/internal/domain/models"
+	"github.com/sergey-frey/cchat/message-service/internal/lib/identity"
+)
+
+// Headers set by the gateway after auth-service validated the request.
+const (
+	headerUserID        = "X-User-Id"
+	headerUsername      = "X-Username"
+	headerSessionID     = "X-Session-Id"
+	headerEmailVerified = "X-Email-Verified"
+	headerUserRole      = "X-User-Role"
+	headerTokenScopes   = "X-Token-Scopes"
+)
+
+func ParseNetworks(cidrs []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted network %q: %w", cidr, err)
+		}
+
+		networks = append(networks, network)
+	}
+
+	return networks, nil
+}
+
+// Identity takes the user from the gateway headers. They are only trusted
+// when the request comes straight from one of the networks, anywhere else
+// they are dropped and the user has to present a token.
+func Identity(networks []*net.IPNet) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !trusted(r, networks) {
+				for _, header := range []string{headerUserID, headerUsername, headerSessionID, headerEmailVerified, headerUserRole, headerTokenScopes} {
+					r.Header.Del(header)
+				}
+
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if user, ok := userFromHeaders(r.Header); ok {
+				r = r.WithContext(identity.WithUser(r.Context(), user))
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func userFromHeaders(header http.Header) (*models.NormalizedUser, bool) {
+	userID, err := uuid.Parse(header.Get(headerUserID))
+	if err != nil {
+		return nil, false
+	}
+
+	sessionID, _ := uuid.Parse(header.Get(headerSessionID))
+	emailVerified, _ := strconv.ParseBool(header.Get(headerEmailVerified))
+
+	var scopes []string
+	if raw := header.Get(headerTokenScopes); raw != "" {
+		scopes = strings.Split(raw, ",")
+	}
+
+	return &models.NormalizedUser{
+		UUID:          userID,
+		Username:      header.Get(headerUsername),
+		EmailVerified: emailVerified,
+		Role:          header.Get(headerUserRole),
+		SessionID:     sessionID,
+		Scopes:        scopes,
+	}, true
+}
+
+func trusted(r *http.Request, networks []*net.IPNet) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
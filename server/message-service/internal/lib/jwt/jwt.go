@@ -1,88 +1,91 @@
 package jwt
 
 import (
+	"context"
 	"errors"
-	"time"
+	"fmt"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 	"github.com/sergey-frey/cchat/message-service/internal/domain/models"
-)
-
-const (
-	accessDuration  = 15 * time.Minute
-	refreshDuration = 43200 * time.Minute
+	"github.com/sergey-frey/cchat/message-service/internal/lib/jwks"
 )
 
 var (
 	ErrUserUnauthorized = errors.New("user unauthorized")
 )
 
-func NewPairTokens(user models.NormalizedUser) (string, string, error) {
-	accessToken := jwt.New(jwt.SigningMethodHS256)
-
-	claims := accessToken.Claims.(jwt.MapClaims)
-	claims["uid"] = user.ID
-	claims["username"] = user.Username
-	claims["email"] = user.Email
-	claims["exp"] = time.Now().Add(accessDuration).Unix()
+// KeySource provides the public keys of auth-service. This service only
+// verifies tokens, it holds no key that could sign one.
+type KeySource interface {
+	Key(ctx context.Context, kid string) (jwks.Key, error)
+}
 
-	accessTokenString, err := accessToken.SignedString([]byte("somesecret"))
-	if err != nil {
-		return "", "", err
-	}
+// keys is set once at startup, before the server accepts requests.
+var keys KeySource
 
-	refreshToken := jwt.New(jwt.SigningMethodHS256)
+func UseKeySource(source KeySource) {
+	keys = source
+}
 
-	claims = refreshToken.Claims.(jwt.MapClaims)
-	claims["exp"] = time.Now().Add(refreshDuration).Unix()
+// VerifyAccessToken only accepts a valid access token. Refresh tokens are
+// bound to server-side sessions and are rotated by auth-service alone.
+func VerifyAccessToken(accessToken string) (*models.NormalizedUser, error) {
+	accesstoken, err := jwt.Parse(accessToken, keyFunc, jwt.WithValidMethods([]string{"RS256", "EdDSA"}))
 
-	refreshTokenString, err := refreshToken.SignedString([]byte("secret"))
-	if err != nil {
-		return "", "", err
+	if err != nil || !accesstoken.Valid {
+		return nil, ErrUserUnauthorized
 	}
 
-	return accessTokenString, refreshTokenString, nil
-
-}
-
-func VerifyAccessToken(accessToken string, refreshToken string) (string, string, *models.NormalizedUser, error) {
-	accesstoken, _ := jwt.Parse(accessToken, func(token *jwt.Token) (any, error) {
-		return []byte("somesecret"), nil
-	})
-
 	claims := accesstoken.Claims.(jwt.MapClaims)
-	var user = models.NormalizedUser{
-		ID:       int64(claims["uid"].(float64)),
-		Username: claims["username"].(string),
-		Email:    claims["email"].(string),
+	if claims["typ"] != "access" {
+		return nil, ErrUserUnauthorized
 	}
 
-	if !accesstoken.Valid {
-		newAccessToken, newRefreshToken, user, err := VerifyRefreshToken(user, refreshToken)
-		return newAccessToken, newRefreshToken, user, err
+	uuidStr, _ := claims["uuid"].(string)
+	userUUID, err := uuid.Parse(uuidStr)
+	if err != nil {
+		return nil, ErrUserUnauthorized
 	}
 
-	return "", "", &user, nil
+	username, _ := claims["username"].(string)
+	email, _ := claims["email"].(string)
+	emailVerified, _ := claims["email_verified"].(bool)
+	role, _ := claims["role"].(string)
+	if role == "" {
+		role = models.RoleUser
+	}
+	sid, _ := claims["sid"].(string)
+	sessionID, _ := uuid.Parse(sid)
+	var user = models.NormalizedUser{
+		UUID:          userUUID,
+		Username:      username,
+		Email:         email,
+		EmailVerified: emailVerified,
+		Role:          role,
+		SessionID:     sessionID,
+	}
+
+	return &user, nil
 }
 
-func VerifyRefreshToken(user models.NormalizedUser, refreshToken string) (string, string, *models.NormalizedUser, error) {
+// keyFunc picks the public key by the kid header and refuses tokens
+// whose algorithm does not belong to that key.
+func keyFunc(token *jwt.Token) (interface{}, error) {
+	if keys == nil {
+		return nil, ErrUserUnauthorized
+	}
 
-	refreshtoken, err := jwt.Parse(refreshToken, func(token *jwt.Token) (any, error) {
-		return []byte("secret"), nil
-	})
+	kid, _ := token.Header["kid"].(string)
 
+	key, err := keys.Key(context.Background(), kid)
 	if err != nil {
-		return "", "", nil, err
+		return nil, err
 	}
 
-	if !refreshtoken.Valid {
-		return "", "", nil, ErrUserUnauthorized
-	}
-
-	newAccessToken, newRefreshToken, err := NewPairTokens(user)
-	if err != nil {
-		return "", "", nil, err
+	if token.Method.Alg() != key.Alg {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 	}
 
-	return newAccessToken, newRefreshToken, &user, nil
+	return key.Public, nil
 }
@@ -0,0 +1,74 @@
+package chatapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/sergey-frey/cchat/message-service/internal/domain/models"
+)
+
+var ErrMemberNotFound = errors.New("member not found")
+
+type senderResponse struct {
+	Status int           `json:"status"`
+	Data   models.Sender `json:"data"`
+}
+
+// Client asks chat-service who may post in a chat.
+type Client struct {
+	httpClient *http.Client
+	baseURL    string
+	token      string
+	log        *slog.Logger
+}
+
+// NewClient takes the token chat-service expects on its internal routes.
+func NewClient(httpClient *http.Client, baseURL string, token string, log *slog.Logger) *Client {
+	return &Client{
+		httpClient: httpClient,
+		baseURL:    baseURL,
+		token:      token,
+		log:        log,
+	}
+}
+
+// Sender returns the role of the user in the chat. A user outside the
+// chat, or a chat that does not exist, is ErrMemberNotFound.
+func (c *Client) Sender(ctx context.Context, chatID uuid.UUID, uid uuid.UUID) (*models.Sender, error) {
+	const op = "api.chatapi.client.Sender"
+
+	endpoint := fmt.Sprintf("%s/internal/chats/%s/members/%s", c.baseURL, chatID, uid)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	req.Header.Set("X-Service-Token", c.token)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, fmt.Errorf("%s: %w", op, ErrMemberNotFound)
+		}
+
+		return nil, fmt.Errorf("%s: unexpected status code %d", op, resp.StatusCode)
+	}
+
+	var body senderResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &body.Data, nil
+}
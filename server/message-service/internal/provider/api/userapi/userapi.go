@@ -0,0 +1,173 @@
+package userapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// maxCached bounds the block cache, expired entries are swept once it is
+// reached.
+const maxCached = 10000
+
+type blockCheckRequest struct {
+	User   uuid.UUID   `json:"user"`
+	Others []uuid.UUID `json:"others"`
+}
+
+type blockCheckResponse struct {
+	Status int `json:"status"`
+	Data   struct {
+		Blocked []uuid.UUID `json:"blocked"`
+	} `json:"data"`
+}
+
+// pair is a cache key. A block is checked in both directions, so the two
+// users are kept in a fixed order.
+type pair [2]uuid.UUID
+
+func newPair(a uuid.UUID, b uuid.UUID) pair {
+	if bytes.Compare(a[:], b[:]) > 0 {
+		a, b = b, a
+	}
+
+	return pair{a, b}
+}
+
+type cached struct {
+	blocked bool
+	expires time.Time
+}
+
+// Client asks user-service about blocks between users. Answers are cached
+// for the ttl, a block or unblock takes up to that long to be noticed.
+type Client struct {
+	httpClient *http.Client
+	baseURL    string
+	token      string
+	ttl        time.Duration
+	log        *slog.Logger
+	mu         sync.Mutex
+	cache      map[pair]cached
+	now        func() time.Time
+}
+
+// NewClient takes the token user-service expects on its internal routes.
+func NewClient(httpClient *http.Client, baseURL string, token string, ttl time.Duration, log *slog.Logger) *Client {
+	return &Client{
+		httpClient: httpClient,
+		baseURL:    baseURL,
+		token:      token,
+		ttl:        ttl,
+		log:        log,
+		cache:      make(map[pair]cached),
+		now:        time.Now,
+	}
+}
+
+// Blocked returns those of the others that blocked the user or were
+// blocked by them. Only the pairs missing from the cache are sent to
+// user-service, in a single request.
+func (c *Client) Blocked(ctx context.Context, user uuid.UUID, others []uuid.UUID) ([]uuid.UUID, error) {
+	const op = "api.userapi.client.Blocked"
+
+	blocked := make([]uuid.UUID, 0)
+	missing := make([]uuid.UUID, 0, len(others))
+
+	now := c.now()
+
+	c.mu.Lock()
+	for _, other := range others {
+		entry, ok := c.cache[newPair(user, other)]
+		switch {
+		case !ok || now.After(entry.expires):
+			missing = append(missing, other)
+		case entry.blocked:
+			blocked = append(blocked, other)
+		}
+	}
+	c.mu.Unlock()
+
+	if len(missing) == 0 {
+		return blocked, nil
+	}
+
+	fetched, err := c.check(ctx, user, missing)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	isBlocked := make(map[uuid.UUID]bool, len(fetched))
+	for _, uid := range fetched {
+		isBlocked[uid] = true
+	}
+
+	c.mu.Lock()
+	if len(c.cache)+len(missing) > maxCached {
+		c.sweep(now)
+	}
+
+	for _, other := range missing {
+		c.cache[newPair(user, other)] = cached{blocked: isBlocked[other], expires: now.Add(c.ttl)}
+
+		if isBlocked[other] {
+			blocked = append(blocked, other)
+		}
+	}
+	c.mu.Unlock()
+
+	return blocked, nil
+}
+
+func (c *Client) check(ctx context.Context, user uuid.UUID, others []uuid.UUID) ([]uuid.UUID, error) {
+	body, err := json.Marshal(blockCheckRequest{User: user, Others: others})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/internal/blocks/check", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Service-Token", c.token)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	var result blockCheckResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+
+	return result.Data.Blocked, nil
+}
+
+// sweep drops the expired entries, or all of them when none has expired.
+// The caller holds the lock.
+func (c *Client) sweep(now time.Time) {
+	for key, entry := range c.cache {
+		if now.After(entry.expires) {
+			delete(c.cache, key)
+		}
+	}
+
+	if len(c.cache) >= maxCached {
+		clear(c.cache)
+	}
+}
@@ -0,0 +1,86 @@
+package userapi
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestClient_BlockedCaches(t *testing.T) {
+	user, blocker, stranger := uuid.New(), uuid.New(), uuid.New()
+
+	var asked [][]uuid.UUID
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/internal/blocks/check" {
+			http.NotFound(w, r)
+			return
+		}
+
+		if r.Header.Get("X-Service-Token") != "secret" {
+			t.Errorf("missing service token")
+		}
+
+		var req blockCheckRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.User != user {
+			t.Errorf("unexpected request %+v: %v", req, err)
+		}
+
+		asked = append(asked, req.Others)
+
+		var result blockCheckResponse
+		result.Status = http.StatusOK
+		result.Data.Blocked = []uuid.UUID{}
+
+		if slices.Contains(req.Others, blocker) {
+			result.Data.Blocked = append(result.Data.Blocked, blocker)
+		}
+
+		_ = json.NewEncoder(w).Encode(result)
+	}))
+	defer server.Close()
+
+	now := time.Now()
+
+	client := NewClient(server.Client(), server.URL, "secret", time.Minute, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	client.now = func() time.Time { return now }
+
+	ctx := context.Background()
+
+	blocked, err := client.Blocked(ctx, user, []uuid.UUID{blocker, stranger})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(blocked, []uuid.UUID{blocker}) {
+		t.Fatalf("expected only the blocker, got %v", blocked)
+	}
+
+	// The pair is cached whichever side asks.
+	blocked, err = client.Blocked(ctx, blocker, []uuid.UUID{user})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(blocked, []uuid.UUID{user}) || len(asked) != 1 {
+		t.Fatalf("expected a cached block, got %v after %d requests", blocked, len(asked))
+	}
+
+	now = now.Add(2 * time.Minute)
+
+	if _, err := client.Blocked(ctx, user, []uuid.UUID{stranger}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(asked) != 2 || !slices.Equal(asked[1], []uuid.UUID{stranger}) {
+		t.Fatalf("expected an expired entry to be asked again, got %v", asked)
+	}
+}
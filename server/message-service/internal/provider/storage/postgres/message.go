@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 
+	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
 	"github.com/sergey-frey/cchat/message-service/internal/domain/models"
 	"github.com/sergey-frey/cchat/message-service/internal/provider/storage"
@@ -60,7 +61,7 @@ func (s *Storage) NewChat(ctx context.Context, users []int64) (chatID int64, err
 	return chatID, nil
 }
 
-func (s *Storage) ListChats(ctx context.Context, currUser int64, username string, cursor int64, limit int) ([]models.Message, *models.Cursor, error) {
+func (s *Storage) ListChats(ctx context.Context, currUser uuid.UUID, username string, cursor int64, limit int) ([]models.Message, *models.Cursor, error) {
 	const op = "storage.chat.Chat"
 
 	tx, err := s.pool.Begin(ctx)
@@ -196,3 +197,96 @@ func (s *Storage) ListChats(ctx context.Context, currUser int64, username string
 
 	return nil, nil, nil
 }
+
+// DeleteUserMessages deletes every message the user wrote.
+func (s *Storage) DeleteUserMessages(ctx context.Context, authorID uuid.UUID) (int64, error) {
+	const op = "storage.message.DeleteUserMessages"
+
+	tag, err := s.pool.Exec(ctx, `
+		DELETE FROM messages
+		WHERE author_id = $1;
+	`, authorID)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return tag.RowsAffected(), nil
+}
+
+// UserMessages lists every message the user wrote, the oldest first.
+func (s *Storage) UserMessages(ctx context.Context, authorID uuid.UUID) ([]models.AuthoredMessage, error) {
+	const op = "storage.message.UserMessages"
+
+	rows, err := s.pool.Query(ctx, `
+		SELECT message_id, chat_id, type, content, created_at
+		FROM messages
+		WHERE author_id = $1
+		ORDER BY created_at, message_id;
+	`, authorID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	messages := make([]models.AuthoredMessage, 0)
+
+	for rows.Next() {
+		var message models.AuthoredMessage
+
+		if err := rows.Scan(&message.ID, &message.ChatID, &message.Type, &message.Content, &message.CreatedAt); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		messages = append(messages, message)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return messages, nil
+}
+
+// SaveMessage stores a message the author wrote to the chat.
+func (s *Storage) SaveMessage(ctx context.Context, chatID uuid.UUID, authorID uuid.UUID, messageType string, content string) (uuid.UUID, error) {
+	const op = "storage.message.SaveMessage"
+
+	var messageID uuid.UUID
+
+	row := s.pool.QueryRow(ctx, `
+		INSERT INTO messages(type, content, chat_id, author_id)
+		VALUES($1, $2, $3, $4)
+		RETURNING message_id;
+	`, messageType, content, chatID, authorID)
+
+	if err := row.Scan(&messageID); err != nil {
+		return uuid.Nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return messageID, nil
+}
+
+// SaveSystemMessage posts the event to the chat as a message without an
+// author, so erasing a user does not take the chat history with them.
+func (s *Storage) SaveSystemMessage(ctx context.Context, chatID uuid.UUID, event models.SystemEvent) (uuid.UUID, error) {
+	const op = "storage.message.SaveSystemMessage"
+
+	content, err := json.Marshal(event)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var messageID uuid.UUID
+
+	row := s.pool.QueryRow(ctx, `
+		INSERT INTO messages(type, content, chat_id, author_id)
+		VALUES($1, $2, $3, $4)
+		RETURNING message_id;
+	`, models.MessageSystem, string(content), chatID, uuid.Nil)
+
+	if err := row.Scan(&messageID); err != nil {
+		return uuid.Nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return messageID, nil
+}
@@ -6,30 +6,53 @@ import (
 	"fmt"
 	"log/slog"
 
+	"github.com/google/uuid"
 	"github.com/sergey-frey/cchat/message-service/internal/domain/models"
 	"github.com/sergey-frey/cchat/message-service/internal/lib/logger/sl"
+	"github.com/sergey-frey/cchat/message-service/internal/provider/api/chatapi"
 	"github.com/sergey-frey/cchat/message-service/internal/provider/storage"
 )
 
 type Message interface {
 	NewChat(ctx context.Context, users []int64) (chatID int64, err error)
-	ListChats(ctx context.Context, currUser int64, username string, cursor int64, limit int) (chats []models.Message, cursors *models.Cursor, err error)
+	ListChats(ctx context.Context, currUser uuid.UUID, username string, cursor int64, limit int) (chats []models.Message, cursors *models.Cursor, err error)
+	DeleteUserMessages(ctx context.Context, authorID uuid.UUID) (deleted int64, err error)
+	UserMessages(ctx context.Context, authorID uuid.UUID) (messages []models.AuthoredMessage, err error)
+	SaveSystemMessage(ctx context.Context, chatID uuid.UUID, event models.SystemEvent) (messageID uuid.UUID, err error)
+	SaveMessage(ctx context.Context, chatID uuid.UUID, authorID uuid.UUID, messageType string, content string) (messageID uuid.UUID, err error)
+}
+
+// Chats tells who may post in a chat, see chatapi.
+type Chats interface {
+	Sender(ctx context.Context, chatID uuid.UUID, uid uuid.UUID) (sender *models.Sender, err error)
+}
+
+// Blocks tells which users are in a block with a user, see userapi.
+type Blocks interface {
+	Blocked(ctx context.Context, user uuid.UUID, others []uuid.UUID) (blocked []uuid.UUID, err error)
 }
 
 type MessageService struct {
 	messageService      Message
+	chats            Chats
+	blocks           Blocks
 	log              *slog.Logger
 }
 
-func New(messageProvider Message, log *slog.Logger) *MessageService {
+func New(messageProvider Message, chats Chats, blocks Blocks, log *slog.Logger) *MessageService {
 	return &MessageService{
 		messageService:      messageProvider,
+		chats:            chats,
+		blocks:           blocks,
 		log:              log,
 	}
 }
 
 var (
 	ErrChatsNotFound = errors.New("chats not found")
+	ErrChatNotFound  = errors.New("chat not found")
+	ErrBlocked       = errors.New("users blocked each other")
+	ErrOnlyAdmins    = errors.New("only admins post in the chat")
 )
 
 func (ms *MessageService) NewChat(ctx context.Context, users []int64) (chatID int64, err error) {
@@ -49,7 +72,7 @@ func (ms *MessageService) NewChat(ctx context.Context, users []int64) (chatID in
 	return chatID, nil
 }
 
-func (ms *MessageService) ListChats(ctx context.Context, currUser int64, username string, cursor int64, limit int) (chats []models.Message, cursors *models.Cursor, err error) {
+func (ms *MessageService) ListChats(ctx context.Context, currUser uuid.UUID, username string, cursor int64, limit int) (chats []models.Message, cursors *models.Cursor, err error) {
 	const op = "services.message.ListChats"
 
 	log := ms.log.With(
@@ -75,3 +98,129 @@ func (ms *MessageService) ListChats(ctx context.Context, currUser int64, usernam
 
 	return chats, rcursor, nil
 }
+
+// EraseUser is the part of an account deletion that happens here.
+func (ms *MessageService) EraseUser(ctx context.Context, authorID uuid.UUID) error {
+	const op = "services.message.EraseUser"
+
+	log := ms.log.With(
+		slog.String("op", op),
+		slog.String("user_id", authorID.String()),
+	)
+
+	deleted, err := ms.messageService.DeleteUserMessages(ctx, authorID)
+	if err != nil {
+		log.Error("failed to delete messages", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("messages deleted", slog.Int64("count", deleted))
+
+	return nil
+}
+
+// ExportUser lists the messages the user wrote for their data export.
+func (ms *MessageService) ExportUser(ctx context.Context, authorID uuid.UUID) ([]models.AuthoredMessage, error) {
+	const op = "services.message.ExportUser"
+
+	messages, err := ms.messageService.UserMessages(ctx, authorID)
+	if err != nil {
+		ms.log.Error("failed to list messages", slog.String("op", op), slog.String("user_id", authorID.String()), sl.Err(err))
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return messages, nil
+}
+
+// PostSystemMessage records a change of the chat or its members in its
+// history.
+func (ms *MessageService) PostSystemMessage(ctx context.Context, chatID uuid.UUID, event models.SystemEvent) (uuid.UUID, error) {
+	const op = "services.message.PostSystemMessage"
+
+	log := ms.log.With(
+		slog.String("op", op),
+		slog.String("chat_id", chatID.String()),
+		slog.String("event", event.Event),
+	)
+
+	messageID, err := ms.messageService.SaveSystemMessage(ctx, chatID, event)
+	if err != nil {
+		log.Error("failed to save system message", sl.Err(err))
+
+		return uuid.Nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("system message posted", slog.String("message_id", messageID.String()))
+
+	return messageID, nil
+}
+
+// Send posts the message of a member to the chat. Where the settings
+// keep posting to the admins, as in a channel, members are refused, and in
+// a direct chat a block between the two users refuses it too.
+func (ms *MessageService) Send(ctx context.Context, author uuid.UUID, chatID uuid.UUID, message models.SendMessage) (uuid.UUID, error) {
+	const op = "services.message.Send"
+
+	log := ms.log.With(
+		slog.String("op", op),
+		slog.String("author", author.String()),
+		slog.String("chat_id", chatID.String()),
+	)
+
+	sender, err := ms.chats.Sender(ctx, chatID, author)
+	if err != nil {
+		if errors.Is(err, chatapi.ErrMemberNotFound) {
+			return uuid.Nil, fmt.Errorf("%s: %w", op, ErrChatNotFound)
+		}
+
+		log.Error("failed to get sender", sl.Err(err))
+
+		return uuid.Nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if sender.Settings.OnlyAdminsPost && sender.Role != models.MemberOwner && sender.Role != models.MemberAdmin {
+		log.Warn("member tried to post where only admins post")
+
+		return uuid.Nil, fmt.Errorf("%s: %w", op, ErrOnlyAdmins)
+	}
+
+	if sender.ChatType == models.ChatDirect && sender.Peer != nil {
+		if err := ms.CheckDirect(ctx, author, *sender.Peer); err != nil {
+			log.Warn("message refused", sl.Err(err))
+
+			return uuid.Nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	messageID, err := ms.messageService.SaveMessage(ctx, chatID, author, models.MessageText, message.Content)
+	if err != nil {
+		log.Error("failed to save message", sl.Err(err))
+
+		return uuid.Nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("message sent", slog.String("message_id", messageID.String()))
+
+	return messageID, nil
+}
+
+// CheckDirect refuses a message in a direct chat when either of the two
+// users blocked the other. Group chats are not affected by blocks.
+func (ms *MessageService) CheckDirect(ctx context.Context, author uuid.UUID, peer uuid.UUID) error {
+	const op = "services.message.CheckDirect"
+
+	blocked, err := ms.blocks.Blocked(ctx, author, []uuid.UUID{peer})
+	if err != nil {
+		ms.log.Error("failed to check blocks", slog.String("op", op), sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if len(blocked) > 0 {
+		return fmt.Errorf("%s: %w", op, ErrBlocked)
+	}
+
+	return nil
+}
@@ -0,0 +1,157 @@
+package message
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/sergey-frey/cchat/message-service/internal/domain/models"
+	"github.com/sergey-frey/cchat/message-service/internal/lib/logger/slogdiscard"
+	"github.com/sergey-frey/cchat/message-service/internal/provider/api/chatapi"
+)
+
+type store struct {
+	Message
+	saved []string
+}
+
+func (s *store) SaveMessage(ctx context.Context, chatID uuid.UUID, authorID uuid.UUID, messageType string, content string) (uuid.UUID, error) {
+	s.saved = append(s.saved, content)
+
+	return uuid.New(), nil
+}
+
+// chats knows the members of a single chat.
+type chats struct {
+	chatType string
+	settings models.ChatSettings
+	roles    map[uuid.UUID]string
+}
+
+func (c *chats) Sender(ctx context.Context, chatID uuid.UUID, uid uuid.UUID) (*models.Sender, error) {
+	role, ok := c.roles[uid]
+	if !ok {
+		return nil, chatapi.ErrMemberNotFound
+	}
+
+	sender := &models.Sender{ChatType: c.chatType, Role: role, Settings: c.settings}
+
+	if c.chatType == models.ChatDirect {
+		for member := range c.roles {
+			if member != uid {
+				sender.Peer = &member
+			}
+		}
+	}
+
+	return sender, nil
+}
+
+// blocks holds the pairs of users in a block, in both directions.
+type blocks map[[2]uuid.UUID]bool
+
+func (b blocks) Blocked(ctx context.Context, user uuid.UUID, others []uuid.UUID) ([]uuid.UUID, error) {
+	blocked := make([]uuid.UUID, 0)
+
+	for _, other := range others {
+		if b[[2]uuid.UUID{user, other}] || b[[2]uuid.UUID{other, user}] {
+			blocked = append(blocked, other)
+		}
+	}
+
+	return blocked, nil
+}
+
+func TestSend_BlockedInDirectChat(t *testing.T) {
+	ctx := context.Background()
+
+	author, peer := uuid.New(), uuid.New()
+
+	st := &store{}
+	direct := &chats{
+		chatType: models.ChatDirect,
+		roles:    map[uuid.UUID]string{author: models.MemberMember, peer: models.MemberMember},
+	}
+
+	ms := New(st, direct, blocks{{peer, author}: true}, slogdiscard.NewDiscardLogger())
+
+	_, err := ms.Send(ctx, author, uuid.New(), models.SendMessage{Content: "hi"})
+	if !errors.Is(err, ErrBlocked) {
+		t.Fatalf("expected the message to be refused, got %v", err)
+	}
+
+	if len(st.saved) != 0 {
+		t.Fatalf("expected nothing saved, got %v", st.saved)
+	}
+
+	// Without the block the same message goes through.
+	ms = New(st, direct, blocks{}, slogdiscard.NewDiscardLogger())
+
+	if _, err := ms.Send(ctx, author, uuid.New(), models.SendMessage{Content: "hi"}); err != nil {
+		t.Fatalf("expected the message to be sent, got %v", err)
+	}
+}
+
+func TestSend_BlocksDoNotAffectGroups(t *testing.T) {
+	ctx := context.Background()
+
+	author, other := uuid.New(), uuid.New()
+
+	group := &chats{
+		chatType: models.ChatGroup,
+		roles:    map[uuid.UUID]string{author: models.MemberMember, other: models.MemberOwner},
+	}
+
+	ms := New(&store{}, group, blocks{{other, author}: true}, slogdiscard.NewDiscardLogger())
+
+	if _, err := ms.Send(ctx, author, uuid.New(), models.SendMessage{Content: "hi"}); err != nil {
+		t.Fatalf("expected the message to be sent, got %v", err)
+	}
+}
+
+func TestSend_OnlyAdminsPost(t *testing.T) {
+	ctx := context.Background()
+
+	owner, admin, member := uuid.New(), uuid.New(), uuid.New()
+
+	channel := &chats{
+		chatType: models.ChatChannel,
+		settings: models.ChatSettings{OnlyAdminsPost: true},
+		roles: map[uuid.UUID]string{
+			owner:  models.MemberOwner,
+			admin:  models.MemberAdmin,
+			member: models.MemberMember,
+		},
+	}
+
+	ms := New(&store{}, channel, blocks{}, slogdiscard.NewDiscardLogger())
+
+	if _, err := ms.Send(ctx, member, uuid.New(), models.SendMessage{Content: "hi"}); !errors.Is(err, ErrOnlyAdmins) {
+		t.Fatalf("expected the member to be refused, got %v", err)
+	}
+
+	for _, author := range []uuid.UUID{owner, admin} {
+		if _, err := ms.Send(ctx, author, uuid.New(), models.SendMessage{Content: "hi"}); err != nil {
+			t.Fatalf("expected %s to post, got %v", channel.roles[author], err)
+		}
+	}
+
+	channel.settings.OnlyAdminsPost = false
+
+	if _, err := ms.Send(ctx, member, uuid.New(), models.SendMessage{Content: "hi"}); err != nil {
+		t.Fatalf("expected the member to post once the setting is off, got %v", err)
+	}
+}
+
+func TestSend_NotAMember(t *testing.T) {
+	ctx := context.Background()
+
+	group := &chats{chatType: models.ChatGroup, roles: map[uuid.UUID]string{}}
+
+	ms := New(&store{}, group, blocks{}, slogdiscard.NewDiscardLogger())
+
+	if _, err := ms.Send(ctx, uuid.New(), uuid.New(), models.SendMessage{Content: "hi"}); !errors.Is(err, ErrChatNotFound) {
+		t.Fatalf("expected the chat not to be found, got %v", err)
+	}
+}
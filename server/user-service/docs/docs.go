@@ -570,24 +570,11 @@ const docTemplate = `{
         "models.NewUserInfo": {
             "type": "object",
             "properties": {
-                "email": {
-                    "type": "string",
-                    "example": "example@mail.com"
-                },
                 "name": {
                     "type": "string",
                     "minLength": 1,
                     "example": "Arnold"
                 },
-                "new_password": {
-                    "type": "string",
-                    "minLength": 8,
-                    "example": "123456789"
-                },
-                "previous_password": {
-                    "type": "string",
-                    "example": "12345678"
-                },
                 "username": {
                     "type": "string",
                     "example": "arnold2004"
@@ -15,12 +15,59 @@ type Config struct {
 	Server         HTTPServer `yaml:"http_server"`
 	PostgreStorage PostgresDB `yaml:"psql"`
 	RedisStorage   RedisDB    `yaml:"redis"`
+	JWKS           JWKS       `yaml:"jwks"`
+	Avatars        Avatars    `yaml:"avatars"`
+	Internal       Internal   `yaml:"internal"`
+	Usernames      Usernames  `yaml:"usernames"`
 	// TokenTTL time.Duration `yaml:"token_ttl" env-required:"true"`
 	//Clients ClientConfig `yaml:"clients"`
 	//AppSecret string `yaml:"app_secret"`
 
 }
 
+// JWKS is where the public keys of auth-service are fetched from.
+type JWKS struct {
+	URL string        `yaml:"url" env:"JWKS_URL" env-default:"http://auth-service:8080/.well-known/jwks.json"`
+	TTL time.Duration `yaml:"ttl" env-default:"5m"`
+}
+
+// Avatars configures the uploaded avatars. Their thumbnails go to Dir or,
+// with the s3 driver, to a bucket. A directory is not shared between
+// instances, replicas need s3. PublicURL is where the gateway exposes the
+// /avatars route of this service.
+type Avatars struct {
+	Driver    string `yaml:"driver" env-default:"filesystem"`
+	Dir       string `yaml:"dir" env-default:"./data/avatars"`
+	MaxSize   int64  `yaml:"max_size" env-default:"5242880"`
+	PublicURL string `yaml:"public_url" env-default:"/services/users/avatars"`
+	S3        S3     `yaml:"s3"`
+}
+
+// Internal restricts the /internal routes to the other services. Their
+// requests come from TrustedNetworks and carry Token, with no token set the
+// routes refuse everyone.
+type Internal struct {
+	TrustedNetworks []string `yaml:"trusted_networks" env:"INTERNAL_TRUSTED_NETWORKS" env-default:"127.0.0.1/32,::1/128"`
+	Token           string   `env:"SERVICE_TOKEN"`
+}
+
+// Usernames governs changes of username. A released username leads to its
+// previous owner for RedirectPeriod and nobody else may take it during
+// Cooldown. Reserved words add to the built-in ones.
+type Usernames struct {
+	RedirectPeriod time.Duration `yaml:"redirect_period" env-default:"720h"`
+	Cooldown       time.Duration `yaml:"cooldown" env-default:"2160h"`
+	Reserved       []string      `yaml:"reserved"`
+}
+
+type S3 struct {
+	Endpoint  string `yaml:"endpoint"`
+	Region    string `yaml:"region" env-default:"us-east-1"`
+	Bucket    string `yaml:"bucket"`
+	AccessKey string `env:"S3_ACCESS_KEY"`
+	SecretKey string `env:"S3_SECRET_KEY"`
+}
+
 type HTTPServer struct {
 	Port         string        `yaml:"server_port" env-default:"localhost:8040"`
 	Timeout      time.Duration `yaml:"timeout" env-default:"4s"`
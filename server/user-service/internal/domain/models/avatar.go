@@ -0,0 +1,44 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// AvatarSizes are the edge lengths, in pixels, of the square thumbnails
+// made from an uploaded avatar.
+var AvatarSizes = []int{64, 128, 512}
+
+// AvatarURLs point at the thumbnails of an uploaded avatar. They change
+// with every upload, so clients may cache them forever.
+type AvatarURLs struct {
+	Small  string `json:"small"`
+	Medium string `json:"medium"`
+	Large  string `json:"large"`
+}
+
+// NewAvatarURLs returns the thumbnail URLs of the avatar version under
+// baseURL, nil if the user has not uploaded one.
+func NewAvatarURLs(baseURL string, uid uuid.UUID, version string) *AvatarURLs {
+	if version == "" {
+		return nil
+	}
+
+	url := func(size int) string {
+		return fmt.Sprintf("%s/%s/%s/%d", strings.TrimRight(baseURL, "/"), uid, version, size)
+	}
+
+	return &AvatarURLs{
+		Small:  url(AvatarSizes[0]),
+		Medium: url(AvatarSizes[1]),
+		Large:  url(AvatarSizes[2]),
+	}
+}
+
+// Blob is a stored file together with its content type.
+type Blob struct {
+	ContentType string
+	Data        []byte
+}
@@ -0,0 +1,18 @@
+package models
+
+import "github.com/google/uuid"
+
+// UserBatch is a lookup of many users at once by the other services. The
+// profiles come back as the viewer may see them, without a viewer only
+// what everyone may see is filled in.
+type UserBatch struct {
+	UUIDs  []uuid.UUID `json:"uuids" validate:"required,min=1,max=500"`
+	Viewer uuid.UUID   `json:"viewer,omitempty"`
+}
+
+// UserCheckResult splits the requested users into those that exist and
+// those that don't.
+type UserCheckResult struct {
+	Existing []uuid.UUID `json:"existing"`
+	Missing  []uuid.UUID `json:"missing"`
+}
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// BlockedUser is an entry of the block list, the profile is seen as the
+// blocker sees it.
+type BlockedUser struct {
+	User      UserInfo  `json:"user"`
+	BlockedAt time.Time `json:"blocked_at"`
+}
+
+// BlockCheck asks which of the others are in a block with the user, in
+// either direction.
+type BlockCheck struct {
+	User   uuid.UUID   `json:"user" validate:"required"`
+	Others []uuid.UUID `json:"others" validate:"required,min=1,max=100"`
+}
+
+// BlockCheckResult lists the others that blocked the user or were blocked
+// by them.
+type BlockCheckResult struct {
+	Blocked []uuid.UUID `json:"blocked"`
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Contact is an entry of the contact list. The nickname is only seen by
+// the owner of the list.
+type Contact struct {
+	User     UserInfo  `json:"user"`
+	Nickname string    `json:"nickname"`
+	Since    time.Time `json:"since"`
+}
+
+// ContactRequest is a pending request, User is the other side of it.
+type ContactRequest struct {
+	User   UserInfo  `json:"user"`
+	SentAt time.Time `json:"sent_at"`
+}
+
+type UpdateContact struct {
+	Nickname string `json:"nickname" validate:"max=64" example:"Mom"`
+}
+
+// ContactCheck asks which of the others are contacts of the user.
+type ContactCheck struct {
+	User   uuid.UUID   `json:"user" validate:"required"`
+	Others []uuid.UUID `json:"others" validate:"required,min=1,max=100"`
+}
+
+type ContactCheckResult struct {
+	Contacts []uuid.UUID `json:"contacts"`
+}
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// UserExport is what user-service keeps about a user, as it goes into the
+// data export. The contacts, requests and blocks show the other users as
+// the exported user sees them.
+type UserExport struct {
+	Profile          UserInfo           `json:"profile"`
+	Privacy          PrivacySettings    `json:"privacy"`
+	UsernameHistory  []ReleasedUsername `json:"username_history"`
+	Contacts         []Contact          `json:"contacts"`
+	IncomingRequests []ContactRequest   `json:"incoming_contact_requests"`
+	OutgoingRequests []ContactRequest   `json:"outgoing_contact_requests"`
+	Blocks           []BlockedUser      `json:"blocks"`
+}
+
+// ReleasedUsername is a username the user gave up.
+type ReleasedUsername struct {
+	Username   string    `json:"username"`
+	ReleasedAt time.Time `json:"released_at"`
+}
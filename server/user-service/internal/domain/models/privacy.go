@@ -0,0 +1,39 @@
+package models
+
+import "github.com/google/uuid"
+
+// Audiences of a privacy setting.
+const (
+	VisibilityEveryone = "everyone"
+	VisibilityContacts = "contacts"
+	VisibilityNobody   = "nobody"
+)
+
+// PrivacySettings decide what other users see of a profile and whether
+// they may start a chat with its owner. The owner always sees everything.
+type PrivacySettings struct {
+	Discoverable       bool   `json:"discoverable"`
+	EmailVisibility    string `json:"email_visibility"`
+	WhoCanStartChat    string `json:"who_can_start_chat"`
+	LastSeenVisibility string `json:"last_seen_visibility"`
+}
+
+// UpdatePrivacy is a partial update, only the fields present change.
+type UpdatePrivacy struct {
+	Discoverable       *bool   `json:"discoverable,omitempty" example:"false"`
+	EmailVisibility    *string `json:"email_visibility,omitempty" validate:"omitempty,oneof=everyone contacts nobody" example:"contacts"`
+	WhoCanStartChat    *string `json:"who_can_start_chat,omitempty" validate:"omitempty,oneof=everyone contacts nobody" example:"everyone"`
+	LastSeenVisibility *string `json:"last_seen_visibility,omitempty" validate:"omitempty,oneof=everyone contacts nobody" example:"nobody"`
+}
+
+// ChatCheck asks whether the initiator may start a chat with the users.
+type ChatCheck struct {
+	Initiator uuid.UUID   `json:"initiator" validate:"required"`
+	Users     []uuid.UUID `json:"users" validate:"required,min=1,max=100"`
+}
+
+// ChatCheckResult lists the users that do not accept a chat from the
+// initiator.
+type ChatCheckResult struct {
+	Denied []uuid.UUID `json:"denied"`
+}
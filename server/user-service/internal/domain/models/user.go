@@ -1,6 +1,17 @@
 package models
 
-import "github.com/google/uuid"
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Roles issued by auth-service.
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
 
 type User struct {
 	UUID       uuid.UUID  `json:"uuid"`
@@ -24,14 +35,28 @@ type UserInfo struct {
 	Email    string `json:"email"`
 	Username string `json:"username"`
 	Name     string `json:"name"`
+	Bio        string     `json:"bio"`
+	Avatar     string     `json:"avatar"`
+	StatusText string     `json:"status_text"`
+	Timezone   string     `json:"timezone"`
+	LastSeenAt *time.Time `json:"last_seen_at"`
+	// AvatarURLs are set once the user uploaded an avatar and take
+	// precedence over Avatar.
+	AvatarURLs    *AvatarURLs `json:"avatar_urls,omitempty"`
+	AvatarVersion string      `json:"-"`
 }
 
+// NewUserInfo is a partial update of the profile. Empty username and name
+// are left as they are. The other fields are only changed when present, an
+// empty string clears them and an empty timezone goes back to UTC. The
+// email and the password belong to auth-service and are not part of it.
 type NewUserInfo struct {
-	Email            string `json:"email,omitempty" validate:"omitempty,email" example:"example@mail.com"`
-	PreviousPassword string `json:"previous_password,omitempty" validate:"omitempty" example:"12345678"`
-	NewPassword      string `json:"new_password,omitempty" validate:"omitempty,gte=8" example:"123456789"`
-	Username         string `json:"username,omitempty" validate:"omitempty" example:"arnold2004"`
-	Name             string `json:"name,omitempty" validate:"omitempty,min=1" example:"Arnold"`
+	Username   string  `json:"username,omitempty" validate:"omitempty,min=3,max=32,alphanum" example:"arnold2004"`
+	Name       string  `json:"name,omitempty" validate:"omitempty,min=1,max=64" example:"Arnold"`
+	Bio        *string `json:"bio,omitempty" validate:"omitempty,max=500" example:"I'll be back"`
+	Avatar     *string `json:"avatar,omitempty" validate:"omitempty,url|len=0,max=512" example:"https://example.com/avatar.png"`
+	StatusText *string `json:"status_text,omitempty" validate:"omitempty,max=140" example:"on vacation"`
+	Timezone   *string `json:"timezone,omitempty" validate:"omitempty,timezone|len=0" example:"Europe/Berlin"`
 }
 
 type CreateUser struct {
@@ -42,6 +67,7 @@ type NormalizedUser struct {
 	UUID       uuid.UUID  `json:"uuid"`
 	Username string `json:"username"`
 	Email    string `json:"email"`
+	Role     string `json:"role"`
 }
 
 func UserToNormalized(user *User) NormalizedUser {
@@ -0,0 +1,214 @@
+package avatar
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"github.com/go-chi/render"
+	"github.com/google/uuid"
+	"github.com/sergey-frey/cchat/user-service/internal/domain/models"
+	resp "github.com/sergey-frey/cchat/user-service/internal/lib/api/response"
+	"github.com/sergey-frey/cchat/user-service/internal/lib/identity"
+	"github.com/sergey-frey/cchat/user-service/internal/lib/logger/sl"
+	"github.com/sergey-frey/cchat/user-service/internal/services/avatar"
+)
+
+// multipartOverhead is allowed on top of the image for the boundaries and
+// part headers of the form.
+const multipartOverhead = 64 << 10
+
+type Avatar interface {
+	Upload(ctx context.Context, uid uuid.UUID, r io.Reader) (urls *models.AvatarURLs, err error)
+	Remove(ctx context.Context, uid uuid.UUID) (err error)
+	Thumbnail(ctx context.Context, uid uuid.UUID, version string, size int) (blob *models.Blob, err error)
+}
+
+type AvatarHandler struct {
+	avatar  Avatar
+	maxSize int64
+	log     *slog.Logger
+}
+
+func New(avatar Avatar, maxSize int64, log *slog.Logger) *AvatarHandler {
+	return &AvatarHandler{
+		avatar:  avatar,
+		maxSize: maxSize,
+		log:     log,
+	}
+}
+
+// @Summary UploadAvatar
+// @Tags user
+// @Description Replaces the avatar of the authenticated user with a JPEG, PNG or GIF sent as the "avatar" form field.
+// @Description The image is cropped to a square and stored as 64, 128 and 512 pixel thumbnails, its metadata is dropped
+// @ID upload-avatar
+// @Accept  mpfd
+// @Produce  json
+// @Param avatar formData file true "image"
+// @Success 200 {object} response.SuccessResponse{data=models.AvatarURLs}
+// @Failure 400,401,404,413,415 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Failure default {object} response.ErrorResponse
+// @Security CookieAuth
+// @Router /profiles/me/avatar [put]
+func (a *AvatarHandler) Upload(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.avatar.Upload"
+
+		log := a.log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		user, _ := identity.User(r.Context())
+
+		r.Body = http.MaxBytesReader(w, r.Body, a.maxSize+multipartOverhead)
+
+		file, _, err := r.FormFile("avatar")
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				avatarError(w, r, avatar.ErrTooLarge, "")
+
+				return
+			}
+
+			log.Warn("failed to read upload", sl.Err(err))
+
+			render.Status(r, http.StatusBadRequest)
+
+			render.JSON(w, r, resp.ErrorResponse{
+				Status: http.StatusBadRequest,
+				Error:  "avatar file is required",
+			})
+
+			return
+		}
+		defer file.Close()
+
+		urls, err := a.avatar.Upload(ctx, user.UUID, file)
+		if err != nil {
+			avatarError(w, r, err, "failed to upload avatar")
+
+			return
+		}
+
+		render.JSON(w, r, resp.SuccessResponse{
+			Status: http.StatusOK,
+			Data:   urls,
+		})
+	}
+}
+
+// @Summary RemoveAvatar
+// @Tags user
+// @Description Removes the uploaded avatar of the authenticated user
+// @ID remove-avatar
+// @Produce  json
+// @Success 200 {object} response.SuccessResponse
+// @Failure 401,404 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Failure default {object} response.ErrorResponse
+// @Security CookieAuth
+// @Router /profiles/me/avatar [delete]
+func (a *AvatarHandler) Remove(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, _ := identity.User(r.Context())
+
+		if err := a.avatar.Remove(ctx, user.UUID); err != nil {
+			avatarError(w, r, err, "failed to remove avatar")
+
+			return
+		}
+
+		render.JSON(w, r, resp.SuccessResponse{
+			Status: http.StatusOK,
+			Data:   "avatar removed",
+		})
+	}
+}
+
+// @Summary Avatar
+// @Tags user
+// @Description Serves a thumbnail of an uploaded avatar. The URL changes with every upload, so the response may be cached for good
+// @ID get-avatar
+// @Produce  jpeg,png
+// @Param user_id path string true "user id"
+// @Param version path string true "avatar version"
+// @Param size path int true "64, 128 or 512"
+// @Success 200 {file} binary
+// @Success 304
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /avatars/{user_id}/{version}/{size} [get]
+func (a *AvatarHandler) Serve(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		uid, uidErr := uuid.Parse(chi.URLParam(r, "user_id"))
+		size, sizeErr := strconv.Atoi(chi.URLParam(r, "size"))
+		version := chi.URLParam(r, "version")
+
+		if uidErr != nil || sizeErr != nil {
+			avatarError(w, r, avatar.ErrAvatarNotFound, "")
+
+			return
+		}
+
+		// The content behind a URL never changes, the version and the size
+		// make a strong validator.
+		etag := `"` + version + "-" + strconv.Itoa(size) + `"`
+
+		if r.Header.Get("If-None-Match") == etag {
+			w.Header().Set("ETag", etag)
+			w.WriteHeader(http.StatusNotModified)
+
+			return
+		}
+
+		blob, err := a.avatar.Thumbnail(ctx, uid, version, size)
+		if err != nil {
+			avatarError(w, r, err, "failed to get avatar")
+
+			return
+		}
+
+		w.Header().Set("Content-Type", blob.ContentType)
+		w.Header().Set("Content-Length", strconv.Itoa(len(blob.Data)))
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+
+		_, _ = w.Write(blob.Data)
+	}
+}
+
+// avatarError answers with the status of a refused upload or lookup,
+// anything else is an internal error described by message.
+func avatarError(w http.ResponseWriter, r *http.Request, err error, message string) {
+	status := http.StatusInternalServerError
+
+	switch {
+	case errors.Is(err, avatar.ErrTooLarge):
+		status, message = http.StatusRequestEntityTooLarge, "avatar is too large"
+	case errors.Is(err, avatar.ErrUnsupportedType):
+		status, message = http.StatusUnsupportedMediaType, "avatar must be a jpeg, png or gif"
+	case errors.Is(err, avatar.ErrInvalidImage):
+		status, message = http.StatusBadRequest, "invalid image"
+	case errors.Is(err, avatar.ErrUserNotFound):
+		status, message = http.StatusNotFound, "user not found"
+	case errors.Is(err, avatar.ErrAvatarNotFound):
+		status, message = http.StatusNotFound, "avatar not found"
+	}
+
+	render.Status(r, status)
+
+	render.JSON(w, r, resp.ErrorResponse{
+		Status: status,
+		Error:  message,
+	})
+}
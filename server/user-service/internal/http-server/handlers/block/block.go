@@ -0,0 +1,223 @@
+package block
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/go-chi/chi/middleware"
+	"github.com/go-chi/render"
+	"github.com/google/uuid"
+	"github.com/sergey-frey/cchat/user-service/internal/domain/models"
+	"github.com/sergey-frey/cchat/user-service/internal/http-server/handlers"
+	resp "github.com/sergey-frey/cchat/user-service/internal/lib/api/response"
+	"github.com/sergey-frey/cchat/user-service/internal/lib/identity"
+	"github.com/sergey-frey/cchat/user-service/internal/services/block"
+)
+
+type Block interface {
+	Block(ctx context.Context, blocker uuid.UUID, blocked uuid.UUID) (err error)
+	Unblock(ctx context.Context, blocker uuid.UUID, blocked uuid.UUID) (err error)
+	Blocks(ctx context.Context, blocker uuid.UUID, cursor string, limit int) (blocks []models.BlockedUser, cursors *models.Cursor, err error)
+	CheckBlocks(ctx context.Context, check models.BlockCheck) (result *models.BlockCheckResult, err error)
+}
+
+type BlockHandler struct {
+	block Block
+	log   *slog.Logger
+}
+
+func New(block Block, log *slog.Logger) *BlockHandler {
+	return &BlockHandler{
+		block: block,
+		log:   log,
+	}
+}
+
+type BlocksResponse struct {
+	Blocks  []models.BlockedUser `json:"blocks"`
+	RCursor models.Cursor        `json:"cursors"`
+}
+
+// @Summary Blocks
+// @Tags user
+// @Description Lists the users the authenticated user blocked, the latest first
+// @ID list-blocks
+// @Produce  json
+// @Param cursor query string false "next_cursor of the previous page"
+// @Param limit query int false "page size, 20 by default, at most 100"
+// @Success 200 {object} response.SuccessResponse{data=BlocksResponse}
+// @Failure 400,401 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Failure default {object} response.ErrorResponse
+// @Security CookieAuth
+// @Router /users/me/blocks [get]
+func (b *BlockHandler) Blocks(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limit, ok := handlers.HandlePageSize(w, r)
+		if !ok {
+			return
+		}
+
+		viewer, _ := identity.User(r.Context())
+
+		blocks, rcursor, err := b.block.Blocks(ctx, viewer.UUID, r.URL.Query().Get("cursor"), limit)
+		if err != nil {
+			blockError(w, r, err, "failed to list blocks")
+
+			return
+		}
+
+		render.JSON(w, r, resp.SuccessResponse{
+			Status: http.StatusOK,
+			Data: BlocksResponse{
+				Blocks:  blocks,
+				RCursor: *rcursor,
+			},
+		})
+	}
+}
+
+// @Summary BlockUser
+// @Tags user
+// @Description Blocks a user. They can no longer start a chat with the authenticated user or message them in a direct chat, and no longer show up in their search
+// @ID block-user
+// @Produce  json
+// @Param uuid path string true "User ID"
+// @Success 200 {object} response.SuccessResponse
+// @Failure 400,401,404 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Failure default {object} response.ErrorResponse
+// @Security CookieAuth
+// @Router /users/me/blocks/{uuid} [post]
+func (b *BlockHandler) Block(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.block.Block"
+
+		log := b.log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		blocked, ok := handlers.HandlePathUser(w, r, log)
+		if !ok {
+			return
+		}
+
+		viewer, _ := identity.User(r.Context())
+
+		if err := b.block.Block(ctx, viewer.UUID, blocked); err != nil {
+			blockError(w, r, err, "failed to block user")
+
+			return
+		}
+
+		render.JSON(w, r, resp.SuccessResponse{
+			Status: http.StatusOK,
+			Data:   "user blocked",
+		})
+	}
+}
+
+// @Summary UnblockUser
+// @Tags user
+// @Description Removes a user from the block list
+// @ID unblock-user
+// @Produce  json
+// @Param uuid path string true "User ID"
+// @Success 200 {object} response.SuccessResponse
+// @Failure 400,401 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Failure default {object} response.ErrorResponse
+// @Security CookieAuth
+// @Router /users/me/blocks/{uuid} [delete]
+func (b *BlockHandler) Unblock(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.block.Unblock"
+
+		log := b.log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		blocked, ok := handlers.HandlePathUser(w, r, log)
+		if !ok {
+			return
+		}
+
+		viewer, _ := identity.User(r.Context())
+
+		if err := b.block.Unblock(ctx, viewer.UUID, blocked); err != nil {
+			blockError(w, r, err, "failed to unblock user")
+
+			return
+		}
+
+		render.JSON(w, r, resp.SuccessResponse{
+			Status: http.StatusOK,
+			Data:   "user unblocked",
+		})
+	}
+}
+
+// @Summary CheckBlocks
+// @Tags internal
+// @Description Called by chat-service and message-service. Returns those of the others that blocked the user or were blocked by them
+// @ID check-blocks
+// @Accept  json
+// @Produce  json
+// @Param input body models.BlockCheck true "user and the users to check"
+// @Success 200 {object} response.SuccessResponse{data=models.BlockCheckResult}
+// @Failure 400,409 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /internal/blocks/check [post]
+func (b *BlockHandler) CheckBlocks(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.block.CheckBlocks"
+
+		log := b.log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		var req models.BlockCheck
+
+		err := render.Decode(r, &req)
+		if flag := handlers.HandleError(w, r, req, err, log); !flag {
+			return
+		}
+
+		result, err := b.block.CheckBlocks(ctx, req)
+		if err != nil {
+			blockError(w, r, err, "failed to check blocks")
+
+			return
+		}
+
+		render.JSON(w, r, resp.SuccessResponse{
+			Status: http.StatusOK,
+			Data:   result,
+		})
+	}
+}
+
+func blockError(w http.ResponseWriter, r *http.Request, err error, message string) {
+	status := http.StatusInternalServerError
+
+	switch {
+	case errors.Is(err, block.ErrBlockSelf):
+		status, message = http.StatusBadRequest, "you can't block yourself"
+	case errors.Is(err, block.ErrUserNotFound):
+		status, message = http.StatusNotFound, "user not found"
+	case errors.Is(err, block.ErrInvalidCursor):
+		status, message = http.StatusBadRequest, "invalid cursor"
+	}
+
+	render.Status(r, status)
+
+	render.JSON(w, r, resp.ErrorResponse{
+		Status: status,
+		Error:  message,
+	})
+}
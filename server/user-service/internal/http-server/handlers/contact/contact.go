@@ -0,0 +1,479 @@
+package contact
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/go-chi/chi/middleware"
+	"github.com/go-chi/render"
+	"github.com/google/uuid"
+	"github.com/sergey-frey/cchat/user-service/internal/domain/models"
+	"github.com/sergey-frey/cchat/user-service/internal/http-server/handlers"
+	resp "github.com/sergey-frey/cchat/user-service/internal/lib/api/response"
+	"github.com/sergey-frey/cchat/user-service/internal/lib/identity"
+	"github.com/sergey-frey/cchat/user-service/internal/services/contact"
+)
+
+type Contact interface {
+	SendRequest(ctx context.Context, requester uuid.UUID, addressee uuid.UUID) (accepted bool, err error)
+	AcceptRequest(ctx context.Context, addressee uuid.UUID, requester uuid.UUID) (err error)
+	DeleteRequest(ctx context.Context, requester uuid.UUID, addressee uuid.UUID) (err error)
+	Requests(ctx context.Context, user uuid.UUID, incoming bool, cursor string, limit int) (requests []models.ContactRequest, cursors *models.Cursor, err error)
+	Contacts(ctx context.Context, owner uuid.UUID, cursor string, limit int) (contacts []models.Contact, cursors *models.Cursor, err error)
+	UpdateContact(ctx context.Context, owner uuid.UUID, contact uuid.UUID, update models.UpdateContact) (updated *models.Contact, err error)
+	RemoveContact(ctx context.Context, owner uuid.UUID, contact uuid.UUID) (err error)
+	CheckContacts(ctx context.Context, check models.ContactCheck) (result *models.ContactCheckResult, err error)
+}
+
+type ContactHandler struct {
+	contact Contact
+	log     *slog.Logger
+}
+
+func New(contact Contact, log *slog.Logger) *ContactHandler {
+	return &ContactHandler{
+		contact: contact,
+		log:     log,
+	}
+}
+
+type ContactsResponse struct {
+	Contacts []models.Contact `json:"contacts"`
+	RCursor  models.Cursor    `json:"cursors"`
+}
+
+type RequestsResponse struct {
+	Requests []models.ContactRequest `json:"requests"`
+	RCursor  models.Cursor           `json:"cursors"`
+}
+
+// @Summary Contacts
+// @Tags contact
+// @Description Lists the contacts of the authenticated user, the latest first
+// @ID list-contacts
+// @Produce  json
+// @Param cursor query string false "next_cursor of the previous page"
+// @Param limit query int false "page size, 20 by default, at most 100"
+// @Success 200 {object} response.SuccessResponse{data=ContactsResponse}
+// @Failure 400,401 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Failure default {object} response.ErrorResponse
+// @Security CookieAuth
+// @Router /users/me/contacts [get]
+func (c *ContactHandler) Contacts(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limit, ok := handlers.HandlePageSize(w, r)
+		if !ok {
+			return
+		}
+
+		viewer, _ := identity.User(r.Context())
+
+		contacts, rcursor, err := c.contact.Contacts(ctx, viewer.UUID, r.URL.Query().Get("cursor"), limit)
+		if err != nil {
+			contactError(w, r, err, "failed to list contacts")
+
+			return
+		}
+
+		render.JSON(w, r, resp.SuccessResponse{
+			Status: http.StatusOK,
+			Data: ContactsResponse{
+				Contacts: contacts,
+				RCursor:  *rcursor,
+			},
+		})
+	}
+}
+
+// @Summary UpdateContact
+// @Tags contact
+// @Description Gives a contact a nickname only the authenticated user sees, an empty one removes it
+// @ID update-contact
+// @Accept  json
+// @Produce  json
+// @Param uuid path string true "User ID"
+// @Param input body models.UpdateContact true "nickname"
+// @Success 200 {object} response.SuccessResponse{data=models.Contact}
+// @Failure 400,401,404,409 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Failure default {object} response.ErrorResponse
+// @Security CookieAuth
+// @Router /users/me/contacts/{uuid} [patch]
+func (c *ContactHandler) UpdateContact(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.contact.UpdateContact"
+
+		log := c.log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		uid, ok := handlers.HandlePathUser(w, r, log)
+		if !ok {
+			return
+		}
+
+		var req models.UpdateContact
+
+		err := render.Decode(r, &req)
+		if flag := handlers.HandleError(w, r, req, err, log); !flag {
+			return
+		}
+
+		viewer, _ := identity.User(r.Context())
+
+		updated, err := c.contact.UpdateContact(ctx, viewer.UUID, uid, req)
+		if err != nil {
+			contactError(w, r, err, "failed to update contact")
+
+			return
+		}
+
+		render.JSON(w, r, resp.SuccessResponse{
+			Status: http.StatusOK,
+			Data:   updated,
+		})
+	}
+}
+
+// @Summary RemoveContact
+// @Tags contact
+// @Description Removes a contact, for both sides
+// @ID remove-contact
+// @Produce  json
+// @Param uuid path string true "User ID"
+// @Success 200 {object} response.SuccessResponse
+// @Failure 400,401 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Failure default {object} response.ErrorResponse
+// @Security CookieAuth
+// @Router /users/me/contacts/{uuid} [delete]
+func (c *ContactHandler) RemoveContact(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.contact.RemoveContact"
+
+		log := c.log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		uid, ok := handlers.HandlePathUser(w, r, log)
+		if !ok {
+			return
+		}
+
+		viewer, _ := identity.User(r.Context())
+
+		if err := c.contact.RemoveContact(ctx, viewer.UUID, uid); err != nil {
+			contactError(w, r, err, "failed to remove contact")
+
+			return
+		}
+
+		render.JSON(w, r, resp.SuccessResponse{
+			Status: http.StatusOK,
+			Data:   "contact removed",
+		})
+	}
+}
+
+// @Summary ContactRequests
+// @Tags contact
+// @Description Lists the pending contact requests the authenticated user received, or sent with direction=outgoing
+// @ID list-contact-requests
+// @Produce  json
+// @Param direction query string false "incoming (default) or outgoing"
+// @Param cursor query string false "next_cursor of the previous page"
+// @Param limit query int false "page size, 20 by default, at most 100"
+// @Success 200 {object} response.SuccessResponse{data=RequestsResponse}
+// @Failure 400,401 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Failure default {object} response.ErrorResponse
+// @Security CookieAuth
+// @Router /users/me/contacts/requests [get]
+func (c *ContactHandler) Requests(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		var incoming bool
+
+		switch query.Get("direction") {
+		case "", "incoming":
+			incoming = true
+		case "outgoing":
+		default:
+			render.Status(r, http.StatusBadRequest)
+
+			render.JSON(w, r, resp.ErrorResponse{
+				Status: http.StatusBadRequest,
+				Error:  "direction must be incoming or outgoing",
+			})
+
+			return
+		}
+
+		limit, ok := handlers.HandlePageSize(w, r)
+		if !ok {
+			return
+		}
+
+		viewer, _ := identity.User(r.Context())
+
+		requests, rcursor, err := c.contact.Requests(ctx, viewer.UUID, incoming, query.Get("cursor"), limit)
+		if err != nil {
+			contactError(w, r, err, "failed to list contact requests")
+
+			return
+		}
+
+		render.JSON(w, r, resp.SuccessResponse{
+			Status: http.StatusOK,
+			Data: RequestsResponse{
+				Requests: requests,
+				RCursor:  *rcursor,
+			},
+		})
+	}
+}
+
+// @Summary SendContactRequest
+// @Tags contact
+// @Description Asks a user to become a contact. If they already asked the authenticated user, the two become contacts right away
+// @ID send-contact-request
+// @Produce  json
+// @Param uuid path string true "User ID"
+// @Success 200 {object} response.SuccessResponse
+// @Failure 400,401,403,404,409 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Failure default {object} response.ErrorResponse
+// @Security CookieAuth
+// @Router /users/me/contacts/requests/{uuid} [post]
+func (c *ContactHandler) SendRequest(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.contact.SendRequest"
+
+		log := c.log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		uid, ok := handlers.HandlePathUser(w, r, log)
+		if !ok {
+			return
+		}
+
+		viewer, _ := identity.User(r.Context())
+
+		accepted, err := c.contact.SendRequest(ctx, viewer.UUID, uid)
+		if err != nil {
+			contactError(w, r, err, "failed to send contact request")
+
+			return
+		}
+
+		message := "contact request sent"
+		if accepted {
+			message = "contact added"
+		}
+
+		render.JSON(w, r, resp.SuccessResponse{
+			Status: http.StatusOK,
+			Data:   message,
+		})
+	}
+}
+
+// @Summary CancelContactRequest
+// @Tags contact
+// @Description Takes back a contact request the authenticated user sent
+// @ID cancel-contact-request
+// @Produce  json
+// @Param uuid path string true "User ID"
+// @Success 200 {object} response.SuccessResponse
+// @Failure 400,401,404 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Failure default {object} response.ErrorResponse
+// @Security CookieAuth
+// @Router /users/me/contacts/requests/{uuid} [delete]
+func (c *ContactHandler) CancelRequest(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.contact.CancelRequest"
+
+		log := c.log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		uid, ok := handlers.HandlePathUser(w, r, log)
+		if !ok {
+			return
+		}
+
+		viewer, _ := identity.User(r.Context())
+
+		if err := c.contact.DeleteRequest(ctx, viewer.UUID, uid); err != nil {
+			contactError(w, r, err, "failed to cancel contact request")
+
+			return
+		}
+
+		render.JSON(w, r, resp.SuccessResponse{
+			Status: http.StatusOK,
+			Data:   "contact request canceled",
+		})
+	}
+}
+
+// @Summary AcceptContactRequest
+// @Tags contact
+// @Description Accepts the contact request a user sent to the authenticated user
+// @ID accept-contact-request
+// @Produce  json
+// @Param uuid path string true "User ID of the requester"
+// @Success 200 {object} response.SuccessResponse
+// @Failure 400,401,404 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Failure default {object} response.ErrorResponse
+// @Security CookieAuth
+// @Router /users/me/contacts/requests/{uuid}/accept [post]
+func (c *ContactHandler) AcceptRequest(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.contact.AcceptRequest"
+
+		log := c.log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		uid, ok := handlers.HandlePathUser(w, r, log)
+		if !ok {
+			return
+		}
+
+		viewer, _ := identity.User(r.Context())
+
+		if err := c.contact.AcceptRequest(ctx, viewer.UUID, uid); err != nil {
+			contactError(w, r, err, "failed to accept contact request")
+
+			return
+		}
+
+		render.JSON(w, r, resp.SuccessResponse{
+			Status: http.StatusOK,
+			Data:   "contact added",
+		})
+	}
+}
+
+// @Summary DeclineContactRequest
+// @Tags contact
+// @Description Declines the contact request a user sent to the authenticated user, the requester is not told
+// @ID decline-contact-request
+// @Produce  json
+// @Param uuid path string true "User ID of the requester"
+// @Success 200 {object} response.SuccessResponse
+// @Failure 400,401,404 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Failure default {object} response.ErrorResponse
+// @Security CookieAuth
+// @Router /users/me/contacts/requests/{uuid}/decline [post]
+func (c *ContactHandler) DeclineRequest(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.contact.DeclineRequest"
+
+		log := c.log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		uid, ok := handlers.HandlePathUser(w, r, log)
+		if !ok {
+			return
+		}
+
+		viewer, _ := identity.User(r.Context())
+
+		if err := c.contact.DeleteRequest(ctx, uid, viewer.UUID); err != nil {
+			contactError(w, r, err, "failed to decline contact request")
+
+			return
+		}
+
+		render.JSON(w, r, resp.SuccessResponse{
+			Status: http.StatusOK,
+			Data:   "contact request declined",
+		})
+	}
+}
+
+// @Summary CheckContacts
+// @Tags internal
+// @Description Called by the other services. Returns those of the others that are contacts of the user
+// @ID check-contacts
+// @Accept  json
+// @Produce  json
+// @Param input body models.ContactCheck true "user and the users to check"
+// @Success 200 {object} response.SuccessResponse{data=models.ContactCheckResult}
+// @Failure 400,409 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /internal/contacts/check [post]
+func (c *ContactHandler) CheckContacts(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.contact.CheckContacts"
+
+		log := c.log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		var req models.ContactCheck
+
+		err := render.Decode(r, &req)
+		if flag := handlers.HandleError(w, r, req, err, log); !flag {
+			return
+		}
+
+		result, err := c.contact.CheckContacts(ctx, req)
+		if err != nil {
+			contactError(w, r, err, "failed to check contacts")
+
+			return
+		}
+
+		render.JSON(w, r, resp.SuccessResponse{
+			Status: http.StatusOK,
+			Data:   result,
+		})
+	}
+}
+
+func contactError(w http.ResponseWriter, r *http.Request, err error, message string) {
+	status := http.StatusInternalServerError
+
+	switch {
+	case errors.Is(err, contact.ErrContactSelf):
+		status, message = http.StatusBadRequest, "you can't add yourself"
+	case errors.Is(err, contact.ErrInvalidCursor):
+		status, message = http.StatusBadRequest, "invalid cursor"
+	case errors.Is(err, contact.ErrBlocked):
+		status, message = http.StatusForbidden, "user does not accept contact requests from you"
+	case errors.Is(err, contact.ErrUserNotFound):
+		status, message = http.StatusNotFound, "user not found"
+	case errors.Is(err, contact.ErrContactNotFound):
+		status, message = http.StatusNotFound, "contact not found"
+	case errors.Is(err, contact.ErrRequestNotFound):
+		status, message = http.StatusNotFound, "contact request not found"
+	case errors.Is(err, contact.ErrAlreadyContacts):
+		status, message = http.StatusConflict, "user is already a contact"
+	}
+
+	render.Status(r, status)
+
+	render.JSON(w, r, resp.ErrorResponse{
+		Status: status,
+		Error:  message,
+	})
+}
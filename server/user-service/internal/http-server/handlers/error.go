@@ -5,9 +5,12 @@ import (
 	"io"
 	"log/slog"
 	"net/http"
+	"strconv"
 
+	"github.com/go-chi/chi"
 	"github.com/go-chi/render"
 	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
 	resp "github.com/sergey-frey/cchat/user-service/internal/lib/api/response"
 	"github.com/sergey-frey/cchat/user-service/internal/lib/logger/sl"
 )
@@ -70,3 +73,45 @@ func HandleGettingCookie(w http.ResponseWriter, r *http.Request, err error, log
 
 	return true
 }
+
+// HandlePageSize reads the limit query parameter of a paged list, 20 when
+// it is missing and at most 100.
+func HandlePageSize(w http.ResponseWriter, r *http.Request) (int, bool) {
+	raw := r.URL.Query().Get("limit")
+	if raw == "" {
+		return 20, true
+	}
+
+	limit, err := strconv.Atoi(raw)
+	if err != nil || limit < 1 {
+		render.Status(r, http.StatusBadRequest)
+
+		render.JSON(w, r, resp.ErrorResponse{
+			Status: http.StatusBadRequest,
+			Error:  "limit must be more than 0",
+		})
+
+		return 0, false
+	}
+
+	return min(limit, 100), true
+}
+
+// HandlePathUser reads the {uuid} path parameter.
+func HandlePathUser(w http.ResponseWriter, r *http.Request, log *slog.Logger) (uuid.UUID, bool) {
+	uid, err := uuid.Parse(chi.URLParam(r, "uuid"))
+	if err != nil {
+		log.Warn("invalid user id", sl.Err(err))
+
+		render.Status(r, http.StatusBadRequest)
+
+		render.JSON(w, r, resp.ErrorResponse{
+			Status: http.StatusBadRequest,
+			Error:  "invalid user id",
+		})
+
+		return uuid.Nil, false
+	}
+
+	return uid, true
+}
@@ -0,0 +1,81 @@
+package export
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/go-chi/chi/middleware"
+	"github.com/go-chi/render"
+	"github.com/google/uuid"
+	"github.com/sergey-frey/cchat/user-service/internal/domain/models"
+	"github.com/sergey-frey/cchat/user-service/internal/http-server/handlers"
+	resp "github.com/sergey-frey/cchat/user-service/internal/lib/api/response"
+	"github.com/sergey-frey/cchat/user-service/internal/services/export"
+)
+
+type Export interface {
+	ExportUser(ctx context.Context, uid uuid.UUID) (export *models.UserExport, err error)
+}
+
+type ExportHandler struct {
+	export Export
+	log    *slog.Logger
+}
+
+func New(export Export, log *slog.Logger) *ExportHandler {
+	return &ExportHandler{
+		export: export,
+		log:    log,
+	}
+}
+
+// @Summary ExportUser
+// @Tags internal
+// @Description Called by auth-service for a data export. Returns the profile, privacy settings, username history, contacts, contact requests and blocks of the user
+// @ID export-user
+// @Produce  json
+// @Param uuid path string true "User ID"
+// @Success 200 {object} response.SuccessResponse{data=models.UserExport}
+// @Failure 400,401,403,404 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /internal/users/{uuid}/export [get]
+func (e *ExportHandler) ExportUser(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.export.ExportUser"
+
+		log := e.log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		uid, ok := handlers.HandlePathUser(w, r, log)
+		if !ok {
+			return
+		}
+
+		data, err := e.export.ExportUser(ctx, uid)
+		if err != nil {
+			status, message := http.StatusInternalServerError, "failed to export user"
+
+			if errors.Is(err, export.ErrUserNotFound) {
+				status, message = http.StatusNotFound, "user not found"
+			}
+
+			render.Status(r, status)
+
+			render.JSON(w, r, resp.ErrorResponse{
+				Status: status,
+				Error:  message,
+			})
+
+			return
+		}
+
+		render.JSON(w, r, resp.SuccessResponse{
+			Status: http.StatusOK,
+			Data:   data,
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package privacy
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/go-chi/chi/middleware"
+	"github.com/go-chi/render"
+	"github.com/google/uuid"
+	"github.com/sergey-frey/cchat/user-service/internal/domain/models"
+	"github.com/sergey-frey/cchat/user-service/internal/http-server/handlers"
+	resp "github.com/sergey-frey/cchat/user-service/internal/lib/api/response"
+	"github.com/sergey-frey/cchat/user-service/internal/lib/identity"
+	"github.com/sergey-frey/cchat/user-service/internal/services/user"
+)
+
+type Privacy interface {
+	Privacy(ctx context.Context, uid uuid.UUID) (settings *models.PrivacySettings, err error)
+	UpdatePrivacy(ctx context.Context, uid uuid.UUID, update models.UpdatePrivacy) (settings *models.PrivacySettings, err error)
+	CheckChat(ctx context.Context, check models.ChatCheck) (result *models.ChatCheckResult, err error)
+}
+
+type PrivacyHandler struct {
+	privacy Privacy
+	log     *slog.Logger
+}
+
+func New(privacy Privacy, log *slog.Logger) *PrivacyHandler {
+	return &PrivacyHandler{
+		privacy: privacy,
+		log:     log,
+	}
+}
+
+// @Summary Privacy
+// @Tags user
+// @Description Returns the privacy settings of the authenticated user
+// @ID get-privacy
+// @Produce  json
+// @Success 200 {object} response.SuccessResponse{data=models.PrivacySettings}
+// @Failure 401,404 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Failure default {object} response.ErrorResponse
+// @Security CookieAuth
+// @Router /profiles/me/privacy [get]
+func (p *PrivacyHandler) Privacy(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		viewer, _ := identity.User(r.Context())
+
+		settings, err := p.privacy.Privacy(ctx, viewer.UUID)
+		if err != nil {
+			privacyError(w, r, err, "failed to get privacy settings")
+
+			return
+		}
+
+		render.JSON(w, r, resp.SuccessResponse{
+			Status: http.StatusOK,
+			Data:   settings,
+		})
+	}
+}
+
+// @Summary UpdatePrivacy
+// @Tags user
+// @Description Changes the privacy settings present in the body. Visibilities are everyone, contacts or nobody
+// @ID update-privacy
+// @Accept  json
+// @Produce  json
+// @Param input body models.UpdatePrivacy true "settings to change"
+// @Success 200 {object} response.SuccessResponse{data=models.PrivacySettings}
+// @Failure 400,401,404,409 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Failure default {object} response.ErrorResponse
+// @Security CookieAuth
+// @Router /profiles/me/privacy [patch]
+func (p *PrivacyHandler) UpdatePrivacy(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.privacy.UpdatePrivacy"
+
+		log := p.log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		var req models.UpdatePrivacy
+
+		err := render.Decode(r, &req)
+		if flag := handlers.HandleError(w, r, req, err, log); !flag {
+			return
+		}
+
+		viewer, _ := identity.User(r.Context())
+
+		settings, err := p.privacy.UpdatePrivacy(ctx, viewer.UUID, req)
+		if err != nil {
+			privacyError(w, r, err, "failed to update privacy settings")
+
+			return
+		}
+
+		render.JSON(w, r, resp.SuccessResponse{
+			Status: http.StatusOK,
+			Data:   settings,
+		})
+	}
+}
+
+// @Summary CheckChat
+// @Tags internal
+// @Description Called by chat-service before creating a chat. Returns the users that do not accept a chat started by the initiator
+// @ID check-chat
+// @Accept  json
+// @Produce  json
+// @Param input body models.ChatCheck true "initiator and participants"
+// @Success 200 {object} response.SuccessResponse{data=models.ChatCheckResult}
+// @Failure 400,409 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /internal/privacy/chat-check [post]
+func (p *PrivacyHandler) CheckChat(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.privacy.CheckChat"
+
+		log := p.log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		var req models.ChatCheck
+
+		err := render.Decode(r, &req)
+		if flag := handlers.HandleError(w, r, req, err, log); !flag {
+			return
+		}
+
+		result, err := p.privacy.CheckChat(ctx, req)
+		if err != nil {
+			privacyError(w, r, err, "failed to check chat")
+
+			return
+		}
+
+		render.JSON(w, r, resp.SuccessResponse{
+			Status: http.StatusOK,
+			Data:   result,
+		})
+	}
+}
+
+func privacyError(w http.ResponseWriter, r *http.Request, err error, message string) {
+	status := http.StatusInternalServerError
+
+	if errors.Is(err, user.ErrUserNotFound) {
+		status, message = http.StatusNotFound, "user not found"
+	}
+
+	render.Status(r, status)
+
+	render.JSON(w, r, resp.ErrorResponse{
+		Status: status,
+		Error:  message,
+	})
+}
@@ -5,25 +5,34 @@ import (
 	"errors"
 	"log/slog"
 	"net/http"
-	"strconv"
+	"net/url"
+	"strings"
 
-	// "github.com/go-chi/chi"
+	"github.com/go-chi/chi"
 	"github.com/go-chi/chi/middleware"
 	"github.com/go-chi/render"
+	"github.com/google/uuid"
 	"github.com/sergey-frey/cchat/user-service/internal/domain/models"
 	"github.com/sergey-frey/cchat/user-service/internal/http-server/handlers"
 	resp "github.com/sergey-frey/cchat/user-service/internal/lib/api/response"
 	"github.com/sergey-frey/cchat/user-service/internal/lib/cookie"
+	"github.com/sergey-frey/cchat/user-service/internal/lib/identity"
 	"github.com/sergey-frey/cchat/user-service/internal/lib/logger/sl"
 	"github.com/sergey-frey/cchat/user-service/internal/services/user"
 )
 
 type User interface {
 	CreateUser(ctx context.Context, email string) (info *models.NormalizedUser, err error)
-	GetUserByID(ctx context.Context, uuid string) (info *models.UserInfo, err error)
+	GetUserByID(ctx context.Context, viewer uuid.UUID, uid uuid.UUID) (info *models.UserInfo, err error)
 	GetUserByEmail(ctx context.Context, email string) (info *models.NormalizedUser, err error)
-	Profiles(ctx context.Context, username string, cursor string, limit int) (profiles []models.UserInfo, cursors *models.Cursor, err error)
-	UpdateInfo(ctx context.Context, username string, newInfo models.NewUserInfo) (info *models.UserInfo, accessToken string, refreshToken string, err error)
+	UserByID(ctx context.Context, uid uuid.UUID) (info *models.NormalizedUser, err error)
+	UserByUsername(ctx context.Context, viewer uuid.UUID, username string) (info *models.UserInfo, redirected bool, err error)
+	Profiles(ctx context.Context, viewer uuid.UUID, query string, cursor string, limit int) (profiles []models.UserInfo, cursors *models.Cursor, err error)
+	UpdateInfo(ctx context.Context, uid uuid.UUID, newInfo models.NewUserInfo) (info *models.UserInfo, err error)
+	AnonymizeUser(ctx context.Context, uid uuid.UUID) (err error)
+	SearchUsers(ctx context.Context, query string, cursor string, limit int) (users []models.UserInfo, cursors *models.Cursor, err error)
+	CheckUsers(ctx context.Context, uids []uuid.UUID) (result *models.UserCheckResult, err error)
+	Users(ctx context.Context, batch models.UserBatch) (users []models.UserInfo, err error)
 }
 
 type UserHandler struct {
@@ -84,18 +93,19 @@ func (u *UserHandler) CreateUser(ctx context.Context) http.HandlerFunc {
 	}
 }
 
-// @Summary GetMyProfile
+// @Summary GetProfileByID
 // @Tags user
-// @Description Retrieves data about an authenticated user
-// @ID get-my-profile
+// @Description Returns the profile of a user. The email and last-seen time are empty when the user hides them from the caller
+// @ID get-profile-by-id
 // @Accept  json
 // @Produce  json
-// @Success 200 {object} response.SuccessResponse
-// @Failure 400,409 {object} response.ErrorResponse
+// @Param uuid path string true "User ID"
+// @Success 200 {object} response.SuccessResponse{data=models.UserInfo}
+// @Failure 400,401,404 {object} response.ErrorResponse
 // @Failure 500 {object} response.ErrorResponse
 // @Failure default {object} response.ErrorResponse
 // @Security CookieAuth
-// @Router /user/myprofile [get]
+// @Router /users/{uuid} [get]
 //
 //go:generate go run github.com/vektra/mockery/v2@v2.53 --name=User
 func (u *UserHandler) GetUserByID(ctx context.Context) http.HandlerFunc {
@@ -112,8 +122,33 @@ func (u *UserHandler) GetUserByID(ctx context.Context) http.HandlerFunc {
 			return
 		}
 
-		info, err := u.userHandler.GetUserByID(ctx, userInfo.Username)
+		uid, err := uuid.Parse(chi.URLParam(r, "uuid"))
 		if err != nil {
+			log.Warn("invalid user id", sl.Err(err))
+
+			render.Status(r, http.StatusBadRequest)
+
+			render.JSON(w, r, resp.ErrorResponse{
+				Status: http.StatusBadRequest,
+				Error:  "invalid user id",
+			})
+
+			return
+		}
+
+		info, err := u.userHandler.GetUserByID(ctx, userInfo.UUID, uid)
+		if err != nil {
+			if errors.Is(err, user.ErrUserNotFound) {
+				render.Status(r, http.StatusNotFound)
+
+				render.JSON(w, r, resp.ErrorResponse{
+					Status: http.StatusNotFound,
+					Error:  "user not found",
+				})
+
+				return
+			}
+
 			log.Error("failed to get info")
 
 			render.Status(r, http.StatusInternalServerError)
@@ -225,116 +260,138 @@ func (u *UserHandler) GetUserByEmail(ctx context.Context) http.HandlerFunc {
 	}
 }
 
-// @Summary Profiles
+// @Summary ProfileByUsername
 // @Tags user
-// @Description Returns a list of users with a matching username
-// @ID list-profiles
-// @Produce json
-// @Param username query string false "Username"
-// @Param cursor query int false "ID of the user after whom the search will take place, 0 if at first"
-// @Param limit query int true "Size of the list of returned users"
-// @Success 200 {object} response.SuccessResponse
-// @Failure 400,409 {object} response.ErrorResponse
+// @Description Returns the profile of the user holding a username, case does not matter. A username released during the redirect period redirects to the current username of its previous owner
+// @ID get-profile-by-username
+// @Produce  json
+// @Param username path string true "Username"
+// @Success 200 {object} response.SuccessResponse{data=models.UserInfo}
+// @Success 302 "the username was released, Location holds the current one"
+// @Failure 401,404 {object} response.ErrorResponse
 // @Failure 500 {object} response.ErrorResponse
 // @Failure default {object} response.ErrorResponse
 // @Security CookieAuth
-// @Router /user/list-profiles [get]
-func (u *UserHandler) Profiles(ctx context.Context) http.HandlerFunc {
+// @Router /profiles/by-username/{username} [get]
+func (u *UserHandler) ProfileByUsername(ctx context.Context) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		const op = "handlers.user.UpdateUserInfo"
+		const op = "handlers.user.ProfileByUsername"
 
 		log := u.log.With(
 			slog.String("op", op),
 			slog.String("request_id", middleware.GetReqID(r.Context())),
 		)
 
-		username := r.URL.Query().Get("username")
-		if username == "" {
-			log.Warn("username is empty")
+		viewer, _ := identity.User(r.Context())
 
-			render.Status(r, http.StatusOK)
-
-			render.JSON(w, r, resp.SuccessResponse{
-				Status: http.StatusOK,
-				Data: ProfilesResponse{
-					Profiles: []models.UserInfo{},
-					RCursor:  models.Cursor{},
-				},
-			})
+		info, redirected, err := u.userHandler.UserByUsername(ctx, viewer.UUID, chi.URLParam(r, "username"))
+		if err != nil {
+			if errors.Is(err, user.ErrUserNotFound) {
+				render.Status(r, http.StatusNotFound)
 
-			return
-		}
+				render.JSON(w, r, resp.ErrorResponse{
+					Status: http.StatusNotFound,
+					Error:  "user not found",
+				})
 
-		stringCursor := r.URL.Query().Get("cursor")
+				return
+			}
 
-		stringPageSize := r.URL.Query().Get("limit")
-		if stringPageSize == "" {
-			log.Warn("limit is empty")
+			log.Error("failed to get profile", sl.Err(err))
 
-			render.Status(r, http.StatusConflict)
+			render.Status(r, http.StatusInternalServerError)
 
 			render.JSON(w, r, resp.ErrorResponse{
-				Status: http.StatusConflict,
-				Error:  "limit is empty",
+				Status: http.StatusInternalServerError,
+				Error:  "failed to get profile",
 			})
 
 			return
 		}
 
-		var cursor string
-		var err error
+		if redirected {
+			// The Location is relative, so it resolves below whatever prefix
+			// the gateway serves this route under.
+			w.Header().Set("Location", url.PathEscape(info.Username))
+			w.WriteHeader(http.StatusFound)
 
-		if stringCursor == "" {
-			cursor = ""
-		} else {
+			return
 		}
 
-		limit, err := strconv.Atoi(stringPageSize)
-		if err != nil {
-			log.Warn("failed to convert limit")
+		render.JSON(w, r, resp.SuccessResponse{
+			Status: http.StatusOK,
+			Data:   info,
+		})
+	}
+}
 
-			render.Status(r, http.StatusInternalServerError)
+// @Summary Profiles
+// @Tags user
+// @Description Searches users by username and name, tolerating typos. Exact matches and contacts come first.
+// @Description Users that opted out of search are left out, emails and last-seen times are empty where their owners hide them
+// @ID list-profiles
+// @Produce json
+// @Param query query string false "part of the username or name"
+// @Param username query string false "same as query, kept for older clients"
+// @Param cursor query string false "next_cursor of the previous page"
+// @Param limit query int false "page size, 20 by default, at most 100"
+// @Success 200 {object} response.SuccessResponse{data=ProfilesResponse}
+// @Failure 400,401 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Failure default {object} response.ErrorResponse
+// @Security CookieAuth
+// @Router /profiles [get]
+func (u *UserHandler) Profiles(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.user.Profiles"
 
-			render.JSON(w, r, resp.ErrorResponse{
-				Status: http.StatusInternalServerError,
-				Error:  "failed to convert limit",
-			})
+		log := u.log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
 
-			return
-		}
+		query := r.URL.Query()
 
-		if limit < 1 {
-			log.Warn("limit must be more than 0")
+		search := strings.TrimSpace(query.Get("query"))
+		if search == "" {
+			search = strings.TrimSpace(query.Get("username"))
+		}
 
-			render.Status(r, http.StatusBadRequest)
+		if search == "" {
+			log.Warn("query is empty")
 
-			render.JSON(w, r, resp.ErrorResponse{
-				Status: http.StatusBadRequest,
-				Error:  "limit must be more than 0",
+			render.JSON(w, r, resp.SuccessResponse{
+				Status: http.StatusOK,
+				Data: ProfilesResponse{
+					Profiles: []models.UserInfo{},
+					RCursor:  models.Cursor{},
+				},
 			})
 
 			return
 		}
 
-		profiles, rcursor, err := u.userHandler.Profiles(ctx, username, cursor, limit)
-		if err != nil {
-			if errors.Is(err, user.ErrUsersNotFound) {
-				log.Warn("users not found")
+		limit, ok := handlers.HandlePageSize(w, r)
+		if !ok {
+			return
+		}
 
-				render.Status(r, http.StatusOK)
+		viewer, _ := identity.User(r.Context())
+
+		profiles, rcursor, err := u.userHandler.Profiles(ctx, viewer.UUID, search, query.Get("cursor"), limit)
+		if err != nil {
+			if errors.Is(err, user.ErrInvalidCursor) {
+				render.Status(r, http.StatusBadRequest)
 
-				render.JSON(w, r, resp.SuccessResponse{
-					Status: http.StatusOK,
-					Data: ProfilesResponse{
-						Profiles: []models.UserInfo{},
-						RCursor:  models.Cursor{},
-					},
+				render.JSON(w, r, resp.ErrorResponse{
+					Status: http.StatusBadRequest,
+					Error:  "invalid cursor",
 				})
 
 				return
 			}
 
-			log.Error("internal error")
+			log.Error("failed to get profiles", sl.Err(err))
 
 			render.Status(r, http.StatusInternalServerError)
 
@@ -360,17 +417,18 @@ func (u *UserHandler) Profiles(ctx context.Context) http.HandlerFunc {
 
 // @Summary UpdateProfile
 // @Tags user
-// @Description Updates the user's information
+// @Description Updates the profile of the authenticated user. Only the fields in the body are changed,
+// @Description an empty bio, avatar or status text clears it. The timezone is an IANA name
 // @ID update-profile
 // @Accept  json
 // @Produce  json
-// @Param input body models.NewUserInfo true "The new password is at least 8 characters long and has a valid email address."
-// @Success 200 {object} response.SuccessResponse
-// @Failure 400,409 {object} response.ErrorResponse
+// @Param input body models.NewUserInfo true "fields to change"
+// @Success 200 {object} response.SuccessResponse{data=models.UserInfo}
+// @Failure 400,401,404,409 {object} response.ErrorResponse
 // @Failure 500 {object} response.ErrorResponse
 // @Failure default {object} response.ErrorResponse
 // @Security CookieAuth
-// @Router /user/update [patch]
+// @Router /profiles/me [patch]
 func (u *UserHandler) UpdateInfo(ctx context.Context) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		const op = "handlers.user.UpdateUserInfo"
@@ -387,18 +445,22 @@ func (u *UserHandler) UpdateInfo(ctx context.Context) http.HandlerFunc {
 			return
 		}
 
-		userInfo, err := cookie.TakeUserInfo(w, r)
-		if flag := handlers.HandleGettingCookie(w, r, err, log); !flag {
-			return
-		}
-
-		info, accessToken, refreshToken, err := u.userHandler.UpdateInfo(ctx, userInfo.Username, newInfo)
+		userInfo, _ := identity.User(r.Context())
 
-		if refreshToken != "" {
-			cookie.SetCookie(w, accessToken, refreshToken)
-		}
+		info, err := u.userHandler.UpdateInfo(ctx, userInfo.UUID, newInfo)
 
 		if err != nil {
+			if errors.Is(err, user.ErrUserNotFound) {
+				render.Status(r, http.StatusNotFound)
+
+				render.JSON(w, r, resp.ErrorResponse{
+					Status: http.StatusNotFound,
+					Error:  "user not found",
+				})
+
+				return
+			}
+
 			if errors.Is(err, user.ErrUsernameExists) {
 				render.Status(r, http.StatusConflict)
 
@@ -410,23 +472,23 @@ func (u *UserHandler) UpdateInfo(ctx context.Context) http.HandlerFunc {
 				return
 			}
 
-			if errors.Is(err, user.ErrEmailExists) {
+			if errors.Is(err, user.ErrUsernameCooldown) {
 				render.Status(r, http.StatusConflict)
 
 				render.JSON(w, r, resp.ErrorResponse{
 					Status: http.StatusConflict,
-					Error:  "email already exists",
+					Error:  "username was released recently and is not available yet",
 				})
 
 				return
 			}
 
-			if errors.Is(err, user.ErrPasswordsMismatch) {
-				render.Status(r, http.StatusConflict)
+			if errors.Is(err, user.ErrUsernameReserved) {
+				render.Status(r, http.StatusBadRequest)
 
 				render.JSON(w, r, resp.ErrorResponse{
-					Status: http.StatusConflict,
-					Error:  "passwords don't match",
+					Status: http.StatusBadRequest,
+					Error:  "username is reserved",
 				})
 
 				return
@@ -450,3 +512,275 @@ func (u *UserHandler) UpdateInfo(ctx context.Context) http.HandlerFunc {
 		})
 	}
 }
+
+// @Summary InternalUser
+// @Tags internal
+// @Description Called by auth-service to look a user up by id, as for an identity link or a refreshed session. Returns the id, email and username
+// @ID internal-user
+// @Produce  json
+// @Param uuid path string true "User ID"
+// @Success 200 {object} response.SuccessResponse{data=models.NormalizedUser}
+// @Failure 400,404 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /internal/users/{uuid} [get]
+func (u *UserHandler) InternalUser(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.user.InternalUser"
+
+		log := u.log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		uid, err := uuid.Parse(chi.URLParam(r, "uuid"))
+		if err != nil {
+			log.Warn("invalid user id", sl.Err(err))
+
+			render.Status(r, http.StatusBadRequest)
+
+			render.JSON(w, r, resp.ErrorResponse{
+				Status: http.StatusBadRequest,
+				Error:  "invalid user id",
+			})
+
+			return
+		}
+
+		info, err := u.userHandler.UserByID(ctx, uid)
+		if err != nil {
+			if errors.Is(err, user.ErrUserNotFound) {
+				render.Status(r, http.StatusNotFound)
+
+				render.JSON(w, r, resp.ErrorResponse{
+					Status: http.StatusNotFound,
+					Error:  "user not found",
+				})
+
+				return
+			}
+
+			render.Status(r, http.StatusInternalServerError)
+
+			render.JSON(w, r, resp.ErrorResponse{
+				Status: http.StatusInternalServerError,
+				Error:  "failed to get user",
+			})
+
+			return
+		}
+
+		render.JSON(w, r, resp.SuccessResponse{
+			Status: http.StatusOK,
+			Data:   info,
+		})
+	}
+}
+
+// @Summary AnonymizeUser
+// @Tags internal
+// @Description Called by auth-service when an account is deleted. Replaces the username, email and name with placeholders, an unknown user is not an error
+// @ID anonymize-user
+// @Produce  json
+// @Param uuid path string true "User ID"
+// @Success 200 {object} response.SuccessResponse
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /internal/users/{uuid} [delete]
+func (u *UserHandler) AnonymizeUser(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.user.AnonymizeUser"
+
+		log := u.log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		uid, err := uuid.Parse(chi.URLParam(r, "uuid"))
+		if err != nil {
+			log.Warn("invalid user id", sl.Err(err))
+
+			render.Status(r, http.StatusBadRequest)
+
+			render.JSON(w, r, resp.ErrorResponse{
+				Status: http.StatusBadRequest,
+				Error:  "invalid user id",
+			})
+
+			return
+		}
+
+		err = u.userHandler.AnonymizeUser(ctx, uid)
+		if err != nil {
+			render.Status(r, http.StatusInternalServerError)
+
+			render.JSON(w, r, resp.ErrorResponse{
+				Status: http.StatusInternalServerError,
+				Error:  "failed to anonymize user",
+			})
+
+			return
+		}
+
+		render.JSON(w, r, resp.SuccessResponse{
+			Status: http.StatusOK,
+			Data:   "user anonymized",
+		})
+	}
+}
+
+// @Summary BatchCheckUsers
+// @Tags internal
+// @Description Called by chat-service to validate the participants of a chat. Tells which of the users exist
+// @ID batch-check-users
+// @Accept  json
+// @Produce  json
+// @Param input body models.UserBatch true "users to check, the viewer is ignored"
+// @Success 200 {object} response.SuccessResponse{data=models.UserCheckResult}
+// @Failure 400,401,403 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /internal/users/batch-check [post]
+func (u *UserHandler) BatchCheck(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.user.BatchCheck"
+
+		log := u.log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		var req models.UserBatch
+
+		err := render.Decode(r, &req)
+		if flag := handlers.HandleError(w, r, req, err, log); !flag {
+			return
+		}
+
+		result, err := u.userHandler.CheckUsers(ctx, req.UUIDs)
+		if err != nil {
+			render.Status(r, http.StatusInternalServerError)
+
+			render.JSON(w, r, resp.ErrorResponse{
+				Status: http.StatusInternalServerError,
+				Error:  "failed to check users",
+			})
+
+			return
+		}
+
+		render.JSON(w, r, resp.SuccessResponse{
+			Status: http.StatusOK,
+			Data:   result,
+		})
+	}
+}
+
+// @Summary BatchUsers
+// @Tags internal
+// @Description Called by chat-service to fill in member lists. Returns the profiles of the users as the viewer may see them, unknown users are left out
+// @ID batch-users
+// @Accept  json
+// @Produce  json
+// @Param input body models.UserBatch true "users to look up and the viewer"
+// @Success 200 {object} response.SuccessResponse{data=[]models.UserInfo}
+// @Failure 400,401,403 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /internal/users/batch [post]
+func (u *UserHandler) BatchUsers(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.user.BatchUsers"
+
+		log := u.log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		var req models.UserBatch
+
+		err := render.Decode(r, &req)
+		if flag := handlers.HandleError(w, r, req, err, log); !flag {
+			return
+		}
+
+		users, err := u.userHandler.Users(ctx, req)
+		if err != nil {
+			render.Status(r, http.StatusInternalServerError)
+
+			render.JSON(w, r, resp.ErrorResponse{
+				Status: http.StatusInternalServerError,
+				Error:  "failed to get users",
+			})
+
+			return
+		}
+
+		render.JSON(w, r, resp.SuccessResponse{
+			Status: http.StatusOK,
+			Data:   users,
+		})
+	}
+}
+
+// @Summary SearchUsers
+// @Tags admin
+// @Description Lists all users newest first, a query narrows them down to the usernames, emails and names containing it. Available to moderators and admins
+// @ID admin-search-users
+// @Produce  json
+// @Param query query string false "part of the username, email or name"
+// @Param cursor query string false "next_cursor of the previous page"
+// @Param limit query int false "page size, 20 by default, at most 100"
+// @Success 200 {object} response.SuccessResponse{data=ProfilesResponse}
+// @Failure 400,401,403 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Failure default {object} response.ErrorResponse
+// @Security CookieAuth
+// @Router /admin/users [get]
+func (u *UserHandler) SearchUsers(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.user.SearchUsers"
+
+		log := u.log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		query := r.URL.Query()
+
+		limit, ok := handlers.HandlePageSize(w, r)
+		if !ok {
+			return
+		}
+
+		users, rcursor, err := u.userHandler.SearchUsers(ctx, query.Get("query"), query.Get("cursor"), limit)
+		if err != nil {
+			if errors.Is(err, user.ErrInvalidCursor) {
+				render.Status(r, http.StatusBadRequest)
+
+				render.JSON(w, r, resp.ErrorResponse{
+					Status: http.StatusBadRequest,
+					Error:  "invalid cursor",
+				})
+
+				return
+			}
+
+			log.Error("failed to search users", sl.Err(err))
+
+			render.Status(r, http.StatusInternalServerError)
+
+			render.JSON(w, r, resp.ErrorResponse{
+				Status: http.StatusInternalServerError,
+				Error:  "internal error",
+			})
+
+			return
+		}
+
+		render.JSON(w, r, resp.SuccessResponse{
+			Status: http.StatusOK,
+			Data: ProfilesResponse{
+				Profiles: users,
+				RCursor:  *rcursor,
+			},
+		})
+	}
+}
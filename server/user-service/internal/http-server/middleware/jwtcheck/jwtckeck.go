@@ -1,17 +1,33 @@
 package jwtcheck
 
 import (
+	"errors"
 	"net/http"
+	"slices"
 
 	"github.com/go-chi/render"
 	resp "github.com/sergey-frey/cchat/user-service/internal/lib/api/response"
 	"github.com/sergey-frey/cchat/user-service/internal/lib/cookie"
+	"github.com/sergey-frey/cchat/user-service/internal/lib/identity"
 )
 
+// JWTCheck verifies the access token and stores its user for the
+// handlers behind it.
 func JWTCheck(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		token, err := cookie.CheckCookie(w, r)
-		if err != nil || token == nil {
+		user, err := cookie.CheckCookie(w, r)
+		if errors.Is(err, cookie.ErrAccessTokenNotAccepted) {
+			render.Status(r, http.StatusForbidden)
+
+			render.JSON(w, r, resp.ErrorResponse{
+				Status: http.StatusForbidden,
+				Error:  "personal access tokens only work for chats and messages",
+			})
+
+			return
+		}
+
+		if err != nil || user == nil {
 			render.Status(r, http.StatusUnauthorized)
 
 			render.JSON(w, r, resp.ErrorResponse{
@@ -22,7 +38,40 @@ func JWTCheck(next http.Handler) http.Handler {
 			return
 		}
 
-		next.ServeHTTP(w, r)
+		next.ServeHTTP(w, r.WithContext(identity.WithUser(r.Context(), user)))
 	})
 
 }
+
+// RequireRole lets through users with one of the roles. It expects
+// JWTCheck to run before it.
+func RequireRole(roles ...string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, ok := identity.User(r.Context())
+			if !ok {
+				render.Status(r, http.StatusUnauthorized)
+
+				render.JSON(w, r, resp.ErrorResponse{
+					Status: http.StatusUnauthorized,
+					Error:  "user unauthorized",
+				})
+
+				return
+			}
+
+			if !slices.Contains(roles, user.Role) {
+				render.Status(r, http.StatusForbidden)
+
+				render.JSON(w, r, resp.ErrorResponse{
+					Status: http.StatusForbidden,
+					Error:  "access denied",
+				})
+
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
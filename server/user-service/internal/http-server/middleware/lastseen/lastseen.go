@@ -0,0 +1,36 @@
+package lastseen
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/sergey-frey/cchat/user-service/internal/lib/identity"
+	"github.com/sergey-frey/cchat/user-service/internal/lib/logger/sl"
+)
+
+type Toucher interface {
+	TouchLastSeen(ctx context.Context, uid uuid.UUID) error
+}
+
+// New moves the last-seen time of the authenticated user on every request.
+// It expects JWTCheck to run before it. A failed write is only logged, it
+// never fails the request.
+func New(toucher Toucher, log *slog.Logger) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		log := log.With(
+			slog.String("component", "middleware/lastseen"),
+		)
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if user, ok := identity.User(r.Context()); ok {
+				if err := toucher.TouchLastSeen(r.Context(), user.UUID); err != nil {
+					log.Warn("failed to touch last seen", sl.Err(err))
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -37,6 +37,12 @@ func ValidationError(errs validator.ValidationErrors) ErrorResponse {
 		// 	errMsgs = append(errMsgs, fmt.Sprintf("field %s must have more than %s characters", err.Field(), err.Param()))
 		case "gte":
 			errMsgs = append(errMsgs, fmt.Sprintf("field %s must have at least %s characters", err.Field(), err.Param()))
+		case "max":
+			errMsgs = append(errMsgs, fmt.Sprintf("field %s must have at most %s characters", err.Field(), err.Param()))
+		case "url", "url|len=0":
+			errMsgs = append(errMsgs, fmt.Sprintf("field %s must be a URL", err.Field()))
+		case "timezone", "timezone|len=0":
+			errMsgs = append(errMsgs, fmt.Sprintf("field %s must be an IANA time zone", err.Field()))
 		default:
 			errMsgs = append(errMsgs, fmt.Sprintf("field %s is not valid", err.Field()))
 		}
@@ -1,14 +1,24 @@
 package cookie
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/sergey-frey/cchat/user-service/internal/domain/models"
 	"github.com/sergey-frey/cchat/user-service/internal/lib/jwt"
 )
 
+// accessTokenPrefix starts every personal access token, see auth-service.
+const accessTokenPrefix = "cchat_pat_"
+
+// ErrAccessTokenNotAccepted is returned for personal access tokens. They
+// only reach the chats and messages, profiles, contacts and blocks are
+// left to the sessions of their owner.
+var ErrAccessTokenNotAccepted = errors.New("personal access tokens are not accepted here")
+
 func TakeUserInfo(w http.ResponseWriter, r *http.Request) (*models.NormalizedUser, error) {
 	user, err := CheckCookie(w, r)
 	if err != nil {
@@ -38,29 +48,40 @@ func SetCookie(w http.ResponseWriter, accessToken string, refreshToken string) {
 	http.SetCookie(w, cookie2)
 }
 
+// CheckCookie verifies the access token of an "Authorization: Bearer"
+// header or, without one, of the access_token cookie. Personal access
+// tokens are refused with ErrAccessTokenNotAccepted.
 func CheckCookie(w http.ResponseWriter, r *http.Request) (*models.NormalizedUser, error) {
-	accessCookie, err := r.Cookie("access_token")
-	if err != nil {
-		return HandlerError(err)
+	accessToken, ok := BearerToken(r)
+	if ok && strings.HasPrefix(accessToken, accessTokenPrefix) {
+		return nil, ErrAccessTokenNotAccepted
 	}
 
-	refreshCookie, err := r.Cookie("refresh_token")
-	if err != nil {
-		return HandlerError(err)
-	}
+	if !ok {
+		accessCookie, err := r.Cookie("access_token")
+		if err != nil {
+			return HandlerError(err)
+		}
 
-	accessToken, refreshToken := accessCookie.Value, refreshCookie.Value
+		accessToken = accessCookie.Value
+	}
 
-	accessToken, refreshToken, user, err := jwt.VerifyAccessToken(accessToken, refreshToken)
+	user, err := jwt.VerifyAccessToken(accessToken)
 	if err != nil {
 		return nil, fmt.Errorf("error with token: %w", err)
 	}
 
-	if accessToken != "" {
-		SetCookie(w, accessToken, refreshToken)
+	return user, nil
+}
+
+// BearerToken returns the access token of an "Authorization: Bearer" header.
+func BearerToken(r *http.Request) (string, bool) {
+	scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return "", false
 	}
 
-	return user, nil
+	return token, true
 }
 
 func DeleteCookie(w http.ResponseWriter) {
@@ -0,0 +1,241 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+)
+
+var (
+	ErrUnsupportedType = errors.New("unsupported image type")
+	ErrInvalidImage    = errors.New("invalid image")
+	ErrTooManyPixels   = errors.New("image dimensions are too large")
+)
+
+// DecodeSquare decodes a JPEG, PNG or GIF and returns its centred square
+// crop. The EXIF orientation of a JPEG is applied to the pixels, the
+// metadata itself is dropped along with the rest of the original file.
+// Images with more than maxPixels pixels are refused before decoding.
+func DecodeSquare(data []byte, maxPixels int) (*image.RGBA, error) {
+	var (
+		decodeConfig func(r *bytes.Reader) (image.Config, error)
+		decode       func(r *bytes.Reader) (image.Image, error)
+	)
+
+	switch http.DetectContentType(data) {
+	case "image/jpeg":
+		decodeConfig = func(r *bytes.Reader) (image.Config, error) { return jpeg.DecodeConfig(r) }
+		decode = func(r *bytes.Reader) (image.Image, error) { return jpeg.Decode(r) }
+	case "image/png":
+		decodeConfig = func(r *bytes.Reader) (image.Config, error) { return png.DecodeConfig(r) }
+		decode = func(r *bytes.Reader) (image.Image, error) { return png.Decode(r) }
+	case "image/gif":
+		decodeConfig = func(r *bytes.Reader) (image.Config, error) { return gif.DecodeConfig(r) }
+		decode = func(r *bytes.Reader) (image.Image, error) { return gif.Decode(r) }
+	default:
+		return nil, ErrUnsupportedType
+	}
+
+	config, err := decodeConfig(bytes.NewReader(data))
+	if err != nil || config.Width < 1 || config.Height < 1 {
+		return nil, ErrInvalidImage
+	}
+
+	if config.Width*config.Height > maxPixels {
+		return nil, ErrTooManyPixels
+	}
+
+	img, err := decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+
+	bounds := img.Bounds()
+	side := min(bounds.Dx(), bounds.Dy())
+	offset := image.Pt(bounds.Min.X+(bounds.Dx()-side)/2, bounds.Min.Y+(bounds.Dy()-side)/2)
+
+	square := image.NewRGBA(image.Rect(0, 0, side, side))
+	draw.Draw(square, square.Bounds(), img, offset, draw.Src)
+
+	// The centre crop does not move under any of the orientations, so it
+	// is enough to turn the square.
+	return orient(square, jpegOrientation(data)), nil
+}
+
+// Resize scales a square image to size×size. Every target pixel is the
+// average of the source pixels it covers, which keeps downscaled
+// thumbnails free of aliasing.
+func Resize(src *image.RGBA, size int) *image.RGBA {
+	side := src.Bounds().Dx()
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+
+	span := func(i int) (int, int) {
+		from := i * side / size
+		return from, max((i+1)*side/size, from+1)
+	}
+
+	for y := range size {
+		y0, y1 := span(y)
+
+		for x := range size {
+			x0, x1 := span(x)
+
+			var sum [4]int
+
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride:]
+
+				for sx := x0; sx < x1; sx++ {
+					for c := range 4 {
+						sum[c] += int(row[sx*4+c])
+					}
+				}
+			}
+
+			n := (y1 - y0) * (x1 - x0)
+			i := dst.PixOffset(x, y)
+
+			for c := range 4 {
+				dst.Pix[i+c] = uint8(sum[c] / n)
+			}
+		}
+	}
+
+	return dst
+}
+
+// Encode writes opaque images as JPEG and the rest as PNG, so transparency
+// survives. It returns the encoded image and its content type.
+func Encode(img *image.RGBA) ([]byte, string, error) {
+	var buf bytes.Buffer
+
+	if img.Opaque() {
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 85}); err != nil {
+			return nil, "", err
+		}
+
+		return buf.Bytes(), "image/jpeg", nil
+	}
+
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, "", err
+	}
+
+	return buf.Bytes(), "image/png", nil
+}
+
+// orient turns a square image upright according to an EXIF orientation.
+func orient(src *image.RGBA, orientation int) *image.RGBA {
+	if orientation < 2 || orientation > 8 {
+		return src
+	}
+
+	last := src.Bounds().Dx() - 1
+	dst := image.NewRGBA(src.Bounds())
+
+	for y := 0; y <= last; y++ {
+		for x := 0; x <= last; x++ {
+			var sx, sy int
+
+			switch orientation {
+			case 2:
+				sx, sy = last-x, y
+			case 3:
+				sx, sy = last-x, last-y
+			case 4:
+				sx, sy = x, last-y
+			case 5:
+				sx, sy = y, x
+			case 6:
+				sx, sy = y, last-x
+			case 7:
+				sx, sy = last-y, last-x
+			case 8:
+				sx, sy = last-y, x
+			}
+
+			copy(dst.Pix[dst.PixOffset(x, y):][:4], src.Pix[src.PixOffset(sx, sy):][:4])
+		}
+	}
+
+	return dst
+}
+
+// jpegOrientation reads the orientation tag from the EXIF segment of a
+// JPEG, 1 (upright) when there is none.
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return 1
+		}
+
+		marker := data[i+1]
+
+		// The metadata segments all come before the image data.
+		if marker == 0xDA || marker == 0xD9 {
+			return 1
+		}
+
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if length < 2 || i+2+length > len(data) {
+			return 1
+		}
+
+		segment := data[i+4 : i+2+length]
+
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return exifOrientation(segment[6:])
+		}
+
+		i += 2 + length
+	}
+
+	return 1
+}
+
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+
+	var order binary.ByteOrder
+
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 1
+	}
+
+	entries := int(order.Uint16(tiff[ifd:]))
+
+	for k := range entries {
+		entry := ifd + 2 + k*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			return int(order.Uint16(tiff[entry+8:]))
+		}
+	}
+
+	return 1
+}
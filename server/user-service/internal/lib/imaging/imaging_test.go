@@ -0,0 +1,157 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// halves is a 120×80 image, red on the top and blue on the bottom.
+func halves() *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, 120, 80))
+
+	for y := range 80 {
+		for x := range 120 {
+			c := color.RGBA{R: 255, A: 255}
+			if y >= 40 {
+				c = color.RGBA{B: 255, A: 255}
+			}
+
+			img.SetRGBA(x, y, c)
+		}
+	}
+
+	return img
+}
+
+// withOrientation inserts an EXIF segment carrying the orientation right
+// after the start of image marker.
+func withOrientation(t *testing.T, jpg []byte, orientation uint16) []byte {
+	t.Helper()
+
+	tiff := []byte("MM\x00\x2a\x00\x00\x00\x08")
+	tiff = binary.BigEndian.AppendUint16(tiff, 1)
+	tiff = binary.BigEndian.AppendUint16(tiff, 0x0112)
+	tiff = binary.BigEndian.AppendUint16(tiff, 3)
+	tiff = binary.BigEndian.AppendUint32(tiff, 1)
+	tiff = binary.BigEndian.AppendUint16(tiff, orientation)
+	tiff = append(tiff, 0, 0, 0, 0, 0, 0)
+
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+
+	out := []byte{0xFF, 0xD8, 0xFF, 0xE1}
+	out = binary.BigEndian.AppendUint16(out, uint16(len(segment)+2))
+	out = append(out, segment...)
+
+	return append(out, jpg[2:]...)
+}
+
+func TestDecodeSquare_AppliesOrientation(t *testing.T) {
+	var buf bytes.Buffer
+
+	if err := jpeg.Encode(&buf, halves(), &jpeg.Options{Quality: 95}); err != nil {
+		t.Fatal(err)
+	}
+
+	square, err := DecodeSquare(buf.Bytes(), 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := square.Bounds(); got != image.Rect(0, 0, 80, 80) {
+		t.Fatalf("expected an 80×80 crop, got %v", got)
+	}
+
+	if c := square.RGBAAt(40, 5); c.R < 200 || c.B > 50 {
+		t.Fatalf("expected red on top without orientation, got %v", c)
+	}
+
+	// 6 asks for a clockwise turn, the top of the stored image ends up on
+	// the right.
+	turned, err := DecodeSquare(withOrientation(t, buf.Bytes(), 6), 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c := turned.RGBAAt(75, 40); c.R < 200 || c.B > 50 {
+		t.Fatalf("expected red on the right, got %v", c)
+	}
+
+	if c := turned.RGBAAt(5, 40); c.B < 200 || c.R > 50 {
+		t.Fatalf("expected blue on the left, got %v", c)
+	}
+}
+
+func TestDecodeSquare_Refuses(t *testing.T) {
+	var buf bytes.Buffer
+
+	if err := png.Encode(&buf, halves()); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := DecodeSquare(buf.Bytes(), 100); !errors.Is(err, ErrTooManyPixels) {
+		t.Fatalf("expected too many pixels, got %v", err)
+	}
+
+	if _, err := DecodeSquare([]byte("<svg xmlns=\"http://www.w3.org/2000/svg\"/>"), 1<<20); !errors.Is(err, ErrUnsupportedType) {
+		t.Fatalf("expected an unsupported type, got %v", err)
+	}
+
+	if _, err := DecodeSquare(buf.Bytes()[:40], 1<<20); !errors.Is(err, ErrInvalidImage) {
+		t.Fatalf("expected an invalid image, got %v", err)
+	}
+}
+
+func TestResizeAndEncode(t *testing.T) {
+	square := image.NewRGBA(image.Rect(0, 0, 100, 100))
+
+	// Transparent on the left, opaque white on the right.
+	for y := range 100 {
+		for x := 50; x < 100; x++ {
+			square.SetRGBA(x, y, color.RGBA{R: 255, G: 255, B: 255, A: 255})
+		}
+	}
+
+	for _, size := range []int{64, 128, 512} {
+		thumb := Resize(square, size)
+
+		if got := thumb.Bounds(); got != image.Rect(0, 0, size, size) {
+			t.Fatalf("expected %d×%d, got %v", size, size, got)
+		}
+
+		if c := thumb.RGBAAt(size-1, size/2); c.A != 255 {
+			t.Fatalf("expected the right edge to stay opaque, got %v", c)
+		}
+
+		data, contentType, err := Encode(thumb)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if contentType != "image/png" {
+			t.Fatalf("expected transparency to be kept as png, got %s", contentType)
+		}
+
+		if _, err := png.Decode(bytes.NewReader(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	opaque := image.NewRGBA(image.Rect(0, 0, 100, 100))
+	draw.Draw(opaque, opaque.Bounds(), image.NewUniform(color.RGBA{G: 128, A: 255}), image.Point{}, draw.Src)
+
+	_, contentType, err := Encode(Resize(opaque, 64))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if contentType != "image/jpeg" {
+		t.Fatalf("expected an opaque image to be a jpeg, got %s", contentType)
+	}
+}
@@ -1,100 +1,50 @@
 package jwt
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"github.com/sergey-frey/cchat/user-service/internal/domain/models"
-)
-
-const (
-	accessDuration  = 15 * time.Minute
-	refreshDuration = 43200 * time.Minute
+	"github.com/sergey-frey/cchat/user-service/internal/lib/jwks"
 )
 
 var (
 	ErrUserUnauthorized = errors.New("user unauthorized")
 )
 
-func NewPairTokens(user models.NormalizedUser) (string, string, error) {
-	accessToken := jwt.New(jwt.SigningMethodHS256)
-
-	claims := accessToken.Claims.(jwt.MapClaims)
-	claims["uuid"] = user.UUID
-	claims["username"] = user.Username
-	claims["email"] = user.Email
-	claims["exp"] = time.Now().Add(accessDuration).Unix()
-
-	accessTokenString, err := accessToken.SignedString([]byte("somesecret"))
-	if err != nil {
-		return "", "", err
-	}
-
-	refreshToken := jwt.New(jwt.SigningMethodHS256)
-
-	claims = refreshToken.Claims.(jwt.MapClaims)
-	claims["exp"] = time.Now().Add(refreshDuration).Unix()
-
-	refreshTokenString, err := refreshToken.SignedString([]byte("secret"))
-	if err != nil {
-		return "", "", err
-	}
+// KeySource provides the public keys of auth-service. This service only
+// verifies tokens, it holds no key that could sign one.
+type KeySource interface {
+	Key(ctx context.Context, kid string) (jwks.Key, error)
+}
 
-	return accessTokenString, refreshTokenString, nil
+// keys is set once at startup, before the server accepts requests.
+var keys KeySource
 
+func UseKeySource(source KeySource) {
+	keys = source
 }
 
-func VerifyAccessToken(accessToken string, refreshToken string) (string, string, *models.NormalizedUser, error) {
+// VerifyAccessToken only accepts a valid access token. Refresh tokens are
+// bound to server-side sessions and are rotated by auth-service alone.
+func VerifyAccessToken(accessToken string) (*models.NormalizedUser, error) {
 	claims := &jwt.MapClaims{}
 
-	accesstoken, err := jwt.ParseWithClaims(accessToken, claims, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte("somesecret"), nil
-	})
-
-	if err != nil || !accesstoken.Valid {
-
-		user, userErr := extractUserFromClaims(*claims)
-		if userErr != nil {
-			return "", "", nil, ErrUserUnauthorized
-		}
-		
-		return VerifyRefreshToken(*user, refreshToken)
+	accesstoken, err := jwt.ParseWithClaims(accessToken, claims, keyFunc, jwt.WithValidMethods([]string{"RS256", "EdDSA"}))
+
+	if err != nil || !accesstoken.Valid || (*claims)["typ"] != "access" {
+		return nil, ErrUserUnauthorized
 	}
 
 	user, userErr := extractUserFromClaims(*claims)
 	if userErr != nil {
-		return "", "", nil, userErr
-	}
-
-	return "", "", user, nil
-}
-
-func VerifyRefreshToken(user models.NormalizedUser, refreshToken string) (string, string, *models.NormalizedUser, error) {
-
-	refreshtoken, err := jwt.Parse(refreshToken, func(token *jwt.Token) (any, error) {
-		return []byte("secret"), nil
-	})
-
-	if err != nil {
-		return "", "", nil, err
-	}
-    
-	if !refreshtoken.Valid {
-		return "", "", nil, ErrUserUnauthorized
-	}
-    
-	newAccessToken, newRefreshToken, err := NewPairTokens(user)
-	if err != nil {
-		return "", "", nil, err
+		return nil, ErrUserUnauthorized
 	}
 
-	return newAccessToken, newRefreshToken, &user, nil
+	return user, nil
 }
 
 func extractUserFromClaims(claims jwt.MapClaims) (*models.NormalizedUser, error) {
@@ -102,7 +52,7 @@ func extractUserFromClaims(claims jwt.MapClaims) (*models.NormalizedUser, error)
 	if !ok {
 		return nil, errors.New("missing or invalid 'uuid' in token claims")
 	}
-	
+
 	userUUID, err := uuid.Parse(uuidStr)
 	if err != nil {
 		return nil, errors.New("failed to parse 'uuid' from token claims")
@@ -118,9 +68,37 @@ func extractUserFromClaims(claims jwt.MapClaims) (*models.NormalizedUser, error)
 		return nil, errors.New("missing or invalid 'email' in token claims")
 	}
 
+	// Tokens issued before roles existed belong to plain users.
+	role, _ := claims["role"].(string)
+	if role == "" {
+		role = models.RoleUser
+	}
+
 	return &models.NormalizedUser{
 		UUID:     userUUID,
 		Username: username,
 		Email:    email,
+		Role:     role,
 	}, nil
 }
+
+// keyFunc picks the public key by the kid header and refuses tokens
+// whose algorithm does not belong to that key.
+func keyFunc(token *jwt.Token) (interface{}, error) {
+	if keys == nil {
+		return nil, ErrUserUnauthorized
+	}
+
+	kid, _ := token.Header["kid"].(string)
+
+	key, err := keys.Key(context.Background(), kid)
+	if err != nil {
+		return nil, err
+	}
+
+	if token.Method.Alg() != key.Alg {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+
+	return key.Public, nil
+}
@@ -0,0 +1,75 @@
+package username
+
+import (
+	"strings"
+	"time"
+)
+
+// reserved are the words nobody may take as a username, they would pass
+// for the service or its staff.
+var reserved = []string{
+	"admin", "administrator", "api", "cchat", "deleted", "help", "info",
+	"mod", "moderator", "null", "official", "root", "security", "service",
+	"settings", "staff", "support", "system", "undefined", "user", "users",
+}
+
+// Lengths a username may have.
+const (
+	MinLength = 3
+	MaxLength = 32
+)
+
+// Normalize is the form usernames are stored and compared in. Usernames
+// differing only in case are the same username.
+func Normalize(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
+
+// IsValid tells whether the normalized username follows the rules of a
+// change of username: MinLength to MaxLength letters and digits.
+func IsValid(username string) bool {
+	if len(username) < MinLength || len(username) > MaxLength {
+		return false
+	}
+
+	for _, r := range username {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Policy is what a change of username has to respect.
+type Policy struct {
+	// RedirectPeriod is how long a released username still leads to its
+	// previous owner.
+	RedirectPeriod time.Duration
+	// Cooldown is how long a released username is kept from other users.
+	Cooldown time.Duration
+
+	words map[string]struct{}
+}
+
+// NewPolicy takes the reserved words in addition to the built-in ones.
+func NewPolicy(redirectPeriod time.Duration, cooldown time.Duration, extra []string) Policy {
+	words := make(map[string]struct{}, len(reserved)+len(extra))
+
+	for _, word := range append(append([]string{}, reserved...), extra...) {
+		words[Normalize(word)] = struct{}{}
+	}
+
+	return Policy{
+		RedirectPeriod: redirectPeriod,
+		Cooldown:       cooldown,
+		words:          words,
+	}
+}
+
+// IsReserved tells whether the normalized username is a reserved word.
+func (p Policy) IsReserved(username string) bool {
+	_, ok := p.words[username]
+
+	return ok
+}
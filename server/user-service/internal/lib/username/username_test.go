@@ -0,0 +1,49 @@
+package username
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPolicy_IsReserved(t *testing.T) {
+	policy := NewPolicy(time.Hour, time.Hour, []string{"  Moderators "})
+
+	tests := []struct {
+		username string
+		want     bool
+	}{
+		{Normalize("Admin"), true},
+		{Normalize(" SUPPORT "), true},
+		{Normalize("moderators"), true},
+		{Normalize("arnold2004"), false},
+		{Normalize("administrators"), false},
+	}
+
+	for _, tt := range tests {
+		if got := policy.IsReserved(tt.username); got != tt.want {
+			t.Errorf("IsReserved(%q) = %v, want %v", tt.username, got, tt.want)
+		}
+	}
+}
+
+func TestIsValid(t *testing.T) {
+	tests := []struct {
+		username string
+		want     bool
+	}{
+		{"arnold2004", true},
+		{"bob", true},
+		{"bo", false},
+		{"o'connor", false},
+		{"bob-1a2b3c4d", false},
+		{strings.Repeat("a", MaxLength), true},
+		{strings.Repeat("a", MaxLength+1), false},
+	}
+
+	for _, tt := range tests {
+		if got := IsValid(tt.username); got != tt.want {
+			t.Errorf("IsValid(%q) = %v, want %v", tt.username, got, tt.want)
+		}
+	}
+}
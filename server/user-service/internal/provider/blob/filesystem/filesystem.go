@@ -0,0 +1,115 @@
+package filesystem
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/sergey-frey/cchat/user-service/internal/domain/models"
+	"github.com/sergey-frey/cchat/user-service/internal/provider/storage"
+)
+
+var ErrInvalidKey = errors.New("invalid blob key")
+
+// Store keeps every blob as a file below a directory. The directory is
+// not shared between instances, so it suits a single one.
+type Store struct {
+	dir string
+}
+
+func New(dir string) *Store {
+	return &Store{
+		dir: dir,
+	}
+}
+
+// Put writes the blob next to its final path first and renames it, a
+// reader never sees half of a file.
+func (s *Store) Put(ctx context.Context, key string, blob models.Blob) error {
+	const op = "blob.filesystem.Put"
+
+	path, err := s.path(key)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(blob.Data); err != nil {
+		_ = tmp.Close()
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// Get reads a blob. The content type is not stored, it is sniffed from
+// the data.
+func (s *Store) Get(ctx context.Context, key string) (*models.Blob, error) {
+	const op = "blob.filesystem.Get"
+
+	path, err := s.path(key)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("%s: %w", op, storage.ErrBlobNotFound)
+		}
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &models.Blob{
+		ContentType: http.DetectContentType(data),
+		Data:        data,
+	}, nil
+}
+
+// Delete removes a blob, a missing one is not an error.
+func (s *Store) Delete(ctx context.Context, key string) error {
+	const op = "blob.filesystem.Delete"
+
+	path, err := s.path(key)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Store) path(key string) (string, error) {
+	name := filepath.FromSlash(key)
+	if !filepath.IsLocal(name) {
+		return "", ErrInvalidKey
+	}
+
+	return filepath.Join(s.dir, name), nil
+}
@@ -0,0 +1,113 @@
+package s3
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/sergey-frey/cchat/user-service/internal/domain/models"
+	"github.com/sergey-frey/cchat/user-service/internal/provider/storage"
+)
+
+// bucket is a local stand-in for an S3 service. It keeps the objects in
+// memory and checks what every request must carry.
+type bucket struct {
+	t       *testing.T
+	mx      sync.Mutex
+	objects map[string]models.Blob
+}
+
+func (b *bucket) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	sum := sha256.Sum256(body)
+
+	if got := r.Header.Get("X-Amz-Content-Sha256"); got != hex.EncodeToString(sum[:]) {
+		b.t.Errorf("payload hash %q does not match the body", got)
+	}
+
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=access/") || !strings.Contains(auth, "/eu-central-1/s3/aws4_request") {
+		http.Error(w, "AccessDenied", http.StatusForbidden)
+		return
+	}
+
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	switch r.Method {
+	case http.MethodPut:
+		b.objects[r.URL.Path] = models.Blob{ContentType: r.Header.Get("Content-Type"), Data: body}
+	case http.MethodGet:
+		object, ok := b.objects[r.URL.Path]
+		if !ok {
+			http.Error(w, "NoSuchKey", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", object.ContentType)
+		_, _ = w.Write(object.Data)
+	case http.MethodDelete:
+		delete(b.objects, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func TestStore_RoundTrip(t *testing.T) {
+	ctx := context.Background()
+
+	stand := &bucket{t: t, objects: map[string]models.Blob{}}
+	server := httptest.NewServer(stand)
+	defer server.Close()
+
+	store, err := New(server.Client(), server.URL, "eu-central-1", "avatars", "access", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blob := models.Blob{ContentType: "image/png", Data: []byte("\x89PNG fake")}
+
+	if err := store.Put(ctx, "avatars/user/v1/64", blob); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := stand.objects["/avatars/avatars/user/v1/64"]; !ok {
+		t.Fatalf("expected a path-style key, got %v", stand.objects)
+	}
+
+	got, err := store.Get(ctx, "avatars/user/v1/64")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.ContentType != blob.ContentType || string(got.Data) != string(blob.Data) {
+		t.Fatalf("expected %v back, got %v", blob, got)
+	}
+
+	if err := store.Delete(ctx, "avatars/user/v1/64"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Delete(ctx, "avatars/user/v1/64"); err != nil {
+		t.Fatalf("expected deleting a missing blob to succeed, got %v", err)
+	}
+
+	if _, err := store.Get(ctx, "avatars/user/v1/64"); !errors.Is(err, storage.ErrBlobNotFound) {
+		t.Fatalf("expected the blob to be gone, got %v", err)
+	}
+
+	denied, err := New(server.Client(), server.URL, "us-east-1", "avatars", "access", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := denied.Put(ctx, "avatars/user/v1/64", blob); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Fatalf("expected the status of a refused request, got %v", err)
+	}
+}
@@ -0,0 +1,170 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/sergey-frey/cchat/user-service/internal/domain/models"
+)
+
+// BlockUser adds the blocked user to the block list of the blocker,
+// blocking someone twice keeps the first entry. A block ends the contact
+// between the two and drops the requests they sent each other.
+func (s *Storage) BlockUser(ctx context.Context, blocker uuid.UUID, blocked uuid.UUID) (err error) {
+	const op = "storage.postgres.block.BlockUser"
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback(ctx)
+			return
+		}
+
+		commitErr := tx.Commit(ctx)
+		if commitErr != nil {
+			err = fmt.Errorf("%s: %w", op, commitErr)
+		}
+	}()
+
+	if err = lockUsers(ctx, tx, blocker, blocked); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO user_blocks (blocker_id, blocked_id)
+		VALUES ($1, $2)
+		ON CONFLICT (blocker_id, blocked_id) DO NOTHING;
+	`, blocker, blocked)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err = unlink(ctx, tx, blocker, blocked); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// UnblockUser removes the blocked user from the block list, a user that
+// is not on it is not an error.
+func (s *Storage) UnblockUser(ctx context.Context, blocker uuid.UUID, blocked uuid.UUID) error {
+	const op = "storage.postgres.block.UnblockUser"
+
+	_, err := s.pool.Exec(ctx, `
+		DELETE FROM user_blocks
+		WHERE blocker_id = $1 AND blocked_id = $2;
+	`, blocker, blocked)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// Blocks pages through the block list of the blocker, the latest block
+// first.
+func (s *Storage) Blocks(ctx context.Context, blocker uuid.UUID, cursor string, limit int) ([]models.BlockedUser, *models.Cursor, error) {
+	const op = "storage.postgres.block.Blocks"
+
+	after, err := afterCursor(cursor)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	rows, err := s.pool.Query(ctx, `
+		SELECT `+viewedProfileColumns+`, b.created_at
+		FROM user_blocks b
+		JOIN users u ON u.user_id = b.blocked_id
+		WHERE b.blocker_id = $1 AND (b.created_at, b.blocked_id) < ($2, $3)
+		ORDER BY b.created_at DESC, b.blocked_id DESC
+		LIMIT $4;
+	`, blocker, after.CreatedAt, after.UUID, limit+1)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	blocks := make([]models.BlockedUser, 0, limit+1)
+
+	for rows.Next() {
+		var block models.BlockedUser
+
+		if err := rows.Scan(append(profileFields(&block.User), &block.BlockedAt)...); err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		blocks = append(blocks, block)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if len(blocks) <= limit {
+		return blocks, &models.Cursor{HasNextPage: false}, nil
+	}
+
+	last := blocks[limit-1]
+
+	next, err := encodeCursor(pageCursor{CreatedAt: last.BlockedAt, UUID: last.User.UUID.String()})
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return blocks[:limit], &models.Cursor{
+		NextCursor:  next,
+		HasNextPage: true,
+	}, nil
+}
+
+// BlockedAmong returns those of the others that blocked the user or were
+// blocked by them.
+func (s *Storage) BlockedAmong(ctx context.Context, user uuid.UUID, others []uuid.UUID) ([]uuid.UUID, error) {
+	const op = "storage.postgres.block.BlockedAmong"
+
+	rows, err := s.pool.Query(ctx, `
+		SELECT blocked_id FROM user_blocks WHERE blocker_id = $1 AND blocked_id = ANY($2)
+		UNION
+		SELECT blocker_id FROM user_blocks WHERE blocked_id = $1 AND blocker_id = ANY($2);
+	`, user, others)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	blocked := make([]uuid.UUID, 0)
+
+	for rows.Next() {
+		var uid uuid.UUID
+
+		if err := rows.Scan(&uid); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		blocked = append(blocked, uid)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return blocked, nil
+}
+
+// notBlockedBy is the SQL condition under which the user bound to $1 has
+// not blocked the users row u.
+const notBlockedBy = `NOT EXISTS (
+	SELECT 1 FROM user_blocks b WHERE b.blocker_id = $1 AND b.blocked_id = u.user_id
+)`
+
+// hasBlocked is the SQL condition under which the users row u has blocked
+// the user bound to $1.
+const hasBlocked = `EXISTS (
+	SELECT 1 FROM user_blocks b WHERE b.blocker_id = u.user_id AND b.blocked_id = $1
+)`
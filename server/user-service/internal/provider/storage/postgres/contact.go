@@ -0,0 +1,416 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"github.com/sergey-frey/cchat/user-service/internal/domain/models"
+	"github.com/sergey-frey/cchat/user-service/internal/provider/storage"
+)
+
+// SendContactRequest asks the addressee to become a contact of the
+// requester. When the addressee already asked the requester, both become
+// contacts right away and accepted is true.
+func (s *Storage) SendContactRequest(ctx context.Context, requester uuid.UUID, addressee uuid.UUID) (accepted bool, err error) {
+	const op = "storage.postgres.contact.SendContactRequest"
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback(ctx)
+			return
+		}
+
+		commitErr := tx.Commit(ctx)
+		if commitErr != nil {
+			err = fmt.Errorf("%s: %w", op, commitErr)
+		}
+	}()
+
+	if err = lockUsers(ctx, tx, requester, addressee); err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var blocked, contacts bool
+
+	err = tx.QueryRow(ctx, `
+		SELECT
+			EXISTS (
+				SELECT 1 FROM user_blocks
+				WHERE (blocker_id = $1 AND blocked_id = $2) OR (blocker_id = $2 AND blocked_id = $1)
+			),
+			EXISTS (
+				SELECT 1 FROM contacts
+				WHERE owner_id = $1 AND contact_id = $2
+			);
+	`, requester, addressee).Scan(&blocked, &contacts)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if blocked {
+		return false, fmt.Errorf("%s: %w", op, storage.ErrBlocked)
+	}
+
+	if contacts {
+		return false, fmt.Errorf("%s: %w", op, storage.ErrAlreadyContacts)
+	}
+
+	tag, err := tx.Exec(ctx, `
+		DELETE FROM contact_requests
+		WHERE requester_id = $2 AND addressee_id = $1;
+	`, requester, addressee)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if tag.RowsAffected() > 0 {
+		if err = link(ctx, tx, requester, addressee); err != nil {
+			return false, fmt.Errorf("%s: %w", op, err)
+		}
+
+		return true, nil
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO contact_requests (requester_id, addressee_id)
+		VALUES ($1, $2)
+		ON CONFLICT (requester_id, addressee_id) DO NOTHING;
+	`, requester, addressee)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return false, nil
+}
+
+// AcceptContactRequest makes the requester and the addressee contacts of
+// each other.
+func (s *Storage) AcceptContactRequest(ctx context.Context, addressee uuid.UUID, requester uuid.UUID) (err error) {
+	const op = "storage.postgres.contact.AcceptContactRequest"
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback(ctx)
+			return
+		}
+
+		commitErr := tx.Commit(ctx)
+		if commitErr != nil {
+			err = fmt.Errorf("%s: %w", op, commitErr)
+		}
+	}()
+
+	if err = lockUsers(ctx, tx, addressee, requester); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	tag, err := tx.Exec(ctx, `
+		DELETE FROM contact_requests
+		WHERE requester_id = $1 AND addressee_id = $2;
+	`, requester, addressee)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrRequestNotFound)
+	}
+
+	if err = link(ctx, tx, addressee, requester); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// DeleteContactRequest drops a pending request, it is how the addressee
+// declines it and how the requester takes it back.
+func (s *Storage) DeleteContactRequest(ctx context.Context, requester uuid.UUID, addressee uuid.UUID) error {
+	const op = "storage.postgres.contact.DeleteContactRequest"
+
+	tag, err := s.pool.Exec(ctx, `
+		DELETE FROM contact_requests
+		WHERE requester_id = $1 AND addressee_id = $2;
+	`, requester, addressee)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrRequestNotFound)
+	}
+
+	return nil
+}
+
+// ContactRequests pages through the pending requests the user received,
+// or sent when incoming is false, the latest first.
+func (s *Storage) ContactRequests(ctx context.Context, user uuid.UUID, incoming bool, cursor string, limit int) ([]models.ContactRequest, *models.Cursor, error) {
+	const op = "storage.postgres.contact.ContactRequests"
+
+	after, err := afterCursor(cursor)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	own, other := "r.addressee_id", "r.requester_id"
+	if !incoming {
+		own, other = other, own
+	}
+
+	rows, err := s.pool.Query(ctx, `
+		SELECT `+viewedProfileColumns+`, r.created_at
+		FROM contact_requests r
+		JOIN users u ON u.user_id = `+other+`
+		WHERE `+own+` = $1 AND (r.created_at, `+other+`) < ($2, $3)
+		ORDER BY r.created_at DESC, `+other+` DESC
+		LIMIT $4;
+	`, user, after.CreatedAt, after.UUID, limit+1)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	requests := make([]models.ContactRequest, 0, limit+1)
+
+	for rows.Next() {
+		var request models.ContactRequest
+
+		if err := rows.Scan(append(profileFields(&request.User), &request.SentAt)...); err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		requests = append(requests, request)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if len(requests) <= limit {
+		return requests, &models.Cursor{HasNextPage: false}, nil
+	}
+
+	last := requests[limit-1]
+
+	next, err := encodeCursor(pageCursor{CreatedAt: last.SentAt, UUID: last.User.UUID.String()})
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return requests[:limit], &models.Cursor{
+		NextCursor:  next,
+		HasNextPage: true,
+	}, nil
+}
+
+// Contacts pages through the contact list of the owner, the latest
+// contact first.
+func (s *Storage) Contacts(ctx context.Context, owner uuid.UUID, cursor string, limit int) ([]models.Contact, *models.Cursor, error) {
+	const op = "storage.postgres.contact.Contacts"
+
+	after, err := afterCursor(cursor)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	rows, err := s.pool.Query(ctx, `
+		SELECT `+viewedProfileColumns+`, c.nickname, c.created_at
+		FROM contacts c
+		JOIN users u ON u.user_id = c.contact_id
+		WHERE c.owner_id = $1 AND (c.created_at, c.contact_id) < ($2, $3)
+		ORDER BY c.created_at DESC, c.contact_id DESC
+		LIMIT $4;
+	`, owner, after.CreatedAt, after.UUID, limit+1)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	contacts := make([]models.Contact, 0, limit+1)
+
+	for rows.Next() {
+		var contact models.Contact
+
+		if err := rows.Scan(append(profileFields(&contact.User), &contact.Nickname, &contact.Since)...); err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		contacts = append(contacts, contact)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if len(contacts) <= limit {
+		return contacts, &models.Cursor{HasNextPage: false}, nil
+	}
+
+	last := contacts[limit-1]
+
+	next, err := encodeCursor(pageCursor{CreatedAt: last.Since, UUID: last.User.UUID.String()})
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return contacts[:limit], &models.Cursor{
+		NextCursor:  next,
+		HasNextPage: true,
+	}, nil
+}
+
+// SetContactNickname names a contact in the list of the owner, an empty
+// nickname removes it.
+func (s *Storage) SetContactNickname(ctx context.Context, owner uuid.UUID, contact uuid.UUID, nickname string) (*models.Contact, error) {
+	const op = "storage.postgres.contact.SetContactNickname"
+
+	var updated models.Contact
+
+	err := s.pool.QueryRow(ctx, `
+		UPDATE contacts c
+		SET nickname = $3
+		FROM users u
+		WHERE c.owner_id = $1 AND c.contact_id = $2 AND u.user_id = c.contact_id
+		RETURNING `+viewedProfileColumns+`, c.nickname, c.created_at;
+	`, owner, contact, nickname).Scan(append(profileFields(&updated.User), &updated.Nickname, &updated.Since)...)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%s: %w", op, storage.ErrContactNotFound)
+		}
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &updated, nil
+}
+
+// RemoveContact ends the contact for both sides, removing someone who is
+// not a contact is not an error.
+func (s *Storage) RemoveContact(ctx context.Context, owner uuid.UUID, contact uuid.UUID) error {
+	const op = "storage.postgres.contact.RemoveContact"
+
+	_, err := s.pool.Exec(ctx, `
+		DELETE FROM contacts
+		WHERE (owner_id = $1 AND contact_id = $2) OR (owner_id = $2 AND contact_id = $1);
+	`, owner, contact)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// ContactsAmong returns those of the others that are contacts of the user.
+func (s *Storage) ContactsAmong(ctx context.Context, user uuid.UUID, others []uuid.UUID) ([]uuid.UUID, error) {
+	const op = "storage.postgres.contact.ContactsAmong"
+
+	rows, err := s.pool.Query(ctx, `
+		SELECT contact_id
+		FROM contacts
+		WHERE owner_id = $1 AND contact_id = ANY($2);
+	`, user, others)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	contacts := make([]uuid.UUID, 0)
+
+	for rows.Next() {
+		var uid uuid.UUID
+
+		if err := rows.Scan(&uid); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		contacts = append(contacts, uid)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return contacts, nil
+}
+
+// lockUsers locks the rows of the users in a fixed order, so the changes
+// to the relation of two users happen one after the other. A missing user
+// is ErrUserNotFound.
+func lockUsers(ctx context.Context, tx pgx.Tx, users ...uuid.UUID) error {
+	rows, err := tx.Query(ctx, `
+		SELECT user_id
+		FROM users
+		WHERE user_id = ANY($1)
+		ORDER BY user_id
+		FOR UPDATE;
+	`, users)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	found := 0
+	for rows.Next() {
+		found++
+	}
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if found != len(users) {
+		return storage.ErrUserNotFound
+	}
+
+	return nil
+}
+
+// link makes the two users contacts of each other.
+func link(ctx context.Context, tx pgx.Tx, a uuid.UUID, b uuid.UUID) error {
+	_, err := tx.Exec(ctx, `
+		INSERT INTO contacts (owner_id, contact_id)
+		VALUES ($1, $2), ($2, $1)
+		ON CONFLICT (owner_id, contact_id) DO NOTHING;
+	`, a, b)
+
+	return err
+}
+
+// unlink ends the contact between the two users and drops the requests
+// they sent each other.
+func unlink(ctx context.Context, tx pgx.Tx, a uuid.UUID, b uuid.UUID) error {
+	_, err := tx.Exec(ctx, `
+		DELETE FROM contacts
+		WHERE (owner_id = $1 AND contact_id = $2) OR (owner_id = $2 AND contact_id = $1);
+	`, a, b)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `
+		DELETE FROM contact_requests
+		WHERE (requester_id = $1 AND addressee_id = $2) OR (requester_id = $2 AND addressee_id = $1);
+	`, a, b)
+
+	return err
+}
+
+// isContact is the SQL condition under which the user bound to $1 is a
+// contact of the users row u.
+const isContact = `EXISTS (
+	SELECT 1 FROM contacts k WHERE k.owner_id = u.user_id AND k.contact_id = $1
+)`
@@ -6,6 +6,8 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -15,12 +17,48 @@ import (
 	"github.com/sergey-frey/cchat/user-service/internal/provider/storage"
 )
 
+// pageCursor is the position of the last row of a page. Lists ordered by
+// time use CreatedAt, the search uses Rank.
 type pageCursor struct {
 	CreatedAt time.Time `json:"c"`
-	UUID        string `json:"u"`
+	Rank      float64   `json:"r"`
+	UUID      string    `json:"u"`
 }
 
-func (s *Storage) CreateUser(ctx context.Context, uid uuid.UUID, email string, username string, name string) (*models.NormalizedUser, error) {
+// afterCursor decodes the position a page starts after. An empty cursor
+// starts before the newest or best ranked row.
+func afterCursor(cursor string) (pageCursor, error) {
+	after := pageCursor{CreatedAt: time.Now().Add(time.Hour), Rank: math.Inf(1), UUID: uuid.Max.String()}
+
+	if cursor == "" {
+		return after, nil
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(cursor)
+	if err != nil {
+		return after, storage.ErrInvalidCursor
+	}
+
+	if err := json.Unmarshal(decoded, &after); err != nil {
+		return after, storage.ErrInvalidCursor
+	}
+
+	return after, nil
+}
+
+func encodeCursor(last pageCursor) (string, error) {
+	data, err := json.Marshal(last)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(data), nil
+}
+
+// CreateUser adds the user under the normalized username. A username
+// released by someone else since cooldownSince is storage.ErrUsernameUnavailable
+// and a taken one is storage.ErrUsernameExists.
+func (s *Storage) CreateUser(ctx context.Context, uid uuid.UUID, email string, username string, name string, cooldownSince time.Time) (info *models.NormalizedUser, err error) {
 	const op = "storage.postgres.user.MyProfile"
 
 	tx, err := s.pool.Begin(ctx)
@@ -40,7 +78,16 @@ func (s *Storage) CreateUser(ctx context.Context, uid uuid.UUID, email string, u
 		}
 	}()
 
-	var info models.NormalizedUser
+	cooling, err := usernameCooling(ctx, tx, uid, username, cooldownSince)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if cooling {
+		return nil, fmt.Errorf("%s: %w", op, storage.ErrUsernameUnavailable)
+	}
+
+	info = &models.NormalizedUser{}
 
 	fmt.Println(uid, email, username, name)
 
@@ -52,15 +99,24 @@ func (s *Storage) CreateUser(ctx context.Context, uid uuid.UUID, email string, u
 
 	err = row.Scan(&info.UUID, &info.Email, &info.Username)
 	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			switch pgErr.ConstraintName {
+			case "users_username_key", "users_username_lower_key":
+				return nil, fmt.Errorf("%s: %w", op, storage.ErrUsernameExists)
+			}
+		}
+
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	fmt.Println(info)
+	fmt.Println(*info)
 
-	return &info, nil
+	return info, nil
 }
 
-func (s *Storage) GetUserByID(ctx context.Context, username string) (*models.UserInfo, error) {
+// GetUserByID returns the profile as the viewer may see it.
+func (s *Storage) GetUserByID(ctx context.Context, viewer uuid.UUID, uid uuid.UUID) (*models.UserInfo, error) {
 	const op = "storage.postgres.user.Profile"
 
 	tx, err := s.pool.Begin(ctx)
@@ -83,12 +139,12 @@ func (s *Storage) GetUserByID(ctx context.Context, username string) (*models.Use
 	var info models.UserInfo
 
 	row := tx.QueryRow(ctx, `
-		SELECT id, email, username, name
-		FROM users
-		WHERE username = $1;
-	`, username)
+		SELECT ` + viewedProfileColumns + `
+		FROM users u
+		WHERE u.user_id = $2;
+	`, viewer, uid)
 
-	err = row.Scan(&info.UUID, &info.Email, &info.Username, &info.Name)
+	err = row.Scan(profileFields(&info)...)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
@@ -138,14 +194,116 @@ func (s *Storage) GetUserByEmail(ctx context.Context, email string) (*models.Nor
 	return &info, nil
 }
 
-func (s *Storage) Profiles(ctx context.Context, username string, cursor string, limit int) ([]models.UserInfo, *models.Cursor, error) {
-	const op = "storage.postgres.user.ListProfiles"
+// UserByID returns the identity of the user that auth-service puts in
+// its tokens.
+func (s *Storage) UserByID(ctx context.Context, uid uuid.UUID) (*models.NormalizedUser, error) {
+	const op = "storage.postgres.user.UserByID"
 
-	tx, err := s.pool.Begin(ctx)
+	var info models.NormalizedUser
+
+	row := s.pool.QueryRow(ctx, `
+		SELECT user_id, email, username
+		FROM users
+		WHERE user_id = $1;
+	`, uid)
+
+	err := row.Scan(&info.UUID, &info.Email, &info.Username)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+		}
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &info, nil
+}
+
+// Profiles searches the users that allow to be found by username and
+// name, as the viewer may see them, the best match first. The rank is the
+// trigram similarity of the closer field, raised for exact and prefix
+// matches and for the contacts of the viewer. The viewer always finds
+// themselves and never the users they blocked.
+func (s *Storage) Profiles(ctx context.Context, viewer uuid.UUID, query string, cursor string, limit int) ([]models.UserInfo, *models.Cursor, error) {
+	const op = "storage.postgres.user.Profiles"
+
+	after, err := afterCursor(cursor)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	query = strings.ToLower(query)
+
+	rows, err := s.pool.Query(ctx, `
+		SELECT *
+		FROM (
+			SELECT `+viewedProfileColumns+`, `+searchRank+` AS rank
+			FROM users u
+			WHERE (u.discoverable OR u.user_id = $1) AND `+notBlockedBy+`
+				AND (lower(u.username) % $2 OR lower(u.name) % $2
+					OR lower(u.username) LIKE $3 OR lower(u.name) LIKE $3)
+		) ranked
+		WHERE (rank, user_id) < ($4, $5)
+		ORDER BY rank DESC, user_id DESC
+		LIMIT $6;
+	`, viewer, query, escapeLike(query)+"%", after.Rank, after.UUID, limit+1)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	profiles := make([]models.UserInfo, 0, limit+1)
+
+	var last pageCursor
+
+	for rows.Next() {
+		var (
+			profile models.UserInfo
+			rank    float64
+		)
+
+		if err := rows.Scan(append(profileFields(&profile), &rank)...); err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		if len(profiles) < limit {
+			last = pageCursor{Rank: rank, UUID: profile.UUID.String()}
+		}
+
+		profiles = append(profiles, profile)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if len(profiles) <= limit {
+		return profiles, &models.Cursor{HasNextPage: false}, nil
+	}
+
+	next, err := encodeCursor(last)
 	if err != nil {
 		return nil, nil, fmt.Errorf("%s: %w", op, err)
 	}
 
+	return profiles[:limit], &models.Cursor{
+		NextCursor:  next,
+		HasNextPage: true,
+	}, nil
+}
+
+// UpdateProfile applies a partial update. Empty email, username and name
+// and nil pointers keep the stored value. A new username has to be free of
+// the cooldown of other users, released after cooldownSince, and the one
+// it replaces goes to the history.
+func (s *Storage) UpdateProfile(ctx context.Context, uid uuid.UUID, update models.NewUserInfo, cooldownSince time.Time) (info *models.UserInfo, err error) {
+	const op = "storage.postgres.user.UpdateProfile"
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
 	defer func() {
 		if err != nil {
 			_ = tx.Rollback(ctx)
@@ -158,118 +316,182 @@ func (s *Storage) Profiles(ctx context.Context, username string, cursor string,
 		}
 	}()
 
-	// Запрашиваем на один элемент больше, чтобы проверить наличие следующей страницы.
-	fetchLimit := limit + 1
+	if update.Username != "" {
+		if err = releaseUsername(ctx, tx, uid, update.Username, cooldownSince); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
 
-	var query string
-	args := make([]interface{}, 0, 4)
+	info = &models.UserInfo{}
 
-	// Ищем по частичному совпадению имени пользователя.
-	// ILIKE - регистронезависимый поиск в PostgreSQL.
-	usernamePattern := username + "%"
+	row := tx.QueryRow(ctx, `
+		UPDATE users
+		SET username = COALESCE(NULLIF($2, ''), username),
+			name = COALESCE(NULLIF($3, ''), name),
+			bio = COALESCE($4, bio),
+			avatar = COALESCE($5, avatar),
+			status_text = COALESCE($6, status_text),
+			timezone = COALESCE($7, timezone),
+			updated_at = NOW()
+		WHERE user_id = $1
+		RETURNING user_id, email, username, name, bio, avatar, status_text, timezone, last_seen_at, avatar_version;
+	`, uid, update.Username, update.Name, update.Bio, update.Avatar, update.StatusText, update.Timezone)
+
+	err = row.Scan(profileFields(info)...)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+		}
 
-	// Внутренняя структура для сканирования данных из БД, включая created_at.
-	type userWithTimestamp struct {
-		models.UserInfo
-		CreatedAt time.Time
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			switch pgErr.ConstraintName {
+			case "users_username_key", "users_username_lower_key":
+				return nil, fmt.Errorf("%s: %w", op, storage.ErrUsernameExists)
+			}
+		}
+
+		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	if cursor == "" {
-		// Первый запрос: курсора нет, начинаем с самого начала.
-		// Сортируем по убыванию времени создания, затем по UUID для стабильного порядка.
-		query = `
-			SELECT id, email, username, name, created_at
-			FROM users
-			WHERE username ILIKE $1
-			ORDER BY created_at DESC, id DESC
-			LIMIT $2
-		`
-		args = append(args, usernamePattern, fetchLimit)
-	} else {
-		// Последующие запросы: используем курсор.
-		decodedCursor, err := base64.StdEncoding.DecodeString(cursor)
-		if err != nil {
-			return nil, nil, fmt.Errorf("%s: invalid cursor format: %w", op, err)
-		}
+	return info, nil
+}
 
-		var c pageCursor
-		if err := json.Unmarshal(decodedCursor, &c); err != nil {
-			return nil, nil, fmt.Errorf("%s: invalid cursor data: %w", op, err)
+// releaseUsername prepares the change of the username of uid to the
+// normalized username: it checks the cooldown and records the current
+// username in the history. Keeping the username is not a change. Users
+// may always take back their own released usernames.
+func releaseUsername(ctx context.Context, tx pgx.Tx, uid uuid.UUID, username string, cooldownSince time.Time) error {
+	var current string
+
+	err := tx.QueryRow(ctx, `
+		SELECT username FROM users WHERE user_id = $1 FOR UPDATE;
+	`, uid).Scan(&current)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return storage.ErrUserNotFound
 		}
 
-		// Ищем записи, которые "старше" (созданы раньше), чем запись в курсоре.
-		// Конструкция (created_at, id) < ($2, $3) эффективно использует индекс.
-		query = `
-			SELECT id, email, username, name, created_at
-			FROM users
-			WHERE username ILIKE $1 AND (created_at, id) < ($2, $3)
-			ORDER BY created_at DESC, id DESC
-			LIMIT $4
-		`
-		args = append(args, usernamePattern, c.CreatedAt, c.UUID, fetchLimit)
+		return err
+	}
+
+	if strings.EqualFold(current, username) {
+		return nil
 	}
 
-	rows, err := s.pool.Query(ctx, query, args...)
+	cooling, err := usernameCooling(ctx, tx, uid, username, cooldownSince)
 	if err != nil {
-		// pgx.ErrNoRows не возвращается для Query, поэтому эта проверка не нужна.
-		// Пустой результат - это не ошибка.
-		return nil, nil, fmt.Errorf("%s: %w", op, err)
+		return err
+	}
+
+	if cooling {
+		return storage.ErrUsernameUnavailable
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO username_history (user_id, username)
+		VALUES ($1, $2);
+	`, uid, current)
+
+	return err
+}
+
+// usernameCooling tells whether someone other than uid released the
+// normalized username since cooldownSince.
+func usernameCooling(ctx context.Context, tx pgx.Tx, uid uuid.UUID, username string, cooldownSince time.Time) (bool, error) {
+	var cooling bool
+
+	err := tx.QueryRow(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM username_history
+			WHERE lower(username) = $1 AND user_id <> $2 AND released_at > $3
+		);
+	`, username, uid, cooldownSince).Scan(&cooling)
+
+	return cooling, err
+}
+
+// UsernameHistory lists the usernames the user released, the latest
+// first.
+func (s *Storage) UsernameHistory(ctx context.Context, uid uuid.UUID) ([]models.ReleasedUsername, error) {
+	const op = "storage.postgres.user.UsernameHistory"
+
+	rows, err := s.pool.Query(ctx, `
+		SELECT username, released_at
+		FROM username_history
+		WHERE user_id = $1
+		ORDER BY released_at DESC, id DESC;
+	`, uid)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 	defer rows.Close()
 
-	profiles := make([]userWithTimestamp, 0, fetchLimit)
+	history := make([]models.ReleasedUsername, 0)
+
 	for rows.Next() {
-		var item userWithTimestamp
-		// Сканируем id в поле UUID структуры UserInfo
-		err := rows.Scan(&item.UUID, &item.Email, &item.Username, &item.Name, &item.CreatedAt)
-		if err != nil {
-			return nil, nil, fmt.Errorf("%s: %w", op, err)
+		var released models.ReleasedUsername
+
+		if err := rows.Scan(&released.Username, &released.ReleasedAt); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
 		}
-		profiles = append(profiles, item)
-	}
 
-	if len(profiles) == 0 {
-		return []models.UserInfo{}, &models.Cursor{HasNextPage: false}, nil
+		history = append(history, released)
 	}
 
-	hasNextPage := len(profiles) > limit
-	if hasNextPage {
-		// Убираем лишний элемент, который мы запрашивали для проверки.
-		profiles = profiles[:limit]
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	// Создаем курсор для следующей страницы из последнего элемента в текущем списке.
-	lastItem := profiles[len(profiles)-1]
-	nextCursorData, err := json.Marshal(pageCursor{
-		CreatedAt: lastItem.CreatedAt,
-		UUID:      lastItem.UUID.String(),
-	})
+	return history, nil
+}
+
+// UserByUsername finds the user holding the normalized username and
+// returns their profile as the viewer bound to $1 may see it. A username
+// nobody holds leads to the user who released it last, if that was after
+// redirectSince, and redirected tells so.
+func (s *Storage) UserByUsername(ctx context.Context, viewer uuid.UUID, username string, redirectSince time.Time) (info *models.UserInfo, redirected bool, err error) {
+	const op = "storage.postgres.user.UserByUsername"
+
+	info = &models.UserInfo{}
+
+	err = s.pool.QueryRow(ctx, `
+		SELECT `+viewedProfileColumns+`, false
+		FROM users u
+		WHERE lower(u.username) = $2
+		UNION ALL
+		SELECT * FROM (
+			SELECT `+viewedProfileColumns+`, true
+			FROM username_history h
+			JOIN users u ON u.user_id = h.user_id
+			WHERE lower(h.username) = $2 AND h.released_at > $3
+			ORDER BY h.released_at DESC
+			LIMIT 1
+		) released
+		ORDER BY 11
+		LIMIT 1;
+	`, viewer, username, redirectSince).Scan(append(profileFields(info), &redirected)...)
 	if err != nil {
-		return nil, nil, fmt.Errorf("%s: failed to create next cursor: %w", op, err)
-	}
-	
-	nextCursor := base64.StdEncoding.EncodeToString(nextCursorData)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, false, fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+		}
 
-	// Преобразуем результат в целевой тип, убирая временную метку.
-	resultProfiles := make([]models.UserInfo, len(profiles))
-	for i, p := range profiles {
-		resultProfiles[i] = p.UserInfo
-	}
-	
-	rcursor := &models.Cursor{
-		NextCursor:  nextCursor,
-		HasNextPage: hasNextPage,
+		return nil, false, fmt.Errorf("%s: %w", op, err)
 	}
 
-	return resultProfiles, rcursor, nil
+	return info, redirected, nil
 }
 
-func (s *Storage) ChangeUsername(ctx context.Context, oldUsername string, newUsername string) (*models.UserInfo, error) {
-	const op = "storage.postgres.user.ChangeUsername"
+// SetAvatarVersion points the user at a new set of uploaded thumbnails,
+// an empty version removes the uploaded avatar. An upload also clears the
+// avatar reference. The version replaced is returned so its thumbnails
+// can be deleted.
+func (s *Storage) SetAvatarVersion(ctx context.Context, uid uuid.UUID, version string) (previous string, err error) {
+	const op = "storage.postgres.user.SetAvatarVersion"
 
 	tx, err := s.pool.Begin(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("%s: %w", op, err)
+		return "", fmt.Errorf("%s: %w", op, err)
 	}
 
 	defer func() {
@@ -282,80 +504,213 @@ func (s *Storage) ChangeUsername(ctx context.Context, oldUsername string, newUse
 		if commitErr != nil {
 			err = fmt.Errorf("%s: %w", op, commitErr)
 		}
-
 	}()
 
-	var info models.UserInfo
+	err = tx.QueryRow(ctx, `
+		SELECT avatar_version
+		FROM users
+		WHERE user_id = $1
+		FOR UPDATE;
+	`, uid).Scan(&previous)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+		}
 
-	row := tx.QueryRow(ctx, `
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = tx.Exec(ctx, `
 		UPDATE users
-		SET username = $1
-		WHERE username = $2
-		RETURNING id, email, username, name;
-	`, newUsername, oldUsername)
+		SET avatar_version = $2, avatar = CASE WHEN $2 = '' THEN avatar ELSE '' END, updated_at = NOW()
+		WHERE user_id = $1;
+	`, uid, version)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return previous, nil
+}
+
+func (s *Storage) Privacy(ctx context.Context, uid uuid.UUID) (*models.PrivacySettings, error) {
+	const op = "storage.postgres.user.Privacy"
 
-	err = row.Scan(&info.UUID, &info.Email, &info.Username, &info.Name)
+	var settings models.PrivacySettings
+
+	row := s.pool.QueryRow(ctx, `
+		SELECT discoverable, email_visibility, who_can_start_chat, last_seen_visibility
+		FROM users
+		WHERE user_id = $1;
+	`, uid)
+
+	err := row.Scan(&settings.Discoverable, &settings.EmailVisibility, &settings.WhoCanStartChat, &settings.LastSeenVisibility)
 	if err != nil {
-		pgErr := err.(*pgconn.PgError)
-		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
-			return nil, fmt.Errorf("%s: %w", op, storage.ErrUsernameExists)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
 		}
 
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	return &info, nil
+	return &settings, nil
 }
 
-func (s *Storage) ChangeEmail(ctx context.Context, username string, newEmail string) (*models.UserInfo, error) {
-	const op = "storage.postgres.user.ChangeEmail"
+// UpdatePrivacy changes the settings present in the update.
+func (s *Storage) UpdatePrivacy(ctx context.Context, uid uuid.UUID, update models.UpdatePrivacy) (*models.PrivacySettings, error) {
+	const op = "storage.postgres.user.UpdatePrivacy"
 
-	tx, err := s.pool.Begin(ctx)
+	var settings models.PrivacySettings
+
+	row := s.pool.QueryRow(ctx, `
+		UPDATE users
+		SET discoverable = COALESCE($2, discoverable),
+			email_visibility = COALESCE($3, email_visibility),
+			who_can_start_chat = COALESCE($4, who_can_start_chat),
+			last_seen_visibility = COALESCE($5, last_seen_visibility),
+			updated_at = NOW()
+		WHERE user_id = $1
+		RETURNING discoverable, email_visibility, who_can_start_chat, last_seen_visibility;
+	`, uid, update.Discoverable, update.EmailVisibility, update.WhoCanStartChat, update.LastSeenVisibility)
+
+	err := row.Scan(&settings.Discoverable, &settings.EmailVisibility, &settings.WhoCanStartChat, &settings.LastSeenVisibility)
 	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+		}
+
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	defer func() {
-		if err != nil {
-			_ = tx.Rollback(ctx)
-			return
+	return &settings, nil
+}
+
+// ChatDenied returns those of the users that do not accept a chat started
+// by the initiator, by their settings or because they blocked them.
+// Unknown users are not in the result.
+func (s *Storage) ChatDenied(ctx context.Context, initiator uuid.UUID, users []uuid.UUID) ([]uuid.UUID, error) {
+	const op = "storage.postgres.user.ChatDenied"
+
+	rows, err := s.pool.Query(ctx, `
+		SELECT u.user_id
+		FROM users u
+		WHERE u.user_id = ANY($2) AND (NOT `+audience("who_can_start_chat")+` OR `+hasBlocked+`);
+	`, initiator, users)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	denied := make([]uuid.UUID, 0)
+
+	for rows.Next() {
+		var uid uuid.UUID
+
+		if err := rows.Scan(&uid); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
 		}
 
-		commitErr := tx.Commit(ctx)
-		if commitErr != nil {
-			err = fmt.Errorf("%s: %w", op, commitErr)
+		denied = append(denied, uid)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return denied, nil
+}
+
+// ExistingUsers returns those of the users that have an account.
+func (s *Storage) ExistingUsers(ctx context.Context, uids []uuid.UUID) ([]uuid.UUID, error) {
+	const op = "storage.postgres.user.ExistingUsers"
+
+	rows, err := s.pool.Query(ctx, `
+		SELECT user_id FROM users WHERE user_id = ANY($1);
+	`, uids)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	existing := make([]uuid.UUID, 0, len(uids))
+
+	for rows.Next() {
+		var uid uuid.UUID
+
+		if err := rows.Scan(&uid); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
 		}
 
-	}()
+		existing = append(existing, uid)
+	}
 
-	var info models.UserInfo
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
 
-	row := tx.QueryRow(ctx, `
-		UPDATE users
-		SET email = $1
-		WHERE username = $2
-		RETURNING id, email, username, name;
-	`, newEmail, username)
+	return existing, nil
+}
 
-	err = row.Scan(&info.UUID, &info.Email, &info.Username, &info.Name)
+// UsersByID returns the profiles of the users as the viewer may see them,
+// in no particular order. Unknown users are not in the result.
+func (s *Storage) UsersByID(ctx context.Context, viewer uuid.UUID, uids []uuid.UUID) ([]models.UserInfo, error) {
+	const op = "storage.postgres.user.UsersByID"
+
+	rows, err := s.pool.Query(ctx, `
+		SELECT `+viewedProfileColumns+`
+		FROM users u
+		WHERE u.user_id = ANY($2);
+	`, viewer, uids)
 	if err != nil {
-		pgErr := err.(*pgconn.PgError)
-		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
-			return nil, fmt.Errorf("%s: %w", op, storage.ErrEmailExists)
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	users := make([]models.UserInfo, 0, len(uids))
+
+	for rows.Next() {
+		var info models.UserInfo
+
+		if err := rows.Scan(profileFields(&info)...); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
 		}
 
+		users = append(users, info)
+	}
+
+	if err := rows.Err(); err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	return &info, nil
+	return users, nil
+}
+
+// TouchLastSeen moves last_seen_at to now unless it is already newer than
+// staleBefore, so a busy client does not write on every request.
+func (s *Storage) TouchLastSeen(ctx context.Context, uid uuid.UUID, now time.Time, staleBefore time.Time) error {
+	const op = "storage.postgres.user.TouchLastSeen"
+
+	_, err := s.pool.Exec(ctx, `
+		UPDATE users
+		SET last_seen_at = $2
+		WHERE user_id = $1 AND (last_seen_at IS NULL OR last_seen_at < $3);
+	`, uid, now, staleBefore)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
 }
 
-func (s *Storage) ChangeName(ctx context.Context, username string, newName string) (*models.UserInfo, error) {
-	const op = "storage.postgres.user.ChangeName"
+// AnonymizeUser replaces everything that identifies the user and drops
+// their contacts, requests and blocks. The username they had is released
+// like on a change, so nobody takes it over right away. The row is kept, so the user_id
+// other services still hold resolves to a placeholder.
+func (s *Storage) AnonymizeUser(ctx context.Context, uid uuid.UUID, username string, email string, name string) (err error) {
+	const op = "storage.postgres.user.AnonymizeUser"
 
 	tx, err := s.pool.Begin(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("%s: %w", op, err)
+		return fmt.Errorf("%s: %w", op, err)
 	}
 
 	defer func() {
@@ -370,19 +725,132 @@ func (s *Storage) ChangeName(ctx context.Context, username string, newName strin
 		}
 	}()
 
-	var info models.UserInfo
+	_, err = tx.Exec(ctx, `
+		INSERT INTO username_history (user_id, username)
+		SELECT user_id, username FROM users
+		WHERE user_id = $1 AND username <> $2;
+	`, uid, username)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
 
-	row := tx.QueryRow(ctx, `
+	_, err = tx.Exec(ctx, `
 		UPDATE users
-		SET name = $1
-		WHERE username = $2
-		RETURNING id, email, username, name;
-	`, newName, username)
+		SET username = $2, email = $3, name = $4, bio = '', avatar = '', status_text = '', avatar_version = '', updated_at = NOW()
+		WHERE user_id = $1;
+	`, uid, username, email, name)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	for _, stmt := range []string{
+		`DELETE FROM contacts WHERE owner_id = $1 OR contact_id = $1;`,
+		`DELETE FROM contact_requests WHERE requester_id = $1 OR addressee_id = $1;`,
+		`DELETE FROM user_blocks WHERE blocker_id = $1 OR blocked_id = $1;`,
+	} {
+		if _, err = tx.Exec(ctx, stmt, uid); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	return nil
+}
 
-	err = row.Scan(&info.UUID, &info.Email, &info.Username, &info.Name)
+// SearchUsers lists all users, newest first, for the admin API. A non empty
+// query keeps the users whose username, email or name contains it.
+func (s *Storage) SearchUsers(ctx context.Context, query string, cursor string, limit int) ([]models.UserInfo, *models.Cursor, error) {
+	const op = "storage.postgres.user.SearchUsers"
+
+	after, err := afterCursor(cursor)
 	if err != nil {
-		return nil, fmt.Errorf("%s: %w", op, err)
+		return nil, nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	return &info, nil
+	rows, err := s.pool.Query(ctx, `
+		SELECT user_id, email, username, name, bio, avatar, status_text, timezone, last_seen_at, avatar_version, created_at
+		FROM users
+		WHERE ($1 = '' OR username ILIKE $2 OR email ILIKE $2 OR name ILIKE $2)
+			AND (created_at, user_id) < ($3, $4)
+		ORDER BY created_at DESC, user_id DESC
+		LIMIT $5;
+	`, query, "%"+escapeLike(query)+"%", after.CreatedAt, after.UUID, limit+1)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	users := make([]models.UserInfo, 0, limit+1)
+
+	var last pageCursor
+
+	for rows.Next() {
+		var (
+			user      models.UserInfo
+			createdAt time.Time
+		)
+
+		if err := rows.Scan(append(profileFields(&user), &createdAt)...); err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		if len(users) < limit {
+			last = pageCursor{CreatedAt: createdAt, UUID: user.UUID.String()}
+		}
+
+		users = append(users, user)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if len(users) <= limit {
+		return users, &models.Cursor{HasNextPage: false}, nil
+	}
+
+	next, err := encodeCursor(last)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return users[:limit], &models.Cursor{
+		NextCursor:  next,
+		HasNextPage: true,
+	}, nil
+}
+
+// audience is the SQL condition under which the viewer bound to $1 belongs
+// to the audience a visibility column of the users row u allows.
+func audience(column string) string {
+	return "(u.user_id = $1 OR u." + column + " = '" + models.VisibilityEveryone + "'" +
+		" OR (u." + column + " = '" + models.VisibilityContacts + "' AND " + isContact + "))"
+}
+
+// searchRank orders the search for the query bound to $2, see Profiles.
+// It is a float8 so the rank kept in a cursor compares exactly.
+var searchRank = `(
+	GREATEST(similarity(lower(u.username), $2), similarity(lower(u.name), $2))::float8
+	+ CASE WHEN lower(u.username) = $2 THEN 2 WHEN lower(u.name) = $2 THEN 1 ELSE 0 END
+	+ CASE WHEN lower(u.username) LIKE $3 THEN 0.5 ELSE 0 END
+	+ CASE WHEN ` + isContact + ` THEN 0.5 ELSE 0 END
+)::float8`
+
+// viewedProfileColumns select a profile as the viewer bound to $1 may see
+// it, what the owner hides from them comes back empty. The order matches
+// profileFields.
+var viewedProfileColumns = `u.user_id,
+	CASE WHEN ` + audience("email_visibility") + ` THEN u.email ELSE '' END,
+	u.username, u.name, u.bio, u.avatar, u.status_text, u.timezone,
+	CASE WHEN ` + audience("last_seen_visibility") + ` THEN u.last_seen_at END,
+	u.avatar_version`
+
+// profileFields are the scan targets of the profile columns, in the order
+// the queries select them.
+func profileFields(info *models.UserInfo) []any {
+	return []any{&info.UUID, &info.Email, &info.Username, &info.Name, &info.Bio, &info.Avatar, &info.StatusText, &info.Timezone, &info.LastSeenAt, &info.AvatarVersion}
+}
+
+// escapeLike keeps the wildcards of a search query literal.
+func escapeLike(query string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(query)
 }
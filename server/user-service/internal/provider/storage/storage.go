@@ -7,8 +7,15 @@ var (
 	ErrUsersNotFound          = errors.New("users not found")
 	ErrUserExists             = errors.New("user already exists")
 	ErrUsernameExists         = errors.New("username already exists")
+	ErrUsernameUnavailable    = errors.New("username is not available")
 	ErrEmailExists            = errors.New("email already exists")
 	ErrFailedToCreateChat     = errors.New("failed to create new chat")
 	ErrFailedToAddUsersInChat = errors.New("failed to add users in chat")
 	ErrChatsNotFound          = errors.New("chats not found")
+	ErrInvalidCursor          = errors.New("invalid cursor")
+	ErrBlobNotFound           = errors.New("blob not found")
+	ErrBlocked                = errors.New("users blocked each other")
+	ErrAlreadyContacts        = errors.New("users are already contacts")
+	ErrContactNotFound        = errors.New("contact not found")
+	ErrRequestNotFound        = errors.New("contact request not found")
 )
@@ -0,0 +1,207 @@
+package avatar
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+
+	"github.com/google/uuid"
+	"github.com/sergey-frey/cchat/user-service/internal/domain/models"
+	"github.com/sergey-frey/cchat/user-service/internal/lib/imaging"
+	"github.com/sergey-frey/cchat/user-service/internal/lib/logger/sl"
+	"github.com/sergey-frey/cchat/user-service/internal/provider/storage"
+)
+
+// maxPixels bounds the decoded size of an upload, a small file can still
+// describe a huge image.
+const maxPixels = 4096 * 4096
+
+type ProfileStore interface {
+	SetAvatarVersion(ctx context.Context, uid uuid.UUID, version string) (previous string, err error)
+}
+
+// BlobStore keeps the thumbnails, see the blob providers.
+type BlobStore interface {
+	Put(ctx context.Context, key string, blob models.Blob) error
+	Get(ctx context.Context, key string) (*models.Blob, error)
+	Delete(ctx context.Context, key string) error
+}
+
+type AvatarService struct {
+	profiles ProfileStore
+	blobs    BlobStore
+	maxSize  int64
+	baseURL  string
+	log      *slog.Logger
+}
+
+var (
+	ErrTooLarge        = errors.New("avatar is too large")
+	ErrUnsupportedType = errors.New("unsupported image type")
+	ErrInvalidImage    = errors.New("invalid image")
+	ErrUserNotFound    = errors.New("user not found")
+	ErrAvatarNotFound  = errors.New("avatar not found")
+)
+
+func New(profiles ProfileStore, blobs BlobStore, maxSize int64, baseURL string, log *slog.Logger) *AvatarService {
+	return &AvatarService{
+		profiles: profiles,
+		blobs:    blobs,
+		maxSize:  maxSize,
+		baseURL:  baseURL,
+		log:      log,
+	}
+}
+
+// Upload turns an image into the square thumbnails of models.AvatarSizes
+// and makes them the avatar of the user. The thumbnails are encoded anew,
+// nothing of the original file but its pixels is kept.
+func (a *AvatarService) Upload(ctx context.Context, uid uuid.UUID, r io.Reader) (*models.AvatarURLs, error) {
+	const op = "services.avatar.Upload"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.String("user_id", uid.String()),
+	)
+
+	data, err := io.ReadAll(io.LimitReader(r, a.maxSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if int64(len(data)) > a.maxSize {
+		return nil, fmt.Errorf("%s: %w", op, ErrTooLarge)
+	}
+
+	square, err := imaging.DecodeSquare(data, maxPixels)
+	if err != nil {
+		switch {
+		case errors.Is(err, imaging.ErrUnsupportedType):
+			return nil, fmt.Errorf("%s: %w", op, ErrUnsupportedType)
+		case errors.Is(err, imaging.ErrTooManyPixels):
+			return nil, fmt.Errorf("%s: %w", op, ErrTooLarge)
+		default:
+			return nil, fmt.Errorf("%s: %w", op, ErrInvalidImage)
+		}
+	}
+
+	thumbnails := make([]models.Blob, len(models.AvatarSizes))
+	hash := sha256.New()
+
+	for i, size := range models.AvatarSizes {
+		encoded, contentType, err := imaging.Encode(imaging.Resize(square, size))
+		if err != nil {
+			log.Error("failed to encode thumbnail", sl.Err(err))
+
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		thumbnails[i] = models.Blob{ContentType: contentType, Data: encoded}
+		hash.Write(encoded)
+	}
+
+	version := hex.EncodeToString(hash.Sum(nil))[:16]
+
+	for i, size := range models.AvatarSizes {
+		if err := a.blobs.Put(ctx, key(uid, version, size), thumbnails[i]); err != nil {
+			log.Error("failed to store thumbnail", sl.Err(err))
+
+			a.removeThumbnails(ctx, log, uid, version)
+
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	previous, err := a.profiles.SetAvatarVersion(ctx, uid, version)
+	if err != nil {
+		a.removeThumbnails(ctx, log, uid, version)
+
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return nil, fmt.Errorf("%s: %w", op, ErrUserNotFound)
+		}
+
+		log.Error("failed to set avatar", sl.Err(err))
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Uploading the same image again yields the same version.
+	if previous != "" && previous != version {
+		a.removeThumbnails(ctx, log, uid, previous)
+	}
+
+	log.Info("avatar uploaded", slog.String("version", version))
+
+	return models.NewAvatarURLs(a.baseURL, uid, version), nil
+}
+
+// Remove drops the uploaded avatar of the user, if there is one.
+func (a *AvatarService) Remove(ctx context.Context, uid uuid.UUID) error {
+	const op = "services.avatar.Remove"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.String("user_id", uid.String()),
+	)
+
+	previous, err := a.profiles.SetAvatarVersion(ctx, uid, "")
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrUserNotFound)
+		}
+
+		log.Error("failed to remove avatar", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if previous != "" {
+		a.removeThumbnails(ctx, log, uid, previous)
+	}
+
+	log.Info("avatar removed")
+
+	return nil
+}
+
+// Thumbnail returns one thumbnail of an avatar version.
+func (a *AvatarService) Thumbnail(ctx context.Context, uid uuid.UUID, version string, size int) (*models.Blob, error) {
+	const op = "services.avatar.Thumbnail"
+
+	// The version ends up in the blob key, only accept what Upload makes.
+	if _, err := hex.DecodeString(version); err != nil || len(version) != 16 || !slices.Contains(models.AvatarSizes, size) {
+		return nil, fmt.Errorf("%s: %w", op, ErrAvatarNotFound)
+	}
+
+	blob, err := a.blobs.Get(ctx, key(uid, version, size))
+	if err != nil {
+		if errors.Is(err, storage.ErrBlobNotFound) {
+			return nil, fmt.Errorf("%s: %w", op, ErrAvatarNotFound)
+		}
+
+		a.log.Error("failed to get thumbnail", slog.String("op", op), sl.Err(err))
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return blob, nil
+}
+
+// removeThumbnails is best effort, a leftover thumbnail is only unused
+// space.
+func (a *AvatarService) removeThumbnails(ctx context.Context, log *slog.Logger, uid uuid.UUID, version string) {
+	for _, size := range models.AvatarSizes {
+		if err := a.blobs.Delete(ctx, key(uid, version, size)); err != nil {
+			log.Warn("failed to delete thumbnail", slog.String("version", version), sl.Err(err))
+		}
+	}
+}
+
+func key(uid uuid.UUID, version string, size int) string {
+	return fmt.Sprintf("avatars/%s/%s/%d", uid, version, size)
+}
@@ -0,0 +1,123 @@
+package block
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/google/uuid"
+	"github.com/sergey-frey/cchat/user-service/internal/domain/models"
+	"github.com/sergey-frey/cchat/user-service/internal/lib/logger/sl"
+	"github.com/sergey-frey/cchat/user-service/internal/provider/storage"
+)
+
+type BlockStore interface {
+	BlockUser(ctx context.Context, blocker uuid.UUID, blocked uuid.UUID) (err error)
+	UnblockUser(ctx context.Context, blocker uuid.UUID, blocked uuid.UUID) (err error)
+	Blocks(ctx context.Context, blocker uuid.UUID, cursor string, limit int) (blocks []models.BlockedUser, cursors *models.Cursor, err error)
+	BlockedAmong(ctx context.Context, user uuid.UUID, others []uuid.UUID) (blocked []uuid.UUID, err error)
+}
+
+type BlockService struct {
+	blocks    BlockStore
+	avatarURL string
+	log       *slog.Logger
+}
+
+var (
+	ErrBlockSelf     = errors.New("users can't block themselves")
+	ErrUserNotFound  = errors.New("user not found")
+	ErrInvalidCursor = errors.New("invalid cursor")
+)
+
+func New(blocks BlockStore, avatarURL string, log *slog.Logger) *BlockService {
+	return &BlockService{
+		blocks:    blocks,
+		avatarURL: avatarURL,
+		log:       log,
+	}
+}
+
+func (b *BlockService) Block(ctx context.Context, blocker uuid.UUID, blocked uuid.UUID) error {
+	const op = "services.block.Block"
+
+	log := b.log.With(
+		slog.String("op", op),
+		slog.String("user_id", blocker.String()),
+	)
+
+	if blocker == blocked {
+		return fmt.Errorf("%s: %w", op, ErrBlockSelf)
+	}
+
+	if err := b.blocks.BlockUser(ctx, blocker, blocked); err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrUserNotFound)
+		}
+
+		log.Error("failed to block user", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("user blocked", slog.String("blocked_id", blocked.String()))
+
+	return nil
+}
+
+func (b *BlockService) Unblock(ctx context.Context, blocker uuid.UUID, blocked uuid.UUID) error {
+	const op = "services.block.Unblock"
+
+	log := b.log.With(
+		slog.String("op", op),
+		slog.String("user_id", blocker.String()),
+	)
+
+	if err := b.blocks.UnblockUser(ctx, blocker, blocked); err != nil {
+		log.Error("failed to unblock user", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("user unblocked", slog.String("blocked_id", blocked.String()))
+
+	return nil
+}
+
+func (b *BlockService) Blocks(ctx context.Context, blocker uuid.UUID, cursor string, limit int) ([]models.BlockedUser, *models.Cursor, error) {
+	const op = "services.block.Blocks"
+
+	blocks, rcursor, err := b.blocks.Blocks(ctx, blocker, cursor, limit)
+	if err != nil {
+		if errors.Is(err, storage.ErrInvalidCursor) {
+			return nil, nil, fmt.Errorf("%s: %w", op, ErrInvalidCursor)
+		}
+
+		b.log.Error("failed to list blocks", slog.String("op", op), sl.Err(err))
+
+		return nil, nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	for i := range blocks {
+		info := &blocks[i].User
+		info.AvatarURLs = models.NewAvatarURLs(b.avatarURL, info.UUID, info.AvatarVersion)
+	}
+
+	return blocks, rcursor, nil
+}
+
+// CheckBlocks lets the other services find the users a request of the
+// user must not reach, whichever side of the block they are on.
+func (b *BlockService) CheckBlocks(ctx context.Context, check models.BlockCheck) (*models.BlockCheckResult, error) {
+	const op = "services.block.CheckBlocks"
+
+	blocked, err := b.blocks.BlockedAmong(ctx, check.User, check.Others)
+	if err != nil {
+		b.log.Error("failed to check blocks", slog.String("op", op), sl.Err(err))
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &models.BlockCheckResult{Blocked: blocked}, nil
+}
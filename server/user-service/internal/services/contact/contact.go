@@ -0,0 +1,232 @@
+package contact
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/google/uuid"
+	"github.com/sergey-frey/cchat/user-service/internal/domain/models"
+	"github.com/sergey-frey/cchat/user-service/internal/lib/logger/sl"
+	"github.com/sergey-frey/cchat/user-service/internal/provider/storage"
+)
+
+type ContactStore interface {
+	SendContactRequest(ctx context.Context, requester uuid.UUID, addressee uuid.UUID) (accepted bool, err error)
+	AcceptContactRequest(ctx context.Context, addressee uuid.UUID, requester uuid.UUID) (err error)
+	DeleteContactRequest(ctx context.Context, requester uuid.UUID, addressee uuid.UUID) (err error)
+	ContactRequests(ctx context.Context, user uuid.UUID, incoming bool, cursor string, limit int) (requests []models.ContactRequest, cursors *models.Cursor, err error)
+	Contacts(ctx context.Context, owner uuid.UUID, cursor string, limit int) (contacts []models.Contact, cursors *models.Cursor, err error)
+	SetContactNickname(ctx context.Context, owner uuid.UUID, contact uuid.UUID, nickname string) (updated *models.Contact, err error)
+	RemoveContact(ctx context.Context, owner uuid.UUID, contact uuid.UUID) (err error)
+	ContactsAmong(ctx context.Context, user uuid.UUID, others []uuid.UUID) (contacts []uuid.UUID, err error)
+}
+
+type ContactService struct {
+	contacts  ContactStore
+	avatarURL string
+	log       *slog.Logger
+}
+
+var (
+	ErrContactSelf     = errors.New("users can't add themselves")
+	ErrUserNotFound    = errors.New("user not found")
+	ErrBlocked         = errors.New("users blocked each other")
+	ErrAlreadyContacts = errors.New("users are already contacts")
+	ErrContactNotFound = errors.New("contact not found")
+	ErrRequestNotFound = errors.New("contact request not found")
+	ErrInvalidCursor   = errors.New("invalid cursor")
+)
+
+func New(contacts ContactStore, avatarURL string, log *slog.Logger) *ContactService {
+	return &ContactService{
+		contacts:  contacts,
+		avatarURL: avatarURL,
+		log:       log,
+	}
+}
+
+// SendRequest asks the addressee to become a contact. If they already
+// asked the requester, the two become contacts and accepted is true.
+func (c *ContactService) SendRequest(ctx context.Context, requester uuid.UUID, addressee uuid.UUID) (bool, error) {
+	const op = "services.contact.SendRequest"
+
+	log := c.log.With(
+		slog.String("op", op),
+		slog.String("user_id", requester.String()),
+	)
+
+	if requester == addressee {
+		return false, fmt.Errorf("%s: %w", op, ErrContactSelf)
+	}
+
+	accepted, err := c.contacts.SendContactRequest(ctx, requester, addressee)
+	if err != nil {
+		if mapped := mapError(err); mapped != nil {
+			return false, fmt.Errorf("%s: %w", op, mapped)
+		}
+
+		log.Error("failed to send contact request", sl.Err(err))
+
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("contact request sent", slog.String("addressee_id", addressee.String()), slog.Bool("accepted", accepted))
+
+	return accepted, nil
+}
+
+func (c *ContactService) AcceptRequest(ctx context.Context, addressee uuid.UUID, requester uuid.UUID) error {
+	const op = "services.contact.AcceptRequest"
+
+	log := c.log.With(
+		slog.String("op", op),
+		slog.String("user_id", addressee.String()),
+	)
+
+	if err := c.contacts.AcceptContactRequest(ctx, addressee, requester); err != nil {
+		if mapped := mapError(err); mapped != nil {
+			return fmt.Errorf("%s: %w", op, mapped)
+		}
+
+		log.Error("failed to accept contact request", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("contact request accepted", slog.String("requester_id", requester.String()))
+
+	return nil
+}
+
+// DeleteRequest drops the request the requester sent to the addressee,
+// whichever of the two asks for it.
+func (c *ContactService) DeleteRequest(ctx context.Context, requester uuid.UUID, addressee uuid.UUID) error {
+	const op = "services.contact.DeleteRequest"
+
+	if err := c.contacts.DeleteContactRequest(ctx, requester, addressee); err != nil {
+		if mapped := mapError(err); mapped != nil {
+			return fmt.Errorf("%s: %w", op, mapped)
+		}
+
+		c.log.Error("failed to delete contact request", slog.String("op", op), sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (c *ContactService) Requests(ctx context.Context, user uuid.UUID, incoming bool, cursor string, limit int) ([]models.ContactRequest, *models.Cursor, error) {
+	const op = "services.contact.Requests"
+
+	requests, rcursor, err := c.contacts.ContactRequests(ctx, user, incoming, cursor, limit)
+	if err != nil {
+		if mapped := mapError(err); mapped != nil {
+			return nil, nil, fmt.Errorf("%s: %w", op, mapped)
+		}
+
+		c.log.Error("failed to list contact requests", slog.String("op", op), sl.Err(err))
+
+		return nil, nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	for i := range requests {
+		c.resolveAvatar(&requests[i].User)
+	}
+
+	return requests, rcursor, nil
+}
+
+func (c *ContactService) Contacts(ctx context.Context, owner uuid.UUID, cursor string, limit int) ([]models.Contact, *models.Cursor, error) {
+	const op = "services.contact.Contacts"
+
+	contacts, rcursor, err := c.contacts.Contacts(ctx, owner, cursor, limit)
+	if err != nil {
+		if mapped := mapError(err); mapped != nil {
+			return nil, nil, fmt.Errorf("%s: %w", op, mapped)
+		}
+
+		c.log.Error("failed to list contacts", slog.String("op", op), sl.Err(err))
+
+		return nil, nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	for i := range contacts {
+		c.resolveAvatar(&contacts[i].User)
+	}
+
+	return contacts, rcursor, nil
+}
+
+func (c *ContactService) UpdateContact(ctx context.Context, owner uuid.UUID, contact uuid.UUID, update models.UpdateContact) (*models.Contact, error) {
+	const op = "services.contact.UpdateContact"
+
+	updated, err := c.contacts.SetContactNickname(ctx, owner, contact, update.Nickname)
+	if err != nil {
+		if mapped := mapError(err); mapped != nil {
+			return nil, fmt.Errorf("%s: %w", op, mapped)
+		}
+
+		c.log.Error("failed to update contact", slog.String("op", op), sl.Err(err))
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	c.resolveAvatar(&updated.User)
+
+	return updated, nil
+}
+
+func (c *ContactService) RemoveContact(ctx context.Context, owner uuid.UUID, contact uuid.UUID) error {
+	const op = "services.contact.RemoveContact"
+
+	if err := c.contacts.RemoveContact(ctx, owner, contact); err != nil {
+		c.log.Error("failed to remove contact", slog.String("op", op), sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// CheckContacts answers for the other services which of the others are
+// contacts of the user.
+func (c *ContactService) CheckContacts(ctx context.Context, check models.ContactCheck) (*models.ContactCheckResult, error) {
+	const op = "services.contact.CheckContacts"
+
+	contacts, err := c.contacts.ContactsAmong(ctx, check.User, check.Others)
+	if err != nil {
+		c.log.Error("failed to check contacts", slog.String("op", op), sl.Err(err))
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &models.ContactCheckResult{Contacts: contacts}, nil
+}
+
+func (c *ContactService) resolveAvatar(info *models.UserInfo) {
+	info.AvatarURLs = models.NewAvatarURLs(c.avatarURL, info.UUID, info.AvatarVersion)
+}
+
+// mapError turns the storage errors a caller can act on into the errors
+// of the service, anything else is nil.
+func mapError(err error) error {
+	switch {
+	case errors.Is(err, storage.ErrUserNotFound):
+		return ErrUserNotFound
+	case errors.Is(err, storage.ErrBlocked):
+		return ErrBlocked
+	case errors.Is(err, storage.ErrAlreadyContacts):
+		return ErrAlreadyContacts
+	case errors.Is(err, storage.ErrContactNotFound):
+		return ErrContactNotFound
+	case errors.Is(err, storage.ErrRequestNotFound):
+		return ErrRequestNotFound
+	case errors.Is(err, storage.ErrInvalidCursor):
+		return ErrInvalidCursor
+	}
+
+	return nil
+}
@@ -0,0 +1,167 @@
+package export
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/google/uuid"
+	"github.com/sergey-frey/cchat/user-service/internal/domain/models"
+	"github.com/sergey-frey/cchat/user-service/internal/lib/logger/sl"
+	"github.com/sergey-frey/cchat/user-service/internal/provider/storage"
+)
+
+type ExportStore interface {
+	GetUserByID(ctx context.Context, viewer uuid.UUID, uid uuid.UUID) (info *models.UserInfo, err error)
+	Privacy(ctx context.Context, uid uuid.UUID) (settings *models.PrivacySettings, err error)
+	UsernameHistory(ctx context.Context, uid uuid.UUID) (history []models.ReleasedUsername, err error)
+	Contacts(ctx context.Context, owner uuid.UUID, cursor string, limit int) (contacts []models.Contact, cursors *models.Cursor, err error)
+	ContactRequests(ctx context.Context, user uuid.UUID, incoming bool, cursor string, limit int) (requests []models.ContactRequest, cursors *models.Cursor, err error)
+	Blocks(ctx context.Context, blocker uuid.UUID, cursor string, limit int) (blocks []models.BlockedUser, cursors *models.Cursor, err error)
+}
+
+type ExportService struct {
+	store     ExportStore
+	avatarURL string
+	log       *slog.Logger
+}
+
+var ErrUserNotFound = errors.New("user not found")
+
+// pageSize is how many entries of a list are read at once.
+const pageSize = 100
+
+func New(store ExportStore, avatarURL string, log *slog.Logger) *ExportService {
+	return &ExportService{
+		store:     store,
+		avatarURL: avatarURL,
+		log:       log,
+	}
+}
+
+// ExportUser gathers everything kept about the user for the data export
+// auth-service assembles.
+func (e *ExportService) ExportUser(ctx context.Context, uid uuid.UUID) (*models.UserExport, error) {
+	const op = "services.export.ExportUser"
+
+	log := e.log.With(
+		slog.String("op", op),
+		slog.String("user_id", uid.String()),
+	)
+
+	export, err := e.collect(ctx, uid)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.Warn("user not found")
+
+			return nil, fmt.Errorf("%s: %w", op, ErrUserNotFound)
+		}
+
+		log.Error("failed to export user", sl.Err(err))
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("user exported")
+
+	return export, nil
+}
+
+func (e *ExportService) collect(ctx context.Context, uid uuid.UUID) (*models.UserExport, error) {
+	profile, err := e.store.GetUserByID(ctx, uid, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	e.resolveAvatar(profile)
+
+	privacy, err := e.store.Privacy(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	history, err := e.store.UsernameHistory(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	contacts, err := allPages(func(cursor string) ([]models.Contact, *models.Cursor, error) {
+		return e.store.Contacts(ctx, uid, cursor, pageSize)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	incoming, err := allPages(func(cursor string) ([]models.ContactRequest, *models.Cursor, error) {
+		return e.store.ContactRequests(ctx, uid, true, cursor, pageSize)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	outgoing, err := allPages(func(cursor string) ([]models.ContactRequest, *models.Cursor, error) {
+		return e.store.ContactRequests(ctx, uid, false, cursor, pageSize)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	blocks, err := allPages(func(cursor string) ([]models.BlockedUser, *models.Cursor, error) {
+		return e.store.Blocks(ctx, uid, cursor, pageSize)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range contacts {
+		e.resolveAvatar(&contacts[i].User)
+	}
+
+	for i := range incoming {
+		e.resolveAvatar(&incoming[i].User)
+	}
+
+	for i := range outgoing {
+		e.resolveAvatar(&outgoing[i].User)
+	}
+
+	for i := range blocks {
+		e.resolveAvatar(&blocks[i].User)
+	}
+
+	return &models.UserExport{
+		Profile:          *profile,
+		Privacy:          *privacy,
+		UsernameHistory:  history,
+		Contacts:         contacts,
+		IncomingRequests: incoming,
+		OutgoingRequests: outgoing,
+		Blocks:           blocks,
+	}, nil
+}
+
+func (e *ExportService) resolveAvatar(info *models.UserInfo) {
+	info.AvatarURLs = models.NewAvatarURLs(e.avatarURL, info.UUID, info.AvatarVersion)
+}
+
+// allPages follows the cursors of a paged list to its end.
+func allPages[T any](page func(cursor string) ([]T, *models.Cursor, error)) ([]T, error) {
+	all := make([]T, 0)
+	cursor := ""
+
+	for {
+		items, next, err := page(cursor)
+		if err != nil {
+			return nil, err
+		}
+
+		all = append(all, items...)
+
+		if !next.HasNextPage {
+			return all, nil
+		}
+
+		cursor = next.NextCursor
+	}
+}
@@ -5,43 +5,67 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"time"
 
 	"github.com/brianvoe/gofakeit/v6"
 	"github.com/google/uuid"
 	"github.com/sergey-frey/cchat/user-service/internal/domain/models"
-	"github.com/sergey-frey/cchat/user-service/internal/lib/jwt"
 	"github.com/sergey-frey/cchat/user-service/internal/lib/logger/sl"
+	usernames "github.com/sergey-frey/cchat/user-service/internal/lib/username"
 	"github.com/sergey-frey/cchat/user-service/internal/provider/storage"
 )
 
 type UserService interface {
-	CreateUser(ctx context.Context, uid uuid.UUID, email string, username string, name string) (info *models.NormalizedUser, err error)
-	GetUserByID(ctx context.Context, username string) (info *models.UserInfo, err error)
+	CreateUser(ctx context.Context, uid uuid.UUID, email string, username string, name string, cooldownSince time.Time) (info *models.NormalizedUser, err error)
+	GetUserByID(ctx context.Context, viewer uuid.UUID, uid uuid.UUID) (info *models.UserInfo, err error)
 	GetUserByEmail(ctx context.Context, email string) (info *models.NormalizedUser, err error)
-	Profiles(ctx context.Context, username string, cursor string, limit int) (profiles []models.UserInfo, cursors *models.Cursor, err error)
-	ChangeUsername(ctx context.Context, oldUsername string, newUsername string) (info *models.UserInfo, err error)
-	ChangeEmail(ctx context.Context, username string, newEmail string) (info *models.UserInfo, err error)
-	ChangeName(ctx context.Context, username string, newName string) (info *models.UserInfo, err error)
+	UserByID(ctx context.Context, uid uuid.UUID) (info *models.NormalizedUser, err error)
+	Profiles(ctx context.Context, viewer uuid.UUID, query string, cursor string, limit int) (profiles []models.UserInfo, cursors *models.Cursor, err error)
+	Privacy(ctx context.Context, uid uuid.UUID) (settings *models.PrivacySettings, err error)
+	UpdatePrivacy(ctx context.Context, uid uuid.UUID, update models.UpdatePrivacy) (settings *models.PrivacySettings, err error)
+	ChatDenied(ctx context.Context, initiator uuid.UUID, users []uuid.UUID) (denied []uuid.UUID, err error)
+	ExistingUsers(ctx context.Context, uids []uuid.UUID) (existing []uuid.UUID, err error)
+	UsersByID(ctx context.Context, viewer uuid.UUID, uids []uuid.UUID) (users []models.UserInfo, err error)
+	UpdateProfile(ctx context.Context, uid uuid.UUID, update models.NewUserInfo, cooldownSince time.Time) (info *models.UserInfo, err error)
+	UserByUsername(ctx context.Context, viewer uuid.UUID, username string, redirectSince time.Time) (info *models.UserInfo, redirected bool, err error)
+	TouchLastSeen(ctx context.Context, uid uuid.UUID, now time.Time, staleBefore time.Time) (err error)
+	AnonymizeUser(ctx context.Context, uid uuid.UUID, username string, email string, name string) (err error)
+	SearchUsers(ctx context.Context, query string, cursor string, limit int) (users []models.UserInfo, cursors *models.Cursor, err error)
 }
 
 type UserDataService struct {
 	userService UserService
+	avatarURL   string
+	usernames   usernames.Policy
 	log         *slog.Logger
 }
 
-func New(userProvider UserService, log *slog.Logger) *UserDataService {
+// New takes the base URL the uploaded avatars are served under, the
+// profiles link their thumbnails below it, and the rules usernames follow.
+func New(userProvider UserService, avatarURL string, policy usernames.Policy, log *slog.Logger) *UserDataService {
 	return &UserDataService{
 		userService: userProvider,
+		avatarURL:   avatarURL,
+		usernames:   policy,
 		log:         log,
 	}
 }
 
+// lastSeenPrecision is how stale last_seen_at may get before a request
+// moves it again.
+const lastSeenPrecision = time.Minute
+
+// usernameAttempts is how many generated usernames a new account tries
+// before giving up, when the ones picked are taken or cooling down.
+const usernameAttempts = 5
+
 var (
 	ErrUserNotFound      = errors.New("user not found")
 	ErrUsersNotFound     = errors.New("users not found")
 	ErrUsernameExists    = errors.New("username already exists")
-	ErrEmailExists       = errors.New("email already exists")
-	ErrPasswordsMismatch = errors.New("passwords don't match")
+	ErrUsernameReserved  = errors.New("username is reserved")
+	ErrUsernameCooldown  = errors.New("username was released recently")
+	ErrInvalidCursor     = errors.New("invalid cursor")
 )
 
 func (u *UserDataService) CreateUser(ctx context.Context, email string) (*models.NormalizedUser, error) {
@@ -55,11 +79,24 @@ func (u *UserDataService) CreateUser(ctx context.Context, email string) (*models
 	log.Info("getting user information")
 
 	name := "nameless"
-	username := gofakeit.Username()
 	uid := uuid.New()
 
-	info, err := u.userService.CreateUser(ctx, uid, email, username, name)
-	if err != nil {
+	var info *models.NormalizedUser
+	var err error
+
+	for attempt := 1; ; attempt++ {
+		info, err = u.userService.CreateUser(ctx, uid, email, u.generateUsername(), name, time.Now().Add(-u.usernames.Cooldown))
+		if err == nil {
+			break
+		}
+
+		taken := errors.Is(err, storage.ErrUsernameExists) || errors.Is(err, storage.ErrUsernameUnavailable)
+		if taken && attempt < usernameAttempts {
+			log.Warn("generated username is not available, trying another")
+
+			continue
+		}
+
 		log.Error("failed to create user", sl.Err(err))
 
 		return nil, fmt.Errorf("%s: %w", op, err)
@@ -70,17 +107,30 @@ func (u *UserDataService) CreateUser(ctx context.Context, email string) (*models
 	return info, nil
 }
 
-func (u *UserDataService) GetUserByID(ctx context.Context, username string) (*models.UserInfo, error) {
+// generateUsername picks a random username for a new account that passes
+// the same rules as a change of username and is not reserved.
+func (u *UserDataService) generateUsername() string {
+	for {
+		username := usernames.Normalize(gofakeit.Username())
+
+		if usernames.IsValid(username) && !u.usernames.IsReserved(username) {
+			return username
+		}
+	}
+}
+
+// GetUserByID returns the profile of uid as the viewer may see it.
+func (u *UserDataService) GetUserByID(ctx context.Context, viewer uuid.UUID, uid uuid.UUID) (*models.UserInfo, error) {
 	const op = "services.user.Profile"
 
 	log := u.log.With(
 		slog.String("op", op),
-		slog.String("username", username),
+		slog.String("user_id", uid.String()),
 	)
 
 	log.Info("getting profile information")
 
-	info, err := u.userService.GetUserByID(ctx, username)
+	info, err := u.userService.GetUserByID(ctx, viewer, uid)
 	if err != nil {
 		if errors.Is(err, storage.ErrUserNotFound) {
 			log.Error("user not found", sl.Err(err))
@@ -95,9 +145,33 @@ func (u *UserDataService) GetUserByID(ctx context.Context, username string) (*mo
 
 	log.Info("got profile information")
 
+	u.resolveAvatar(info)
+
 	return info, nil
 }
 
+// UserByUsername returns the profile of the user holding the username as
+// the viewer may see it. A username released within the redirect period
+// still finds its previous owner, redirected tells that it did.
+func (u *UserDataService) UserByUsername(ctx context.Context, viewer uuid.UUID, username string) (*models.UserInfo, bool, error) {
+	const op = "services.user.UserByUsername"
+
+	info, redirected, err := u.userService.UserByUsername(ctx, viewer, usernames.Normalize(username), time.Now().Add(-u.usernames.RedirectPeriod))
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return nil, false, fmt.Errorf("%s: %w", op, ErrUserNotFound)
+		}
+
+		u.log.Error("failed to find user by username", slog.String("op", op), sl.Err(err))
+
+		return nil, false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	u.resolveAvatar(info)
+
+	return info, redirected, nil
+}
+
 func (u *UserDataService) GetUserByEmail(ctx context.Context, email string) (*models.NormalizedUser, error) {
 	const op = "services.user.GetUserByEmail"
 
@@ -126,23 +200,42 @@ func (u *UserDataService) GetUserByEmail(ctx context.Context, email string) (*mo
 	return info, nil
 }
 
-func (u *UserDataService) Profiles(ctx context.Context, username string, cursor string, limit int) ([]models.UserInfo, *models.Cursor, error) {
+// UserByID returns the identity of the user for auth-service, which
+// keeps the tokens it issues in line with the profile.
+func (u *UserDataService) UserByID(ctx context.Context, uid uuid.UUID) (*models.NormalizedUser, error) {
+	const op = "services.user.UserByID"
+
+	info, err := u.userService.UserByID(ctx, uid)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return nil, fmt.Errorf("%s: %w", op, ErrUserNotFound)
+		}
+
+		u.log.Error("failed to get user", slog.String("op", op), slog.String("user_id", uid.String()), sl.Err(err))
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return info, nil
+}
+
+// Profiles searches users by username and name, the best match first.
+func (u *UserDataService) Profiles(ctx context.Context, viewer uuid.UUID, query string, cursor string, limit int) ([]models.UserInfo, *models.Cursor, error) {
 	const op = "services.user.ListProfiles"
 
 	log := u.log.With(
 		slog.String("op", op),
-		slog.String("username", username),
+		slog.String("query", query),
 	)
 
 	log.Info("getting profiles")
 
-	profiles, rcursor, err := u.userService.Profiles(ctx, username, cursor, limit)
+	profiles, rcursor, err := u.userService.Profiles(ctx, viewer, query, cursor, limit)
 	if err != nil {
-		if errors.Is(err, storage.ErrUsersNotFound) {
-			log.Error("users not found")
-
-			return nil, nil, fmt.Errorf("%s: %w", op, ErrUsersNotFound)
+		if errors.Is(err, storage.ErrInvalidCursor) {
+			return nil, nil, fmt.Errorf("%s: %w", op, ErrInvalidCursor)
 		}
+
 		log.Error("failed to get profiles", sl.Err(err))
 
 		return nil, nil, fmt.Errorf("%s: %w", op, err)
@@ -150,73 +243,235 @@ func (u *UserDataService) Profiles(ctx context.Context, username string, cursor
 
 	log.Info("got profiles")
 
+	for i := range profiles {
+		u.resolveAvatar(&profiles[i])
+	}
+
 	return profiles, rcursor, nil
 }
 
-func (u *UserDataService) UpdateInfo(ctx context.Context, username string, newInfo models.NewUserInfo) (info *models.UserInfo, accessToken string, refreshToken string, err error) {
+// SearchUsers pages through all users for the admin API.
+func (u *UserDataService) SearchUsers(ctx context.Context, query string, cursor string, limit int) ([]models.UserInfo, *models.Cursor, error) {
+	const op = "services.user.SearchUsers"
+
+	log := u.log.With(
+		slog.String("op", op),
+	)
+
+	users, rcursor, err := u.userService.SearchUsers(ctx, query, cursor, limit)
+	if err != nil {
+		if errors.Is(err, storage.ErrInvalidCursor) {
+			return nil, nil, fmt.Errorf("%s: %w", op, ErrInvalidCursor)
+		}
+
+		log.Error("failed to search users", sl.Err(err))
+
+		return nil, nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	for i := range users {
+		u.resolveAvatar(&users[i])
+	}
+
+	return users, rcursor, nil
+}
+
+// UpdateInfo changes the given profile fields of the user and keeps the
+// rest, all of them are written at once or none is.
+func (u *UserDataService) UpdateInfo(ctx context.Context, uid uuid.UUID, newInfo models.NewUserInfo) (*models.UserInfo, error) {
 	const op = "services.user.UpdateInfo"
 
 	log := u.log.With(
 		slog.String("op", op),
-		slog.String("username", username),
+		slog.String("user_id", uid.String()),
 	)
 
-	if newInfo.Name != "" {
-		log.Info("changing name")
+	log.Info("updating profile")
+
+	if newInfo.Timezone != nil && *newInfo.Timezone == "" {
+		utc := "UTC"
+		newInfo.Timezone = &utc
+	}
+
+	newInfo.Username = usernames.Normalize(newInfo.Username)
 
-		info, err = u.userService.ChangeName(ctx, username, newInfo.Name)
-		if err != nil {
-			log.Error("failed with changing name", sl.Err(err))
+	if newInfo.Username != "" && u.usernames.IsReserved(newInfo.Username) {
+		log.Warn("username is reserved", slog.String("username", newInfo.Username))
 
-			return nil, "", "", fmt.Errorf("%s: %w", op, err)
+		return nil, fmt.Errorf("%s: %w", op, ErrUsernameReserved)
+	}
+
+	info, err := u.userService.UpdateProfile(ctx, uid, newInfo, time.Now().Add(-u.usernames.Cooldown))
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrUserNotFound):
+			log.Warn("user not found")
+
+			return nil, fmt.Errorf("%s: %w", op, ErrUserNotFound)
+		case errors.Is(err, storage.ErrUsernameExists):
+			log.Warn("username already exists")
+
+			return nil, fmt.Errorf("%s: %w", op, ErrUsernameExists)
+		case errors.Is(err, storage.ErrUsernameUnavailable):
+			log.Warn("username is in its cooldown")
+
+			return nil, fmt.Errorf("%s: %w", op, ErrUsernameCooldown)
 		}
 
-		log.Info("name changed")
+		log.Error("failed to update profile", sl.Err(err))
+
+		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	if newInfo.Email != "" {
-		log.Info("changing email")
+	log.Info("profile updated")
 
-		info, err = u.userService.ChangeEmail(ctx, username, newInfo.Email)
-		if err != nil {
-			if errors.Is(err, storage.ErrEmailExists) {
-				log.Error("email already exists", sl.Err(err))
+	u.resolveAvatar(info)
 
-				return nil, "", "", fmt.Errorf("%s: %w", op, ErrEmailExists)
-			}
-			log.Error("failed to change email", sl.Err(err))
+	return info, nil
+}
 
-			return nil, "", "", fmt.Errorf("%s: %w", op, err)
+func (u *UserDataService) Privacy(ctx context.Context, uid uuid.UUID) (*models.PrivacySettings, error) {
+	const op = "services.user.Privacy"
+
+	settings, err := u.userService.Privacy(ctx, uid)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return nil, fmt.Errorf("%s: %w", op, ErrUserNotFound)
 		}
 
-		log.Info("email changed")
+		u.log.Error("failed to get privacy settings", slog.String("op", op), sl.Err(err))
+
+		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	if newInfo.Username != "" {
-		log.Info("changing username")
+	return settings, nil
+}
 
-		info, err := u.userService.ChangeUsername(ctx, username, newInfo.Username)
-		if err != nil {
-			if errors.Is(err, storage.ErrUsernameExists) {
-				log.Error("username already exists", sl.Err(err))
+func (u *UserDataService) UpdatePrivacy(ctx context.Context, uid uuid.UUID, update models.UpdatePrivacy) (*models.PrivacySettings, error) {
+	const op = "services.user.UpdatePrivacy"
 
-				return nil, "", "", fmt.Errorf("%s: %w", op, ErrUsernameExists)
-			}
-			log.Error("failed to change username", sl.Err(err))
+	log := u.log.With(
+		slog.String("op", op),
+		slog.String("user_id", uid.String()),
+	)
 
-			return nil, "", "", fmt.Errorf("%s: %w", op, err)
+	settings, err := u.userService.UpdatePrivacy(ctx, uid, update)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return nil, fmt.Errorf("%s: %w", op, ErrUserNotFound)
 		}
 
-		user := models.InfoToNormalized(info)
-		accessToken, refreshToken, err = jwt.NewPairTokens(user)
-		if err != nil {
-			log.Error("failed to generate tokens", sl.Err(err))
+		log.Error("failed to update privacy settings", sl.Err(err))
 
-			return nil, "", "", fmt.Errorf("%s: %w", op, err)
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("privacy settings updated")
+
+	return settings, nil
+}
+
+// CheckChat tells chat-service which of the users refuse a chat started
+// by the initiator.
+func (u *UserDataService) CheckChat(ctx context.Context, check models.ChatCheck) (*models.ChatCheckResult, error) {
+	const op = "services.user.CheckChat"
+
+	denied, err := u.userService.ChatDenied(ctx, check.Initiator, check.Users)
+	if err != nil {
+		u.log.Error("failed to check chat", slog.String("op", op), sl.Err(err))
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &models.ChatCheckResult{Denied: denied}, nil
+}
+
+// CheckUsers tells the other services which of the users exist.
+func (u *UserDataService) CheckUsers(ctx context.Context, uids []uuid.UUID) (*models.UserCheckResult, error) {
+	const op = "services.user.CheckUsers"
+
+	existing, err := u.userService.ExistingUsers(ctx, uids)
+	if err != nil {
+		u.log.Error("failed to check users", slog.String("op", op), sl.Err(err))
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	found := make(map[uuid.UUID]struct{}, len(existing))
+	for _, uid := range existing {
+		found[uid] = struct{}{}
+	}
+
+	missing := make([]uuid.UUID, 0)
+
+	for _, uid := range uids {
+		if _, ok := found[uid]; !ok {
+			missing = append(missing, uid)
+			found[uid] = struct{}{}
 		}
+	}
+
+	return &models.UserCheckResult{Existing: existing, Missing: missing}, nil
+}
+
+// Users looks up many profiles in one go, so that chat-service can fill
+// in a member list without a request per member.
+func (u *UserDataService) Users(ctx context.Context, batch models.UserBatch) ([]models.UserInfo, error) {
+	const op = "services.user.Users"
+
+	users, err := u.userService.UsersByID(ctx, batch.Viewer, batch.UUIDs)
+	if err != nil {
+		u.log.Error("failed to get users", slog.String("op", op), sl.Err(err))
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	for i := range users {
+		u.resolveAvatar(&users[i])
+	}
+
+	return users, nil
+}
 
-		log.Info("username changed")
+// TouchLastSeen records that the user is active. It writes at most once
+// per lastSeenPrecision.
+func (u *UserDataService) TouchLastSeen(ctx context.Context, uid uuid.UUID) error {
+	const op = "services.user.TouchLastSeen"
+
+	now := time.Now()
+
+	if err := u.userService.TouchLastSeen(ctx, uid, now, now.Add(-lastSeenPrecision)); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
 	}
 
-	return info, accessToken, refreshToken, nil
+	return nil
+}
+
+// AnonymizeUser is the part of an account deletion that happens here. The
+// placeholders are derived from the id, so running it again changes nothing.
+func (u *UserDataService) AnonymizeUser(ctx context.Context, uid uuid.UUID) error {
+	const op = "services.user.AnonymizeUser"
+
+	log := u.log.With(
+		slog.String("op", op),
+		slog.String("user_id", uid.String()),
+	)
+
+	log.Info("anonymizing user")
+
+	err := u.userService.AnonymizeUser(ctx, uid, "deleted-"+uid.String(), uid.String()+"@deleted.invalid", "Deleted user")
+	if err != nil {
+		log.Error("failed to anonymize user", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("user anonymized")
+
+	return nil
+}
+
+// resolveAvatar links the thumbnails of an uploaded avatar.
+func (u *UserDataService) resolveAvatar(info *models.UserInfo) {
+	info.AvatarURLs = models.NewAvatarURLs(u.avatarURL, info.UUID, info.AvatarVersion)
 }
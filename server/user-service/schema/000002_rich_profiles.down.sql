@@ -0,0 +1,6 @@
+ALTER TABLE users
+    DROP COLUMN IF EXISTS "last_seen_at",
+    DROP COLUMN IF EXISTS "timezone",
+    DROP COLUMN IF EXISTS "status_text",
+    DROP COLUMN IF EXISTS "avatar",
+    DROP COLUMN IF EXISTS "bio";
@@ -0,0 +1,6 @@
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS "bio" TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS "avatar" TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS "status_text" TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS "timezone" TEXT NOT NULL DEFAULT 'UTC',
+    ADD COLUMN IF NOT EXISTS "last_seen_at" TIMESTAMPTZ;
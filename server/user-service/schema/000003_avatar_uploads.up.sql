@@ -0,0 +1,2 @@
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS "avatar_version" TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,5 @@
+ALTER TABLE users
+    DROP COLUMN IF EXISTS "last_seen_visibility",
+    DROP COLUMN IF EXISTS "who_can_start_chat",
+    DROP COLUMN IF EXISTS "email_visibility",
+    DROP COLUMN IF EXISTS "discoverable";
@@ -0,0 +1,8 @@
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS "discoverable" BOOLEAN NOT NULL DEFAULT TRUE,
+    ADD COLUMN IF NOT EXISTS "email_visibility" TEXT NOT NULL DEFAULT 'contacts'
+        CHECK ("email_visibility" IN ('everyone', 'contacts', 'nobody')),
+    ADD COLUMN IF NOT EXISTS "who_can_start_chat" TEXT NOT NULL DEFAULT 'everyone'
+        CHECK ("who_can_start_chat" IN ('everyone', 'contacts', 'nobody')),
+    ADD COLUMN IF NOT EXISTS "last_seen_visibility" TEXT NOT NULL DEFAULT 'everyone'
+        CHECK ("last_seen_visibility" IN ('everyone', 'contacts', 'nobody'));
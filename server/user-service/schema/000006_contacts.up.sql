@@ -0,0 +1,24 @@
+CREATE TABLE IF NOT EXISTS
+    contact_requests (
+        "requester_id" UUID NOT NULL REFERENCES users ("user_id") ON DELETE CASCADE,
+        "addressee_id" UUID NOT NULL REFERENCES users ("user_id") ON DELETE CASCADE,
+        "created_at" TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+        PRIMARY KEY ("requester_id", "addressee_id"),
+        CHECK ("requester_id" <> "addressee_id")
+    );
+
+CREATE INDEX IF NOT EXISTS contact_requests_addressee_id_idx ON contact_requests ("addressee_id", "created_at");
+
+-- A contact is stored once for each side, so both can give the other a
+-- nickname of their own.
+CREATE TABLE IF NOT EXISTS
+    contacts (
+        "owner_id" UUID NOT NULL REFERENCES users ("user_id") ON DELETE CASCADE,
+        "contact_id" UUID NOT NULL REFERENCES users ("user_id") ON DELETE CASCADE,
+        "nickname" TEXT NOT NULL DEFAULT '',
+        "created_at" TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+        PRIMARY KEY ("owner_id", "contact_id"),
+        CHECK ("owner_id" <> "contact_id")
+    );
+
+CREATE INDEX IF NOT EXISTS contacts_owner_id_created_at_idx ON contacts ("owner_id", "created_at", "contact_id");
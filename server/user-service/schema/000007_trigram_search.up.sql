@@ -0,0 +1,6 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- The search compares lowercased values, the indexes serve both the
+-- similarity operator and the prefix LIKE.
+CREATE INDEX IF NOT EXISTS users_username_trgm_idx ON users USING GIN (lower("username") gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS users_name_trgm_idx ON users USING GIN (lower("name") gin_trgm_ops);
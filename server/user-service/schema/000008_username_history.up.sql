@@ -0,0 +1,40 @@
+-- Every username a user gave up. An entry lets the old username lead to
+-- its owner for a while and keeps it from others during the cooldown.
+CREATE TABLE IF NOT EXISTS
+    username_history (
+        "id" BIGSERIAL PRIMARY KEY,
+        "user_id" UUID NOT NULL REFERENCES users ("user_id") ON DELETE CASCADE,
+        "username" TEXT NOT NULL,
+        "released_at" TIMESTAMPTZ NOT NULL DEFAULT NOW()
+    );
+
+CREATE INDEX IF NOT EXISTS username_history_username_idx ON username_history (lower("username"), "released_at" DESC);
+
+-- Usernames are compared in lower case from now on. Where usernames only
+-- differ in case, as Bob and bob, the oldest account keeps it and the
+-- others get the first 8 hex digits of their id as a suffix. The rest is
+-- cut to 24 letters and digits, so the new username passes the rules of a
+-- change of username. The username they gave up goes to their history, so
+-- their old links still lead to them while nobody else holds it.
+WITH renamed AS (
+    SELECT "user_id", "username",
+        left(regexp_replace(lower("username"), '[^a-z0-9]', '', 'g'), 24)
+            || left(replace("user_id"::TEXT, '-', ''), 8) AS "new_username"
+    FROM (
+        SELECT "user_id", "username",
+            row_number() OVER (PARTITION BY lower("username") ORDER BY "created_at", "user_id") AS "position"
+        FROM users
+    ) ranked
+    WHERE "position" > 1
+), released AS (
+    INSERT INTO username_history ("user_id", "username")
+    SELECT "user_id", "username" FROM renamed
+)
+UPDATE users u
+SET "username" = r."new_username", "updated_at" = NOW()
+FROM renamed r
+WHERE u."user_id" = r."user_id";
+
+UPDATE users SET "username" = lower("username") WHERE "username" <> lower("username");
+
+CREATE UNIQUE INDEX IF NOT EXISTS users_username_lower_key ON users (lower("username"));
@@ -1,8 +1,14 @@
 package tests
 
 import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
 	"net/http"
 	"net/url"
+	"strings"
 	"testing"
 
 	"github.com/brianvoe/gofakeit/v6"
@@ -54,25 +60,22 @@ func TestUpdateUserInfo_HappyPath(t *testing.T) {
 	e := httpexpect.Default(t, u.String())
 
 	email := gofakeit.Email()
-	previousPassword := randomFakePassword(normalLengthPass)
-	newPassword := randomFakePassword(normalLengthPass)
+	password := randomFakePassword(normalLengthPass)
 	username := gofakeit.Username()
 	name := gofakeit.Name()
 
 	e.POST("/cchat/auth/register").
 		WithJSON(models.RegisterUser{
 			Email:    email,
-			Password: previousPassword,
+			Password: password,
 		}).
 		Expect().
 		Status(http.StatusOK)
 
-	e.PATCH("/cchat/user/update").
+	e.PATCH("/cchat/profiles/me").
 		WithJSON(models.NewUserInfo{
-			PreviousPassword: previousPassword,
-			NewPassword:      newPassword,
-			Username:         username,
-			Name:             name,
+			Username: username,
+			Name:     name,
 		}).
 		Expect().
 		Status(http.StatusOK)
@@ -86,10 +89,9 @@ func TestUpdateUserInfo_HappyPath(t *testing.T) {
 // 	}
 // }
 
-func TestUpdatePassword_FailCases(t *testing.T) {
-	email := gofakeit.Email()
-	password := randomFakePassword(normalLengthPass)
-
+// The email belongs to auth-service, where a change is verified, so the
+// profile update leaves it as it is.
+func TestUpdateProfile_IgnoresEmail(t *testing.T) {
 	u := url.URL{
 		Scheme: "http",
 		Host:   host,
@@ -97,53 +99,30 @@ func TestUpdatePassword_FailCases(t *testing.T) {
 
 	e := httpexpect.Default(t, u.String())
 
-	resp := e.POST("/cchat/auth/register").
+	email := gofakeit.Email()
+
+	e.POST("/cchat/auth/register").
 		WithJSON(models.RegisterUser{
 			Email:    email,
-			Password: password,
-		}).Expect().JSON().Object()
-
-	cases := []struct {
-		name             string
-		email            string
-		previousPassword string
-		newPassword      string
-		expectedErr      string
-	}{
-		{
-			name:             "Update password with incorrect Previous password",
-			email:            email,
-			previousPassword: randomFakePassword(normalLengthPass),
-			newPassword:      randomFakePassword(normalLengthPass),
-			expectedErr:      "passwords don't match",
-		},
-		{
-			name:             "Update password with invalid New password",
-			email:            email,
-			previousPassword: password,
-			newPassword:      randomFakePassword(notEnoughLengthPass),
-			expectedErr:      "field NewPassword must have at least 8 characters",
-		},
-	}
-
-	for _, tt := range cases {
-		t.Run(tt.name, func(t *testing.T) {
-			resp = e.PATCH("/cchat/user/update").
-				WithJSON(models.NewUserInfo{
-					PreviousPassword: tt.previousPassword,
-					NewPassword:      tt.newPassword,
-				}).Expect().JSON().Object()
-
-			if tt.expectedErr != "" {
-				resp.NotContainsKey("data")
+			Password: randomFakePassword(normalLengthPass),
+		}).
+		Expect().
+		Status(http.StatusOK)
 
-				resp.Value("error").String().IsEqual(tt.expectedErr)
+	name := gofakeit.Name()
 
-				return
-			}
+	profile := e.PATCH("/cchat/profiles/me").
+		WithJSON(map[string]string{
+			"email":             gofakeit.Email(),
+			"previous_password": randomFakePassword(normalLengthPass),
+			"new_password":      randomFakePassword(normalLengthPass),
+			"name":              name,
+		}).
+		Expect().Status(http.StatusOK).
+		JSON().Object().Value("data").Object()
 
-		})
-	}
+	profile.Value("name").String().IsEqual(name)
+	profile.Value("email").String().IsEqual(email)
 }
 
 func TestUpdateUsername_FailCases(t *testing.T) {
@@ -163,6 +142,20 @@ func TestUpdateUsername_FailCases(t *testing.T) {
 			username:         "stepan42k",
 			expectedErr:      "username already exists",
 		},
+		{
+			name:             "Update username with existed username in another case",
+			email:            gofakeit.Email(),
+			previousPassword: randomFakePassword(normalLengthPass),
+			username:         "Stepan42K",
+			expectedErr:      "username already exists",
+		},
+		{
+			name:             "Update username with reserved word",
+			email:            gofakeit.Email(),
+			previousPassword: randomFakePassword(normalLengthPass),
+			username:         "Admin",
+			expectedErr:      "username is reserved",
+		},
 	}
 	for _, tt := range cases {
 		t.Run(tt.name, func(t *testing.T) {
@@ -179,7 +172,7 @@ func TestUpdateUsername_FailCases(t *testing.T) {
 					Password: tt.previousPassword,
 				}).Expect().JSON().Object()
 
-			resp := e.PATCH("/cchat/user/update").
+			resp := e.PATCH("/cchat/profiles/me").
 				WithJSON(models.NewUserInfo{
 					Username: tt.username,
 					Name:     tt.name,
@@ -209,11 +202,11 @@ func TestUpdateName_FailCases(t *testing.T) {
 		expectedErr      string
 	}{
 		{
-			name:             "Update name with invalid name",
+			name:             "Update name with too long name",
 			email:            gofakeit.Email(),
 			previousPassword: randomFakePassword(normalLengthPass),
-			personName:       "",
-			expectedErr:      "field Name must have at least 1 characters",
+			personName:       strings.Repeat("a", 65),
+			expectedErr:      "field Name must have at most 64 characters",
 		},
 	}
 
@@ -232,7 +225,7 @@ func TestUpdateName_FailCases(t *testing.T) {
 					Password: tt.previousPassword,
 				}).Expect().JSON().Object()
 
-			resp := e.PATCH("/cchat/user/update").
+			resp := e.PATCH("/cchat/profiles/me").
 				WithJSON(models.NewUserInfo{
 					Name: tt.personName,
 				}).Expect().JSON().Object()
@@ -249,6 +242,450 @@ func TestUpdateName_FailCases(t *testing.T) {
 	}
 }
 
+func TestUpdateProfile_PartialUpdate(t *testing.T) {
+	u := url.URL{
+		Scheme: "http",
+		Host:   host,
+	}
+
+	e := httpexpect.Default(t, u.String())
+
+	e.POST("/cchat/auth/register").
+		WithJSON(models.RegisterUser{
+			Email:    gofakeit.Email(),
+			Password: randomFakePassword(normalLengthPass),
+		}).
+		Expect().
+		Status(http.StatusOK)
+
+	bio := "I'll be back"
+	timezone := "Europe/Berlin"
+
+	profile := e.PATCH("/cchat/profiles/me").
+		WithJSON(models.NewUserInfo{
+			Bio:      &bio,
+			Timezone: &timezone,
+		}).
+		Expect().Status(http.StatusOK).
+		JSON().Object().Value("data").Object()
+
+	profile.Value("bio").String().IsEqual(bio)
+	profile.Value("timezone").String().IsEqual(timezone)
+
+	status := "on vacation"
+
+	profile = e.PATCH("/cchat/profiles/me").
+		WithJSON(models.NewUserInfo{
+			StatusText: &status,
+		}).
+		Expect().Status(http.StatusOK).
+		JSON().Object().Value("data").Object()
+
+	profile.Value("status_text").String().IsEqual(status)
+	profile.Value("bio").String().IsEqual(bio)
+
+	cleared := ""
+
+	e.PATCH("/cchat/profiles/me").
+		WithJSON(models.NewUserInfo{
+			Bio: &cleared,
+		}).
+		Expect().Status(http.StatusOK).
+		JSON().Object().Value("data").Object().
+		Value("bio").String().IsEmpty()
+
+	invalid := "Mars/Olympus"
+
+	e.PATCH("/cchat/profiles/me").
+		WithJSON(models.NewUserInfo{
+			Timezone: &invalid,
+		}).
+		Expect().Status(http.StatusConflict).
+		JSON().Object().Value("error").String().IsEqual("field Timezone must be an IANA time zone")
+}
+
+func TestUploadAvatar(t *testing.T) {
+	u := url.URL{
+		Scheme: "http",
+		Host:   host,
+	}
+
+	e := httpexpect.Default(t, u.String())
+
+	e.POST("/cchat/auth/register").
+		WithJSON(models.RegisterUser{
+			Email:    gofakeit.Email(),
+			Password: randomFakePassword(normalLengthPass),
+		}).
+		Expect().
+		Status(http.StatusOK)
+
+	img := image.NewRGBA(image.Rect(0, 0, 300, 200))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.RGBA{R: 200, A: 255}), image.Point{}, draw.Src)
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+
+	urls := e.PUT("/cchat/profiles/me/avatar").
+		WithMultipart().
+		WithFileBytes("avatar", "avatar.png", buf.Bytes()).
+		Expect().Status(http.StatusOK).
+		JSON().Object().Value("data").Object()
+
+	urls.Value("small").String().HasSuffix("/64")
+	urls.Value("large").String().HasSuffix("/512")
+
+	e.PUT("/cchat/profiles/me/avatar").
+		WithMultipart().
+		WithFileBytes("avatar", "avatar.svg", []byte(`<svg xmlns="http://www.w3.org/2000/svg"/>`)).
+		Expect().Status(http.StatusUnsupportedMediaType)
+}
+
+func TestPrivacy_HidesEmail(t *testing.T) {
+	u := url.URL{
+		Scheme: "http",
+		Host:   host,
+	}
+
+	owner := httpexpect.Default(t, u.String())
+	viewer := httpexpect.Default(t, u.String())
+
+	for _, e := range []*httpexpect.Expect{owner, viewer} {
+		e.POST("/cchat/auth/register").
+			WithJSON(models.RegisterUser{
+				Email:    gofakeit.Email(),
+				Password: randomFakePassword(normalLengthPass),
+			}).
+			Expect().
+			Status(http.StatusOK)
+	}
+
+	everyone := "everyone"
+	nobody := "nobody"
+
+	me := owner.PATCH("/cchat/profiles/me").
+		WithJSON(models.NewUserInfo{}).
+		Expect().Status(http.StatusOK).
+		JSON().Object().Value("data").Object()
+
+	uid := me.Value("uuid").String().Raw()
+	username := me.Value("username").String().Raw()
+
+	owner.PATCH("/cchat/profiles/me/privacy").
+		WithJSON(models.UpdatePrivacy{EmailVisibility: &everyone}).
+		Expect().Status(http.StatusOK)
+
+	viewer.GET("/cchat/users/{uuid}").WithPath("uuid", uid).
+		Expect().Status(http.StatusOK).
+		JSON().Object().Value("data").Object().
+		Value("email").String().NotEmpty()
+
+	discoverable := false
+
+	owner.PATCH("/cchat/profiles/me/privacy").
+		WithJSON(models.UpdatePrivacy{EmailVisibility: &nobody, Discoverable: &discoverable}).
+		Expect().Status(http.StatusOK).
+		JSON().Object().Value("data").Object().
+		Value("email_visibility").String().IsEqual(nobody)
+
+	viewer.GET("/cchat/users/{uuid}").WithPath("uuid", uid).
+		Expect().Status(http.StatusOK).
+		JSON().Object().Value("data").Object().
+		Value("email").String().IsEmpty()
+
+	owner.GET("/cchat/users/{uuid}").WithPath("uuid", uid).
+		Expect().Status(http.StatusOK).
+		JSON().Object().Value("data").Object().
+		Value("email").String().NotEmpty()
+
+	viewer.GET("/cchat/profiles/").
+		WithQuery("username", username).
+		WithQuery("limit", 10).
+		Expect().Status(http.StatusOK).
+		JSON().Object().Value("data").Object().
+		Value("profiles").Array().IsEmpty()
+
+	owner.PATCH("/cchat/profiles/me/privacy").
+		WithJSON(map[string]string{"who_can_start_chat": "friends"}).
+		Expect().Status(http.StatusConflict)
+}
+
+func TestBlocks_HideFromSearch(t *testing.T) {
+	u := url.URL{
+		Scheme: "http",
+		Host:   host,
+	}
+
+	blocker := httpexpect.Default(t, u.String())
+	blocked := httpexpect.Default(t, u.String())
+
+	for _, e := range []*httpexpect.Expect{blocker, blocked} {
+		e.POST("/cchat/auth/register").
+			WithJSON(models.RegisterUser{
+				Email:    gofakeit.Email(),
+				Password: randomFakePassword(normalLengthPass),
+			}).
+			Expect().
+			Status(http.StatusOK)
+	}
+
+	blockerID := blocker.PATCH("/cchat/profiles/me").
+		WithJSON(models.NewUserInfo{}).
+		Expect().Status(http.StatusOK).
+		JSON().Object().Value("data").Object().
+		Value("uuid").String().Raw()
+
+	me := blocked.PATCH("/cchat/profiles/me").
+		WithJSON(models.NewUserInfo{}).
+		Expect().Status(http.StatusOK).
+		JSON().Object().Value("data").Object()
+
+	uid := me.Value("uuid").String().Raw()
+	username := me.Value("username").String().Raw()
+
+	blocker.POST("/cchat/users/me/blocks/{uuid}").WithPath("uuid", blockerID).
+		Expect().Status(http.StatusBadRequest)
+
+	// Blocking twice is not an error.
+	for range 2 {
+		blocker.POST("/cchat/users/me/blocks/{uuid}").WithPath("uuid", uid).
+			Expect().Status(http.StatusOK)
+	}
+
+	blocks := blocker.GET("/cchat/users/me/blocks").
+		Expect().Status(http.StatusOK).
+		JSON().Object().Value("data").Object().
+		Value("blocks").Array()
+
+	blocks.Length().IsEqual(1)
+	blocks.Value(0).Object().Value("user").Object().Value("uuid").String().IsEqual(uid)
+
+	blocker.GET("/cchat/profiles/").
+		WithQuery("username", username).
+		WithQuery("limit", 10).
+		Expect().Status(http.StatusOK).
+		JSON().Object().Value("data").Object().
+		Value("profiles").Array().IsEmpty()
+
+	blocker.DELETE("/cchat/users/me/blocks/{uuid}").WithPath("uuid", uid).
+		Expect().Status(http.StatusOK)
+
+	blocker.GET("/cchat/profiles/").
+		WithQuery("username", username).
+		WithQuery("limit", 10).
+		Expect().Status(http.StatusOK).
+		JSON().Object().Value("data").Object().
+		Value("profiles").Array().Value(0).Object().
+		Value("uuid").String().IsEqual(uid)
+}
+
+func TestContacts_RequestAndAccept(t *testing.T) {
+	u := url.URL{
+		Scheme: "http",
+		Host:   host,
+	}
+
+	alice := httpexpect.Default(t, u.String())
+	bob := httpexpect.Default(t, u.String())
+
+	ids := make([]string, 0, 2)
+
+	for _, e := range []*httpexpect.Expect{alice, bob} {
+		e.POST("/cchat/auth/register").
+			WithJSON(models.RegisterUser{
+				Email:    gofakeit.Email(),
+				Password: randomFakePassword(normalLengthPass),
+			}).
+			Expect().
+			Status(http.StatusOK)
+
+		ids = append(ids, e.PATCH("/cchat/profiles/me").
+			WithJSON(models.NewUserInfo{}).
+			Expect().Status(http.StatusOK).
+			JSON().Object().Value("data").Object().
+			Value("uuid").String().Raw())
+	}
+
+	aliceID, bobID := ids[0], ids[1]
+
+	contacts := "contacts"
+
+	bob.PATCH("/cchat/profiles/me/privacy").
+		WithJSON(models.UpdatePrivacy{EmailVisibility: &contacts}).
+		Expect().Status(http.StatusOK)
+
+	alice.GET("/cchat/users/{uuid}").WithPath("uuid", bobID).
+		Expect().Status(http.StatusOK).
+		JSON().Object().Value("data").Object().
+		Value("email").String().IsEmpty()
+
+	alice.POST("/cchat/users/me/contacts/requests/{uuid}").WithPath("uuid", bobID).
+		Expect().Status(http.StatusOK)
+
+	bob.GET("/cchat/users/me/contacts/requests").
+		Expect().Status(http.StatusOK).
+		JSON().Object().Value("data").Object().
+		Value("requests").Array().Length().IsEqual(1)
+
+	bob.POST("/cchat/users/me/contacts/requests/{uuid}/accept").WithPath("uuid", aliceID).
+		Expect().Status(http.StatusOK)
+
+	alice.POST("/cchat/users/me/contacts/requests/{uuid}").WithPath("uuid", bobID).
+		Expect().Status(http.StatusConflict)
+
+	alice.GET("/cchat/users/{uuid}").WithPath("uuid", bobID).
+		Expect().Status(http.StatusOK).
+		JSON().Object().Value("data").Object().
+		Value("email").String().NotEmpty()
+
+	alice.PATCH("/cchat/users/me/contacts/{uuid}").WithPath("uuid", bobID).
+		WithJSON(models.UpdateContact{Nickname: "Bobby"}).
+		Expect().Status(http.StatusOK).
+		JSON().Object().Value("data").Object().
+		Value("nickname").String().IsEqual("Bobby")
+
+	list := alice.GET("/cchat/users/me/contacts").
+		Expect().Status(http.StatusOK).
+		JSON().Object().Value("data").Object().
+		Value("contacts").Array()
+
+	list.Length().IsEqual(1)
+	list.Value(0).Object().Value("nickname").String().IsEqual("Bobby")
+
+	// The nickname is Alice's own.
+	bob.GET("/cchat/users/me/contacts").
+		Expect().Status(http.StatusOK).
+		JSON().Object().Value("data").Object().
+		Value("contacts").Array().Value(0).Object().
+		Value("nickname").String().IsEmpty()
+
+	// Blocking ends the contact.
+	bob.POST("/cchat/users/me/blocks/{uuid}").WithPath("uuid", aliceID).
+		Expect().Status(http.StatusOK)
+
+	alice.GET("/cchat/users/me/contacts").
+		Expect().Status(http.StatusOK).
+		JSON().Object().Value("data").Object().
+		Value("contacts").Array().IsEmpty()
+
+	alice.POST("/cchat/users/me/contacts/requests/{uuid}").WithPath("uuid", bobID).
+		Expect().Status(http.StatusForbidden)
+}
+
+func TestProfiles_FuzzySearch(t *testing.T) {
+	u := url.URL{
+		Scheme: "http",
+		Host:   host,
+	}
+
+	e := httpexpect.Default(t, u.String())
+
+	e.POST("/cchat/auth/register").
+		WithJSON(models.RegisterUser{
+			Email:    gofakeit.Email(),
+			Password: randomFakePassword(normalLengthPass),
+		}).
+		Expect().
+		Status(http.StatusOK)
+
+	name := "Quixotic " + gofakeit.LetterN(8)
+
+	uid := e.PATCH("/cchat/profiles/me").
+		WithJSON(models.NewUserInfo{Name: name}).
+		Expect().Status(http.StatusOK).
+		JSON().Object().Value("data").Object().
+		Value("uuid").String().Raw()
+
+	// A typo still finds the name, and an exact match comes first.
+	e.GET("/cchat/profiles/").
+		WithQuery("query", strings.Replace(name, "Quixotic", "quixotik", 1)).
+		Expect().Status(http.StatusOK).
+		JSON().Object().Value("data").Object().
+		Value("profiles").Array().Value(0).Object().
+		Value("uuid").String().IsEqual(uid)
+
+	page := e.GET("/cchat/profiles/").
+		WithQuery("query", "quixotic").
+		WithQuery("limit", 1).
+		Expect().Status(http.StatusOK).
+		JSON().Object().Value("data").Object()
+
+	page.Value("profiles").Array().Length().IsEqual(1)
+
+	cursors := page.Value("cursors").Object()
+	if cursors.Value("has_next_page").Boolean().Raw() {
+		next := e.GET("/cchat/profiles/").
+			WithQuery("query", "quixotic").
+			WithQuery("limit", 1).
+			WithQuery("cursor", cursors.Value("next_cursor").String().Raw()).
+			Expect().Status(http.StatusOK).
+			JSON().Object().Value("data").Object().
+			Value("profiles").Array()
+
+		next.Length().IsEqual(1)
+		next.Value(0).Object().Value("uuid").NotEqual(page.Value("profiles").Array().Value(0).Object().Value("uuid").Raw())
+	}
+
+	e.GET("/cchat/profiles/").
+		WithQuery("query", "quixotic").
+		WithQuery("cursor", "not a cursor").
+		Expect().Status(http.StatusBadRequest)
+}
+
+func TestUsernameChange_RedirectsAndCooldown(t *testing.T) {
+	u := url.URL{
+		Scheme: "http",
+		Host:   host,
+	}
+
+	owner := httpexpect.Default(t, u.String())
+	other := httpexpect.Default(t, u.String())
+
+	for _, e := range []*httpexpect.Expect{owner, other} {
+		e.POST("/cchat/auth/register").
+			WithJSON(models.RegisterUser{
+				Email:    gofakeit.Email(),
+				Password: randomFakePassword(normalLengthPass),
+			}).
+			Expect().
+			Status(http.StatusOK)
+	}
+
+	released := "Old" + gofakeit.LetterN(10)
+	current := "new" + gofakeit.LetterN(10)
+
+	uid := owner.PATCH("/cchat/profiles/me").
+		WithJSON(models.NewUserInfo{Username: released}).
+		Expect().Status(http.StatusOK).
+		JSON().Object().Value("data").Object().
+		HasValue("username", strings.ToLower(released)).
+		Value("uuid").String().Raw()
+
+	owner.PATCH("/cchat/profiles/me").
+		WithJSON(models.NewUserInfo{Username: current}).
+		Expect().Status(http.StatusOK)
+
+	// The old username leads to the owner under their new one.
+	other.GET("/cchat/profiles/by-username/{username}").WithPath("username", released).
+		Expect().Status(http.StatusOK).
+		JSON().Object().Value("data").Object().
+		HasValue("uuid", uid).
+		HasValue("username", strings.ToLower(current))
+
+	other.PATCH("/cchat/profiles/me").
+		WithJSON(models.NewUserInfo{Username: released}).
+		Expect().Status(http.StatusConflict).
+		JSON().Object().Value("error").String().
+		IsEqual("username was released recently and is not available yet")
+
+	// The owner may take it back.
+	owner.PATCH("/cchat/profiles/me").
+		WithJSON(models.NewUserInfo{Username: released}).
+		Expect().Status(http.StatusOK)
+}
+
 func randomFakePassword(length int) string {
 	return gofakeit.Password(true, true, true, false, false, length)
 }